@@ -1,15 +1,21 @@
 package main
 
 import (
+	"cloud-go-testtask/internal/cachesync"
 	"cloud-go-testtask/internal/config"
 	"cloud-go-testtask/internal/delivery"
+	"cloud-go-testtask/internal/health"
+	"cloud-go-testtask/internal/leader"
+	"cloud-go-testtask/internal/metrics"
+	"cloud-go-testtask/internal/migrator"
+	"cloud-go-testtask/internal/repository"
 	"cloud-go-testtask/internal/repository/cache"
 	"cloud-go-testtask/internal/repository/rdbms"
+	"cloud-go-testtask/internal/storage"
+	"cloud-go-testtask/internal/tracing"
 	"cloud-go-testtask/internal/usecase"
 	"context"
-	"database/sql"
 	"errors"
-	_ "github.com/lib/pq"
 	"log"
 	"log/slog"
 	"net/http"
@@ -17,6 +23,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 const (
@@ -41,45 +48,176 @@ func main() {
 
 	logger := setupLogger(cfg.Env)
 
-	db, err := sql.Open("postgres", cfg.DBConfig.GetPostgresDSN())
+	store, err := storage.Open(cfg)
 	if err != nil {
-		logger.Error("Failed to connect to database", "error", err)
-		log.Fatalf("Failed to connect to database: %v", err)
+		logger.Error("Failed to open storage", "error", err)
+		log.Fatalf("Failed to open storage: %v", err)
 	}
-	defer db.Close()
 
-	if err := db.Ping(); err != nil {
-		logger.Error("Failed to ping database", "error", err)
-		log.Fatalf("Failed to ping database: %v", err)
+	// readiness probes are registered along with the dependencies they check
+	checker := health.NewChecker(cfg.HTTPServer.RequestTimeout)
+
+	if store.DB != nil {
+		m, err := migrator.New(store.DB, store.Dialect, logger)
+		if err != nil {
+			logger.Error("Failed to init migrator", "error", err)
+			log.Fatalf("Failed to init migrator: %v", err)
+		}
+		if cfg.AutoMigrate {
+			if err := m.Up(context.Background()); err != nil {
+				logger.Error("Failed to apply migrations", "error", err)
+				log.Fatalf("Failed to apply migrations: %v", err)
+			}
+		}
+		checker.Add("database", store.DB.PingContext)
+		checker.Add("migrations", m.CheckVersion)
 	}
 
-	rdbmsRepo := rdbms.NewPlaylistRepositoryRDBMS(db)
+	// lifecycle is canceled on SIGINT/SIGTERM and stops background playback
+	lifecycle, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	appMetrics := metrics.New()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		logger.Error("Failed to init tracing", "error", err)
+		log.Fatalf("Failed to init tracing: %v", err)
+	}
+
+	repo := store.Repo
+	repo.SetMethodObserver(appMetrics.ObserveQuery)
 	cacheRepo := cache.NewPlaylistRepositoryCache()
 
 	defaultPlaylistID := 1
-	if repo, ok := rdbmsRepo.(*rdbms.PlaylistRepositoryRDBMS); ok {
-		repo.SetDefaultPlaylistID(defaultPlaylistID)
-	} else {
-		logger.Error("Failed to set default playlist ID: invalid repository type")
-		log.Fatalf("Invalid repository type")
-	}
+	repo.SetDefaultPlaylistID(defaultPlaylistID)
 
-	uc := usecase.NewPlaylistUseCase(rdbmsRepo, cacheRepo, logger)
+	uc := usecase.NewPlaylistUseCase(repo, cacheRepo, logger)
+	uc.SetLifecycle(lifecycle)
+	checker.Add("cache", uc.CheckCache)
+	appMetrics.InstrumentPlayback(uc)
+	smartUC := usecase.NewSmartPlaylistUseCase(repo, uc, logger)
+	libraryUC := usecase.NewLibraryUseCase(repo, uc, logger)
+	importUC := usecase.NewImportUseCase(repo, uc, logger)
+	exportUC := usecase.NewExportUseCase(repo, logger)
 
 	// Инициализация кеша
-	if err := uc.InitCache(); err != nil {
+	if err := uc.InitCache(lifecycle); err != nil {
 		logger.Error("Failed to initialize cache", "error", err)
 		log.Fatalf("Failed to initialize cache: %v", err)
 	}
 
-	handler := delivery.NewPlaylistHandler(uc, logger)
-	router := delivery.NewRouter(handler)
+	if cfg.Reconciler.Interval > 0 {
+		repair, err := usecase.ParseRepairDirection(cfg.Reconciler.Repair)
+		if err != nil {
+			logger.Error("Invalid reconciler config", "error", err)
+			log.Fatalf("Invalid reconciler config: %v", err)
+		}
+		go uc.RunReconciler(lifecycle, cfg.Reconciler.Interval, repair)
+	}
 
-	// Middleware
-	//router.Use(middleware.RequestID)
-	//router.Use(middleware.Logger)
-	//router.Use(middleware.Recoverer)
-	//router.Use(middleware.URLFormat)
+	// replicas sharing the database pick up each other's writes, other storages serve a single instance
+	if cfg.CacheSync.Enabled && store.Dialect == rdbms.DialectPostgres {
+		listener, err := cachesync.New(cfg.DBConfig.GetPostgresDSN(), uc, cfg.CacheSync.ResyncInterval, logger)
+		if err != nil {
+			logger.Error("Failed to listen for changes", "error", err)
+			log.Fatalf("Failed to listen for changes: %v", err)
+		}
+		go listener.Run(lifecycle)
+	}
+
+	if cfg.CheckpointInterval > 0 {
+		go uc.RunCheckpointer(lifecycle, cfg.CheckpointInterval)
+	}
+
+	// with leader election only the instance holding the lock plays, the others forward playback commands to it.
+	// The election outlives lifecycle: the leader saves its checkpoint on shutdown before it resigns
+	var elector *leader.Elector
+	resignLeadership := func(context.Context) error { return nil }
+	if cfg.Leader.Election {
+		if store.Dialect != rdbms.DialectPostgres {
+			logger.Error("Leader election requires Postgres storage", "storage", cfg.Storage)
+			log.Fatalf("Leader election requires Postgres storage, got %q", cfg.Storage)
+		}
+		instanceID := cfg.Leader.InstanceID
+		if instanceID == "" {
+			instanceID, _ = os.Hostname()
+		}
+		// the listen address is no use to other replicas, e.g. 0.0.0.0:8082
+		if err := leader.ValidateAdvertiseURL(cfg.Leader.AdvertiseURL); err != nil {
+			logger.Error("Leader election requires ADVERTISE_URL", "error", err)
+			log.Fatalf("Leader election requires ADVERTISE_URL: %v", err)
+		}
+		// forwarded commands come from the follower, the leader sees their clients only through X-Forwarded-For
+		if len(cfg.HTTPServer.TrustedProxies) == 0 {
+			logger.Warn("TRUSTED_PROXIES is empty, the leader rate-limits all clients of a follower as one")
+		}
+		elector = leader.NewElector(store.DB, defaultPlaylistID, instanceID, cfg.Leader.AdvertiseURL, cfg.Leader.Interval, logger)
+		uc.Follow(lifecycle) // until elected
+
+		election, stopElection := context.WithCancel(context.Background())
+		electionDone := make(chan struct{})
+		go func() {
+			defer close(electionDone)
+			elector.Run(election, func(leadership context.Context) {
+				if err := uc.Lead(leadership); err != nil {
+					logger.Error("Failed to take playback over", "error", err)
+					return
+				}
+				<-leadership.Done()
+				uc.Follow(context.Background())
+			})
+		}()
+		resignLeadership = func(ctx context.Context) error {
+			stopElection()
+			select {
+			case <-electionDone:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	handler := delivery.NewPlaylistHandler(uc, logger)
+	smartHandler := delivery.NewSmartPlaylistHandler(smartUC, logger)
+	libraryHandler := delivery.NewLibraryHandler(libraryUC, logger)
+	importHandler := delivery.NewImportHandler(importUC, logger)
+	exportHandler := delivery.NewExportHandler(exportUC, logger)
+	trustedProxies, err := delivery.ParseTrustedProxies(cfg.HTTPServer.TrustedProxies)
+	if err != nil {
+		logger.Error("Invalid trusted proxies", "error", err)
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+	routerOptions := delivery.RouterOptions{
+		RequestTimeout: cfg.HTTPServer.RequestTimeout,
+		Metrics:        appMetrics,
+		Logger:         logger,
+		Health:         delivery.NewHealthHandler(checker, uc, logger),
+		Admin:          delivery.NewAdminHandler(uc, logger),
+		TrustedProxies: trustedProxies,
+		AdminUsers:     map[string]string{cfg.HTTPServer.User: cfg.HTTPServer.Password},
+	}
+	if elector != nil {
+		routerOptions.Leadership = elector
+	}
+	// retries of requests with Idempotency-Key are answered from the database, file storage has none
+	if keys, ok := repo.(repository.IdempotencyStore); ok && cfg.Idempotency.Enabled {
+		routerOptions.Idempotency = delivery.NewIdempotencyKeys(keys, cfg.Idempotency.TTL, cfg.Idempotency.LockTimeout, logger)
+		if cfg.Idempotency.PurgeInterval > 0 {
+			go routerOptions.Idempotency.RunPurger(lifecycle, cfg.Idempotency.PurgeInterval)
+		}
+	}
+	rateLimiter, err := delivery.NewRateLimiter(delivery.RateLimits{
+		Control: delivery.RateLimit{Rate: cfg.RateLimit.ControlRate, Burst: cfg.RateLimit.ControlBurst},
+		Read:    delivery.RateLimit{Rate: cfg.RateLimit.ReadRate, Burst: cfg.RateLimit.ReadBurst},
+	}, logger)
+	if err != nil {
+		logger.Error("Invalid rate limits", "error", err)
+		log.Fatalf("Invalid rate limits: %v", err)
+	}
+	routerOptions.RateLimiter = rateLimiter
+	router := delivery.NewRouter(handler, smartHandler, libraryHandler, importHandler, exportHandler, routerOptions)
 
 	// Init server
 	logger.Info("Starting server", slog.String("address", cfg.Address))
@@ -94,21 +232,38 @@ func main() {
 	// Run server
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.Error("Failed to start server")
+			logger.Error("Failed to start server", slog.String("error", err.Error()))
+			stop()
 		}
 	}()
 
 	// Graceful shutdown signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	<-lifecycle.Done()
 
-	// Gracefully shut down the server
-	if err := srv.Shutdown(context.Background()); err != nil {
-		logger.Error("Server forced to shutdown")
+	// Playback goroutines have seen the canceled lifecycle already, the steps wait for them
+	// and persist the state before the storage goes away
+	ok := shutdown(logger, cfg.ShutdownTimeout,
+		shutdownStep{name: "readiness", run: func(ctx context.Context) error {
+			// /readyz fails from now on, the load balancer stops routing here before the server closes
+			checker.Drain()
+			select {
+			case <-time.After(cfg.ShutdownDrainDelay):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}},
+		shutdownStep{name: "http server", run: srv.Shutdown},
+		shutdownStep{name: "playback", run: uc.Shutdown},
+		shutdownStep{name: "leadership", run: resignLeadership},
+		shutdownStep{name: "storage", run: func(context.Context) error { return store.Close() }},
+		shutdownStep{name: "traces", run: shutdownTracing},
+	)
+	if !ok {
+		logger.Error("Server exiting, state may be incomplete")
+		os.Exit(1)
 	}
 	logger.Info("Server exiting")
-
 }
 
 func setupLogger(env string) *slog.Logger {
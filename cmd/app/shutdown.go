@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+/*
+shutdownStep is one stage of the graceful shutdown
+*/
+type shutdownStep struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+/*
+shutdown runs steps in order under one deadline. A failed step is logged and the next ones still run,
+as they release resources independently. Once a step overruns the deadline the rest are skipped,
+all of them are logged as unfinished. Returns false if something did not finish
+*/
+func shutdown(logger *slog.Logger, timeout time.Duration, steps ...shutdownStep) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	logger.Info("Shutting down", slog.Duration("timeout", timeout))
+
+	var unfinished []string
+	for i, step := range steps {
+		done := make(chan error, 1)
+		go func() { done <- step.run(ctx) }()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				logger.Error("Shutdown step failed", slog.String("step", step.name), slog.String("error", err.Error()))
+				unfinished = append(unfinished, step.name)
+				continue
+			}
+			logger.Info("Shutdown step completed", slog.String("step", step.name))
+
+		case <-ctx.Done():
+			for _, skipped := range steps[i:] {
+				unfinished = append(unfinished, skipped.name)
+			}
+			logger.Error("Shutdown deadline exceeded",
+				slog.String("step", step.name),
+				slog.Any("unfinished", unfinished),
+			)
+			return false
+		}
+	}
+
+	if len(unfinished) > 0 {
+		logger.Error("Shutdown completed with failures", slog.Any("unfinished", unfinished))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cloud-go-testtask/internal/repository/rdbms"
+	"database/sql"
+	"fmt"
+	"github.com/pressly/goose/v3"
+	"io/fs"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+printPlan prints SQL that command would execute, without touching the schema
+*/
+func printPlan(db *sql.DB, dialect rdbms.Dialect, fsys fs.FS, command string, args []string) error {
+	current, err := currentVersion(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	all, err := goose.CollectMigrations(".", 0, math.MaxInt64)
+	if err != nil {
+		return err
+	}
+
+	type step struct {
+		m  *goose.Migration
+		up bool
+	}
+	var plan []step
+
+	switch command {
+	case "up", "up-to":
+		target := int64(math.MaxInt64)
+		if command == "up-to" {
+			target, _ = strconv.ParseInt(args[0], 10, 64)
+		}
+		for _, m := range all {
+			if m.Version > current && m.Version <= target {
+				plan = append(plan, step{m: m, up: true})
+			}
+		}
+	case "down", "redo":
+		m, err := all.Current(current)
+		if err != nil {
+			return fmt.Errorf("no migration to roll back at version %d", current)
+		}
+		plan = append(plan, step{m: m})
+		if command == "redo" {
+			plan = append(plan, step{m: m, up: true})
+		}
+	case "down-to":
+		target, _ := strconv.ParseInt(args[0], 10, 64)
+		for i := len(all) - 1; i >= 0; i-- {
+			if all[i].Version > target && all[i].Version <= current {
+				plan = append(plan, step{m: all[i]})
+			}
+		}
+	default:
+		return fmt.Errorf("-dry-run is not supported for %s", command)
+	}
+
+	fmt.Printf("-- current version: %d\n", current)
+	if len(plan) == 0 {
+		fmt.Println("-- nothing to do")
+		return nil
+	}
+
+	for _, s := range plan {
+		data, err := fs.ReadFile(fsys, s.m.Source)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", s.m.Source, err)
+		}
+		direction := "down"
+		if s.up {
+			direction = "up"
+		}
+		fmt.Printf("\n-- %s %s\n", direction, s.m.Source)
+		fmt.Println(strings.TrimSpace(section(data, s.up)))
+	}
+	return nil
+}
+
+/*
+currentVersion reads the schema version, unlike goose.GetDBVersion it doesn't create the version table
+*/
+func currentVersion(db *sql.DB, dialect rdbms.Dialect) (int64, error) {
+	query := `SELECT to_regclass('goose_db_version') IS NOT NULL`
+	if dialect == rdbms.DialectSQLite {
+		query = `SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'goose_db_version'`
+	}
+
+	var exists bool
+	if err := db.QueryRow(query).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("failed to check version table: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+	return goose.GetDBVersion(db)
+}
+
+/*
+section returns the "-- +goose Up" or "-- +goose Down" part of a SQL migration
+*/
+func section(data []byte, up bool) string {
+	want := "-- +goose Down"
+	if up {
+		want = "-- +goose Up"
+	}
+
+	var b strings.Builder
+	in := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "-- +goose Up") || strings.HasPrefix(trimmed, "-- +goose Down") {
+			in = strings.HasPrefix(trimmed, want)
+			continue
+		}
+		if in {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
@@ -2,30 +2,126 @@ package main
 
 import (
 	"cloud-go-testtask/internal/config"
-	"database/sql"
-	_ "github.com/lib/pq"
+	"cloud-go-testtask/internal/repository/rdbms"
+	"cloud-go-testtask/internal/storage"
+	"cloud-go-testtask/migrations"
+	"flag"
+	"fmt"
 	"github.com/pressly/goose/v3"
 	"log"
+	"os"
+	"strconv"
 )
 
+const usage = `usage: migrate [flags] COMMAND [ARGS]
+
+commands:
+  up                 apply all pending migrations (default)
+  up-to VERSION      apply pending migrations up to VERSION
+  down               roll back the latest migration
+  down-to VERSION    roll back migrations down to VERSION
+  redo               roll back the latest migration and apply it again
+  status             print applied and pending migrations
+  version            print the current schema version
+  create NAME [sql]  create a new SQL migration file in -dir (./migrations by default),
+                     Go migrations are not supported: only the SQL files are run
+
+flags:
+`
+
 func main() {
-	cfg := config.MustLoad()
-	dsn := cfg.DBConfig.GetPostgresDSN()
-	if dsn == "" {
-		log.Fatal("DB_DSN environment variable is not set")
+	dir := flag.String("dir", os.Getenv("MIGRATIONS_DIR"), "migrations directory, embedded migrations of the STORAGE dialect are used when empty")
+	dryRun := flag.Bool("dry-run", false, "print SQL of up/up-to/down/down-to/redo instead of applying it")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	command, args := "up", flag.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
 	}
 
-	db, err := sql.Open("postgres", dsn)
+	// create writes a file, so it needs a real directory and no database
+	if command == "create" {
+		if len(args) == 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		// goose creates Go migrations by default, but they would never run from the embedded SQL files
+		if len(args) > 2 || len(args) == 2 && args[1] != "sql" {
+			log.Fatalf("create supports only sql migrations, got %q", args[1:])
+		}
+		createDir := *dir
+		if createDir == "" {
+			createDir = "./migrations"
+		}
+		if err := goose.Run("create", nil, createDir, args[0], "sql"); err != nil {
+			log.Fatalf("Failed to create migration: %v", err)
+		}
+		return
+	}
+
+	if err := checkArgs(command, args); err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := config.MustLoad()
+
+	db, dialect, err := storage.OpenDB(cfg)
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer db.Close()
 
-	migrationsDir := "./migrations"
+	if dialect == rdbms.DialectSQLite {
+		if err := goose.SetDialect("sqlite3"); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fsys := migrations.ForDialect(string(dialect))
+	if *dir != "" {
+		fsys = os.DirFS(*dir)
+	}
+	goose.SetBaseFS(fsys)
+
+	if *dryRun {
+		if err := printPlan(db, dialect, fsys, command, args); err != nil {
+			log.Fatalf("Failed to plan migrations: %v", err)
+		}
+		return
+	}
 
-	if err := goose.Up(db, migrationsDir); err != nil {
-		log.Fatalf("Failed to apply migrations: %v", err)
+	if err := goose.Run(command, db, ".", args...); err != nil {
+		log.Fatalf("Failed to run %s: %v", command, err)
 	}
 
-	log.Println("Migrations applied successfully!")
+	switch command {
+	case "up", "up-to", "down", "down-to", "redo":
+		log.Printf("Migrations command %s completed successfully!", command)
+	}
+}
+
+/*
+checkArgs validates the commands that goose.Run accepts, so a typo doesn't reach the database
+*/
+func checkArgs(command string, args []string) error {
+	switch command {
+	case "up", "down", "redo", "status", "version":
+		if len(args) > 0 {
+			return fmt.Errorf("%s takes no arguments", command)
+		}
+	case "up-to", "down-to":
+		if len(args) != 1 {
+			return fmt.Errorf("%s requires VERSION", command)
+		}
+		if _, err := strconv.ParseInt(args[0], 10, 64); err != nil {
+			return fmt.Errorf("version must be a number, got %q", args[0])
+		}
+	default:
+		return fmt.Errorf("unknown command %q, run migrate -h for help", command)
+	}
+	return nil
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/*
+apiClient is a thin client of the playlist HTTP API, it knows only the calls the TUI needs
+*/
+type apiClient struct {
+	base *url.URL
+	http *http.Client
+}
+
+type song struct {
+	ID       int    `json:"id"`
+	Title    string `json:"title"`
+	Artist   string `json:"artist"`
+	Duration int    `json:"duration"`
+}
+
+type state struct {
+	Status       string `json:"status"` // stopped, playing or paused
+	Position     int    `json:"position"`
+	Song         *song  `json:"song"`
+	PlaylistID   int    `json:"playlist_id"`
+	PlaylistName string `json:"playlist_name"`
+	Index        int    `json:"index"` // 1-based, 0 if there is no current song
+	Total        int    `json:"total"`
+}
+
+func newAPIClient(addr string, timeout time.Duration) (*apiClient, error) {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	base, err := url.Parse(strings.TrimSuffix(addr, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid server address %q: %w", addr, err)
+	}
+
+	return &apiClient{base: base, http: &http.Client{Timeout: timeout}}, nil
+}
+
+func (c *apiClient) State() (*state, error) {
+	var out state
+	if err := c.doJSON(http.MethodGet, "/state", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+/*
+Playlist returns songs of the playlist loaded for playback, in play order
+*/
+func (c *apiClient) Playlist() ([]song, error) {
+	var out struct {
+		Songs []song `json:"sogs"`
+	}
+	if err := c.doJSON(http.MethodGet, "/playlist", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Songs, nil
+}
+
+/*
+Control sends one of play, pause, next or prev
+*/
+func (c *apiClient) Control(action string) error {
+	return c.doJSON(http.MethodPost, "/"+action, nil, nil)
+}
+
+func (c *apiClient) Seek(position int) error {
+	return c.doJSON(http.MethodPost, "/seek", map[string]int{"position": position}, nil)
+}
+
+/*
+Move moves the song at 1-based position from to position to
+*/
+func (c *apiClient) Move(from, to int) error {
+	return c.doJSON(http.MethodPost, "/playlist/move", map[string]int{"from": from, "to": to}, nil)
+}
+
+func (c *apiClient) doJSON(method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	u := *c.base
+	u.Path += path
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to server failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		text := strings.TrimSpace(string(msg))
+		if text == "" {
+			text = http.StatusText(resp.StatusCode)
+		}
+		return errors.New(resp.Status + ": " + text)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const defaultAddr = "http://localhost:8082"
+
+func main() {
+	addr := flag.String("addr", envOr("PLAYLISTCTL_ADDR", defaultAddr), "server address")
+	interval := flag.Duration("interval", 500*time.Millisecond, "state polling interval")
+	timeout := flag.Duration("timeout", 5*time.Second, "request timeout")
+	flag.Parse()
+
+	api, err := newAPIClient(*addr, *timeout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "playlist-tui:", err)
+		os.Exit(2)
+	}
+
+	if _, err := tea.NewProgram(newModel(api, *interval), tea.WithAltScreen()).Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "playlist-tui:", err)
+		os.Exit(1)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const seekStep = 10 // seconds
+
+var (
+	titleStyle    = lipgloss.NewStyle().Bold(true)
+	currentStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("10")).Bold(true)
+	selectedStyle = lipgloss.NewStyle().Reverse(true)
+	dimStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+)
+
+type (
+	tickMsg  struct{}
+	stateMsg struct {
+		state *state
+		err   error
+	}
+	playlistMsg struct {
+		songs []song
+		err   error
+	}
+	// actionMsg reports result of a control request, the state is refreshed right after it
+	actionMsg struct {
+		err       error
+		reordered bool
+	}
+)
+
+/*
+model polls GET /state and keeps the playlist in sync with it, the playlist is refetched
+only when the state shows it has changed (other playlist, other size or other current song)
+*/
+type model struct {
+	api      *apiClient
+	interval time.Duration
+
+	state    *state
+	songs    []song
+	selected int  // 0-based index of the highlighted row
+	follow   bool // selection follows the current song until the user moves it
+	err      error
+
+	width  int
+	height int
+}
+
+func newModel(api *apiClient, interval time.Duration) model {
+	return model{api: api, interval: interval, follow: true}
+}
+
+func (m model) Init() tea.Cmd {
+	return tea.Batch(m.fetchState, m.fetchPlaylist)
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, nil
+
+	case tickMsg:
+		return m, m.fetchState
+
+	case stateMsg:
+		m.err = msg.err
+		var cmds []tea.Cmd
+		if msg.err == nil {
+			if m.playlistChanged(msg.state) {
+				cmds = append(cmds, m.fetchPlaylist)
+			}
+			m.state = msg.state
+			if m.follow && m.state.Index > 0 {
+				m.selected = m.state.Index - 1
+			}
+		}
+		cmds = append(cmds, m.tick())
+		return m, tea.Batch(cmds...)
+
+	case playlistMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.songs = msg.songs
+		m.selected = clamp(m.selected, 0, len(m.songs)-1)
+		return m, nil
+
+	case actionMsg:
+		m.err = msg.err
+		if msg.reordered {
+			return m, tea.Batch(m.fetchState, m.fetchPlaylist)
+		}
+		return m, m.fetchState
+
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+	}
+
+	return m, nil
+}
+
+func (m model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "ctrl+c", "esc":
+		return m, tea.Quit
+
+	case " ":
+		if m.state != nil && m.state.Status == "playing" {
+			return m, m.control("pause")
+		}
+		return m, m.control("play")
+	case "n":
+		m.follow = true
+		return m, m.control("next")
+	case "p":
+		m.follow = true
+		return m, m.control("prev")
+
+	case "left", "h":
+		return m, m.seek(-seekStep)
+	case "right", "l":
+		return m, m.seek(seekStep)
+
+	case "up", "k":
+		m.follow = false
+		m.selected = clamp(m.selected-1, 0, len(m.songs)-1)
+	case "down", "j":
+		m.follow = false
+		m.selected = clamp(m.selected+1, 0, len(m.songs)-1)
+	case "c":
+		m.follow = true
+		if m.state != nil && m.state.Index > 0 {
+			m.selected = m.state.Index - 1
+		}
+
+	case "K", "shift+up", "[":
+		return m.move(-1)
+	case "J", "shift+down", "]":
+		return m.move(1)
+
+	case "r":
+		return m, tea.Batch(m.fetchState, m.fetchPlaylist)
+	}
+
+	return m, nil
+}
+
+/*
+move shifts the selected song by delta rows, the selection moves together with the song
+*/
+func (m model) move(delta int) (tea.Model, tea.Cmd) {
+	from := m.selected
+	to := from + delta
+	if from < 0 || to < 0 || to >= len(m.songs) {
+		return m, nil
+	}
+
+	m.follow = false
+	m.selected = to
+	api := m.api
+	return m, func() tea.Msg {
+		return actionMsg{err: api.Move(from+1, to+1), reordered: true}
+	}
+}
+
+func (m model) seek(delta int) tea.Cmd {
+	if m.state == nil || m.state.Song == nil {
+		return nil
+	}
+	position := clamp(m.state.Position+delta, 0, m.state.Song.Duration-1)
+	api := m.api
+	return func() tea.Msg {
+		return actionMsg{err: api.Seek(position)}
+	}
+}
+
+func (m model) control(action string) tea.Cmd {
+	api := m.api
+	return func() tea.Msg {
+		return actionMsg{err: api.Control(action)}
+	}
+}
+
+func (m model) fetchState() tea.Msg {
+	st, err := m.api.State()
+	return stateMsg{state: st, err: err}
+}
+
+func (m model) fetchPlaylist() tea.Msg {
+	songs, err := m.api.Playlist()
+	return playlistMsg{songs: songs, err: err}
+}
+
+func (m model) tick() tea.Cmd {
+	return tea.Tick(m.interval, func(time.Time) tea.Msg { return tickMsg{} })
+}
+
+func (m model) playlistChanged(st *state) bool {
+	if m.state == nil || st.PlaylistID != m.state.PlaylistID || st.Total != len(m.songs) {
+		return true
+	}
+	if st.Index > 0 && st.Song != nil {
+		return m.songs[st.Index-1].ID != st.Song.ID
+	}
+	return false
+}
+
+func (m model) View() string {
+	var b strings.Builder
+
+	name := "playlist"
+	if m.state != nil && m.state.PlaylistName != "" {
+		name = m.state.PlaylistName
+	}
+	b.WriteString(titleStyle.Render(name))
+	b.WriteString(dimStyle.Render(fmt.Sprintf("  %d songs", len(m.songs))))
+	b.WriteString("\n\n")
+
+	b.WriteString(m.viewSongs())
+	b.WriteString("\n")
+	b.WriteString(m.viewProgress())
+	b.WriteString("\n")
+
+	if m.err != nil {
+		b.WriteString(errorStyle.Render(m.err.Error()))
+	}
+	b.WriteString("\n")
+	b.WriteString(dimStyle.Render("space play/pause · n/p next/prev · ←/→ seek · ↑/↓ select · K/J move · c current · r refresh · q quit"))
+
+	return b.String()
+}
+
+func (m model) viewSongs() string {
+	if len(m.songs) == 0 {
+		return dimStyle.Render("  playlist is empty") + "\n"
+	}
+
+	current := -1
+	if m.state != nil {
+		current = m.state.Index - 1
+	}
+
+	// header, progress, status and help take 7 lines, the rest is a window around the selection
+	rows := len(m.songs)
+	if m.height > 0 {
+		rows = max(m.height-7, 1)
+	}
+	first := clamp(m.selected-rows/2, 0, max(len(m.songs)-rows, 0))
+	last := min(first+rows, len(m.songs))
+
+	var b strings.Builder
+	for i := first; i < last; i++ {
+		s := m.songs[i]
+		marker := "  "
+		if i == current {
+			marker = "▶ "
+		}
+		line := fmt.Sprintf("%s%3d. %s - %s  %s", marker, i+1, s.Artist, s.Title, formatSeconds(s.Duration))
+
+		switch {
+		case i == m.selected && i == current:
+			line = selectedStyle.Inherit(currentStyle).Render(line)
+		case i == m.selected:
+			line = selectedStyle.Render(line)
+		case i == current:
+			line = currentStyle.Render(line)
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (m model) viewProgress() string {
+	if m.state == nil || m.state.Song == nil {
+		return dimStyle.Render("stopped, nothing to play")
+	}
+
+	st := m.state
+	width := 40
+	if m.width > 0 {
+		width = clamp(m.width-30, 10, 80)
+	}
+	filled := 0
+	if st.Song.Duration > 0 {
+		filled = clamp(st.Position*width/st.Song.Duration, 0, width)
+	}
+	bar := currentStyle.Render(strings.Repeat("█", filled)) + dimStyle.Render(strings.Repeat("░", width-filled))
+
+	return fmt.Sprintf("%-7s %s %s / %s", st.Status, bar, formatSeconds(st.Position), formatSeconds(st.Song.Duration))
+}
+
+func formatSeconds(s int) string {
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+func clamp(v, lo, hi int) int {
+	if v > hi {
+		v = hi
+	}
+	if v < lo {
+		v = lo
+	}
+	return v
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	errOfflinePlayback = errors.New("playback runs in the server, offline mode supports only status")
+	errNothingImported = errors.New("no playlist entries could be imported")
+	errOfflineCache    = errors.New("the cache lives in the server, offline mode cannot reconcile it")
+)
+
+/*
+client is implemented over the HTTP API and directly over DB (offline mode).
+Views below repeat the JSON shapes of the API, so both modes print the same output
+*/
+type client interface {
+	AddSong(title, artist string, duration time.Duration) (*song, error)
+	ListSongs(q songQuery) (*songsPage, error)
+	UpdateSong(id int, title, artist string, duration time.Duration) (*song, error)
+	DeleteSong(id int) error
+
+	CreatePlaylist(name, description string) (*playlist, error)
+	ListPlaylists(q playlistQuery) (*playlistsPage, error)
+	DeletePlaylist(id int) error
+	ImportPlaylist(req importRequest) (*importReport, error)
+	ExportPlaylist(id int, format string, w io.Writer) error
+
+	Control(action string) error // play, pause, next or prev
+	State() (*state, error)
+
+	Reconcile(repair string) (*reconcileReport, error) // repair: none, cache or db
+
+	Close() error
+}
+
+type songQuery struct {
+	Text   string
+	Artist string
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+type playlistQuery struct {
+	Text   string
+	Limit  int
+	Cursor string
+}
+
+type importRequest struct {
+	Format      string
+	Name        string
+	Description string
+	Body        io.Reader
+}
+
+type song struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Artist    string    `json:"artist"`
+	Duration  int       `json:"duration"`
+	AddedAt   time.Time `json:"added_at"`
+	PlayCount int       `json:"play_count"`
+}
+
+type songsPage struct {
+	Songs      []song `json:"songs"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type playlist struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	SongCount   int       `json:"song_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type playlistsPage struct {
+	Playlists  []playlist `json:"playlists"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+type unresolvedEntry struct {
+	Index    int    `json:"index"`
+	Location string `json:"location,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Artist   string `json:"artist,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+type importReport struct {
+	PlaylistID   int               `json:"playlist_id,omitempty"`
+	Name         string            `json:"name"`
+	Imported     int               `json:"imported"`
+	CreatedSongs int               `json:"created_songs"`
+	Unresolved   []unresolvedEntry `json:"unresolved"`
+}
+
+type state struct {
+	Status       string `json:"status"`
+	Position     int    `json:"position"`
+	Song         *song  `json:"song"`
+	PlaylistID   int    `json:"playlist_id"`
+	PlaylistName string `json:"playlist_name"`
+	Index        int    `json:"index"`
+	Total        int    `json:"total"`
+}
+
+type consistency struct {
+	Consistent     bool  `json:"consistent"`
+	Detached       bool  `json:"detached"`
+	CacheSongs     int   `json:"cache_songs"`
+	DBSongs        int   `json:"db_songs"`
+	MissingInDB    []int `json:"missing_in_db"`
+	MissingInCache []int `json:"missing_in_cache"`
+	OrderDiffers   bool  `json:"order_differs"`
+	CacheCurrentID int   `json:"cache_current_song_id"`
+	DBCurrentID    int   `json:"db_current_song_id"`
+}
+
+type reconcileReport struct {
+	Repair   string      `json:"repair"`
+	Found    consistency `json:"found"`
+	Repaired bool        `json:"repaired"`
+	Error    string      `json:"error,omitempty"`
+}
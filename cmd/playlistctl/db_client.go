@@ -0,0 +1,243 @@
+package main
+
+import (
+	"cloud-go-testtask/internal/config"
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/pagination"
+	"cloud-go-testtask/internal/playlistio"
+	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/repository/cache"
+	"cloud-go-testtask/internal/storage"
+	"cloud-go-testtask/internal/usecase"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const defaultPlaylistID = 1
+
+/*
+dbClient works directly with DB using the same use cases as the server, for the time the server is down.
+Playback is not started, so only status of the stored playlist is available
+*/
+type dbClient struct {
+	ctx      context.Context
+	store    *storage.Storage
+	playback *usecase.PlaylistUseCase
+	library  *usecase.LibraryUseCase
+	importer *usecase.ImportUseCase
+	exporter *usecase.ExportUseCase
+}
+
+func newDBClient() (*dbClient, error) {
+	cfg := config.MustLoad()
+
+	store, err := storage.Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	repo := store.Repo
+	repo.SetDefaultPlaylistID(defaultPlaylistID)
+
+	playback := usecase.NewPlaylistUseCase(repo, cache.NewPlaylistRepositoryCache(), logger)
+	if err := playback.InitCache(ctx); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to load default playlist: %w", err)
+	}
+
+	return &dbClient{
+		ctx:      ctx,
+		store:    store,
+		playback: playback,
+		library:  usecase.NewLibraryUseCase(repo, playback, logger),
+		importer: usecase.NewImportUseCase(repo, playback, logger),
+		exporter: usecase.NewExportUseCase(repo, logger),
+	}, nil
+}
+
+func (c *dbClient) AddSong(title, artist string, duration time.Duration) (*song, error) {
+	if title == "" || artist == "" || duration <= 0 {
+		return nil, errors.New("title, artist and positive duration are required")
+	}
+
+	s, err := c.playback.AddSong(c.ctx, title, artist, duration)
+	if err != nil {
+		return nil, err
+	}
+	return newSong(s), nil
+}
+
+func (c *dbClient) ListSongs(q songQuery) (*songsPage, error) {
+	after, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := c.library.SearchSongs(c.ctx, repository.SongQuery{
+		Text:   q.Text,
+		Artist: q.Artist,
+		Sort:   repository.SongSort(q.Sort),
+		Limit:  q.Limit,
+		After:  after,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := &songsPage{Songs: make([]song, 0, len(page.Songs)), NextCursor: encodeCursor(page.Next)}
+	for _, s := range page.Songs {
+		out.Songs = append(out.Songs, *newSong(s))
+	}
+	return out, nil
+}
+
+func (c *dbClient) UpdateSong(id int, title, artist string, duration time.Duration) (*song, error) {
+	s, err := c.playback.UpdateSong(c.ctx, id, title, artist, duration, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newSong(s), nil
+}
+
+func (c *dbClient) DeleteSong(id int) error {
+	return c.playback.DeleteSong(c.ctx, id, nil)
+}
+
+func (c *dbClient) CreatePlaylist(name, description string) (*playlist, error) {
+	id, err := c.library.CreatePlaylist(c.ctx, name, description)
+	if err != nil {
+		return nil, err
+	}
+	return &playlist{ID: id, Name: name, Description: description}, nil
+}
+
+func (c *dbClient) ListPlaylists(q playlistQuery) (*playlistsPage, error) {
+	after, err := decodeCursor(q.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := c.library.SearchPlaylists(c.ctx, repository.PlaylistQuery{Text: q.Text, Limit: q.Limit, After: after})
+	if err != nil {
+		return nil, err
+	}
+
+	out := &playlistsPage{Playlists: make([]playlist, 0, len(page.Playlists)), NextCursor: encodeCursor(page.Next)}
+	for _, p := range page.Playlists {
+		out.Playlists = append(out.Playlists, playlist{
+			ID:          p.ID,
+			Name:        p.Name,
+			Description: p.Description,
+			SongCount:   p.SongCount,
+			CreatedAt:   p.CreatedAt,
+		})
+	}
+	return out, nil
+}
+
+func (c *dbClient) DeletePlaylist(id int) error {
+	return c.library.DeletePlaylist(c.ctx, id, nil)
+}
+
+func (c *dbClient) ImportPlaylist(req importRequest) (*importReport, error) {
+	format, err := playlistio.ParseFormat(req.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := c.importer.Import(c.ctx, usecase.ImportRequest{
+		Name:        req.Name,
+		Description: req.Description,
+		Format:      format,
+		Body:        req.Body,
+	})
+	if report == nil {
+		return nil, err
+	}
+
+	out := &importReport{
+		PlaylistID:   report.PlaylistID,
+		Name:         report.Name,
+		Imported:     report.Imported,
+		CreatedSongs: report.CreatedSongs,
+		Unresolved:   make([]unresolvedEntry, 0, len(report.Unresolved)),
+	}
+	for _, entry := range report.Unresolved {
+		out.Unresolved = append(out.Unresolved, unresolvedEntry(entry))
+	}
+	if errors.Is(err, usecase.ErrNothingToImport) {
+		return out, errNothingImported
+	}
+	return out, err
+}
+
+func (c *dbClient) ExportPlaylist(id int, format string, w io.Writer) error {
+	if format == "" {
+		format = string(playlistio.FormatJSON)
+	}
+	return c.exporter.Export(c.ctx, id, playlistio.Format(format), w)
+}
+
+func (c *dbClient) Control(action string) error {
+	return errOfflinePlayback
+}
+
+func (c *dbClient) State() (*state, error) {
+	st, err := c.playback.State(c.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &state{
+		Status:       "stopped",
+		PlaylistID:   st.PlaylistID,
+		PlaylistName: st.PlaylistName,
+		Index:        st.Index,
+		Total:        st.Total,
+	}
+	if st.Song != nil {
+		out.Song = newSong(st.Song)
+	}
+	return out, nil
+}
+
+func (c *dbClient) Reconcile(repair string) (*reconcileReport, error) {
+	return nil, errOfflineCache
+}
+
+func (c *dbClient) Close() error {
+	return c.store.Close()
+}
+
+func newSong(s *entity.Song) *song {
+	return &song{
+		ID:        s.ID,
+		Title:     s.Title,
+		Artist:    s.Artist,
+		Duration:  int(s.Duration.Seconds()),
+		AddedAt:   s.AddedAt,
+		PlayCount: s.PlayCount,
+	}
+}
+
+func decodeCursor(raw string) (*pagination.Cursor, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	return pagination.Decode(raw)
+}
+
+func encodeCursor(cursor *pagination.Cursor) string {
+	if cursor == nil {
+		return ""
+	}
+	return cursor.Encode()
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+httpClient talks to a running server
+*/
+type httpClient struct {
+	base     *url.URL
+	user     string // Basic credentials of /admin routes, sent if set
+	password string
+	http     *http.Client
+}
+
+func newHTTPClient(addr, user, password string, timeout time.Duration) (*httpClient, error) {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	base, err := url.Parse(strings.TrimSuffix(addr, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid server address %q: %w", addr, err)
+	}
+
+	return &httpClient{base: base, user: user, password: password, http: &http.Client{Timeout: timeout}}, nil
+}
+
+func (c *httpClient) AddSong(title, artist string, duration time.Duration) (*song, error) {
+	var out song
+	body := map[string]any{"title": title, "artist": artist, "duration": int(duration.Seconds())}
+	if err := c.doJSON(http.MethodPost, "/songs", nil, body, &out, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *httpClient) ListSongs(q songQuery) (*songsPage, error) {
+	params := url.Values{}
+	setParam(params, "q", q.Text)
+	setParam(params, "artist", q.Artist)
+	setParam(params, "sort", q.Sort)
+	setParam(params, "cursor", q.Cursor)
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	var out songsPage
+	if err := c.doJSON(http.MethodGet, "/songs", params, nil, &out, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *httpClient) UpdateSong(id int, title, artist string, duration time.Duration) (*song, error) {
+	body := map[string]any{}
+	if title != "" {
+		body["title"] = title
+	}
+	if artist != "" {
+		body["artist"] = artist
+	}
+	if duration != 0 {
+		body["duration"] = int(duration.Seconds())
+	}
+
+	var out song
+	if err := c.doJSON(http.MethodPatch, "/songs/"+strconv.Itoa(id), nil, body, &out, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *httpClient) DeleteSong(id int) error {
+	return c.doJSON(http.MethodDelete, "/songs/"+strconv.Itoa(id), nil, nil, nil, http.StatusNoContent)
+}
+
+func (c *httpClient) CreatePlaylist(name, description string) (*playlist, error) {
+	var out playlist
+	body := map[string]string{"name": name, "description": description}
+	if err := c.doJSON(http.MethodPost, "/playlists", nil, body, &out, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *httpClient) ListPlaylists(q playlistQuery) (*playlistsPage, error) {
+	params := url.Values{}
+	setParam(params, "q", q.Text)
+	setParam(params, "cursor", q.Cursor)
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	var out playlistsPage
+	if err := c.doJSON(http.MethodGet, "/playlists", params, nil, &out, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *httpClient) DeletePlaylist(id int) error {
+	return c.doJSON(http.MethodDelete, "/playlists/"+strconv.Itoa(id), nil, nil, nil, http.StatusNoContent)
+}
+
+func (c *httpClient) ImportPlaylist(req importRequest) (*importReport, error) {
+	params := url.Values{}
+	setParam(params, "format", req.Format)
+	setParam(params, "name", req.Name)
+	setParam(params, "description", req.Description)
+
+	resp, err := c.do(http.MethodPost, "/playlists/import", params, "application/octet-stream", req.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusUnprocessableEntity {
+		return nil, responseError(resp)
+	}
+
+	var report importReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		return &report, errNothingImported
+	}
+	return &report, nil
+}
+
+func (c *httpClient) ExportPlaylist(id int, format string, w io.Writer) error {
+	params := url.Values{}
+	setParam(params, "format", format)
+
+	resp, err := c.do(http.MethodGet, "/playlists/"+strconv.Itoa(id)+"/export", params, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (c *httpClient) Control(action string) error {
+	return c.doJSON(http.MethodPost, "/"+action, nil, nil, nil, http.StatusOK)
+}
+
+func (c *httpClient) State() (*state, error) {
+	var out state
+	if err := c.doJSON(http.MethodGet, "/state", nil, nil, &out, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+/*
+Reconcile returns the report also when the repair failed, the server sends it along with the error
+*/
+func (c *httpClient) Reconcile(repair string) (*reconcileReport, error) {
+	params := url.Values{}
+	setParam(params, "repair", repair)
+
+	resp, err := c.do(http.MethodPost, "/admin/reconcile", params, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return nil, responseError(resp)
+	}
+
+	var report reconcileReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if report.Error != "" {
+		return &report, errors.New(resp.Status + ": " + report.Error)
+	}
+	return &report, nil
+}
+
+func (c *httpClient) Close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+/*
+doJSON sends in as JSON body (if not nil) and decodes response into out (if not nil)
+*/
+func (c *httpClient) doJSON(method, path string, params url.Values, in, out any, wantStatus int) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	resp, err := c.do(method, path, params, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		return responseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+func (c *httpClient) do(method, path string, params url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	u := *c.base
+	u.Path += path
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to server failed: %w", err)
+	}
+	return resp, nil
+}
+
+/*
+responseError turns a non-successful response into error, handlers reply with a plain text message
+*/
+func responseError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	text := strings.TrimSpace(string(msg))
+	if text == "" {
+		text = http.StatusText(resp.StatusCode)
+	}
+	return errors.New(resp.Status + ": " + text)
+}
+
+func setParam(params url.Values, name, value string) {
+	if value != "" {
+		params.Set(name, value)
+	}
+}
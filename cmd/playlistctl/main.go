@@ -0,0 +1,401 @@
+package main
+
+import (
+	"cloud-go-testtask/internal/playlistio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const usage = `playlistctl manages songs, playlists and playback of the playlist service.
+
+Usage:
+  playlistctl [global flags] <command> [flags]
+
+Commands:
+  songs add -title T -artist A -duration 3m25s
+  songs list [-q text] [-artist A] [-sort -added] [-limit N] [-cursor C] [-all]
+  songs edit <id> [-title T] [-artist A] [-duration D]
+  songs rm <id>
+
+  playlists create -name N [-description D]
+  playlists ls [-q text] [-limit N] [-cursor C] [-all]
+  playlists rm <id>
+  playlists import -file road-trip.m3u8 [-format m3u8] [-name N] [-description D]
+  playlists export <id> [-format json|m3u|m3u8|pls|xspf] [-out file]
+
+  play | pause | next | prev
+  status
+  reconcile [-repair none|cache|db]
+
+Durations are given in seconds or as Go durations (3m25s).
+In offline mode the DB is configured by the same environment as the server.
+
+Global flags:
+`
+
+func main() {
+	fs := flag.NewFlagSet("playlistctl", flag.ExitOnError)
+	addr := fs.String("addr", envOr("PLAYLISTCTL_ADDR", "http://localhost:8082"), "server address")
+	user := fs.String("user", os.Getenv("PLAYLISTCTL_USER"), "user of admin commands (reconcile), HTTP_SERVER_USER of the server")
+	password := fs.String("password", os.Getenv("PLAYLISTCTL_PASSWORD"), "password of admin commands, HTTP_SERVER_PASSWORD of the server")
+	offline := fs.Bool("offline", false, "work directly with DB instead of the server")
+	output := fs.String("o", outputTable, "output format: table or json")
+	timeout := fs.Duration("timeout", 10*time.Second, "request timeout")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *output != outputTable && *output != outputJSON {
+		fail(fmt.Errorf("unknown output format %q", *output))
+	}
+
+	var c client
+	var err error
+	if *offline {
+		c, err = newDBClient()
+	} else {
+		c, err = newHTTPClient(*addr, *user, *password, *timeout)
+	}
+	if err != nil {
+		fail(err)
+	}
+	defer c.Close()
+
+	p := &printer{w: os.Stdout, format: *output}
+	if err := run(c, p, fs.Args()); err != nil {
+		c.Close()
+		fail(err)
+	}
+}
+
+func run(c client, p *printer, args []string) error {
+	command, args := args[0], args[1:]
+
+	switch command {
+	case "songs", "song":
+		return runSongs(c, p, args)
+	case "playlists", "playlist":
+		return runPlaylists(c, p, args)
+	case "play", "pause", "next", "prev":
+		if err := c.Control(command); err != nil {
+			return err
+		}
+		st, err := c.State()
+		if err != nil {
+			return err
+		}
+		return p.state(st)
+	case "status":
+		st, err := c.State()
+		if err != nil {
+			return err
+		}
+		return p.state(st)
+	case "reconcile":
+		fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+		repair := fs.String("repair", "none", "none only reports, cache reloads it from DB, db rewrites DB after cache")
+		if _, err := parseFlags(fs, args, 0); err != nil {
+			return err
+		}
+		report, err := c.Reconcile(*repair)
+		if report != nil {
+			if printErr := p.reconcile(report); printErr != nil {
+				return printErr
+			}
+		}
+		return err
+	}
+
+	return fmt.Errorf("unknown command %q, run playlistctl -h for help", command)
+}
+
+func runSongs(c client, p *printer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("songs: subcommand is required: add, list, edit or rm")
+	}
+	sub, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("songs "+sub, flag.ContinueOnError)
+	switch sub {
+	case "add":
+		title := fs.String("title", "", "song title")
+		artist := fs.String("artist", "", "song artist")
+		duration := fs.String("duration", "", "song duration")
+		if _, err := parseFlags(fs, args, 0); err != nil {
+			return err
+		}
+		d, err := parseDuration(*duration)
+		if err != nil {
+			return err
+		}
+		s, err := c.AddSong(*title, *artist, d)
+		if err != nil {
+			return err
+		}
+		return p.song(s)
+
+	case "list", "ls":
+		var q songQuery
+		fs.StringVar(&q.Text, "q", "", "full text search by title and artist")
+		fs.StringVar(&q.Artist, "artist", "", "filter by artist")
+		fs.StringVar(&q.Sort, "sort", "", "sort: id, title, artist, duration, added; prefix - for descending")
+		fs.IntVar(&q.Limit, "limit", 0, "page size")
+		fs.StringVar(&q.Cursor, "cursor", "", "cursor of the page")
+		all := fs.Bool("all", false, "fetch all pages")
+		if _, err := parseFlags(fs, args, 0); err != nil {
+			return err
+		}
+
+		var songs []song
+		for {
+			page, err := c.ListSongs(q)
+			if err != nil {
+				return err
+			}
+			songs = append(songs, page.Songs...)
+			if !*all || page.NextCursor == "" {
+				if page.NextCursor != "" && p.format == outputTable {
+					defer fmt.Fprintf(os.Stderr, "next page: -cursor %s\n", page.NextCursor)
+				}
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+		return p.songs(songs)
+
+	case "edit":
+		title := fs.String("title", "", "new title")
+		artist := fs.String("artist", "", "new artist")
+		duration := fs.String("duration", "", "new duration")
+		ids, err := parseFlags(fs, args, 1)
+		if err != nil {
+			return err
+		}
+		var d time.Duration
+		if *duration != "" {
+			if d, err = parseDuration(*duration); err != nil {
+				return err
+			}
+		}
+		if *title == "" && *artist == "" && d == 0 {
+			return errors.New("songs edit: nothing to change")
+		}
+		s, err := c.UpdateSong(ids[0], *title, *artist, d)
+		if err != nil {
+			return err
+		}
+		return p.song(s)
+
+	case "rm", "delete":
+		ids, err := parseFlags(fs, args, 1)
+		if err != nil {
+			return err
+		}
+		if err := c.DeleteSong(ids[0]); err != nil {
+			return err
+		}
+		return p.message("Song %d deleted", ids[0])
+	}
+
+	return fmt.Errorf("songs: unknown subcommand %q", sub)
+}
+
+func runPlaylists(c client, p *printer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("playlists: subcommand is required: create, ls, rm, import or export")
+	}
+	sub, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("playlists "+sub, flag.ContinueOnError)
+	switch sub {
+	case "create":
+		name := fs.String("name", "", "playlist name")
+		description := fs.String("description", "", "playlist description")
+		if _, err := parseFlags(fs, args, 0); err != nil {
+			return err
+		}
+		pl, err := c.CreatePlaylist(*name, *description)
+		if err != nil {
+			return err
+		}
+		return p.playlist(pl)
+
+	case "ls", "list":
+		var q playlistQuery
+		fs.StringVar(&q.Text, "q", "", "full text search by name and description")
+		fs.IntVar(&q.Limit, "limit", 0, "page size")
+		fs.StringVar(&q.Cursor, "cursor", "", "cursor of the page")
+		all := fs.Bool("all", false, "fetch all pages")
+		if _, err := parseFlags(fs, args, 0); err != nil {
+			return err
+		}
+
+		var playlists []playlist
+		for {
+			page, err := c.ListPlaylists(q)
+			if err != nil {
+				return err
+			}
+			playlists = append(playlists, page.Playlists...)
+			if !*all || page.NextCursor == "" {
+				if page.NextCursor != "" && p.format == outputTable {
+					defer fmt.Fprintf(os.Stderr, "next page: -cursor %s\n", page.NextCursor)
+				}
+				break
+			}
+			q.Cursor = page.NextCursor
+		}
+		return p.playlists(playlists)
+
+	case "rm", "delete":
+		ids, err := parseFlags(fs, args, 1)
+		if err != nil {
+			return err
+		}
+		if err := c.DeletePlaylist(ids[0]); err != nil {
+			return err
+		}
+		return p.message("Playlist %d deleted", ids[0])
+
+	case "import":
+		file := fs.String("file", "", "playlist file, - for stdin")
+		format := fs.String("format", "", "m3u, m3u8, pls, xspf or json (detected by extension if empty)")
+		name := fs.String("name", "", "name of the new playlist (taken from the file if empty)")
+		description := fs.String("description", "", "description of the new playlist")
+		if _, err := parseFlags(fs, args, 0); err != nil {
+			return err
+		}
+		if *file == "" {
+			return errors.New("playlists import: -file is required")
+		}
+
+		f, err := detectFormat(*format, *file)
+		if err != nil {
+			return err
+		}
+
+		var body io.Reader = os.Stdin
+		if *file != "-" {
+			in, err := os.Open(*file)
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+			body = in
+		}
+
+		report, err := c.ImportPlaylist(importRequest{Format: string(f), Name: *name, Description: *description, Body: body})
+		if report != nil {
+			if printErr := p.report(report); printErr != nil {
+				return printErr
+			}
+		}
+		return err
+
+	case "export":
+		format := fs.String("format", string(playlistio.FormatJSON), "json, m3u, m3u8, pls or xspf")
+		out := fs.String("out", "", "output file (stdout if empty)")
+		ids, err := parseFlags(fs, args, 1)
+		if err != nil {
+			return err
+		}
+
+		if *out == "" {
+			return c.ExportPlaylist(ids[0], *format, os.Stdout)
+		}
+
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		if err := c.ExportPlaylist(ids[0], *format, f); err != nil {
+			f.Close()
+			os.Remove(*out)
+			return err
+		}
+		return f.Close()
+	}
+
+	return fmt.Errorf("playlists: unknown subcommand %q", sub)
+}
+
+/*
+parseFlags allows flags after positional arguments (e.g. "songs edit 5 -title X")
+and checks that exactly ids positional IDs are given
+*/
+func parseFlags(fs *flag.FlagSet, args []string, ids int) ([]int, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) != ids {
+		return nil, fmt.Errorf("%s: expected %d id argument(s), got %d", fs.Name(), ids, len(positional))
+	}
+
+	result := make([]int, 0, ids)
+	for _, raw := range positional {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("%s: invalid id %q", fs.Name(), raw)
+		}
+		result = append(result, id)
+	}
+	return result, nil
+}
+
+/*
+parseDuration accepts plain seconds as in the API or Go durations
+*/
+func parseDuration(s string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(s); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+func detectFormat(format, file string) (playlistio.Format, error) {
+	if format != "" {
+		return playlistio.ParseFormat(format)
+	}
+	if file == "-" {
+		return "", errors.New("playlists import: -format is required when reading stdin")
+	}
+	return playlistio.DetectFormat(file, "")
+}
+
+func envOr(name, fallback string) string {
+	if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "playlistctl:", err)
+	os.Exit(1)
+}
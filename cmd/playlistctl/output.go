@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func (p *printer) json(v any) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (p *printer) table(header string, rows func(tw *tabwriter.Writer)) error {
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, header)
+	rows(tw)
+	return tw.Flush()
+}
+
+func (p *printer) songs(songs []song) error {
+	if p.format == outputJSON {
+		return p.json(songs)
+	}
+	return p.table("ID\tTITLE\tARTIST\tDURATION\tPLAYS\tADDED", func(tw *tabwriter.Writer) {
+		for _, s := range songs {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%s\n",
+				s.ID, s.Title, s.Artist, formatSeconds(s.Duration), s.PlayCount, formatTime(s.AddedAt))
+		}
+	})
+}
+
+func (p *printer) song(s *song) error {
+	if p.format == outputJSON {
+		return p.json(s)
+	}
+	return p.songs([]song{*s})
+}
+
+func (p *printer) playlists(playlists []playlist) error {
+	if p.format == outputJSON {
+		return p.json(playlists)
+	}
+	return p.table("ID\tNAME\tSONGS\tCREATED\tDESCRIPTION", func(tw *tabwriter.Writer) {
+		for _, pl := range playlists {
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\n",
+				pl.ID, pl.Name, pl.SongCount, formatTime(pl.CreatedAt), oneLine(pl.Description))
+		}
+	})
+}
+
+func (p *printer) playlist(pl *playlist) error {
+	if p.format == outputJSON {
+		return p.json(pl)
+	}
+	_, err := fmt.Fprintf(p.w, "Playlist %q created with id %d\n", pl.Name, pl.ID)
+	return err
+}
+
+func (p *printer) report(r *importReport) error {
+	if p.format == outputJSON {
+		return p.json(r)
+	}
+
+	if r.PlaylistID != 0 {
+		fmt.Fprintf(p.w, "Playlist %q created with id %d\n", r.Name, r.PlaylistID)
+	}
+	fmt.Fprintf(p.w, "Imported: %d, created songs: %d, unresolved: %d\n", r.Imported, r.CreatedSongs, len(r.Unresolved))
+	if len(r.Unresolved) == 0 {
+		return nil
+	}
+
+	return p.table("#\tENTRY\tREASON", func(tw *tabwriter.Writer) {
+		for _, entry := range r.Unresolved {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", entry.Index, entryName(entry), entry.Reason)
+		}
+	})
+}
+
+func (p *printer) state(st *state) error {
+	if p.format == outputJSON {
+		return p.json(st)
+	}
+
+	fmt.Fprintf(p.w, "Status:   %s\n", st.Status)
+	fmt.Fprintf(p.w, "Playlist: %s (id %d)\n", st.PlaylistName, st.PlaylistID)
+	if st.Song == nil {
+		_, err := fmt.Fprintln(p.w, "Song:     -")
+		return err
+	}
+	fmt.Fprintf(p.w, "Song:     %d/%d %s - %s (id %d)\n", st.Index, st.Total, st.Song.Artist, st.Song.Title, st.Song.ID)
+	_, err := fmt.Fprintf(p.w, "Position: %s / %s\n", formatSeconds(st.Position), formatSeconds(st.Song.Duration))
+	return err
+}
+
+func (p *printer) reconcile(r *reconcileReport) error {
+	if p.format == outputJSON {
+		return p.json(r)
+	}
+
+	found := r.Found
+	switch {
+	case found.Detached:
+		_, err := fmt.Fprintln(p.w, "A playlist which is not stored in DB is playing, nothing to compare")
+		return err
+	case found.Consistent:
+		_, err := fmt.Fprintf(p.w, "Cache and DB are consistent: %d songs\n", found.CacheSongs)
+		return err
+	}
+
+	fmt.Fprintf(p.w, "Songs:            %d in cache, %d in DB\n", found.CacheSongs, found.DBSongs)
+	fmt.Fprintf(p.w, "Missing in DB:    %s\n", formatIDs(found.MissingInDB))
+	fmt.Fprintf(p.w, "Missing in cache: %s\n", formatIDs(found.MissingInCache))
+	fmt.Fprintf(p.w, "Order differs:    %t\n", found.OrderDiffers)
+	fmt.Fprintf(p.w, "Current song:     %d in cache, %d in DB\n", found.CacheCurrentID, found.DBCurrentID)
+	if r.Repaired {
+		_, err := fmt.Fprintf(p.w, "Repaired: %s\n", r.Repair)
+		return err
+	}
+	return nil
+}
+
+func (p *printer) message(format string, args ...any) error {
+	if p.format == outputJSON {
+		return p.json(map[string]string{"result": fmt.Sprintf(format, args...)})
+	}
+	_, err := fmt.Fprintf(p.w, format+"\n", args...)
+	return err
+}
+
+func entryName(entry unresolvedEntry) string {
+	switch {
+	case entry.Title != "" && entry.Artist != "":
+		return entry.Artist + " - " + entry.Title
+	case entry.Title != "":
+		return entry.Title
+	}
+	return entry.Location
+}
+
+func formatIDs(ids []int) string {
+	if len(ids) == 0 {
+		return "-"
+	}
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.Itoa(id))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatSeconds(seconds int) string {
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,161 @@
+package cachesync
+
+import (
+	"cloud-go-testtask/internal/usecase"
+	"context"
+	"encoding/json"
+	"github.com/lib/pq"
+	"log/slog"
+	"time"
+)
+
+/*
+Channel is the Postgres channel notify_playlist_change() trigger from migrations notifies on
+*/
+const Channel = "playlist_changes"
+
+const (
+	minReconnectInterval = time.Second
+	maxReconnectInterval = time.Minute
+)
+
+/*
+Change is the payload of a notification: the table and the IDs of the written row.
+PlaylistID is 0 for songs, SongID is 0 for playlists
+*/
+type Change struct {
+	Table      string `json:"table"`
+	Op         string `json:"op"`
+	PlaylistID int    `json:"playlist_id"`
+	SongID     int    `json:"song_id"`
+}
+
+/*
+Listener keeps the cache of this instance in sync with writes of the other ones. Every write to
+playlists, playlist_songs and songs is notified by a trigger, Listener resyncs the cache on
+notifications about the loaded playlist or any song. Notifications are lost while the connection
+is down, so the cache is resynced after reconnects and every resyncInterval as well
+*/
+type Listener struct {
+	uc             *usecase.PlaylistUseCase
+	notifications  <-chan *pq.Notification
+	resyncInterval time.Duration
+	logger         *slog.Logger
+	close          func() error
+}
+
+/*
+New opens a dedicated connection to Postgres at dsn and listens on Channel.
+resyncInterval of 0 disables periodic resyncs
+*/
+func New(dsn string, uc *usecase.PlaylistUseCase, resyncInterval time.Duration, logger *slog.Logger) (*Listener, error) {
+	logger = logger.With(slog.String("op", "cachesync.Listener"))
+
+	listener := pq.NewListener(dsn, minReconnectInterval, maxReconnectInterval, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			logger.Warn("Lost connection to listen for changes", slog.String("error", err.Error()))
+		case pq.ListenerEventConnectionAttemptFailed:
+			logger.Warn("Failed to reconnect to listen for changes", slog.String("error", err.Error()))
+		case pq.ListenerEventReconnected:
+			logger.Info("Reconnected to listen for changes")
+		}
+	})
+	if err := listener.Listen(Channel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return newListener(listener.NotificationChannel(), uc, resyncInterval, logger, listener.Close), nil
+}
+
+func newListener(notifications <-chan *pq.Notification, uc *usecase.PlaylistUseCase, resyncInterval time.Duration, logger *slog.Logger, closer func() error) *Listener {
+	return &Listener{
+		uc:             uc,
+		notifications:  notifications,
+		resyncInterval: resyncInterval,
+		logger:         logger,
+		close:          closer,
+	}
+}
+
+/*
+Run applies notifications until ctx is done, then closes the connection
+*/
+func (l *Listener) Run(ctx context.Context) {
+	defer func() {
+		if err := l.close(); err != nil {
+			l.logger.Warn("Failed to close listener", slog.String("error", err.Error()))
+		}
+	}()
+
+	var tick <-chan time.Time
+	if l.resyncInterval > 0 {
+		ticker := time.NewTicker(l.resyncInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			l.resync(ctx, false)
+		case n, ok := <-l.notifications:
+			if !ok {
+				return
+			}
+			relevant, library := l.apply(ctx, n)
+			// a bulk write notifies per row, one resync covers the ones already queued
+			for len(l.notifications) > 0 {
+				r, lib := l.apply(ctx, <-l.notifications)
+				relevant, library = relevant || r, library || lib
+			}
+			if relevant {
+				l.resync(ctx, library)
+			}
+		}
+	}
+}
+
+/*
+apply decodes n and reports whether it concerns the loaded playlist and whether the library changed.
+pq sends nil after reconnecting, notifications might have been missed meanwhile
+*/
+func (l *Listener) apply(ctx context.Context, n *pq.Notification) (relevant, library bool) {
+	if n == nil {
+		l.logger.Info("Resyncing after reconnect")
+		return true, true
+	}
+
+	var change Change
+	if err := json.Unmarshal([]byte(n.Extra), &change); err != nil {
+		l.logger.Warn("Malformed change notification", slog.String("payload", n.Extra), slog.String("error", err.Error()))
+		return true, true // resyncing needlessly is cheaper than missing a change
+	}
+	l.logger.Debug("Change notified",
+		slog.String("table", change.Table),
+		slog.String("change", change.Op),
+		slog.Int("playlist_id", change.PlaylistID),
+		slog.Int("song_id", change.SongID),
+	)
+
+	if change.Table == "songs" {
+		return true, true
+	}
+	state, err := l.uc.State(ctx)
+	if err != nil {
+		return true, false
+	}
+	return change.PlaylistID == state.PlaylistID, false
+}
+
+func (l *Listener) resync(ctx context.Context, library bool) {
+	if library {
+		l.uc.LibraryChanged()
+	}
+	if _, err := l.uc.Resync(ctx); err != nil {
+		l.logger.Error("Failed to resync cache", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,188 @@
+package cachesync
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/migrator"
+	"cloud-go-testtask/internal/repository/rdbms"
+	"cloud-go-testtask/internal/usecase"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/*
+newSyncedUseCase returns use case with songs 1, 2 loaded and a mock DB another instance has added song 3 to
+*/
+func newSyncedUseCase(t *testing.T) *usecase.PlaylistUseCase {
+	ctx := context.Background()
+	rdbmsRepo := usecase.NewMockPlaylistRepo()
+	for id := 1; id <= 2; id++ {
+		require.NoError(t, rdbmsRepo.AddSong(ctx, &entity.Song{ID: id, Title: "Song", Artist: "Artist", Duration: 5 * time.Second}))
+	}
+	uc := usecase.NewPlaylistUseCase(rdbmsRepo, usecase.NewMockPlaylistRepo(), slog.Default())
+	require.NoError(t, uc.InitCache(ctx))
+
+	// the mocks share the loaded playlist, DB gets its own one
+	stored := &entity.Playlist{}
+	for id := 1; id <= 3; id++ {
+		node := stored.AddToEnd(&entity.Song{ID: id, Title: "Song", Artist: "Artist", Duration: 5 * time.Second})
+		if id == 1 {
+			require.NoError(t, stored.SetCurrent(node))
+		}
+	}
+	require.NoError(t, rdbmsRepo.LoadPlaylist(ctx, stored))
+	return uc
+}
+
+/*
+runListener runs Listener on notifications until they are closed, done is closed after Run returns
+*/
+func runListener(t *testing.T, uc *usecase.PlaylistUseCase, notifications chan *pq.Notification, resyncInterval time.Duration) (done chan struct{}) {
+	var closed atomic.Bool
+	l := newListener(notifications, uc, resyncInterval, slog.Default(), func() error {
+		closed.Store(true)
+		return nil
+	})
+
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Run(context.Background())
+		assert.True(t, closed.Load(), "connection is closed on return")
+	}()
+	return done
+}
+
+func cachedSongs(t *testing.T, uc *usecase.PlaylistUseCase) int {
+	state, err := uc.State(context.Background())
+	require.NoError(t, err)
+	return state.Total
+}
+
+func TestListener(t *testing.T) {
+	tests := []struct {
+		name         string
+		notification *pq.Notification
+		resynced     bool
+		library      bool
+	}{
+		{
+			name:         "loaded playlist changed",
+			notification: &pq.Notification{Channel: Channel, Extra: `{"table":"playlist_songs","op":"insert","playlist_id":0,"song_id":3}`},
+			resynced:     true,
+		},
+		{
+			name:         "other playlist changed",
+			notification: &pq.Notification{Channel: Channel, Extra: `{"table":"playlist_songs","op":"insert","playlist_id":5,"song_id":3}`},
+		},
+		{
+			name:         "song changed",
+			notification: &pq.Notification{Channel: Channel, Extra: `{"table":"songs","op":"update","playlist_id":null,"song_id":2}`},
+			resynced:     true,
+			library:      true,
+		},
+		{
+			name:         "malformed payload",
+			notification: &pq.Notification{Channel: Channel, Extra: `not json`},
+			resynced:     true,
+			library:      true,
+		},
+		{
+			name:     "reconnected",
+			resynced: true,
+			library:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := newSyncedUseCase(t)
+			var libraryChanges atomic.Int32
+			uc.OnLibraryChange(func() { libraryChanges.Add(1) })
+
+			// unbuffered, so the notification is applied before Run sees the channel closed
+			notifications := make(chan *pq.Notification)
+			done := runListener(t, uc, notifications, 0)
+			notifications <- tt.notification
+			close(notifications)
+			<-done
+
+			if tt.resynced {
+				assert.Equal(t, 3, cachedSongs(t, uc))
+			} else {
+				assert.Equal(t, 2, cachedSongs(t, uc))
+			}
+			assert.Equal(t, tt.library, libraryChanges.Load() > 0)
+		})
+	}
+}
+
+func TestListenerPeriodicResync(t *testing.T) {
+	uc := newSyncedUseCase(t)
+	notifications := make(chan *pq.Notification)
+	done := runListener(t, uc, notifications, 10*time.Millisecond)
+
+	assert.Eventually(t, func() bool { return cachedSongs(t, uc) == 3 }, time.Second, 5*time.Millisecond,
+		"missed notifications are caught up without any new one")
+	close(notifications)
+	<-done
+}
+
+/*
+TestSongTriggersPostgres checks the triggers of migrations against the database of TEST_POSTGRES_DSN:
+edits of a song are notified, play counts are not
+*/
+func TestSongTriggersPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	ctx := context.Background()
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	m, err := migrator.New(db, rdbms.DialectPostgres, slog.Default())
+	require.NoError(t, err)
+	require.NoError(t, m.Up(ctx))
+
+	listener := pq.NewListener(dsn, minReconnectInterval, maxReconnectInterval, nil)
+	t.Cleanup(func() { _ = listener.Close() })
+	require.NoError(t, listener.Listen(Channel))
+
+	var songID int
+	require.NoError(t, db.QueryRowContext(ctx,
+		"INSERT INTO songs (title, artist, duration) VALUES ('Song', 'Artist', 5) RETURNING id").Scan(&songID))
+	t.Cleanup(func() { _, _ = db.ExecContext(context.Background(), "DELETE FROM songs WHERE id = $1", songID) })
+
+	next := func() *Change {
+		select {
+		case n := <-listener.Notify:
+			var change Change
+			require.NoError(t, json.Unmarshal([]byte(n.Extra), &change))
+			return &change
+		case <-time.After(500 * time.Millisecond):
+			return nil
+		}
+	}
+	change := next()
+	require.NotNil(t, change)
+	assert.Equal(t, Change{Table: "songs", Op: "insert", SongID: songID}, *change)
+
+	repo := rdbms.NewPlaylistRepositoryRDBMS(db).(*rdbms.PlaylistRepositoryRDBMS)
+	require.NoError(t, repo.IncrementPlayCount(ctx, songID))
+	assert.Nil(t, next(), "a play count is not notified")
+
+	_, err = db.ExecContext(ctx, "UPDATE songs SET title = 'Renamed' WHERE id = $1", songID)
+	require.NoError(t, err)
+	change = next()
+	require.NotNil(t, change)
+	assert.Equal(t, "update", change.Op)
+}
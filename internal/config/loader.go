@@ -20,17 +20,74 @@ type DBConfig struct {
 
 type Config struct {
 	Env         string `yaml:"env" env:"ENV" env-default:"local"`
+	Storage     string `yaml:"storage" env:"STORAGE" env-default:"postgres"` // postgres (DB_* settings), sqlite (file at StoragePath) or file (log and snapshots in StoragePath directory)
 	StoragePath string `yaml:"storage_path" env:"STORAGE_PATH" env-required:"true"`
 	HTTPServer  `yaml:"http_server"`
 	DBConfig    DBConfig `yaml:"db_config"`
+	// AutoMigrate applies embedded migrations on app start, set AUTO_MIGRATE=false where migrations are run separately
+	AutoMigrate bool `yaml:"auto_migrate" env:"AUTO_MIGRATE" env-default:"true"`
+	// ShutdownTimeout bounds the whole graceful shutdown: draining requests, stopping playback and saving its state
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" env-default:"10s"`
+	// ShutdownDrainDelay is how long /readyz reports not ready before the server stops accepting requests
+	ShutdownDrainDelay time.Duration `yaml:"shutdown_drain_delay" env:"SHUTDOWN_DRAIN_DELAY" env-default:"0s"`
+	// CheckpointInterval is how often the playback position is saved while it changes, so the instance
+	// taking playback over after a crash resumes close to it. 0 saves it on shutdown only
+	CheckpointInterval time.Duration     `yaml:"checkpoint_interval" env:"CHECKPOINT_INTERVAL" env-default:"5s"`
+	Tracing            TracingConfig     `yaml:"tracing"`
+	Reconciler         ReconcilerConfig  `yaml:"reconciler"`
+	CacheSync          CacheSyncConfig   `yaml:"cache_sync"`
+	Leader             LeaderConfig      `yaml:"leader"`
+	Idempotency        IdempotencyConfig `yaml:"idempotency"`
+	RateLimit          RateLimitConfig   `yaml:"rate_limit"`
+}
+
+type ReconcilerConfig struct {
+	Interval time.Duration `yaml:"interval" env:"RECONCILE_INTERVAL" env-default:"1m"` // 0 disables background checks
+	Repair   string        `yaml:"repair" env:"RECONCILE_REPAIR" env-default:"none"`   // none, cache (from DB) or db (from cache)
+}
+
+type CacheSyncConfig struct {
+	Enabled        bool          `yaml:"enabled" env:"CACHE_SYNC_ENABLED" env-default:"true"`          // listen for changes made by other instances, Postgres only
+	ResyncInterval time.Duration `yaml:"resync_interval" env:"CACHE_RESYNC_INTERVAL" env-default:"5m"` // full resync in case notifications were missed, 0 disables
+}
+
+type LeaderConfig struct {
+	Election     bool          `yaml:"election" env:"LEADER_ELECTION" env-default:"false"`       // Postgres only, required to run more than one replica
+	InstanceID   string        `yaml:"instance_id" env:"INSTANCE_ID"`                            // host name if empty
+	AdvertiseURL string        `yaml:"advertise_url" env:"ADVERTISE_URL"`                        // followers forward playback commands to it, required with election
+	Interval     time.Duration `yaml:"interval" env:"LEADER_ELECTION_INTERVAL" env-default:"5s"` // between attempts of followers and lock checks of the leader
+}
+
+type IdempotencyConfig struct {
+	Enabled       bool          `yaml:"enabled" env:"IDEMPOTENCY_ENABLED" env-default:"true"`             // Postgres and SQLite only
+	TTL           time.Duration `yaml:"ttl" env:"IDEMPOTENCY_TTL" env-default:"24h"`                      // how long responses are replayed for retries
+	LockTimeout   time.Duration `yaml:"lock_timeout" env:"IDEMPOTENCY_LOCK_TIMEOUT" env-default:"1m"`     // a key of a request which never completed is free again after it
+	PurgeInterval time.Duration `yaml:"purge_interval" env:"IDEMPOTENCY_PURGE_INTERVAL" env-default:"1h"` // between removals of expired keys, 0 disables
+}
+
+type RateLimitConfig struct {
+	ControlRate  float64 `yaml:"control_rate" env:"RATE_LIMIT_CONTROL_RATE" env-default:"2"`   // /play, /pause, /next, /prev, /seek per second and client, 0 disables
+	ControlBurst int     `yaml:"control_burst" env:"RATE_LIMIT_CONTROL_BURST" env-default:"5"` // commands a client may send at once
+	ReadRate     float64 `yaml:"read_rate" env:"RATE_LIMIT_READ_RATE" env-default:"20"`        // GET requests per second and client, 0 disables
+	ReadBurst    int     `yaml:"read_burst" env:"RATE_LIMIT_READ_BURST" env-default:"40"`
+}
+
+type TracingConfig struct {
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_ENDPOINT"` // host:port of OTLP/HTTP collector, tracing is off if empty
+	Insecure    bool    `yaml:"insecure" env:"TRACING_INSECURE" env-default:"true"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" env-default:"1"`
+	ServiceName string  `yaml:"service_name" env:"TRACING_SERVICE_NAME" env-default:"playlist"`
 }
 
 type HTTPServer struct {
 	Address     string        `yaml:"address" env:"HTTP_SERVER_ADDRESS" env-default:"localhost:8080"`
 	Timeout     time.Duration `yaml:"timeout" env:"HTTP_SERVER_TIMEOUT" env-default:"4s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env:"HTTP_SERVER_IDLE_TIMEOUT" env-default:"60s"`
-	User        string        `yaml:"user" env:"HTTP_SERVER_USER" env-required:"true"`
-	Password    string        `yaml:"password" env:"HTTP_SERVER_PASSWORD" env-required:"true" env:"HTTP_SERVER_PASSWORD"`
+	// RequestTimeout is the deadline of request processing incl. DB queries, keep it below Timeout
+	RequestTimeout time.Duration `yaml:"request_timeout" env:"HTTP_SERVER_REQUEST_TIMEOUT" env-default:"3s"`
+	User           string        `yaml:"user" env:"HTTP_SERVER_USER" env-required:"true"` // Basic auth of /admin routes
+	Password       string        `yaml:"password" env:"HTTP_SERVER_PASSWORD" env-required:"true" env:"HTTP_SERVER_PASSWORD"`
+	TrustedProxies []string      `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" env-separator:","` // IPs and CIDRs allowed to set X-Forwarded-For, e.g. the load balancer and other replicas
 }
 
 func MustLoad() *Config {
@@ -0,0 +1,68 @@
+package delivery
+
+import (
+	"cloud-go-testtask/internal/logging"
+	"cloud-go-testtask/internal/usecase"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+type AdminHandler struct {
+	uc     *usecase.PlaylistUseCase
+	logger *slog.Logger
+}
+
+func NewAdminHandler(uc *usecase.PlaylistUseCase, logger *slog.Logger) *AdminHandler {
+	return &AdminHandler{
+		uc:     uc,
+		logger: logger,
+	}
+}
+
+/*
+ReconcileHandler serves POST /admin/reconcile?repair=none|cache|db: compares the cached playlist
+with the one in DB and repairs the side which is not the source of truth. none only reports.
+Followers refuse to repair DB with 409, it is the leader's to write
+*/
+func (h *AdminHandler) ReconcileHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.AdminHandler.ReconcileHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	direction, err := usecase.ParseRepairDirection(r.URL.Query().Get("repair"))
+	if err != nil {
+		operationLogger.Warn("Invalid repair direction", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	operationLogger.Info("Received Reconcile request", slog.String("repair", string(direction)))
+
+	result, err := h.uc.Reconcile(r.Context(), direction)
+	if errors.Is(err, usecase.ErrNotLeader) {
+		operationLogger.Warn("Refused to repair DB on a follower")
+		http.Error(w, "DB is repaired only by the leader", http.StatusConflict)
+		return
+	}
+	if result == nil {
+		operationLogger.Error("Failed to compare cache and DB", slog.String("error", err.Error()))
+		http.Error(w, "failed to compare cache and DB", http.StatusInternalServerError)
+		return
+	}
+
+	resp := reconcileResponse{
+		Repair:   string(direction),
+		Found:    newConsistencyDTO(result.Found),
+		Repaired: result.Repaired,
+	}
+	status := http.StatusOK
+	if err != nil {
+		operationLogger.Error("Failed to repair", slog.String("error", err.Error()))
+		resp.Error = err.Error()
+		status = http.StatusInternalServerError
+		if errors.Is(err, usecase.ErrRepairUnsupported) {
+			status = http.StatusNotImplemented
+		}
+	}
+	writeJSON(w, operationLogger, status, resp)
+}
@@ -0,0 +1,394 @@
+package delivery
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/health"
+	"cloud-go-testtask/internal/usecase"
+	"time"
+)
+
+// Request and response types of the HTTP API. Durations are always in seconds
+
+type addSongRequest struct {
+	Title    string `json:"title"`
+	Artist   string `json:"artist"`
+	Duration int    `json:"duration"`
+}
+
+type songDTO struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Artist    string    `json:"artist"`
+	Duration  int       `json:"duration"`
+	AddedAt   time.Time `json:"added_at"`
+	PlayCount int       `json:"play_count"`
+	Version   int       `json:"version"` // the ETag of the song, expected in If-Match of PATCH and DELETE /songs/{id}
+}
+
+func newSongDTO(song *entity.Song) songDTO {
+	return songDTO{
+		ID:        song.ID,
+		Title:     song.Title,
+		Artist:    song.Artist,
+		Duration:  int(song.Duration.Seconds()),
+		AddedAt:   song.AddedAt,
+		PlayCount: song.PlayCount,
+		Version:   song.Version,
+	}
+}
+
+type seekRequest struct {
+	Position int `json:"position"` // seconds from the start of the current song
+}
+
+type moveSongRequest struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+/*
+ GET /state
+*/
+
+const (
+	playbackStopped = "stopped"
+	playbackPlaying = "playing"
+	playbackPaused  = "paused"
+)
+
+type playbackStateResponse struct {
+	Status       string   `json:"status"`
+	Position     int      `json:"position"` // seconds from the start of the current song
+	Song         *songDTO `json:"song"`
+	PlaylistID   int      `json:"playlist_id"`
+	PlaylistName string   `json:"playlist_name"`
+	Index        int      `json:"index"` // 1-based position of the current song, 0 if none
+	Total        int      `json:"total"`
+}
+
+func newPlaybackStateResponse(state *usecase.PlaybackState) playbackStateResponse {
+	resp := playbackStateResponse{
+		Status:       playbackStopped,
+		Position:     int(state.Position.Seconds()),
+		PlaylistID:   state.PlaylistID,
+		PlaylistName: state.PlaylistName,
+		Index:        state.Index,
+		Total:        state.Total,
+	}
+	switch {
+	case state.Playing:
+		resp.Status = playbackPlaying
+	case state.Paused:
+		resp.Status = playbackPaused
+	}
+	if state.Song != nil {
+		song := newSongDTO(state.Song)
+		resp.Song = &song
+	}
+	return resp
+}
+
+/*
+ GET /playlist (v1). The shape, including the "sogs" key, is kept as is for existing clients
+*/
+
+type legacySongDTO struct {
+	ID       int    `json:"id"`
+	Title    string `json:"title"`
+	Artist   string `json:"artist"`
+	Duration int    `json:"duration"`
+}
+
+type legacyPlaylistResponse struct {
+	Sogs []legacySongDTO `json:"sogs"`
+}
+
+func newLegacyPlaylistResponse(playlist *entity.Playlist) legacyPlaylistResponse {
+	var resp legacyPlaylistResponse
+	for node := playlist.GetHead(); node != nil; node = node.Next {
+		if node.Song == nil {
+			continue
+		}
+		resp.Sogs = append(resp.Sogs, legacySongDTO{
+			ID:       node.Song.ID,
+			Title:    node.Song.Title,
+			Artist:   node.Song.Artist,
+			Duration: int(node.Song.Duration.Seconds()),
+		})
+	}
+	return resp
+}
+
+/*
+ GET /v2/playlists/{id}
+*/
+
+type playlistItemDTO struct {
+	Position int     `json:"position"` // 1-based position in playlist
+	Current  bool    `json:"current"`
+	Song     songDTO `json:"song"`
+}
+
+type playlistV2Response struct {
+	ID              int               `json:"id"`
+	Name            string            `json:"name"`
+	Description     string            `json:"description"`
+	SongCount       int               `json:"song_count"`
+	TotalDuration   int               `json:"total_duration"`
+	CurrentPosition *int              `json:"current_position"` // null if no song is current
+	Items           []playlistItemDTO `json:"items"`
+	NextCursor      string            `json:"next_cursor,omitempty"`
+}
+
+func newPlaylistV2Response(page *usecase.PlaylistPage) playlistV2Response {
+	resp := playlistV2Response{
+		ID:            page.ID,
+		Name:          page.Name,
+		Description:   page.Description,
+		SongCount:     page.SongCount,
+		TotalDuration: int(page.TotalDuration.Seconds()),
+		Items:         make([]playlistItemDTO, 0, len(page.Items)),
+	}
+	if page.CurrentPosition > 0 {
+		position := page.CurrentPosition
+		resp.CurrentPosition = &position
+	}
+	for _, item := range page.Items {
+		resp.Items = append(resp.Items, playlistItemDTO{
+			Position: item.Position,
+			Current:  item.Current,
+			Song:     newSongDTO(item.Song),
+		})
+	}
+	if page.Next != nil {
+		resp.NextCursor = page.Next.Encode()
+	}
+	return resp
+}
+
+/*
+ Library search
+*/
+
+type songsPageResponse struct {
+	Songs      []songDTO `json:"songs"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+type playlistInfoResponse struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	SongCount   int       `json:"song_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type createPlaylistRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type createPlaylistResponse struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type playlistsPageResponse struct {
+	Playlists  []playlistInfoResponse `json:"playlists"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+/*
+ Smart playlists
+*/
+
+type smartRuleDTO struct {
+	Field    string `json:"field"`
+	Operator string `json:"op"`
+	Value    string `json:"value"`
+}
+
+type smartPlaylistRequest struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Rules       []smartRuleDTO `json:"rules"`
+	SortBy      string         `json:"sort_by"`
+	Limit       int            `json:"limit"`
+}
+
+type smartPlaylistResponse struct {
+	ID          int            `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Rules       []smartRuleDTO `json:"rules"`
+	SortBy      string         `json:"sort_by"`
+	Limit       int            `json:"limit"`
+	Version     int            `json:"version"` // the ETag of the smart playlist, expected in If-Match of PUT and DELETE
+	Songs       []songDTO      `json:"songs,omitempty"`
+}
+
+func (req smartPlaylistRequest) toEntity() *entity.SmartPlaylist {
+	sp := &entity.SmartPlaylist{
+		Name:        req.Name,
+		Description: req.Description,
+		SortBy:      entity.SmartSort(req.SortBy),
+		Limit:       req.Limit,
+	}
+	for _, rule := range req.Rules {
+		sp.Rules = append(sp.Rules, entity.SmartRule{
+			Field:    entity.RuleField(rule.Field),
+			Operator: entity.RuleOperator(rule.Operator),
+			Value:    rule.Value,
+		})
+	}
+	return sp
+}
+
+func newSmartPlaylistResponse(sp *entity.SmartPlaylist, playlist *entity.Playlist) smartPlaylistResponse {
+	resp := smartPlaylistResponse{
+		ID:          sp.ID,
+		Name:        sp.Name,
+		Description: sp.Description,
+		Rules:       []smartRuleDTO{},
+		SortBy:      string(sp.SortBy),
+		Limit:       sp.Limit,
+		Version:     sp.Version,
+	}
+	for _, rule := range sp.Rules {
+		resp.Rules = append(resp.Rules, smartRuleDTO{
+			Field:    string(rule.Field),
+			Operator: string(rule.Operator),
+			Value:    rule.Value,
+		})
+	}
+
+	if playlist == nil {
+		return resp
+	}
+
+	resp.Songs = []songDTO{}
+	for node := playlist.GetHead(); node != nil; node = node.Next {
+		if node.Song != nil {
+			resp.Songs = append(resp.Songs, newSongDTO(node.Song))
+		}
+	}
+	return resp
+}
+
+/*
+ Playlist import
+*/
+
+type unresolvedEntryDTO struct {
+	Index    int    `json:"index"`
+	Location string `json:"location,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Artist   string `json:"artist,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+type importReportResponse struct {
+	PlaylistID   int                  `json:"playlist_id,omitempty"`
+	Name         string               `json:"name"`
+	Imported     int                  `json:"imported"`
+	CreatedSongs int                  `json:"created_songs"`
+	Unresolved   []unresolvedEntryDTO `json:"unresolved"`
+}
+
+func newImportReportResponse(report *usecase.ImportReport) importReportResponse {
+	resp := importReportResponse{
+		PlaylistID:   report.PlaylistID,
+		Name:         report.Name,
+		Imported:     report.Imported,
+		CreatedSongs: report.CreatedSongs,
+		Unresolved:   make([]unresolvedEntryDTO, 0, len(report.Unresolved)),
+	}
+	for _, entry := range report.Unresolved {
+		resp.Unresolved = append(resp.Unresolved, unresolvedEntryDTO{
+			Index:    entry.Index,
+			Location: entry.Location,
+			Title:    entry.Title,
+			Artist:   entry.Artist,
+			Reason:   entry.Reason,
+		})
+	}
+	return resp
+}
+
+type readinessResponse struct {
+	Status   string            `json:"status"` // "ready" or "not ready"
+	Draining bool              `json:"draining"`
+	Checks   map[string]string `json:"checks"` // "ok" or the error of the probe
+}
+
+func newReadinessResponse(report health.Report) readinessResponse {
+	resp := readinessResponse{Status: "ready", Draining: report.Draining, Checks: make(map[string]string, len(report.Checks))}
+	if !report.Ready {
+		resp.Status = "not ready"
+	}
+	for _, check := range report.Checks {
+		resp.Checks[check.Name] = "ok"
+		if check.Err != nil {
+			resp.Checks[check.Name] = check.Err.Error()
+		}
+	}
+	return resp
+}
+
+type goroutinesDTO struct {
+	Playback int `json:"playback"`
+	Total    int `json:"total"`
+}
+
+type consistencyDTO struct {
+	Consistent     bool  `json:"consistent"`
+	Detached       bool  `json:"detached"` // a playlist not stored in DB is loaded, nothing is compared
+	CacheSongs     int   `json:"cache_songs"`
+	DBSongs        int   `json:"db_songs"`
+	MissingInDB    []int `json:"missing_in_db"`
+	MissingInCache []int `json:"missing_in_cache"`
+	OrderDiffers   bool  `json:"order_differs"`
+	CacheCurrentID int   `json:"cache_current_song_id"`
+	DBCurrentID    int   `json:"db_current_song_id"`
+}
+
+func newConsistencyDTO(c *usecase.Consistency) consistencyDTO {
+	return consistencyDTO{
+		Consistent:     c.Consistent(),
+		Detached:       c.Detached,
+		CacheSongs:     c.CacheSongs,
+		DBSongs:        c.DBSongs,
+		MissingInDB:    nonNil(c.MissingInDB),
+		MissingInCache: nonNil(c.MissingInCache),
+		OrderDiffers:   c.OrderDiffers,
+		CacheCurrentID: c.CacheCurrentID,
+		DBCurrentID:    c.DBCurrentID,
+	}
+}
+
+/*
+nonNil makes empty lists encode as [] rather than null
+*/
+func nonNil(ids []int) []int {
+	if ids == nil {
+		return []int{}
+	}
+	return ids
+}
+
+type debugStateResponse struct {
+	Readiness   readinessResponse      `json:"readiness"`
+	Goroutines  goroutinesDTO          `json:"goroutines"`
+	Leading     bool                   `json:"leading"` // this instance drives playback, followers forward commands to the leader
+	Playback    *playbackStateResponse `json:"playback"`
+	Consistency *consistencyDTO        `json:"consistency"`
+	Errors      []string               `json:"errors,omitempty"` // parts which could not be collected
+}
+
+type reconcileResponse struct {
+	Repair   string         `json:"repair"`
+	Found    consistencyDTO `json:"found"` // the difference before the repair
+	Repaired bool           `json:"repaired"`
+	Error    string         `json:"error,omitempty"`
+}
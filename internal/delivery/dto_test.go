@@ -0,0 +1,23 @@
+package delivery
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLegacyPlaylistResponseShape(t *testing.T) {
+	playlist := &entity.Playlist{}
+	playlist.AddToEnd(&entity.Song{ID: 1, Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second})
+
+	data, err := json.Marshal(newLegacyPlaylistResponse(playlist))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"sogs":[{"id":1,"title":"Imagine","artist":"John Lennon","duration":183}]}`, string(data))
+
+	data, err = json.Marshal(newLegacyPlaylistResponse(&entity.Playlist{}))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"sogs":null}`, string(data))
+}
@@ -0,0 +1,82 @@
+package delivery
+
+import (
+	"bytes"
+	"cloud-go-testtask/internal/logging"
+	"cloud-go-testtask/internal/playlistio"
+	"cloud-go-testtask/internal/usecase"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+type ExportHandler struct {
+	uc     *usecase.ExportUseCase
+	logger *slog.Logger
+}
+
+func NewExportHandler(uc *usecase.ExportUseCase, logger *slog.Logger) *ExportHandler {
+	return &ExportHandler{
+		uc:     uc,
+		logger: logger,
+	}
+}
+
+/*
+ExportPlaylistHandler serves GET /playlists/{id}/export?format=m3u|m3u8|pls|xspf|json
+JSON is the default, it is the only format imported back without losses
+*/
+func (h *ExportHandler) ExportPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.ExportHandler.ExportPlaylistHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received ExportPlaylist request")
+
+	id, ok := parseIDParam(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	format := playlistio.FormatJSON
+	if raw := r.URL.Query().Get("format"); raw != "" {
+		var err error
+		if format, err = playlistio.ParseFormat(raw); err != nil {
+			operationLogger.Warn("Unknown playlist format", slog.String("error", err.Error()))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// the file is built in memory, so errors can still be reported with a proper status
+	var buf bytes.Buffer
+	if err := h.uc.Export(r.Context(), id, format, &buf); err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrPlaylistNotFound):
+			operationLogger.Warn("Playlist not found", slog.String("error", err.Error()))
+			http.Error(w, "playlist not found", http.StatusNotFound)
+		case errors.Is(err, usecase.ErrInvalidQuery):
+			operationLogger.Warn("Invalid export request", slog.String("error", err.Error()))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			operationLogger.Error("Failed to export playlist", slog.String("error", err.Error()))
+			http.Error(w, "failed to export playlist", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	filename := fmt.Sprintf("playlist-%d.%s", id, format)
+	w.Header().Set("Content-Type", playlistio.ContentType(format)+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := buf.WriteTo(w); err != nil {
+		operationLogger.Error("Failed to write response", slog.String("error", err.Error()))
+		return
+	}
+
+	operationLogger.Info("Playlist exported successfully", slog.Int("id", id), slog.String("format", string(format)))
+}
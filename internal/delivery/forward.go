@@ -0,0 +1,87 @@
+package delivery
+
+import (
+	"cloud-go-testtask/internal/leader"
+	"cloud-go-testtask/internal/logging"
+	"cloud-go-testtask/internal/tracing"
+	"context"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+const (
+	forwardedHeader = "X-Playlist-Forwarded" // set on requests a follower has forwarded
+	leaderHeader    = "X-Playlist-Leader"    // instance ID of the leader which served a forwarded request
+)
+
+/*
+Leadership tells whether this instance drives playback and which one does otherwise
+*/
+type Leadership interface {
+	Leading() bool
+	Leader(ctx context.Context) (*leader.Info, error)
+}
+
+/*
+ForwardToLeader serves playback routes on the leader and proxies them to the leader from followers.
+Without a reachable leader, e.g. during failover, 503 with Retry-After asks the client to repeat the request
+*/
+func ForwardToLeader(leadership Leadership, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if leadership.Leading() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			const op = "delivery.ForwardToLeader"
+			operationLogger := logging.FromContext(r.Context(), logger).With(slog.String("op", op))
+
+			if r.Header.Get(forwardedHeader) != "" {
+				// the sender took this instance for the leader, the leadership has moved since
+				operationLogger.Warn("Forwarded request reached a follower")
+				leaderUnavailable(w, "playback leader has changed")
+				return
+			}
+
+			info, err := leadership.Leader(r.Context())
+			if err != nil {
+				operationLogger.Warn("Failed to find playback leader", slog.String("error", err.Error()))
+				leaderUnavailable(w, "no playback leader: "+err.Error())
+				return
+			}
+			target, err := url.Parse(info.Address)
+			if err != nil {
+				operationLogger.Error("Invalid leader address", slog.String("address", info.Address), slog.String("error", err.Error()))
+				leaderUnavailable(w, "invalid playback leader address")
+				return
+			}
+
+			operationLogger.Debug("Forwarding to playback leader", slog.String("leader", info.InstanceID), slog.String("address", info.Address))
+			proxy := &httputil.ReverseProxy{
+				Rewrite: func(pr *httputil.ProxyRequest) {
+					pr.SetURL(target)
+					pr.SetXForwarded()
+					pr.Out.Header.Set(forwardedHeader, "1")
+					pr.Out.Header.Del(idempotencyKeyHeader) // the key is already reserved by this instance
+					pr.Out.Header.Set(middleware.RequestIDHeader, middleware.GetReqID(pr.In.Context()))
+					tracing.Inject(pr.In.Context(), pr.Out.Header)
+				},
+				ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+					operationLogger.Warn("Playback leader is unreachable", slog.String("leader", info.InstanceID), slog.String("error", err.Error()))
+					leaderUnavailable(w, "playback leader is unreachable")
+				},
+			}
+			w.Header().Set(leaderHeader, info.InstanceID)
+			proxy.ServeHTTP(w, r)
+		})
+	}
+}
+
+func leaderUnavailable(w http.ResponseWriter, message string) {
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, message, http.StatusServiceUnavailable)
+}
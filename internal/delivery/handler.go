@@ -1 +1,67 @@
 package delivery
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Helpers shared by handlers
+
+func parseIDParam(w http.ResponseWriter, r *http.Request, operationLogger *slog.Logger) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		operationLogger.Warn("Invalid id parameter", slog.String("id", chi.URLParam(r, "id")))
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func writeJSON(w http.ResponseWriter, operationLogger *slog.Logger, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		operationLogger.Error("Failed to encode response to JSON", slog.String("error", err.Error()))
+	}
+}
+
+/*
+setETag sets the strong entity tag of a versioned entity, unversioned ones (version 0) get none
+*/
+func setETag(w http.ResponseWriter, version int) {
+	if version != 0 {
+		w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+	}
+}
+
+/*
+parseIfMatch returns the versions listed in If-Match, nil if the header is absent or "*".
+Weak and foreign tags never match, if no listed tag can the precondition fails with 412 right away
+*/
+func parseIfMatch(w http.ResponseWriter, r *http.Request, operationLogger *slog.Logger) ([]int, bool) {
+	header := strings.Join(r.Header.Values("If-Match"), ",")
+	if strings.TrimSpace(header) == "" || strings.TrimSpace(header) == "*" {
+		return nil, true
+	}
+
+	var versions []int
+	for _, tag := range strings.Split(header, ",") {
+		unquoted, err := strconv.Unquote(strings.TrimSpace(tag))
+		if err != nil {
+			continue
+		}
+		if version, err := strconv.Atoi(unquoted); err == nil && version > 0 {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		operationLogger.Warn("No If-Match tag can match", slog.String("if_match", header))
+		http.Error(w, "version does not match", http.StatusPreconditionFailed)
+		return nil, false
+	}
+	return versions, true
+}
@@ -0,0 +1,130 @@
+package delivery
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/usecase"
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	ctx := context.Background()
+	rdbmsRepo := usecase.NewMockPlaylistRepo()
+	for id := 1; id <= 2; id++ {
+		require.NoError(t, rdbmsRepo.AddSong(ctx, &entity.Song{ID: id, Title: "Song", Artist: "Artist", Duration: 5 * time.Second, Version: 1}))
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	uc := usecase.NewPlaylistUseCase(rdbmsRepo, usecase.NewMockPlaylistRepo(), logger)
+	require.NoError(t, uc.InitCache(ctx))
+
+	h := NewPlaylistHandler(uc, logger)
+	r := chi.NewRouter()
+	r.Get("/current", h.GetCurrentSongHandler)
+	r.Patch("/songs/{id}", h.UpdateSongHandler)
+	r.Delete("/songs/{id}", h.DeleteSongHandler)
+
+	do := func(method, target, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/current", "", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+	assert.JSONEq(t, `{"id":1,"title":"Song","artist":"Artist","duration":5,"added_at":"0001-01-01T00:00:00Z","play_count":0,"version":1}`,
+		rec.Body.String())
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		ifMatch string
+		status  int
+		etag    string
+	}{
+		{name: "stale version", method: http.MethodPatch, target: "/songs/1", ifMatch: `"2"`, status: http.StatusPreconditionFailed},
+		{name: "weak tag never matches", method: http.MethodPatch, target: "/songs/1", ifMatch: `W/"1"`, status: http.StatusPreconditionFailed},
+		{name: "current version", method: http.MethodPatch, target: "/songs/1", ifMatch: `"3", "1"`, status: http.StatusOK, etag: `"2"`},
+		{name: "without If-Match", method: http.MethodPatch, target: "/songs/1", status: http.StatusOK, etag: `"3"`},
+		{name: "delete stale version", method: http.MethodDelete, target: "/songs/2", ifMatch: `"2"`, status: http.StatusPreconditionFailed},
+		{name: "delete any version", method: http.MethodDelete, target: "/songs/2", ifMatch: "*", status: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.method, tt.target, tt.ifMatch, `{"title":"Renamed"}`)
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.Equal(t, tt.etag, rec.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestConditionalPlaylistWrites(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	libraryRepo := usecase.NewMockLibraryRepo(&entity.Song{ID: 1, Title: "Song", Duration: 5 * time.Second, Version: 1})
+	libraryRepo.AddPlaylist(&entity.Playlist{ID: 1, Name: "Road trip", Version: 3})
+	smart := usecase.NewSmartPlaylistUseCase(usecase.NewMockSmartPlaylistRepo(), nil, logger)
+	_, err := smart.Create(ctx, &entity.SmartPlaylist{
+		Name:  "Short",
+		Rules: []entity.SmartRule{{Field: entity.RuleFieldDuration, Operator: entity.RuleOpLess, Value: "260"}},
+	})
+	require.NoError(t, err)
+
+	library := NewLibraryHandler(usecase.NewLibraryUseCase(libraryRepo, nil, logger), logger)
+	smartHandler := NewSmartPlaylistHandler(smart, logger)
+	r := chi.NewRouter()
+	r.Get("/v2/playlists/{id}", library.GetPlaylistV2Handler)
+	r.Delete("/playlists/{id}", library.DeletePlaylistHandler)
+	r.Put("/smart-playlists/{id}", smartHandler.UpdateHandler)
+	r.Delete("/smart-playlists/{id}", smartHandler.DeleteHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/playlists/1", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+
+	body := `{"name":"Shorter","rules":[{"field":"duration","op":"lt","value":"200"}]}`
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		ifMatch string
+		status  int
+		etag    string
+	}{
+		{name: "update smart playlist stale version", method: http.MethodPut, target: "/smart-playlists/1", ifMatch: `"2"`, status: http.StatusPreconditionFailed},
+		{name: "update smart playlist current version", method: http.MethodPut, target: "/smart-playlists/1", ifMatch: `"1"`, status: http.StatusOK, etag: `"2"`},
+		{name: "delete smart playlist stale version", method: http.MethodDelete, target: "/smart-playlists/1", ifMatch: `"1"`, status: http.StatusPreconditionFailed},
+		{name: "delete smart playlist current version", method: http.MethodDelete, target: "/smart-playlists/1", ifMatch: `"2"`, status: http.StatusNoContent},
+		{name: "delete playlist stale version", method: http.MethodDelete, target: "/playlists/1", ifMatch: `"2"`, status: http.StatusPreconditionFailed},
+		{name: "delete playlist weak tag", method: http.MethodDelete, target: "/playlists/1", ifMatch: `W/"3"`, status: http.StatusPreconditionFailed},
+		{name: "delete playlist current version", method: http.MethodDelete, target: "/playlists/1", ifMatch: `"3"`, status: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(body))
+			req.Header.Set("If-Match", tt.ifMatch)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.Equal(t, tt.etag, rec.Header().Get("ETag"))
+		})
+	}
+}
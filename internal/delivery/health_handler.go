@@ -0,0 +1,89 @@
+package delivery
+
+import (
+	"cloud-go-testtask/internal/health"
+	"cloud-go-testtask/internal/logging"
+	"cloud-go-testtask/internal/usecase"
+	"log/slog"
+	"net/http"
+	"runtime"
+)
+
+type HealthHandler struct {
+	checker *health.Checker
+	uc      *usecase.PlaylistUseCase
+	logger  *slog.Logger
+}
+
+func NewHealthHandler(checker *health.Checker, uc *usecase.PlaylistUseCase, logger *slog.Logger) *HealthHandler {
+	return &HealthHandler{
+		checker: checker,
+		uc:      uc,
+		logger:  logger,
+	}
+}
+
+/*
+HealthzHandler serves GET /healthz: the process is up and serves HTTP, dependencies are not checked
+*/
+func (h *HealthHandler) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.HealthHandler.HealthzHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	writeJSON(w, operationLogger, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+/*
+ReadyzHandler serves GET /readyz: 200 if all probes pass, 503 if some failed or the service is shutting down
+*/
+func (h *HealthHandler) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.HealthHandler.ReadyzHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	report := h.checker.Ready(r.Context())
+	resp := newReadinessResponse(report)
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+		operationLogger.Warn("Service is not ready", slog.Any("checks", resp.Checks), slog.Bool("draining", report.Draining))
+	}
+	writeJSON(w, operationLogger, status, resp)
+}
+
+/*
+DebugStateHandler serves GET /debug/state: readiness, playback state, goroutines
+and the difference between the cached playlist and the one in DB
+*/
+func (h *HealthHandler) DebugStateHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.HealthHandler.DebugStateHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	resp := debugStateResponse{
+		Readiness: newReadinessResponse(h.checker.Ready(r.Context())),
+		Goroutines: goroutinesDTO{
+			Playback: h.uc.PlaybackGoroutines(),
+			Total:    runtime.NumGoroutine(),
+		},
+		Leading: h.uc.Leading(),
+	}
+
+	if state, err := h.uc.State(r.Context()); err != nil {
+		resp.Errors = append(resp.Errors, err.Error())
+	} else {
+		playback := newPlaybackStateResponse(state)
+		resp.Playback = &playback
+	}
+
+	if consistency, err := h.uc.CheckConsistency(r.Context()); err != nil {
+		resp.Errors = append(resp.Errors, err.Error())
+	} else {
+		dto := newConsistencyDTO(consistency)
+		resp.Consistency = &dto
+	}
+
+	if len(resp.Errors) > 0 {
+		operationLogger.Warn("Debug state is incomplete", slog.Any("errors", resp.Errors))
+	}
+	writeJSON(w, operationLogger, http.StatusOK, resp)
+}
@@ -0,0 +1,235 @@
+package delivery
+
+import (
+	"bytes"
+	"cloud-go-testtask/internal/logging"
+	"cloud-go-testtask/internal/repository"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/go-chi/chi/v5/middleware"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed" // set on responses replayed from the store
+	maxIdempotencyKeyLength  = 255
+	maxIdempotentBodySize    = maxImportFileSize + 1<<20 // an imported file with multipart overhead
+)
+
+/*
+IdempotencyKeys makes mutating requests carrying Idempotency-Key safe to retry: the first request is served
+and its response is stored for ttl, retries with the same key get the stored response and the use case
+is not run again. A key belongs to the method, path and body of its first request, reusing it for
+another request is 422, retrying while the first request is served is 409. Server errors and answers
+which may change on their own (429, 409, 412) are not stored, the retry runs the request again. A key of a request which never completed, e.g. the instance crashed,
+is free again after lease
+*/
+type IdempotencyKeys struct {
+	store  repository.IdempotencyStore
+	ttl    time.Duration
+	lease  time.Duration
+	logger *slog.Logger
+}
+
+func NewIdempotencyKeys(store repository.IdempotencyStore, ttl, lease time.Duration, logger *slog.Logger) *IdempotencyKeys {
+	return &IdempotencyKeys{
+		store:  store,
+		ttl:    ttl,
+		lease:  lease,
+		logger: logger,
+	}
+}
+
+func (k *IdempotencyKeys) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || !mutating(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		const op = "delivery.IdempotencyKeys.Middleware"
+		operationLogger := logging.FromContext(r.Context(), k.logger).With(slog.String("op", op), slog.String("idempotency_key", key))
+
+		if len(key) > maxIdempotencyKeyLength {
+			operationLogger.Warn("Idempotency key is too long", slog.Int("length", len(key)))
+			http.Error(w, "idempotency key is too long", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodySize))
+		if err != nil {
+			operationLogger.Warn("Failed to read request body", slog.String("error", err.Error()))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "request body is too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := requestFingerprint(r, body)
+		reservation, err := newReservation()
+		if err != nil {
+			operationLogger.Error("Failed to generate reservation", slog.String("error", err.Error()))
+			http.Error(w, "failed to check idempotency key", http.StatusInternalServerError)
+			return
+		}
+
+		stored, err := k.store.ReserveIdempotencyKey(r.Context(), key, fingerprint, reservation, k.lease)
+		if err != nil {
+			operationLogger.Error("Failed to reserve idempotency key", slog.String("error", err.Error()))
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "failed to check idempotency key", http.StatusServiceUnavailable)
+			return
+		}
+		switch {
+		case stored == nil:
+			k.serve(w, r, next, operationLogger, key, fingerprint, reservation)
+		case stored.Fingerprint != fingerprint:
+			operationLogger.Warn("Idempotency key reused for another request")
+			http.Error(w, "idempotency key was used for another request", http.StatusUnprocessableEntity)
+		case stored.Status == 0:
+			operationLogger.Warn("Request with the idempotency key is in progress")
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "request with this idempotency key is in progress", http.StatusConflict)
+		default:
+			operationLogger.Info("Replaying stored response", slog.Int("status", stored.Status))
+			replay(w, stored)
+		}
+	})
+}
+
+/*
+serve runs the request for the reserved key and stores its response
+*/
+func (k *IdempotencyKeys) serve(w http.ResponseWriter, r *http.Request, next http.Handler, operationLogger *slog.Logger, key, fingerprint, reservation string) {
+	var body bytes.Buffer
+	ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	ww.Tee(&body)
+
+	// the key must not stay reserved for the lease if the handler panics
+	completed := false
+	defer func() {
+		if !completed {
+			k.release(r.Context(), operationLogger, key, reservation)
+		}
+	}()
+	next.ServeHTTP(ww, r)
+	completed = true
+
+	status := ww.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if transient(status) {
+		k.release(r.Context(), operationLogger, key, reservation)
+		return
+	}
+
+	header := w.Header().Clone()
+	header.Del(middleware.RequestIDHeader) // a retry has its own
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), k.lease)
+	defer cancel()
+	err := k.store.SaveIdempotentResponse(ctx, key, reservation, &repository.IdempotentResponse{
+		Fingerprint: fingerprint,
+		Status:      status,
+		Header:      header,
+		Body:        body.Bytes(),
+	}, k.ttl)
+	if errors.Is(err, repository.ErrIdempotencyKeyLost) {
+		operationLogger.Warn("Idempotency key expired while the request was served", slog.Duration("lease", k.lease))
+	} else if err != nil {
+		// the reservation expires after the lease, a retry runs the request again then
+		operationLogger.Error("Failed to store response for idempotency key", slog.String("error", err.Error()))
+	}
+}
+
+func (k *IdempotencyKeys) release(ctx context.Context, operationLogger *slog.Logger, key, reservation string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), k.lease)
+	defer cancel()
+	if err := k.store.ReleaseIdempotencyKey(ctx, key, reservation); err != nil {
+		operationLogger.Error("Failed to release idempotency key", slog.String("error", err.Error()))
+	}
+}
+
+/*
+RunPurger removes expired keys every interval until ctx is done
+*/
+func (k *IdempotencyKeys) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := k.store.PurgeIdempotencyKeys(ctx)
+			if err != nil {
+				k.logger.Error("Failed to purge idempotency keys", slog.String("error", err.Error()))
+				continue
+			}
+			k.logger.Debug("Idempotency keys purged", slog.Int64("purged", purged))
+		}
+	}
+}
+
+/*
+newReservation identifies one request holding a key, so a request which outlived its lease
+cannot save or release the key a retry has taken over since
+*/
+func newReservation() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+/*
+transient reports whether a retry of the same request may get another answer: server errors,
+rate limits and conflicts with the current state, e.g. a stale If-Match
+*/
+func transient(status int) bool {
+	switch status {
+	case http.StatusConflict, http.StatusPreconditionFailed, http.StatusTooManyRequests:
+		return true
+	}
+	return status >= http.StatusInternalServerError
+}
+
+func mutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+/*
+requestFingerprint identifies a request by method, path with query and body
+*/
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, stored *repository.IdempotentResponse) {
+	for name, values := range stored.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(stored.Status)
+	w.Write(stored.Body)
+}
@@ -0,0 +1,120 @@
+package delivery
+
+import (
+	"cloud-go-testtask/internal/repository"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+memoryIdempotencyStore keeps keys in memory, expiry is not modelled
+*/
+type memoryIdempotencyStore struct {
+	mu           sync.Mutex
+	keys         map[string]*repository.IdempotentResponse
+	reservations map[string]string
+}
+
+func (s *memoryIdempotencyStore) ReserveIdempotencyKey(_ context.Context, key, fingerprint, reservation string, _ time.Duration) (*repository.IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored, ok := s.keys[key]; ok {
+		return stored, nil
+	}
+	s.keys[key] = &repository.IdempotentResponse{Fingerprint: fingerprint}
+	s.reservations[key] = reservation
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) SaveIdempotentResponse(_ context.Context, key, reservation string, response *repository.IdempotentResponse, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored, ok := s.keys[key]; !ok || stored.Status != 0 || s.reservations[key] != reservation {
+		return repository.ErrIdempotencyKeyLost
+	}
+	s.keys[key] = response
+	return nil
+}
+
+func (s *memoryIdempotencyStore) ReleaseIdempotencyKey(_ context.Context, key, reservation string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored, ok := s.keys[key]; ok && stored.Status == 0 && s.reservations[key] == reservation {
+		delete(s.keys, key)
+	}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) PurgeIdempotencyKeys(context.Context) (int64, error) {
+	return 0, nil
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	store := &memoryIdempotencyStore{keys: map[string]*repository.IdempotentResponse{}, reservations: map[string]string{}}
+	keys := NewIdempotencyKeys(store, time.Hour, time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	calls := 0
+	status := http.StatusCreated
+	handler := keys.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, `{"id":3}`)
+	}))
+
+	do := func(method, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/songs", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(idempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "song", `{"title":"Imagine"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Empty(t, rec.Header().Get(idempotentReplayedHeader))
+
+	rec = do(http.MethodPost, "song", `{"title":"Imagine"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, `{"id":3}`, rec.Body.String())
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "true", rec.Header().Get(idempotentReplayedHeader))
+	assert.Equal(t, 1, calls)
+
+	rec = do(http.MethodPost, "song", `{"title":"Jealous Guy"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	store.keys["in progress"] = &repository.IdempotentResponse{Fingerprint: requestFingerprint(httptest.NewRequest(http.MethodPost, "/songs", nil), []byte("{}"))}
+	rec = do(http.MethodPost, "in progress", "{}")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	// server errors are not stored, the retry runs the request again
+	status = http.StatusInternalServerError
+	do(http.MethodPost, "failed", "{}")
+	status = http.StatusCreated
+	rec = do(http.MethodPost, "failed", "{}")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, 3, calls)
+
+	// requests without a key and reads are not tracked
+	do(http.MethodPost, "", "{}")
+	do(http.MethodGet, "read", "")
+	do(http.MethodGet, "read", "")
+	assert.Equal(t, 6, calls)
+	require.NotContains(t, store.keys, "read")
+
+	rec = do(http.MethodPost, strings.Repeat("k", maxIdempotencyKeyLength+1), "{}")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,97 @@
+package delivery
+
+import (
+	"cloud-go-testtask/internal/logging"
+	"cloud-go-testtask/internal/playlistio"
+	"cloud-go-testtask/internal/usecase"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+)
+
+const maxImportFileSize = 10 << 20
+
+type ImportHandler struct {
+	uc     *usecase.ImportUseCase
+	logger *slog.Logger
+}
+
+func NewImportHandler(uc *usecase.ImportUseCase, logger *slog.Logger) *ImportHandler {
+	return &ImportHandler{
+		uc:     uc,
+		logger: logger,
+	}
+}
+
+/*
+ImportPlaylistHandler serves POST /playlists/import?format=&name=&description=
+The file is sent either as request body or as "file" field of multipart form.
+Format is taken from the query, file name or content type.
+*/
+func (h *ImportHandler) ImportPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.ImportHandler.ImportPlaylistHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received ImportPlaylist request")
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportFileSize)
+
+	var body io.Reader = r.Body
+	filename := ""
+	contentType := r.Header.Get("Content-Type")
+
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "multipart/form-data" {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			operationLogger.Warn("Failed to read file from form", slog.String("error", err.Error()))
+			http.Error(w, "invalid multipart form: file is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		body = file
+		filename = header.Filename
+		contentType = header.Header.Get("Content-Type")
+	}
+
+	params := r.URL.Query()
+
+	var format playlistio.Format
+	var err error
+	if raw := params.Get("format"); raw != "" {
+		format, err = playlistio.ParseFormat(raw)
+	} else {
+		format, err = playlistio.DetectFormat(filename, contentType)
+	}
+	if err != nil {
+		operationLogger.Warn("Unknown playlist format", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.uc.Import(r.Context(), usecase.ImportRequest{
+		Name:        params.Get("name"),
+		Description: params.Get("description"),
+		Format:      format,
+		Body:        body,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrInvalidPlaylistFile):
+			operationLogger.Warn("Invalid playlist file", slog.String("error", err.Error()))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, usecase.ErrNothingToImport):
+			operationLogger.Warn("Nothing to import", slog.Int("unresolved", len(report.Unresolved)))
+			writeJSON(w, operationLogger, http.StatusUnprocessableEntity, newImportReportResponse(report))
+		default:
+			operationLogger.Error("Failed to import playlist", slog.String("error", err.Error()))
+			http.Error(w, "failed to import playlist", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	operationLogger.Info("Playlist imported successfully", slog.Int("playlist_id", report.PlaylistID))
+	writeJSON(w, operationLogger, http.StatusCreated, newImportReportResponse(report))
+}
@@ -0,0 +1,280 @@
+package delivery
+
+import (
+	"cloud-go-testtask/internal/logging"
+	"cloud-go-testtask/internal/pagination"
+	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/usecase"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type LibraryHandler struct {
+	uc     *usecase.LibraryUseCase
+	logger *slog.Logger
+}
+
+func NewLibraryHandler(uc *usecase.LibraryUseCase, logger *slog.Logger) *LibraryHandler {
+	return &LibraryHandler{
+		uc:     uc,
+		logger: logger,
+	}
+}
+
+/*
+SearchSongsHandler serves GET /songs?q=&artist=&min_duration=&max_duration=&sort=&limit=&cursor=
+Durations are in seconds
+*/
+func (h *LibraryHandler) SearchSongsHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.LibraryHandler.SearchSongsHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received SearchSongs request")
+
+	q, err := parseSongQuery(r.URL.Query())
+	if err != nil {
+		operationLogger.Warn("Invalid query parameters", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.uc.SearchSongs(r.Context(), q)
+	if err != nil {
+		h.writeError(w, operationLogger, err)
+		return
+	}
+
+	resp := songsPageResponse{Songs: make([]songDTO, 0, len(page.Songs))}
+	for _, song := range page.Songs {
+		resp.Songs = append(resp.Songs, newSongDTO(song))
+	}
+	if page.Next != nil {
+		resp.NextCursor = page.Next.Encode()
+	}
+
+	writeJSON(w, operationLogger, http.StatusOK, resp)
+}
+
+/*
+SearchPlaylistsHandler serves GET /playlists?q=&limit=&cursor=
+*/
+func (h *LibraryHandler) SearchPlaylistsHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.LibraryHandler.SearchPlaylistsHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received SearchPlaylists request")
+
+	q, err := parsePlaylistQuery(r.URL.Query())
+	if err != nil {
+		operationLogger.Warn("Invalid query parameters", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.uc.SearchPlaylists(r.Context(), q)
+	if err != nil {
+		h.writeError(w, operationLogger, err)
+		return
+	}
+
+	resp := playlistsPageResponse{Playlists: make([]playlistInfoResponse, 0, len(page.Playlists))}
+	for _, p := range page.Playlists {
+		resp.Playlists = append(resp.Playlists, playlistInfoResponse{
+			ID:          p.ID,
+			Name:        p.Name,
+			Description: p.Description,
+			SongCount:   p.SongCount,
+			CreatedAt:   p.CreatedAt,
+		})
+	}
+	if page.Next != nil {
+		resp.NextCursor = page.Next.Encode()
+	}
+
+	writeJSON(w, operationLogger, http.StatusOK, resp)
+}
+
+func (h *LibraryHandler) CreatePlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.LibraryHandler.CreatePlaylistHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received CreatePlaylist request")
+
+	var req createPlaylistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		operationLogger.Error("Failed to decode request body", slog.String("error", err.Error()))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	id, err := h.uc.CreatePlaylist(r.Context(), req.Name, req.Description)
+	if err != nil {
+		h.writeError(w, operationLogger, err)
+		return
+	}
+
+	operationLogger.Info("Playlist created successfully", slog.Int("id", id))
+	writeJSON(w, operationLogger, http.StatusCreated, createPlaylistResponse{
+		ID:          id,
+		Name:        req.Name,
+		Description: req.Description,
+	})
+}
+
+func (h *LibraryHandler) DeletePlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.LibraryHandler.DeletePlaylistHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received DeletePlaylist request")
+
+	id, ok := parseIDParam(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	ifMatch, ok := parseIfMatch(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	if err := h.uc.DeletePlaylist(r.Context(), id, ifMatch); err != nil {
+		h.writeError(w, operationLogger, err)
+		return
+	}
+
+	operationLogger.Info("Playlist deleted successfully", slog.Int("id", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+GetPlaylistV2Handler serves GET /v2/playlists/{id}?limit=&cursor=
+*/
+func (h *LibraryHandler) GetPlaylistV2Handler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.LibraryHandler.GetPlaylistV2Handler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received GetPlaylistV2 request")
+
+	id, ok := parseIDParam(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	limit, err := intParam(params, "limit")
+	if err != nil {
+		operationLogger.Warn("Invalid query parameters", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	after, err := cursorParam(params)
+	if err != nil {
+		operationLogger.Warn("Invalid query parameters", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.uc.GetPlaylistPage(r.Context(), id, limit, after)
+	if err != nil {
+		h.writeError(w, operationLogger, err)
+		return
+	}
+
+	setETag(w, page.Version)
+	writeJSON(w, operationLogger, http.StatusOK, newPlaylistV2Response(page))
+}
+
+func (h *LibraryHandler) writeError(w http.ResponseWriter, operationLogger *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidQuery):
+		operationLogger.Warn("Invalid query", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, usecase.ErrInvalidPlaylist):
+		operationLogger.Warn("Invalid playlist", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, usecase.ErrPlaylistNotFound):
+		operationLogger.Warn("Playlist not found", slog.String("error", err.Error()))
+		http.Error(w, "playlist not found", http.StatusNotFound)
+	case errors.Is(err, usecase.ErrPlaylistAlreadyExists), errors.Is(err, usecase.ErrPlaylistInUse):
+		operationLogger.Warn("Playlist conflict", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, usecase.ErrVersionConflict):
+		operationLogger.Warn("Playlist version conflict", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	default:
+		operationLogger.Error("Library request failed", slog.String("error", err.Error()))
+		http.Error(w, "library request failed", http.StatusInternalServerError)
+	}
+}
+
+func parseSongQuery(params url.Values) (repository.SongQuery, error) {
+	q := repository.SongQuery{
+		Text:   params.Get("q"),
+		Artist: params.Get("artist"),
+		Sort:   repository.SongSort(params.Get("sort")),
+	}
+
+	var err error
+	if q.MinDuration, err = durationParam(params, "min_duration"); err != nil {
+		return q, err
+	}
+	if q.MaxDuration, err = durationParam(params, "max_duration"); err != nil {
+		return q, err
+	}
+	if q.Limit, err = intParam(params, "limit"); err != nil {
+		return q, err
+	}
+	if q.After, err = cursorParam(params); err != nil {
+		return q, err
+	}
+
+	return q, nil
+}
+
+func parsePlaylistQuery(params url.Values) (repository.PlaylistQuery, error) {
+	q := repository.PlaylistQuery{Text: params.Get("q")}
+
+	var err error
+	if q.Limit, err = intParam(params, "limit"); err != nil {
+		return q, err
+	}
+	if q.After, err = cursorParam(params); err != nil {
+		return q, err
+	}
+
+	return q, nil
+}
+
+func intParam(params url.Values, name string) (int, error) {
+	raw := params.Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %q", name, raw)
+	}
+	return n, nil
+}
+
+func durationParam(params url.Values, name string) (time.Duration, error) {
+	seconds, err := intParam(params, name)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func cursorParam(params url.Values) (*pagination.Cursor, error) {
+	raw := params.Get("cursor")
+	if raw == "" {
+		return nil, nil
+	}
+	return pagination.Decode(raw)
+}
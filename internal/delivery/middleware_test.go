@@ -0,0 +1,203 @@
+package delivery
+
+import (
+	"bytes"
+	"cloud-go-testtask/internal/leader"
+	"cloud-go-testtask/internal/logging"
+	"cloud-go-testtask/internal/metrics"
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	slow := func(status int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			http.Error(w, "failed to get playlist", status)
+		})
+	}
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		want    int
+	}{
+		{name: "server error after deadline", handler: slow(http.StatusInternalServerError), want: http.StatusGatewayTimeout},
+		{name: "client error after deadline", handler: slow(http.StatusNotFound), want: http.StatusNotFound},
+		{
+			name: "in time",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "failed to get playlist", http.StatusInternalServerError)
+			}),
+			want: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			RequestTimeout(10*time.Millisecond)(tt.handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/playlist", nil))
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New()
+	r := chi.NewRouter()
+	r.Use(Metrics(m))
+	r.Get("/songs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "song not found", http.StatusNotFound)
+	})
+
+	for _, path := range []string{"/songs/1", "/songs/2", "/unknown"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `playlist_http_requests_total{method="GET",route="/songs/{id}",status="404"} 2`)
+	assert.Contains(t, rec.Body.String(), `playlist_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+}
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID, RequestLogger(logger), Recoverer)
+	r.Post("/next", func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context(), nil).Info("Received Next request")
+	})
+	r.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("broken handler")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/next", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-42")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, "req-42", rec.Header().Get(middleware.RequestIDHeader))
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code, "panic is recovered")
+
+	var lines []map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal(line, &record))
+		lines = append(lines, record)
+	}
+	require.Len(t, lines, 4)
+
+	assert.Equal(t, "Received Next request", lines[0]["msg"])
+	assert.Equal(t, "Request served", lines[1]["msg"])
+	for _, record := range lines[:2] {
+		assert.Equal(t, "req-42", record["request_id"], "lines of one request share its ID")
+	}
+
+	assert.Equal(t, "Handler panicked", lines[2]["msg"])
+	assert.Equal(t, lines[2]["request_id"], lines[3]["request_id"])
+	assert.NotEqual(t, "req-42", lines[3]["request_id"])
+	assert.EqualValues(t, http.StatusInternalServerError, lines[3]["status"])
+}
+
+type fakeLeadership struct {
+	leading bool
+	leader  *leader.Info
+}
+
+func (f *fakeLeadership) Leading() bool {
+	return f.leading
+}
+
+func (f *fakeLeadership) Leader(context.Context) (*leader.Info, error) {
+	if f.leader == nil {
+		return nil, leader.ErrNoLeader
+	}
+	return f.leader, nil
+}
+
+func TestForwardToLeader(t *testing.T) {
+	local := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "served locally")
+	})
+	leaderServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "1", r.Header.Get(forwardedHeader))
+		assert.Equal(t, "req-1", r.Header.Get(middleware.RequestIDHeader), "logs of both instances share the request ID")
+		_, _ = io.WriteString(w, "served by leader "+r.Method+" "+r.URL.Path)
+	}))
+	defer leaderServer.Close()
+
+	tests := []struct {
+		name       string
+		leadership *fakeLeadership
+		forwarded  bool
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "leader serves",
+			leadership: &fakeLeadership{leading: true},
+			wantStatus: http.StatusOK,
+			wantBody:   "served locally",
+		},
+		{
+			name:       "follower forwards",
+			leadership: &fakeLeadership{leader: &leader.Info{InstanceID: "app-2", Address: leaderServer.URL}},
+			wantStatus: http.StatusOK,
+			wantBody:   "served by leader POST /next",
+		},
+		{
+			name:       "no leader during failover",
+			leadership: &fakeLeadership{},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "leader is unreachable",
+			leadership: &fakeLeadership{leader: &leader.Info{InstanceID: "app-2", Address: "http://127.0.0.1:1"}},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "forwarded request is not forwarded again",
+			leadership: &fakeLeadership{leader: &leader.Info{InstanceID: "app-2", Address: leaderServer.URL}},
+			forwarded:  true,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			r.Use(middleware.RequestID)
+			r.With(ForwardToLeader(tt.leadership, slog.Default())).Post("/next", local)
+
+			req := httptest.NewRequest(http.MethodPost, "/next", nil)
+			req.Header.Set(middleware.RequestIDHeader, "req-1")
+			if tt.forwarded {
+				req.Header.Set(forwardedHeader, "1")
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusServiceUnavailable {
+				assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
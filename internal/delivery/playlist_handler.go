@@ -1,6 +1,7 @@
 package delivery
 
 import (
+	"cloud-go-testtask/internal/logging"
 	"cloud-go-testtask/internal/usecase"
 	"encoding/json"
 	"errors"
@@ -23,15 +24,9 @@ func NewPlaylistHandler(uc *usecase.PlaylistUseCase, logger *slog.Logger) *Playl
 	}
 }
 
-type addSongRequest struct {
-	Title    string `json:"title"`
-	Artist   string `json:"artist"`
-	Duration int    `json:"duration"`
-}
-
 func (h *PlaylistHandler) AddSongHandler(w http.ResponseWriter, r *http.Request) {
 	const op = "delivery.PlaylistHandler.AddSongHandler"
-	operationLogger := h.logger.With(slog.String("op", op))
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
 
 	operationLogger.Info("Received AddSong request")
 
@@ -52,7 +47,7 @@ func (h *PlaylistHandler) AddSongHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err := h.uc.AddSong(req.Title, req.Artist, time.Duration(req.Duration)*time.Second)
+	song, err := h.uc.AddSong(r.Context(), req.Title, req.Artist, time.Duration(req.Duration)*time.Second)
 	if err != nil {
 
 		switch {
@@ -77,16 +72,102 @@ func (h *PlaylistHandler) AddSongHandler(w http.ResponseWriter, r *http.Request)
 		slog.String("artist", req.Artist),
 	)
 
-	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, operationLogger, http.StatusCreated, newSongDTO(song))
+}
+
+/*
+UpdateSongHandler serves PATCH /songs/{id}, omitted fields keep their values.
+With If-Match the song is updated only if it still has one of the listed versions
+*/
+func (h *PlaylistHandler) UpdateSongHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.PlaylistHandler.UpdateSongHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received UpdateSong request")
+
+	id, ok := parseIDParam(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	ifMatch, ok := parseIfMatch(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	var req addSongRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		operationLogger.Error("Failed to decode request body", slog.String("error", err.Error()))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	song, err := h.uc.UpdateSong(r.Context(), id, req.Title, req.Artist, time.Duration(req.Duration)*time.Second, ifMatch)
+	if err != nil {
+		h.writeSongError(w, operationLogger, err)
+		return
+	}
+
+	operationLogger.Info("Song updated successfully", slog.Int("id", id))
+	setETag(w, song.Version)
+	writeJSON(w, operationLogger, http.StatusOK, newSongDTO(song))
+}
+
+/*
+DeleteSongHandler serves DELETE /songs/{id}, with If-Match only one of the listed versions is removed
+*/
+func (h *PlaylistHandler) DeleteSongHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.PlaylistHandler.DeleteSongHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received DeleteSong request")
+
+	id, ok := parseIDParam(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	ifMatch, ok := parseIfMatch(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	if err := h.uc.DeleteSong(r.Context(), id, ifMatch); err != nil {
+		h.writeSongError(w, operationLogger, err)
+		return
+	}
+
+	operationLogger.Info("Song deleted successfully", slog.Int("id", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *PlaylistHandler) writeSongError(w http.ResponseWriter, operationLogger *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrUpdateSongNotFound), errors.Is(err, usecase.ErrDeleteSongNotFound):
+		operationLogger.Warn("Song not found", slog.String("error", err.Error()))
+		http.Error(w, "song not found", http.StatusNotFound)
+	case errors.Is(err, usecase.ErrInvalidSong):
+		operationLogger.Warn("Invalid song parameters", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, usecase.ErrCannotDeleteCurrentSong):
+		operationLogger.Warn("Cannot delete current song", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, usecase.ErrVersionConflict):
+		operationLogger.Warn("Song version conflict", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	default:
+		operationLogger.Error("Song operation failed", slog.String("error", err.Error()))
+		http.Error(w, "song operation failed", http.StatusInternalServerError)
+	}
 }
 
 func (h *PlaylistHandler) PlayHandler(w http.ResponseWriter, r *http.Request) {
 	const op = "delivery.PlaylistHandler.PlayHandler"
-	operationLogger := h.logger.With(slog.String("op", op))
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
 
 	operationLogger.Info("Received Play request")
 
-	if err := h.uc.Play(); err != nil {
+	if err := h.uc.Play(r.Context()); err != nil {
 		operationLogger.Error("Failed to start playback", slog.String("error", err.Error()))
 		http.Error(w, "failed to play: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -98,11 +179,11 @@ func (h *PlaylistHandler) PlayHandler(w http.ResponseWriter, r *http.Request) {
 
 func (h *PlaylistHandler) PauseHandler(w http.ResponseWriter, r *http.Request) {
 	const op = "delivery.PlaylistHandler.PauseHandler"
-	operationLogger := h.logger.With(slog.String("op", op))
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
 
 	operationLogger.Info("Received Pause request")
 
-	if err := h.uc.Pause(); err != nil {
+	if err := h.uc.Pause(r.Context()); err != nil {
 		operationLogger.Warn("Failed to pause playback", slog.String("error", err.Error()))
 		http.Error(w, "failed to pause: "+err.Error(), http.StatusConflict)
 		return
@@ -114,11 +195,11 @@ func (h *PlaylistHandler) PauseHandler(w http.ResponseWriter, r *http.Request) {
 
 func (h *PlaylistHandler) NextHandler(w http.ResponseWriter, r *http.Request) {
 	const op = "delivery.PlaylistHandler.NextHandler"
-	operationLogger := h.logger.With(slog.String("op", op))
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
 
 	operationLogger.Info("Received Next request")
 
-	if err := h.uc.Next(); err != nil {
+	if err := h.uc.Next(r.Context()); err != nil {
 		operationLogger.Warn("Failed to move to next song", slog.String("error", err.Error()))
 		http.Error(w, "failed to next: "+err.Error(), http.StatusNotFound)
 		return
@@ -130,11 +211,11 @@ func (h *PlaylistHandler) NextHandler(w http.ResponseWriter, r *http.Request) {
 
 func (h *PlaylistHandler) PrevHandler(w http.ResponseWriter, r *http.Request) {
 	const op = "delivery.PlaylistHandler.PrevHandler"
-	operationLogger := h.logger.With(slog.String("op", op))
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
 
 	operationLogger.Info("Received Prev request")
 
-	if err := h.uc.Prev(); err != nil {
+	if err := h.uc.Prev(r.Context()); err != nil {
 		operationLogger.Warn("Failed to move to previous song", slog.String("error", err.Error()))
 		http.Error(w, "failed to prev: "+err.Error(), http.StatusNotFound)
 		return
@@ -146,11 +227,11 @@ func (h *PlaylistHandler) PrevHandler(w http.ResponseWriter, r *http.Request) {
 
 func (h *PlaylistHandler) GetCurrentSongHandler(w http.ResponseWriter, r *http.Request) {
 	const op = "delivery.PlaylistHandler.GetCurrentSongHandler"
-	operationLogger := h.logger.With(slog.String("op", op))
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
 
 	operationLogger.Info("Received GetCurrentSong request")
 
-	song, err := h.uc.GetCurrentSong()
+	song, err := h.uc.GetCurrentSong(r.Context())
 	if err != nil {
 		operationLogger.Warn("Failed to get current song", slog.String("error", err.Error()))
 		http.Error(w, "no current song: "+err.Error(), http.StatusNotFound)
@@ -161,46 +242,120 @@ func (h *PlaylistHandler) GetCurrentSongHandler(w http.ResponseWriter, r *http.R
 		slog.String("artist", song.Artist),
 	)
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(song); err != nil {
-		operationLogger.Error("Failed to encode current song to JSON", slog.String("error", err.Error()))
-		http.Error(w, "failed to encode song", http.StatusInternalServerError)
+	setETag(w, song.Version)
+	writeJSON(w, operationLogger, http.StatusOK, newSongDTO(song))
+}
+
+/*
+SeekHandler serves POST /seek with body {"position": seconds}
+*/
+func (h *PlaylistHandler) SeekHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.PlaylistHandler.SeekHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received Seek request")
+
+	var req seekRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		operationLogger.Error("Failed to decode request body", slog.String("error", err.Error()))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.uc.Seek(r.Context(), time.Duration(req.Position)*time.Second); err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrInvalidSeek):
+			operationLogger.Warn("Invalid seek position", slog.String("error", err.Error()))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, usecase.ErrNoCurrentSong):
+			operationLogger.Warn("No current song", slog.String("error", err.Error()))
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			operationLogger.Error("Failed to seek", slog.String("error", err.Error()))
+			http.Error(w, "failed to seek", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	operationLogger.Info("Seek completed successfully", slog.Int("position", req.Position))
+	w.WriteHeader(http.StatusOK)
+}
+
+/*
+MoveSongHandler serves POST /playlist/move with body {"from": 3, "to": 1}, positions are 1-based.
+With If-Match the playlist is reordered only if it still has one of the listed versions, see GET /playlist
+*/
+func (h *PlaylistHandler) MoveSongHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.PlaylistHandler.MoveSongHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received MoveSong request")
+
+	ifMatch, ok := parseIfMatch(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	var req moveSongRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		operationLogger.Error("Failed to decode request body", slog.String("error", err.Error()))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.uc.MoveSong(r.Context(), req.From, req.To, ifMatch); err != nil {
+		if errors.Is(err, usecase.ErrInvalidPosition) {
+			operationLogger.Warn("Invalid positions", slog.String("error", err.Error()))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, usecase.ErrVersionConflict) {
+			operationLogger.Warn("Playlist version conflict", slog.String("error", err.Error()))
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+			return
+		}
+		operationLogger.Error("Failed to move song", slog.String("error", err.Error()))
+		http.Error(w, "failed to move song", http.StatusInternalServerError)
+		return
+	}
+
+	operationLogger.Info("Song moved successfully", slog.Int("from", req.From), slog.Int("to", req.To))
+	w.WriteHeader(http.StatusOK)
+}
+
+/*
+StateHandler serves GET /state: playback status, position and the current song
+*/
+func (h *PlaylistHandler) StateHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.PlaylistHandler.StateHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	state, err := h.uc.State(r.Context())
+	if err != nil {
+		operationLogger.Error("Failed to get playback state", slog.String("error", err.Error()))
+		http.Error(w, "failed to get playback state", http.StatusInternalServerError)
 		return
 	}
 
+	writeJSON(w, operationLogger, http.StatusOK, newPlaybackStateResponse(state))
 }
 
 func (h *PlaylistHandler) GetPlaylistHandler(w http.ResponseWriter, r *http.Request) {
 	const op = "delivery.PlaylistHandler.GetPlaylistHandler"
-	operationLogger := h.logger.With(slog.String("op", op))
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
 
 	operationLogger.Info("Received GetPlaylist request")
 
-	playlist, err := h.uc.GetPlaylist()
+	playlist, err := h.uc.GetPlaylist(r.Context())
 	if err != nil {
 		operationLogger.Error("Failed to get playlist", slog.String("error", err.Error()))
 		http.Error(w, "failed to get playlist: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	var sogs []map[string]interface{}
-	current := playlist.GetHead()
-	for current != nil {
-		if current.Song != nil {
-			sogs = append(sogs, map[string]interface{}{
-				"id":       current.Song.ID,
-				"title":    current.Song.Title,
-				"artist":   current.Song.Artist,
-				"duration": int(current.Song.Duration.Seconds()),
-			})
-		}
-		current = current.Next
-	}
-
-	resp := map[string]interface{}{
-		"sogs": sogs,
-	}
+	resp := newLegacyPlaylistResponse(playlist)
 
+	setETag(w, playlist.Version)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		operationLogger.Error("Failed to encode playlist to JSON", slog.String("error", err.Error()))
@@ -208,3 +363,19 @@ func (h *PlaylistHandler) GetPlaylistHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 }
+
+func (h *PlaylistHandler) ReloadPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.PlaylistHandler.ReloadPlaylistHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received ReloadPlaylist request")
+
+	if err := h.uc.ReloadPlaylist(r.Context()); err != nil {
+		operationLogger.Error("Failed to reload playlist", slog.String("error", err.Error()))
+		http.Error(w, "failed to reload playlist: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	operationLogger.Info("Playlist reloaded successfully")
+	w.WriteHeader(http.StatusOK)
+}
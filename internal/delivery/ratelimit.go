@@ -0,0 +1,263 @@
+package delivery
+
+import (
+	"cloud-go-testtask/internal/logging"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const rateLimitSweepInterval = time.Minute // how often buckets of idle clients are dropped
+
+var errInvalidRateLimit = errors.New("rate must not be negative and burst must be at least 1 when rate is set")
+
+/*
+RateLimit is a token bucket: Burst requests at once, then Rate requests per second. Zero Rate disables the limit
+*/
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+func (l RateLimit) validate() error {
+	if l.Rate < 0 || math.IsNaN(l.Rate) || math.IsInf(l.Rate, 0) || (l.Rate > 0 && l.Burst < 1) {
+		return errInvalidRateLimit
+	}
+	return nil
+}
+
+/*
+RateLimits are the budgets of a client: Control for playback commands, Read for GET requests
+*/
+type RateLimits struct {
+	Control RateLimit `json:"control"`
+	Read    RateLimit `json:"read"`
+}
+
+type rateBudget string
+
+const (
+	controlBudget rateBudget = "control"
+	readBudget    rateBudget = "read"
+)
+
+type bucketKey struct {
+	budget rateBudget
+	client string
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+/*
+refill adds the tokens earned since the last request, never more than burst
+*/
+func (b *tokenBucket) refill(limit RateLimit, now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * limit.Rate
+		b.last = now
+	}
+	b.tokens = math.Min(b.tokens, float64(limit.Burst))
+}
+
+/*
+RateLimiter limits requests of every client by its IP address: the peer, or the client a trusted proxy reports.
+Each client has a budget for playback commands and one for reads, so polling /state does not use up /next.
+Buckets live in the memory of the instance: with several replicas followers and the leader limit the requests
+they serve each, playback commands of all replicas end up on the leader. Limits can be changed at runtime,
+clients keep their buckets
+*/
+type RateLimiter struct {
+	mu        sync.Mutex
+	limits    RateLimits
+	buckets   map[bucketKey]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+	logger    *slog.Logger
+}
+
+func NewRateLimiter(limits RateLimits, logger *slog.Logger) (*RateLimiter, error) {
+	if err := limits.Control.validate(); err != nil {
+		return nil, err
+	}
+	if err := limits.Read.validate(); err != nil {
+		return nil, err
+	}
+	return &RateLimiter{
+		limits:    limits,
+		buckets:   make(map[bucketKey]*tokenBucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+		logger:    logger,
+	}, nil
+}
+
+func (l *RateLimiter) Limits() RateLimits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limits
+}
+
+/*
+SetLimits replaces the limits, they apply to the next request of every client
+*/
+func (l *RateLimiter) SetLimits(limits RateLimits) error {
+	if err := limits.Control.validate(); err != nil {
+		return err
+	}
+	if err := limits.Read.validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+	return nil
+}
+
+/*
+Control limits playback commands with the control budget
+*/
+func (l *RateLimiter) Control(next http.Handler) http.Handler {
+	return l.limit(controlBudget, next)
+}
+
+/*
+Read limits GET and HEAD requests with the read budget, other methods pass
+*/
+func (l *RateLimiter) Read(next http.Handler) http.Handler {
+	limited := l.limit(readBudget, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limited.ServeHTTP(w, r)
+	})
+}
+
+func (l *RateLimiter) limit(budget rateBudget, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := rateLimitClient(r)
+		retryAfter, ok := l.take(bucketKey{budget: budget, client: client})
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		const op = "delivery.RateLimiter.limit"
+		logging.FromContext(r.Context(), l.logger).Warn("Rate limit exceeded",
+			slog.String("op", op),
+			slog.String("budget", string(budget)),
+			slog.String("client", client),
+			slog.Duration("retry_after", retryAfter),
+		)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	})
+}
+
+/*
+take spends a token of the client's bucket, without one it tells how long until the next token
+*/
+func (l *RateLimiter) take(key bucketKey) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limits.Control
+	if key.budget == readBudget {
+		limit = l.limits.Read
+	}
+	if limit.Rate == 0 {
+		return 0, true
+	}
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.refill(limit, now)
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - bucket.tokens) / limit.Rate * float64(time.Second)), false
+}
+
+/*
+sweep drops buckets which are full again, a new bucket of the client starts full as well
+*/
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, bucket := range l.buckets {
+		limit := l.limits.Control
+		if key.budget == readBudget {
+			limit = l.limits.Read
+		}
+		bucket.refill(limit, now)
+		if limit.Rate == 0 || bucket.tokens >= float64(limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+/*
+rateLimitClient is the IP address RealIP has verified. Headers and credentials the client sends
+are not checked here, so a client can't pick another bucket with them
+*/
+func rateLimitClient(r *http.Request) string {
+	if addr, ok := remoteAddr(r.RemoteAddr); ok {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
+
+/*
+LimitsHandler serves GET /admin/rate-limits
+*/
+func (l *RateLimiter) LimitsHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.RateLimiter.LimitsHandler"
+	operationLogger := logging.FromContext(r.Context(), l.logger).With(slog.String("op", op))
+
+	writeJSON(w, operationLogger, http.StatusOK, l.Limits())
+}
+
+/*
+SetLimitsHandler serves PUT /admin/rate-limits, both budgets are replaced
+*/
+func (l *RateLimiter) SetLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.RateLimiter.SetLimitsHandler"
+	operationLogger := logging.FromContext(r.Context(), l.logger).With(slog.String("op", op))
+
+	var req RateLimits
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		operationLogger.Error("Failed to decode request body", slog.String("error", err.Error()))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := l.SetLimits(req); err != nil {
+		operationLogger.Warn("Invalid rate limits", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	operationLogger.Info("Rate limits changed",
+		slog.Float64("control_rate", req.Control.Rate),
+		slog.Int("control_burst", req.Control.Burst),
+		slog.Float64("read_rate", req.Read.Rate),
+		slog.Int("read_burst", req.Read.Burst),
+	)
+	writeJSON(w, operationLogger, http.StatusOK, req)
+}
@@ -0,0 +1,210 @@
+package delivery
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/usecase"
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", " 192.0.2.1 ", ""})
+	require.NoError(t, err)
+	_, err = ParseTrustedProxies([]string{"proxy.local"})
+	assert.Error(t, err)
+
+	var got string
+	handler := RealIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = r.RemoteAddr }))
+
+	tests := []struct {
+		name    string
+		peer    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "no proxy", peer: "203.0.113.5:1234", want: "203.0.113.5:1234"},
+		{name: "untrusted peer", peer: "203.0.113.5:1234", headers: map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2"}, want: "203.0.113.5:1234"},
+		{name: "trusted proxy", peer: "10.1.2.3:1234", headers: map[string]string{"X-Forwarded-For": "198.51.100.1"}, want: "198.51.100.1"},
+		{name: "forged hops left of the client", peer: "10.1.2.3:1234", headers: map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1, 192.0.2.1"}, want: "198.51.100.1"},
+		{name: "only proxies", peer: "10.1.2.3:1234", headers: map[string]string{"X-Forwarded-For": "10.0.0.9, 192.0.2.1"}, want: "10.0.0.9"},
+		{name: "X-Real-IP", peer: "192.0.2.1:1234", headers: map[string]string{"X-Real-IP": "198.51.100.2"}, want: "198.51.100.2"},
+		{name: "garbage", peer: "10.1.2.3:1234", headers: map[string]string{"X-Forwarded-For": "not-an-ip"}, want: "10.1.2.3:1234"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/state", nil)
+			req.RemoteAddr = tt.peer
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAdminRoutesRequireAuth(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	limiter, err := NewRateLimiter(RateLimits{}, logger)
+	require.NoError(t, err)
+	opts := RouterOptions{
+		Health:      NewHealthHandler(nil, nil, logger),
+		Admin:       NewAdminHandler(nil, logger),
+		RateLimiter: limiter,
+		AdminUsers:  map[string]string{"admin": "secret"},
+	}
+	router := NewRouter(nil, nil, nil, nil, nil, opts)
+
+	do := func(user, password string) int {
+		req := httptest.NewRequest(http.MethodPut, "/admin/rate-limits", strings.NewReader(`{"control":{"rate":1,"burst":1}}`))
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, do("", ""))
+	assert.Equal(t, http.StatusUnauthorized, do("admin", "wrong"))
+	assert.Equal(t, RateLimits{}, limiter.Limits())
+	assert.Equal(t, http.StatusOK, do("admin", "secret"))
+	assert.Equal(t, RateLimit{Rate: 1, Burst: 1}, limiter.Limits().Control)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/state", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "debug state is an admin route")
+
+	// without credentials the routes are not served at all
+	opts.AdminUsers = nil
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/admin/reconcile", nil),
+		httptest.NewRequest(http.MethodGet, "/debug/state", nil),
+	} {
+		rec := httptest.NewRecorder()
+		NewRouter(nil, nil, nil, nil, nil, opts).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotFound, rec.Code, req.URL.Path)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter, err := NewRateLimiter(RateLimits{
+		Control: RateLimit{Rate: 0.5, Burst: 2},
+		Read:    RateLimit{Rate: 10, Burst: 1},
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	r := chi.NewRouter()
+	r.Use(limiter.Read)
+	r.With(limiter.Control).Post("/next", ok)
+	r.Get("/state", ok)
+	r.Post("/songs", ok)
+	r.Get("/admin/rate-limits", limiter.LimitsHandler)
+	r.Put("/admin/rate-limits", limiter.SetLimitsHandler)
+
+	do := func(method, target, peer, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if peer != "" {
+			req.RemoteAddr = peer
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/next", "", "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/next", "", "").Code)
+	rec := do(http.MethodPost, "/next", "", "")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+	// budgets and clients are separate, other writes are not limited
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/state", "", "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/next", "192.0.2.7:4000", "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/songs", "", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodGet, "/state", "", "").Code)
+
+	// credentials and forwarding headers of the client don't pick another bucket
+	req := httptest.NewRequest(http.MethodPost, "/next", nil)
+	req.SetBasicAuth("alice", "secret")
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	rec = httptest.NewRecorder()
+	RealIP(nil)(r).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	now = now.Add(2 * time.Second)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/next", "", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "/next", "", "").Code)
+
+	rec = do(http.MethodPut, "/admin/rate-limits", "", `{"control":{"rate":0,"burst":0},"read":{"rate":-1,"burst":1}}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = do(http.MethodPut, "/admin/rate-limits", "", `{"control":{"rate":0,"burst":0},"read":{"rate":100,"burst":100}}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, RateLimits{Read: RateLimit{Rate: 100, Burst: 100}}, limiter.Limits())
+
+	// zero rate turns the budget off at once
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, do(http.MethodPost, "/next", "", "").Code)
+	}
+
+	// buckets of idle clients are dropped
+	now = now.Add(rateLimitSweepInterval)
+	do(http.MethodGet, "/state", "", "")
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestThrottledIdempotentRetry(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rdbmsRepo := usecase.NewMockPlaylistRepo()
+	for id := 1; id <= 3; id++ {
+		require.NoError(t, rdbmsRepo.AddSong(ctx, &entity.Song{ID: id, Title: "Song", Artist: "Artist", Duration: 5 * time.Second}))
+	}
+	uc := usecase.NewPlaylistUseCase(rdbmsRepo, usecase.NewMockPlaylistRepo(), logger)
+	require.NoError(t, uc.InitCache(ctx))
+	defer uc.Shutdown(ctx)
+
+	limiter, err := NewRateLimiter(RateLimits{Control: RateLimit{Rate: 1, Burst: 1}}, logger)
+	require.NoError(t, err)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	store := &memoryIdempotencyStore{keys: map[string]*repository.IdempotentResponse{}, reservations: map[string]string{}}
+	router := NewRouter(NewPlaylistHandler(uc, logger), nil, nil, nil, nil, RouterOptions{
+		RateLimiter: limiter,
+		Idempotency: NewIdempotencyKeys(store, time.Hour, time.Minute, logger),
+	})
+
+	next := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/next", nil)
+		req.Header.Set(idempotencyKeyHeader, key)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	require.Equal(t, http.StatusOK, next("first").Code)
+	rec := next("second")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	// the throttled request is not stored, its retry is served once the bucket has refilled
+	now = now.Add(time.Second)
+	rec = next("second")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(idempotentReplayedHeader))
+	state, err := uc.State(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, state.Song.ID)
+}
@@ -1,24 +1,132 @@
 package delivery
 
 import (
+	"cloud-go-testtask/internal/metrics"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
 	"net/http"
+	"net/netip"
+	"time"
 )
 
-// TODO: Implement all CRUD methods
+/*
+RouterOptions are settings shared by all routes
+*/
+type RouterOptions struct {
+	RequestTimeout time.Duration    // zero disables the deadline
+	Metrics        *metrics.Metrics // nil disables /metrics and request instrumentation
+	Logger         *slog.Logger     // nil disables access log, handlers log without request ID
+	Health         *HealthHandler   // nil disables /healthz, /readyz and /debug/state
+	Admin          *AdminHandler    // nil disables /admin routes
+	Leadership     Leadership       // nil: this instance always drives playback, nothing is forwarded
+	Idempotency    *IdempotencyKeys // nil disables Idempotency-Key support
+	RateLimiter    *RateLimiter     // nil disables rate limits and /admin/rate-limits
+	// TrustedProxies may report the client in X-Forwarded-For and X-Real-IP, e.g. the load balancer and
+	// the other replicas, which forward playback commands. Nil trusts nobody, the peer is the client
+	TrustedProxies []netip.Prefix
+	AdminUsers     map[string]string // user to password of Basic auth of /admin routes and /debug/state, empty disables them
+}
 
-func NewRouter(h *PlaylistHandler) http.Handler {
+func NewRouter(h *PlaylistHandler, sh *SmartPlaylistHandler, lh *LibraryHandler, ih *ImportHandler, eh *ExportHandler, opts RouterOptions) http.Handler {
 	r := chi.NewRouter()
+	r.Use(middleware.RequestID, RealIP(opts.TrustedProxies), Tracing())
+	if opts.Logger != nil {
+		r.Use(RequestLogger(opts.Logger))
+	}
+	r.Use(Recoverer)
+	if opts.Metrics != nil {
+		r.Use(Metrics(opts.Metrics))
+		r.Handle("/metrics", opts.Metrics.Handler())
+	}
+	if opts.Health != nil { // probes have their own timeout
+		r.Get("/healthz", opts.Health.HealthzHandler)
+		r.Get("/readyz", opts.Health.ReadyzHandler)
+	}
+
+	r.Group(func(r chi.Router) {
+		if opts.RequestTimeout > 0 {
+			r.Use(RequestTimeout(opts.RequestTimeout))
+		}
+		if opts.RateLimiter != nil { // a replayed retry costs a token as well
+			r.Use(opts.RateLimiter.Read)
+		}
+		if opts.Idempotency != nil { // before forwarding, so followers answer retries of forwarded requests too
+			r.Use(opts.Idempotency.Middleware)
+		}
+		var playback, control []func(http.Handler) http.Handler
+		if opts.Leadership != nil {
+			playback = append(playback, ForwardToLeader(opts.Leadership, h.logger))
+		}
+		if opts.RateLimiter != nil { // after forwarding, the leader limits commands sent to every replica
+			control = append(control, opts.RateLimiter.Control)
+		}
+		apiRoutes(r, h, sh, lh, ih, eh, playback, control)
+		if len(opts.AdminUsers) > 0 {
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.BasicAuth("admin", opts.AdminUsers))
+				if opts.Health != nil { // the consistency check holds playback and reads the whole playlist
+					r.Get("/debug/state", opts.Health.DebugStateHandler)
+				}
+				if opts.Admin != nil {
+					r.Post("/admin/reconcile", opts.Admin.ReconcileHandler)
+					if opts.RateLimiter != nil {
+						r.Get("/admin/rate-limits", opts.RateLimiter.LimitsHandler)
+						r.Put("/admin/rate-limits", opts.RateLimiter.SetLimitsHandler)
+					}
+				}
+			})
+		}
+	})
+
+	return r
+}
+
+/*
+apiRoutes registers the API, playback middlewares wrap the routes which drive or report playback,
+control middlewares wrap the playback commands after them
+*/
+func apiRoutes(r chi.Router, h *PlaylistHandler, sh *SmartPlaylistHandler, lh *LibraryHandler, ih *ImportHandler, eh *ExportHandler, playback, control []func(http.Handler) http.Handler) {
 
 	r.Post("/songs", h.AddSongHandler)
+	r.Get("/songs", lh.SearchSongsHandler)
+	r.Patch("/songs/{id}", h.UpdateSongHandler)
+	r.Delete("/songs/{id}", h.DeleteSongHandler)
 
-	r.Get("/playlist", h.GetPlaylistHandler)
-	r.Get("/current", h.GetCurrentSongHandler)
+	r.Post("/playlists", lh.CreatePlaylistHandler)
+	r.Get("/playlists", lh.SearchPlaylistsHandler)
+	r.Delete("/playlists/{id}", lh.DeletePlaylistHandler)
+	r.Post("/playlists/import", ih.ImportPlaylistHandler)
+	r.Get("/playlists/{id}/export", eh.ExportPlaylistHandler)
 
-	r.Post("/play", h.PlayHandler)
-	r.Post("/pause", h.PauseHandler)
-	r.Post("/next", h.NextHandler)
-	r.Post("/prev", h.PrevHandler)
+	r.Get("/v2/playlists/{id}", lh.GetPlaylistV2Handler)
 
-	return r
+	r.Get("/playlist", h.GetPlaylistHandler) // v1, kept for existing clients
+	r.Post("/playlist/move", h.MoveSongHandler)
+
+	r.Group(func(r chi.Router) {
+		r.Use(playback...)
+		r.Post("/playlist/reload", h.ReloadPlaylistHandler)
+		r.Get("/current", h.GetCurrentSongHandler)
+		r.Get("/state", h.StateHandler)
+
+		r.Group(func(r chi.Router) {
+			r.Use(control...)
+			r.Post("/play", h.PlayHandler)
+			r.Post("/pause", h.PauseHandler)
+			r.Post("/next", h.NextHandler)
+			r.Post("/prev", h.PrevHandler)
+			r.Post("/seek", h.SeekHandler)
+		})
+	})
+
+	r.Route("/smart-playlists", func(r chi.Router) {
+		r.Post("/", sh.CreateHandler)
+		r.Get("/", sh.ListHandler)
+		r.Get("/{id}", sh.GetHandler)
+		r.Put("/{id}", sh.UpdateHandler)
+		r.Delete("/{id}", sh.DeleteHandler)
+		r.Post("/{id}/refresh", sh.RefreshHandler)
+		r.With(playback...).With(control...).Post("/{id}/play", sh.PlayHandler)
+	})
 }
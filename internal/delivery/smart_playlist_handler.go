@@ -0,0 +1,219 @@
+package delivery
+
+import (
+	"cloud-go-testtask/internal/logging"
+	"cloud-go-testtask/internal/usecase"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+type SmartPlaylistHandler struct {
+	uc     *usecase.SmartPlaylistUseCase
+	logger *slog.Logger
+}
+
+func NewSmartPlaylistHandler(uc *usecase.SmartPlaylistUseCase, logger *slog.Logger) *SmartPlaylistHandler {
+	return &SmartPlaylistHandler{
+		uc:     uc,
+		logger: logger,
+	}
+}
+
+func (h *SmartPlaylistHandler) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.SmartPlaylistHandler.CreateHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received CreateSmartPlaylist request")
+
+	var req smartPlaylistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		operationLogger.Error("Failed to decode request body", slog.String("error", err.Error()))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sp := req.toEntity()
+	if _, err := h.uc.Create(r.Context(), sp); err != nil {
+		h.writeError(w, operationLogger, err)
+		return
+	}
+
+	operationLogger.Info("Smart playlist created successfully", slog.Int("id", sp.ID))
+	setETag(w, sp.Version)
+	writeJSON(w, operationLogger, http.StatusCreated, newSmartPlaylistResponse(sp, nil))
+}
+
+func (h *SmartPlaylistHandler) ListHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.SmartPlaylistHandler.ListHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received ListSmartPlaylists request")
+
+	playlists, err := h.uc.List(r.Context())
+	if err != nil {
+		h.writeError(w, operationLogger, err)
+		return
+	}
+
+	resp := make([]smartPlaylistResponse, 0, len(playlists))
+	for _, sp := range playlists {
+		resp = append(resp, newSmartPlaylistResponse(sp, nil))
+	}
+
+	writeJSON(w, operationLogger, http.StatusOK, resp)
+}
+
+func (h *SmartPlaylistHandler) GetHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.SmartPlaylistHandler.GetHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received GetSmartPlaylist request")
+
+	id, ok := parseIDParam(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	sp, err := h.uc.Get(r.Context(), id)
+	if err != nil {
+		h.writeError(w, operationLogger, err)
+		return
+	}
+
+	playlist, err := h.uc.Materialize(r.Context(), id)
+	if err != nil {
+		h.writeError(w, operationLogger, err)
+		return
+	}
+
+	setETag(w, sp.Version)
+	writeJSON(w, operationLogger, http.StatusOK, newSmartPlaylistResponse(sp, playlist))
+}
+
+func (h *SmartPlaylistHandler) UpdateHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.SmartPlaylistHandler.UpdateHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received UpdateSmartPlaylist request")
+
+	id, ok := parseIDParam(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	ifMatch, ok := parseIfMatch(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	var req smartPlaylistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		operationLogger.Error("Failed to decode request body", slog.String("error", err.Error()))
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sp := req.toEntity()
+	sp.ID = id
+	if err := h.uc.Update(r.Context(), sp, ifMatch); err != nil {
+		h.writeError(w, operationLogger, err)
+		return
+	}
+
+	operationLogger.Info("Smart playlist updated successfully", slog.Int("id", id))
+	setETag(w, sp.Version)
+	writeJSON(w, operationLogger, http.StatusOK, newSmartPlaylistResponse(sp, nil))
+}
+
+func (h *SmartPlaylistHandler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.SmartPlaylistHandler.DeleteHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received DeleteSmartPlaylist request")
+
+	id, ok := parseIDParam(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	ifMatch, ok := parseIfMatch(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	if err := h.uc.Delete(r.Context(), id, ifMatch); err != nil {
+		h.writeError(w, operationLogger, err)
+		return
+	}
+
+	operationLogger.Info("Smart playlist deleted successfully", slog.Int("id", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *SmartPlaylistHandler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.SmartPlaylistHandler.RefreshHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received RefreshSmartPlaylist request")
+
+	id, ok := parseIDParam(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	sp, err := h.uc.Get(r.Context(), id)
+	if err != nil {
+		h.writeError(w, operationLogger, err)
+		return
+	}
+
+	playlist, err := h.uc.Refresh(r.Context(), id)
+	if err != nil {
+		h.writeError(w, operationLogger, err)
+		return
+	}
+
+	writeJSON(w, operationLogger, http.StatusOK, newSmartPlaylistResponse(sp, playlist))
+}
+
+func (h *SmartPlaylistHandler) PlayHandler(w http.ResponseWriter, r *http.Request) {
+	const op = "delivery.SmartPlaylistHandler.PlayHandler"
+	operationLogger := logging.FromContext(r.Context(), h.logger).With(slog.String("op", op))
+
+	operationLogger.Info("Received PlaySmartPlaylist request")
+
+	id, ok := parseIDParam(w, r, operationLogger)
+	if !ok {
+		return
+	}
+
+	if err := h.uc.Play(r.Context(), id); err != nil {
+		h.writeError(w, operationLogger, err)
+		return
+	}
+
+	operationLogger.Info("Smart playlist playback started", slog.Int("id", id))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *SmartPlaylistHandler) writeError(w http.ResponseWriter, operationLogger *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrSmartPlaylistNotFound):
+		operationLogger.Warn("Smart playlist not found", slog.String("error", err.Error()))
+		http.Error(w, "smart playlist not found", http.StatusNotFound)
+	case errors.Is(err, usecase.ErrInvalidSmartPlaylist):
+		operationLogger.Warn("Invalid smart playlist", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, usecase.ErrEmptySmartPlaylist):
+		operationLogger.Warn("Smart playlist is empty", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, usecase.ErrVersionConflict):
+		operationLogger.Warn("Smart playlist version conflict", slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	default:
+		operationLogger.Error("Smart playlist operation failed", slog.String("error", err.Error()))
+		http.Error(w, "smart playlist operation failed", http.StatusInternalServerError)
+	}
+}
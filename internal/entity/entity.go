@@ -3,6 +3,9 @@ package entity
 import "errors"
 
 var (
-	ErrNullEntity   = errors.New("cannot set entity to nil")
-	ErrSongNotFound = errors.New("song not found")
+	ErrNullEntity       = errors.New("cannot set entity to nil")
+	ErrSongNotFound     = errors.New("song not found")
+	ErrInvalidPosition  = errors.New("position is out of playlist range")
+	ErrInvalidSmartRule = errors.New("invalid smart playlist rule")
+	ErrInvalidSmartSort = errors.New("invalid smart playlist sort")
 )
@@ -29,3 +29,57 @@ func TestSetCurrentNil(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, entity.ErrNullEntity, err)
 }
+
+func TestPlaylistMove(t *testing.T) {
+	titles := func(p *entity.Playlist) []string {
+		var result []string
+		for node := p.GetHead(); node != nil; node = node.Next {
+			if node.Next != nil {
+				assert.Same(t, node, node.Next.Prev, "links must stay consistent")
+			}
+			result = append(result, node.Song.Title)
+		}
+		return result
+	}
+
+	playlist := &entity.Playlist{}
+	for _, title := range []string{"A", "B", "C", "D"} {
+		playlist.AddToEnd(&entity.Song{Title: title})
+	}
+	current := playlist.GetHead().Next // B
+	assert.NoError(t, playlist.SetCurrent(current))
+
+	assert.NoError(t, playlist.Move(1, 3))
+	assert.Equal(t, []string{"B", "C", "A", "D"}, titles(playlist))
+
+	assert.NoError(t, playlist.Move(4, 1))
+	assert.Equal(t, []string{"D", "B", "C", "A"}, titles(playlist))
+	assert.Equal(t, "A", playlist.GetTail().Song.Title)
+
+	assert.NoError(t, playlist.Move(2, 2))
+	assert.Same(t, current, playlist.GetCurrent())
+
+	assert.ErrorIs(t, playlist.Move(0, 1), entity.ErrInvalidPosition)
+	assert.ErrorIs(t, playlist.Move(1, 5), entity.ErrInvalidPosition)
+}
+
+func TestPlaylistClone(t *testing.T) {
+	playlist := &entity.Playlist{ID: 7, Name: "Road trip", Version: 3}
+	for _, title := range []string{"A", "B", "C"} {
+		playlist.AddToEnd(&entity.Song{Title: title})
+	}
+	assert.NoError(t, playlist.SetCurrent(playlist.GetHead().Next))
+
+	clone := playlist.Clone()
+	assert.Equal(t, "Road trip", clone.Name)
+	assert.Equal(t, 3, clone.Version)
+	assert.Equal(t, "B", clone.GetCurrent().Song.Title)
+	assert.NotSame(t, playlist.GetCurrent(), clone.GetCurrent())
+	assert.NotSame(t, playlist.GetCurrent().Song, clone.GetCurrent().Song)
+
+	clone.GetHead().Song.Title = "Renamed"
+	assert.NoError(t, clone.Move(1, 3))
+	assert.Equal(t, "A", playlist.GetHead().Song.Title)
+	assert.Equal(t, "C", playlist.GetTail().Song.Title)
+	assert.Same(t, playlist.GetHead().Next, playlist.GetCurrent())
+}
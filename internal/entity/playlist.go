@@ -7,6 +7,11 @@ type PlaylistNode struct {
 }
 
 type Playlist struct {
+	ID          int
+	Name        string
+	Description string
+	Version     int // bumped when songs or their order change, 0 if the storage does not version playlists
+
 	head    *PlaylistNode
 	current *PlaylistNode
 	tail    *PlaylistNode
@@ -80,3 +85,88 @@ func (p *Playlist) RemoveSong(songID int) error {
 	}
 	return ErrSongNotFound
 }
+
+/*
+Move puts the song at position from to position to, positions are 1-based.
+The current song stays current
+*/
+func (p *Playlist) Move(from, to int) error {
+	node := p.nodeAt(from)
+	target := p.nodeAt(to)
+	if node == nil || target == nil {
+		return ErrInvalidPosition
+	}
+	if node == target {
+		return nil
+	}
+
+	// unlink
+	if node.Prev != nil {
+		node.Prev.Next = node.Next
+	} else {
+		p.head = node.Next
+	}
+	if node.Next != nil {
+		node.Next.Prev = node.Prev
+	} else {
+		p.tail = node.Prev
+	}
+
+	// moving down puts the node after target, moving up puts it before
+	if from < to {
+		node.Prev, node.Next = target, target.Next
+		if target.Next != nil {
+			target.Next.Prev = node
+		} else {
+			p.tail = node
+		}
+		target.Next = node
+	} else {
+		node.Prev, node.Next = target.Prev, target
+		if target.Prev != nil {
+			target.Prev.Next = node
+		} else {
+			p.head = node
+		}
+		target.Prev = node
+	}
+
+	return nil
+}
+
+/*
+Clone returns a deep copy with its own nodes and songs, the current song stays current
+*/
+func (p *Playlist) Clone() *Playlist {
+	clone := &Playlist{
+		ID:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Version:     p.Version,
+	}
+	var current *PlaylistNode
+	for node := p.head; node != nil; node = node.Next {
+		var song *Song
+		if node.Song != nil {
+			copied := *node.Song
+			song = &copied
+		}
+		copied := clone.AddToEnd(song)
+		if node == p.current {
+			current = copied
+		}
+	}
+	clone.current = current
+	return clone
+}
+
+func (p *Playlist) nodeAt(position int) *PlaylistNode {
+	if position < 1 {
+		return nil
+	}
+	node := p.head
+	for i := 1; node != nil && i < position; i++ {
+		node = node.Next
+	}
+	return node
+}
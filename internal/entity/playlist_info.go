@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+/*
+PlaylistInfo is a short description of a stored playlist used in listings
+*/
+type PlaylistInfo struct {
+	ID          int
+	Name        string
+	Description string
+	SongCount   int
+	CreatedAt   time.Time
+}
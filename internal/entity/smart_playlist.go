@@ -0,0 +1,192 @@
+package entity
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RuleField string
+
+const (
+	RuleFieldArtist    RuleField = "artist"
+	RuleFieldDuration  RuleField = "duration"   // seconds
+	RuleFieldAddedAt   RuleField = "added_at"   // days since the song was added
+	RuleFieldPlayCount RuleField = "play_count" // number of completed plays
+)
+
+type RuleOperator string
+
+const (
+	RuleOpEquals  RuleOperator = "eq"
+	RuleOpLess    RuleOperator = "lt"
+	RuleOpGreater RuleOperator = "gt"
+	RuleOpWithin  RuleOperator = "within"
+)
+
+type SmartSort string
+
+const (
+	SmartSortNone          SmartSort = ""
+	SmartSortMostPlayed    SmartSort = "most_played"
+	SmartSortRecentlyAdded SmartSort = "recently_added"
+	SmartSortTitle         SmartSort = "title"
+)
+
+/*
+SmartRule is a single condition over song metadata, e.g.
+{artist eq "Queen"}, {duration lt 240}, {added_at within 7} or {play_count eq 0}
+*/
+type SmartRule struct {
+	Field    RuleField
+	Operator RuleOperator
+	Value    string
+}
+
+/*
+SmartPlaylist is a playlist whose songs are computed from rules instead of being stored.
+All rules must match for a song to be included. Limit <= 0 means no limit.
+*/
+type SmartPlaylist struct {
+	ID          int
+	Name        string
+	Description string
+	Rules       []SmartRule
+	SortBy      SmartSort
+	Limit       int
+	Version     int // bumped by every write, 0 if the storage does not version smart playlists
+}
+
+func (r SmartRule) Validate() error {
+	switch r.Field {
+	case RuleFieldArtist:
+		if r.Operator != RuleOpEquals {
+			return fmt.Errorf("%w: field %q supports only %q", ErrInvalidSmartRule, r.Field, RuleOpEquals)
+		}
+		if r.Value == "" {
+			return fmt.Errorf("%w: empty artist", ErrInvalidSmartRule)
+		}
+		return nil
+	case RuleFieldDuration, RuleFieldPlayCount:
+		if r.Operator != RuleOpEquals && r.Operator != RuleOpLess && r.Operator != RuleOpGreater {
+			return fmt.Errorf("%w: field %q does not support %q", ErrInvalidSmartRule, r.Field, r.Operator)
+		}
+	case RuleFieldAddedAt:
+		if r.Operator != RuleOpWithin {
+			return fmt.Errorf("%w: field %q supports only %q", ErrInvalidSmartRule, r.Field, RuleOpWithin)
+		}
+	default:
+		return fmt.Errorf("%w: unknown field %q", ErrInvalidSmartRule, r.Field)
+	}
+
+	if n, err := strconv.Atoi(r.Value); err != nil || n < 0 {
+		return fmt.Errorf("%w: field %q expects a non-negative integer, got %q", ErrInvalidSmartRule, r.Field, r.Value)
+	}
+
+	return nil
+}
+
+func (r SmartRule) Matches(song *Song, now time.Time) bool {
+	if song == nil {
+		return false
+	}
+
+	if r.Field == RuleFieldArtist {
+		return strings.EqualFold(song.Artist, r.Value)
+	}
+
+	n, err := strconv.Atoi(r.Value)
+	if err != nil {
+		return false
+	}
+
+	switch r.Field {
+	case RuleFieldDuration:
+		return compareInt(int(song.Duration.Seconds()), r.Operator, n)
+	case RuleFieldPlayCount:
+		return compareInt(song.PlayCount, r.Operator, n)
+	case RuleFieldAddedAt:
+		return !song.AddedAt.IsZero() && !song.AddedAt.Before(now.AddDate(0, 0, -n))
+	}
+
+	return false
+}
+
+func compareInt(value int, op RuleOperator, n int) bool {
+	switch op {
+	case RuleOpEquals:
+		return value == n
+	case RuleOpLess:
+		return value < n
+	case RuleOpGreater:
+		return value > n
+	}
+	return false
+}
+
+func (sp *SmartPlaylist) Validate() error {
+	for _, rule := range sp.Rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+
+	switch sp.SortBy {
+	case SmartSortNone, SmartSortMostPlayed, SmartSortRecentlyAdded, SmartSortTitle:
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidSmartSort, sp.SortBy)
+	}
+
+	return nil
+}
+
+func (sp *SmartPlaylist) Matches(song *Song, now time.Time) bool {
+	for _, rule := range sp.Rules {
+		if !rule.Matches(song, now) {
+			return false
+		}
+	}
+	return song != nil
+}
+
+/*
+Materialize builds a regular Playlist from the library songs that match the rules,
+so the result can be handed over to the playback engine as is.
+Songs keep library order unless SortBy is set.
+*/
+func (sp *SmartPlaylist) Materialize(songs []*Song, now time.Time) *Playlist {
+	var matched []*Song
+	for _, song := range songs {
+		if sp.Matches(song, now) {
+			matched = append(matched, song)
+		}
+	}
+
+	switch sp.SortBy {
+	case SmartSortMostPlayed:
+		sort.SliceStable(matched, func(i, j int) bool {
+			return matched[i].PlayCount > matched[j].PlayCount
+		})
+	case SmartSortRecentlyAdded:
+		sort.SliceStable(matched, func(i, j int) bool {
+			return matched[i].AddedAt.After(matched[j].AddedAt)
+		})
+	case SmartSortTitle:
+		sort.SliceStable(matched, func(i, j int) bool {
+			return strings.ToLower(matched[i].Title) < strings.ToLower(matched[j].Title)
+		})
+	}
+
+	if sp.Limit > 0 && len(matched) > sp.Limit {
+		matched = matched[:sp.Limit]
+	}
+
+	playlist := &Playlist{Name: sp.Name, Description: sp.Description}
+	for _, song := range matched {
+		playlist.AddToEnd(song)
+	}
+
+	return playlist
+}
@@ -0,0 +1,100 @@
+package entity_test
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func smartLibrary(now time.Time) []*entity.Song {
+	return []*entity.Song{
+		{ID: 1, Title: "Bohemian Rhapsody", Artist: "Queen", Duration: 354 * time.Second, AddedAt: now.AddDate(0, 0, -30), PlayCount: 12},
+		{ID: 2, Title: "Under Pressure", Artist: "Queen", Duration: 248 * time.Second, AddedAt: now.AddDate(0, 0, -2), PlayCount: 0},
+		{ID: 3, Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second, AddedAt: now.AddDate(0, 0, -1), PlayCount: 3},
+		{ID: 4, Title: "Another One Bites the Dust", Artist: "queen", Duration: 215 * time.Second, AddedAt: now.AddDate(0, 0, -10), PlayCount: 7},
+	}
+}
+
+func playlistIDs(p *entity.Playlist) []int {
+	var ids []int
+	for node := p.GetHead(); node != nil; node = node.Next {
+		ids = append(ids, node.Song.ID)
+	}
+	return ids
+}
+
+func TestSmartPlaylistMaterialize(t *testing.T) {
+	now := time.Date(2024, 12, 16, 12, 0, 0, 0, time.UTC)
+	songs := smartLibrary(now)
+
+	tests := []struct {
+		name string
+		sp   entity.SmartPlaylist
+		want []int
+	}{
+		{
+			name: "artist equals",
+			sp:   entity.SmartPlaylist{Rules: []entity.SmartRule{{Field: entity.RuleFieldArtist, Operator: entity.RuleOpEquals, Value: "Queen"}}},
+			want: []int{1, 2, 4},
+		},
+		{
+			name: "duration under",
+			sp:   entity.SmartPlaylist{Rules: []entity.SmartRule{{Field: entity.RuleFieldDuration, Operator: entity.RuleOpLess, Value: "240"}}},
+			want: []int{3, 4},
+		},
+		{
+			name: "added in the last 7 days",
+			sp:   entity.SmartPlaylist{Rules: []entity.SmartRule{{Field: entity.RuleFieldAddedAt, Operator: entity.RuleOpWithin, Value: "7"}}},
+			want: []int{2, 3},
+		},
+		{
+			name: "never played",
+			sp:   entity.SmartPlaylist{Rules: []entity.SmartRule{{Field: entity.RuleFieldPlayCount, Operator: entity.RuleOpEquals, Value: "0"}}},
+			want: []int{2},
+		},
+		{
+			name: "most played with limit",
+			sp:   entity.SmartPlaylist{SortBy: entity.SmartSortMostPlayed, Limit: 2},
+			want: []int{1, 4},
+		},
+		{
+			name: "rules are combined",
+			sp: entity.SmartPlaylist{
+				Rules: []entity.SmartRule{
+					{Field: entity.RuleFieldArtist, Operator: entity.RuleOpEquals, Value: "queen"},
+					{Field: entity.RuleFieldPlayCount, Operator: entity.RuleOpGreater, Value: "0"},
+				},
+				SortBy: entity.SmartSortTitle,
+			},
+			want: []int{4, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, tt.sp.Validate())
+			playlist := tt.sp.Materialize(songs, now)
+			assert.Equal(t, tt.want, playlistIDs(playlist))
+			if len(tt.want) > 0 {
+				assert.Equal(t, playlist.GetHead(), playlist.GetCurrent())
+			}
+		})
+	}
+}
+
+func TestSmartPlaylistValidate(t *testing.T) {
+	invalid := []entity.SmartPlaylist{
+		{Rules: []entity.SmartRule{{Field: "genre", Operator: entity.RuleOpEquals, Value: "rock"}}},
+		{Rules: []entity.SmartRule{{Field: entity.RuleFieldArtist, Operator: entity.RuleOpLess, Value: "Queen"}}},
+		{Rules: []entity.SmartRule{{Field: entity.RuleFieldDuration, Operator: entity.RuleOpLess, Value: "long"}}},
+		{Rules: []entity.SmartRule{{Field: entity.RuleFieldAddedAt, Operator: entity.RuleOpEquals, Value: "7"}}},
+	}
+
+	for _, sp := range invalid {
+		assert.ErrorIs(t, sp.Validate(), entity.ErrInvalidSmartRule)
+	}
+
+	sp := entity.SmartPlaylist{SortBy: "random"}
+	assert.ErrorIs(t, sp.Validate(), entity.ErrInvalidSmartSort)
+}
@@ -3,8 +3,11 @@ package entity
 import "time"
 
 type Song struct {
-	ID       int
-	Title    string
-	Duration time.Duration
-	Artist   string
+	ID        int
+	Title     string
+	Duration  time.Duration
+	Artist    string
+	AddedAt   time.Time
+	PlayCount int
+	Version   int // bumped by every write, 0 if the storage does not version songs
 }
@@ -0,0 +1,97 @@
+/*
+Package health tells the orchestrator whether the service can take traffic
+*/
+package health
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Probe checks one dependency, nil means it is usable
+*/
+type Probe func(ctx context.Context) error
+
+type namedProbe struct {
+	name  string
+	probe Probe
+}
+
+/*
+Result is the outcome of one probe, Err is nil if it passed
+*/
+type Result struct {
+	Name string
+	Err  error
+}
+
+/*
+Report is the outcome of a readiness check
+*/
+type Report struct {
+	Ready    bool
+	Draining bool
+	Checks   []Result
+}
+
+/*
+Checker runs the registered probes. Once Drain is called the service reports not ready,
+so the load balancer stops sending requests before the server stops accepting them
+*/
+type Checker struct {
+	probes   []namedProbe
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+/*
+NewChecker returns Checker giving each probe timeout to complete
+*/
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+/*
+Add registers probe, it must be called before the checker is used
+*/
+func (c *Checker) Add(name string, probe Probe) {
+	c.probes = append(c.probes, namedProbe{name: name, probe: probe})
+}
+
+/*
+Drain makes the service not ready for good, it is the first step of graceful shutdown
+*/
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+/*
+Ready runs all probes, the service is ready if none of them failed and it is not draining.
+Probes run even while draining, so the report still shows the state of dependencies
+*/
+func (c *Checker) Ready(ctx context.Context) Report {
+	report := Report{Ready: true, Draining: c.draining.Load()}
+	if report.Draining {
+		report.Ready = false
+	}
+
+	for _, p := range c.probes {
+		err := c.run(ctx, p.probe)
+		if err != nil {
+			report.Ready = false
+		}
+		report.Checks = append(report.Checks, Result{Name: p.name, Err: err})
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, probe Probe) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	return probe(ctx)
+}
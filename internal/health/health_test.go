@@ -0,0 +1,38 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	ctx := context.Background()
+	errDown := errors.New("connection refused")
+
+	var dbErr error
+	c := NewChecker(10 * time.Millisecond)
+	c.Add("database", func(context.Context) error { return dbErr })
+	c.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+
+	report := c.Ready(ctx)
+	assert.True(t, report.Ready, "probe which returns nil after its timeout still passes")
+	assert.Equal(t, []Result{{Name: "database"}, {Name: "slow"}}, report.Checks)
+
+	dbErr = errDown
+	report = c.Ready(ctx)
+	assert.False(t, report.Ready)
+	assert.ErrorIs(t, report.Checks[0].Err, errDown)
+
+	dbErr = nil
+	c.Drain()
+	report = c.Ready(ctx)
+	assert.False(t, report.Ready, "draining service is not ready")
+	assert.True(t, report.Draining)
+	assert.Equal(t, []Result{{Name: "database"}, {Name: "slow"}}, report.Checks, "dependencies are still reported")
+}
@@ -0,0 +1,202 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+/*
+lockClass is the first key of the two-key advisory lock, the second one is the playlist ID.
+Two-key locks never collide with the single-key lock of migrations
+*/
+const lockClass = 0x504c4159 // "PLAY"
+
+var (
+	ErrNoLeader            = errors.New("no instance leads playback")
+	ErrInvalidAdvertiseURL = errors.New("advertise URL must be an http(s) URL other replicas reach this instance at")
+)
+
+/*
+ValidateAdvertiseURL checks that followers can forward to address: an http or https URL with a host,
+which is not a wildcard listen address such as 0.0.0.0 or [::]
+*/
+func ValidateAdvertiseURL(address string) error {
+	u, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAdvertiseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: got %q", ErrInvalidAdvertiseURL, address)
+	}
+	if host := u.Hostname(); host == "" || net.ParseIP(host) != nil && net.ParseIP(host).IsUnspecified() {
+		return fmt.Errorf("%w: got %q", ErrInvalidAdvertiseURL, address)
+	}
+	return nil
+}
+
+/*
+Info is the leader published in playback_leaders
+*/
+type Info struct {
+	InstanceID string
+	Address    string // base URL followers forward playback commands to
+	ElectedAt  time.Time
+}
+
+/*
+Elector runs leader election among instances sharing a Postgres database: the one holding the session
+advisory lock of the playlist drives its playback. The lock lives as long as the connection holding it,
+so a crashed leader releases it and a follower takes over on its next attempt
+*/
+type Elector struct {
+	db         *sql.DB
+	playlistID int
+	instanceID string
+	address    string
+	interval   time.Duration // between attempts of followers and health checks of the leader connection
+	logger     *slog.Logger
+	leading    atomic.Bool
+}
+
+func NewElector(db *sql.DB, playlistID int, instanceID, address string, interval time.Duration, logger *slog.Logger) *Elector {
+	return &Elector{
+		db:         db,
+		playlistID: playlistID,
+		instanceID: instanceID,
+		address:    address,
+		interval:   interval,
+		logger:     logger.With(slog.String("op", "leader.Elector"), slog.String("instance_id", instanceID)),
+	}
+}
+
+/*
+Leading reports whether this instance holds the lock
+*/
+func (e *Elector) Leading() bool {
+	return e.leading.Load()
+}
+
+/*
+Leader returns the instance holding the lock, ErrNoLeader if none does,
+e.g. between a crash of the leader and the election of the next one
+*/
+func (e *Elector) Leader(ctx context.Context) (*Info, error) {
+	var info Info
+	err := e.db.QueryRowContext(ctx, `
+		SELECT l.instance_id, l.address, l.elected_at FROM playback_leaders l
+		WHERE l.playlist_id = $1 AND EXISTS (
+			SELECT 1 FROM pg_locks
+			WHERE locktype = 'advisory' AND classid = $2::oid AND objid = $3::oid AND objsubid = 2 AND granted)`,
+		e.playlistID, lockClass, e.playlistID).Scan(&info.InstanceID, &info.Address, &info.ElectedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoLeader
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+/*
+Run takes part in the election until ctx is done. Each time this instance is elected lead is called
+in its own goroutine with a context which is canceled when the leadership is lost; the lock is
+released only after lead returns, so playback is stopped before another instance starts it.
+lead returning earlier resigns the leadership, e.g. if taking playback over failed
+*/
+func (e *Elector) Run(ctx context.Context, lead func(leadership context.Context)) {
+	for {
+		if err := e.campaign(ctx, lead); err != nil && ctx.Err() == nil {
+			e.logger.Warn("Leader election failed", slog.String("error", err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.interval):
+		}
+	}
+}
+
+/*
+campaign tries to take the lock once and, if it succeeds, leads until the connection breaks or ctx is done
+*/
+func (e *Elector) campaign(ctx context.Context, lead func(leadership context.Context)) error {
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1, $2)", lockClass, e.playlistID).Scan(&acquired); err != nil {
+		return fmt.Errorf("failed to try lock: %w", err)
+	}
+	if !acquired {
+		return nil
+	}
+	defer func() {
+		unlockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), e.interval)
+		defer cancel()
+		if _, err := conn.ExecContext(unlockCtx, "SELECT pg_advisory_unlock($1, $2)", lockClass, e.playlistID); err != nil {
+			// back in the pool the session would keep the lock, closing the connection releases it
+			e.logger.Warn("Failed to release leader lock, dropping connection", slog.String("error", err.Error()))
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, `
+		INSERT INTO playback_leaders (playlist_id, instance_id, address, elected_at) VALUES ($1, $2, $3, now())
+		ON CONFLICT (playlist_id) DO UPDATE SET instance_id = $2, address = $3, elected_at = now()`,
+		e.playlistID, e.instanceID, e.address); err != nil {
+		return fmt.Errorf("failed to publish leader: %w", err)
+	}
+
+	e.logger.Info("Elected playback leader", slog.Int("playlist_id", e.playlistID), slog.String("address", e.address))
+	leadership, resign := context.WithCancel(ctx)
+	done := make(chan struct{})
+	e.leading.Store(true)
+	go func() {
+		defer close(done)
+		lead(leadership)
+	}()
+
+	err = e.hold(leadership, conn, done)
+	e.leading.Store(false)
+	resign()
+	<-done
+	e.logger.Info("Resigned playback leadership")
+	return err
+}
+
+/*
+hold checks the connection holding the lock every interval until ctx is done or lead returns,
+the lock is lost with the connection
+*/
+func (e *Elector) hold(ctx context.Context, conn *sql.Conn, done <-chan struct{}) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-done:
+			return nil
+		case <-ticker.C:
+			checkCtx, cancel := context.WithTimeout(ctx, e.interval)
+			_, err := conn.ExecContext(checkCtx, "SELECT 1")
+			cancel()
+			if err != nil && ctx.Err() == nil {
+				return fmt.Errorf("lost connection holding the lock: %w", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package leader
+
+import (
+	"cloud-go-testtask/internal/migrator"
+	"cloud-go-testtask/internal/repository/rdbms"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+fakePostgres serves the statements of Elector the way Postgres does: advisory locks belong to the session
+and are released when it ends, pg_locks lists the granted ones
+*/
+type fakePostgres struct {
+	mu      sync.Mutex
+	locks   map[[2]int64]*fakeConn
+	leaders map[int64]Info
+}
+
+type fakeRows struct {
+	values []driver.Value
+	done   bool
+}
+
+func newFakeDB(t *testing.T) (*sql.DB, *fakePostgres) {
+	pg := &fakePostgres{locks: make(map[[2]int64]*fakeConn), leaders: make(map[int64]Info)}
+	db := sql.OpenDB(pg)
+	t.Cleanup(func() { _ = db.Close() })
+	return db, pg
+}
+
+func (pg *fakePostgres) Connect(context.Context) (driver.Conn, error) { return &fakeConn{pg: pg}, nil }
+func (pg *fakePostgres) Driver() driver.Driver                        { return nil }
+
+/*
+breakHolder ends the session holding the lock of playlistID as a broken network would: the server
+releases the lock, the client gets errors on the connection
+*/
+func (pg *fakePostgres) breakHolder(playlistID int64) bool {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	conn, ok := pg.locks[[2]int64{lockClass, playlistID}]
+	if !ok {
+		return false
+	}
+	conn.broken = true
+	pg.release(conn)
+	return true
+}
+
+func (pg *fakePostgres) release(conn *fakeConn) {
+	for key, holder := range pg.locks {
+		if holder == conn {
+			delete(pg.locks, key)
+		}
+	}
+}
+
+type fakeConn struct {
+	pg     *fakePostgres
+	broken bool // guarded by pg.mu
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c *fakeConn) Close() error {
+	c.pg.mu.Lock()
+	defer c.pg.mu.Unlock()
+	c.pg.release(c)
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rows, err := c.QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	_ = rows.Close()
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.pg.mu.Lock()
+	defer c.pg.mu.Unlock()
+	if c.broken {
+		return nil, driver.ErrBadConn
+	}
+
+	query = strings.TrimSpace(query)
+	switch {
+	case strings.HasPrefix(query, "SELECT pg_try_advisory_lock"):
+		key := [2]int64{args[0].Value.(int64), args[1].Value.(int64)}
+		holder, held := c.pg.locks[key]
+		if !held {
+			c.pg.locks[key] = c
+		}
+		return &fakeRows{values: []driver.Value{!held || holder == c}}, nil
+	case strings.HasPrefix(query, "SELECT pg_advisory_unlock"):
+		key := [2]int64{args[0].Value.(int64), args[1].Value.(int64)}
+		released := c.pg.locks[key] == c
+		if released {
+			delete(c.pg.locks, key)
+		}
+		return &fakeRows{values: []driver.Value{released}}, nil
+	case strings.HasPrefix(query, "INSERT INTO playback_leaders"):
+		c.pg.leaders[args[0].Value.(int64)] = Info{
+			InstanceID: args[1].Value.(string),
+			Address:    args[2].Value.(string),
+			ElectedAt:  time.Now(),
+		}
+		return &fakeRows{done: true}, nil
+	case strings.Contains(query, "FROM pg_locks"):
+		info, ok := c.pg.leaders[args[0].Value.(int64)]
+		if _, granted := c.pg.locks[[2]int64{args[1].Value.(int64), args[2].Value.(int64)}]; !ok || !granted {
+			return &fakeRows{done: true}, nil
+		}
+		return &fakeRows{values: []driver.Value{info.InstanceID, info.Address, info.ElectedAt}}, nil
+	case query == "SELECT 1":
+		return &fakeRows{values: []driver.Value{int64(1)}}, nil
+	}
+	return nil, errors.New("unexpected query: " + query)
+}
+
+func (r *fakeRows) Columns() []string {
+	columns := make([]string, len(r.values))
+	for i := range columns {
+		columns[i] = "column"
+	}
+	return columns
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.values)
+	return nil
+}
+
+/*
+runElector runs the election of e until the test ends, the returned channel reports every leadership it got
+*/
+func runElector(t *testing.T, e *Elector) <-chan context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	elected := make(chan context.Context, 10)
+	go func() {
+		defer close(done)
+		e.Run(ctx, func(leadership context.Context) {
+			elected <- leadership
+			<-leadership.Done()
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return elected
+}
+
+func TestElector(t *testing.T) {
+	ctx := context.Background()
+	db, pg := newFakeDB(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	first := NewElector(db, 1, "first", "http://first:8082", 10*time.Millisecond, logger)
+	second := NewElector(db, 1, "second", "http://second:8082", 10*time.Millisecond, logger)
+
+	_, err := first.Leader(ctx)
+	assert.ErrorIs(t, err, ErrNoLeader)
+
+	elected := runElector(t, first)
+	var leadership context.Context
+	select {
+	case leadership = <-elected:
+	case <-time.After(time.Second):
+		t.Fatal("first instance is not elected")
+	}
+	assert.True(t, first.Leading())
+
+	// the leader is published and found while it holds the lock
+	info, err := second.Leader(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "first", info.InstanceID)
+	assert.Equal(t, "http://first:8082", info.Address)
+
+	secondElected := runElector(t, second)
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, second.Leading(), "the lock is held by the first instance")
+
+	// the leader loses its connection, it resigns and the other instance takes over
+	require.True(t, pg.breakHolder(1))
+	select {
+	case <-leadership.Done():
+	case <-time.After(time.Second):
+		t.Fatal("leadership is not lost with the connection")
+	}
+	select {
+	case <-secondElected:
+	case <-time.After(time.Second):
+		t.Fatal("second instance is not elected")
+	}
+	require.Eventually(t, func() bool { return !first.Leading() }, time.Second, 10*time.Millisecond)
+	assert.True(t, second.Leading())
+
+	info, err = first.Leader(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "second", info.InstanceID)
+	assert.Equal(t, "http://second:8082", info.Address)
+}
+
+func TestElectorLeaderWithoutLock(t *testing.T) {
+	ctx := context.Background()
+	db, pg := newFakeDB(t)
+	e := NewElector(db, 1, "first", "http://first:8082", 10*time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// lead returning at once resigns, the lock is released and the published row is stale
+	ran := make(chan struct{}, 10)
+	run, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(run, func(context.Context) { ran <- struct{}{} })
+	}()
+	<-ran
+	stop()
+	<-done
+
+	assert.False(t, e.Leading())
+	pg.mu.Lock()
+	assert.Empty(t, pg.locks)
+	assert.Contains(t, pg.leaders, int64(1))
+	pg.mu.Unlock()
+	_, err := e.Leader(ctx)
+	assert.ErrorIs(t, err, ErrNoLeader, "a published leader which does not hold the lock is not the leader")
+}
+
+/*
+TestElectorPostgres runs the election against the database of TEST_POSTGRES_DSN, the lock holder is found
+in pg_locks and its backend is terminated to break the connection
+*/
+func TestElectorPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	m, err := migrator.New(db, rdbms.DialectPostgres, logger)
+	require.NoError(t, err)
+	require.NoError(t, m.Up(ctx))
+
+	first := NewElector(db, 1, "first", "http://first:8082", 50*time.Millisecond, logger)
+	second := NewElector(db, 1, "second", "http://second:8082", 50*time.Millisecond, logger)
+
+	elected := runElector(t, first)
+	var leadership context.Context
+	select {
+	case leadership = <-elected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first instance is not elected")
+	}
+	info, err := second.Leader(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "http://first:8082", info.Address)
+
+	secondElected := runElector(t, second)
+	_, err = db.ExecContext(ctx, `
+		SELECT pg_terminate_backend(pid) FROM pg_locks
+		WHERE locktype = 'advisory' AND classid = $1::oid AND objid = 1 AND objsubid = 2 AND granted`, lockClass)
+	require.NoError(t, err)
+
+	select {
+	case <-leadership.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("leadership is not lost with the connection")
+	}
+	select {
+	case <-secondElected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second instance is not elected")
+	}
+	info, err = first.Leader(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "second", info.InstanceID)
+}
+
+func TestValidateAdvertiseURL(t *testing.T) {
+	for _, address := range []string{"http://playlist-1:8082", "https://playlist.example.com", "http://10.0.0.5:8082", "http://127.0.0.1:8082"} {
+		assert.NoError(t, ValidateAdvertiseURL(address), address)
+	}
+	for _, address := range []string{"", "playlist-1:8082", "ftp://playlist-1", "http://", "http://0.0.0.0:8082", "http://[::]:8082", "http://:8082"} {
+		assert.ErrorIs(t, ValidateAdvertiseURL(address), ErrInvalidAdvertiseURL, address)
+	}
+}
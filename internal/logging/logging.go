@@ -0,0 +1,30 @@
+/*
+Package logging carries the request-scoped logger through context, so use cases and repositories
+log with the request ID of the HTTP request they serve
+*/
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type loggerKey struct{}
+
+/*
+NewContext returns a copy of ctx carrying logger
+*/
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+/*
+FromContext returns the logger carried by ctx, or fallback if there is none,
+e.g. in background playback or in tests calling use cases directly
+*/
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return fallback
+}
@@ -0,0 +1,96 @@
+/*
+Package metrics exports Prometheus metrics of the API, the storage and the playback engine
+*/
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "playlist"
+
+/*
+Metrics holds the collectors of the service in its own registry, so tests can create as many as they need
+*/
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+	dbDuration   *prometheus.HistogramVec
+	transitions  *prometheus.CounterVec
+	skips        prometheus.Counter
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route pattern and status.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route pattern and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Duration of storage calls by repository method.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"method"}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "playback_transitions_total",
+			Help:      "Changes of the current song during playback by reason: next, prev or auto.",
+		}, []string{"reason"}),
+		skips: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "playback_skips_total",
+			Help:      "Songs left by next or prev after they had started playing.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.dbDuration,
+		m.transitions,
+		m.skips,
+	)
+	return m
+}
+
+/*
+Handler serves the metrics in the Prometheus exposition format
+*/
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+/*
+ObserveHTTPRequest records a served request. route is the chi route pattern, not the path,
+to keep the number of series bounded
+*/
+func (m *Metrics) ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	m.httpRequests.WithLabelValues(method, route, code).Inc()
+	m.httpDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+/*
+ObserveQuery records a repository call, it is a repository.MethodObserver
+*/
+func (m *Metrics) ObserveQuery(method string, duration time.Duration) {
+	m.dbDuration.WithLabelValues(method).Observe(duration.Seconds())
+}
@@ -0,0 +1,59 @@
+package metrics_test
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/metrics"
+	"cloud-go-testtask/internal/usecase"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestInstrumentPlayback(t *testing.T) {
+	ctx := context.Background()
+	rdbmsRepo := usecase.NewMockPlaylistRepo()
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, rdbmsRepo.AddSong(ctx, &entity.Song{ID: i, Title: "Song", Duration: 5 * time.Second}))
+	}
+	uc := usecase.NewPlaylistUseCase(rdbmsRepo, usecase.NewMockPlaylistRepo(), slog.Default())
+	require.NoError(t, uc.InitCache(ctx))
+
+	m := metrics.New()
+	m.InstrumentPlayback(uc)
+
+	require.NoError(t, uc.Next(ctx))
+	require.NoError(t, uc.Seek(ctx, 2*time.Second))
+	require.NoError(t, uc.Next(ctx))
+	require.NoError(t, uc.Prev(ctx))
+	require.NoError(t, uc.Pause(ctx))
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `playlist_playback_transitions_total{reason="next"} 2`)
+	assert.Contains(t, body, `playlist_playback_transitions_total{reason="prev"} 1`)
+	assert.Contains(t, body, "playlist_playback_skips_total 1", "only the song played from 2s is skipped")
+	assert.Contains(t, body, "playlist_playback_current_song_id 2")
+	assert.Contains(t, body, "playlist_playback_paused 1")
+	assert.Contains(t, body, "playlist_cache_songs 3")
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestObserveQuery(t *testing.T) {
+	m := metrics.New()
+	m.ObserveQuery("GetPlaylist", 3*time.Millisecond)
+
+	assert.Contains(t, scrape(t, m), `playlist_db_query_duration_seconds_count{method="GetPlaylist"} 1`)
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"cloud-go-testtask/internal/usecase"
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/*
+InstrumentPlayback counts song transitions of uc and exports its state, which is read on every scrape
+*/
+func (m *Metrics) InstrumentPlayback(uc *usecase.PlaylistUseCase) {
+	uc.OnTransition(func(t usecase.Transition) {
+		m.transitions.WithLabelValues(string(t.Reason)).Inc()
+		if t.Skipped {
+			m.skips.Inc()
+		}
+	})
+	m.registry.MustRegister(newPlaybackCollector(uc))
+}
+
+/*
+playbackCollector reads the whole state at once, so gauges of one scrape are consistent
+*/
+type playbackCollector struct {
+	uc *usecase.PlaylistUseCase
+
+	playing    *prometheus.Desc
+	paused     *prometheus.Desc
+	songID     *prometheus.Desc
+	position   *prometheus.Desc
+	cacheSize  *prometheus.Desc
+	goroutines *prometheus.Desc
+}
+
+func newPlaybackCollector(uc *usecase.PlaylistUseCase) *playbackCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, nil, nil)
+	}
+
+	return &playbackCollector{
+		uc:         uc,
+		playing:    desc("playback_playing", "1 if a song is playing."),
+		paused:     desc("playback_paused", "1 if playback is paused."),
+		songID:     desc("playback_current_song_id", "ID of the current song, 0 if none."),
+		position:   desc("playback_position_seconds", "Position within the current song."),
+		cacheSize:  desc("cache_songs", "Number of songs in the cached playlist."),
+		goroutines: desc("playback_goroutines", "Running playback goroutines."),
+	}
+}
+
+func (c *playbackCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.playing
+	ch <- c.paused
+	ch <- c.songID
+	ch <- c.position
+	ch <- c.cacheSize
+	ch <- c.goroutines
+}
+
+func (c *playbackCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.goroutines, prometheus.GaugeValue, float64(c.uc.PlaybackGoroutines()))
+
+	state, err := c.uc.State(context.Background())
+	if err != nil {
+		return // cache is not loaded yet
+	}
+
+	songID := 0
+	if state.Song != nil {
+		songID = state.Song.ID
+	}
+	ch <- prometheus.MustNewConstMetric(c.playing, prometheus.GaugeValue, boolValue(state.Playing))
+	ch <- prometheus.MustNewConstMetric(c.paused, prometheus.GaugeValue, boolValue(state.Paused))
+	ch <- prometheus.MustNewConstMetric(c.songID, prometheus.GaugeValue, float64(songID))
+	ch <- prometheus.MustNewConstMetric(c.position, prometheus.GaugeValue, state.Position.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.cacheSize, prometheus.GaugeValue, float64(state.Total))
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+package migrator
+
+import (
+	"cloud-go-testtask/internal/repository/rdbms"
+	"cloud-go-testtask/migrations"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+	"log/slog"
+)
+
+var (
+	ErrMigrate        = errors.New("failed to apply migrations")
+	ErrSchemaVersion  = errors.New("failed to get schema version")
+	ErrSchemaOutdated = errors.New("database schema is behind the binary")
+)
+
+/*
+Migrator applies migrations embedded into the binary. On Postgres replicas starting together are serialized
+by a session advisory lock (the same lock id goose uses by default), so only one of them
+runs pending migrations and the others find nothing to do once they get the lock.
+SQLite database is a local file of a single process and needs no lock
+*/
+type Migrator struct {
+	provider *goose.Provider
+	logger   *slog.Logger
+}
+
+func New(db *sql.DB, dialect rdbms.Dialect, logger *slog.Logger) (*Migrator, error) {
+	gooseDialect := goose.DialectPostgres
+	var opts []goose.ProviderOption
+
+	if dialect == rdbms.DialectSQLite {
+		gooseDialect = goose.DialectSQLite3
+	} else {
+		locker, err := lock.NewPostgresSessionLocker()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMigrate, err)
+		}
+		opts = append(opts, goose.WithSessionLocker(locker))
+	}
+
+	provider, err := goose.NewProvider(gooseDialect, db, migrations.ForDialect(string(dialect)), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMigrate, err)
+	}
+
+	return &Migrator{provider: provider, logger: logger}, nil
+}
+
+/*
+Up applies all pending migrations
+*/
+func (m *Migrator) Up(ctx context.Context) error {
+	const op = "migrator.Migrator.Up"
+	operationLogger := m.logger.With(slog.String("op", op))
+
+	operationLogger.Info("Applying pending migrations")
+
+	results, err := m.provider.Up(ctx)
+	if err != nil {
+		operationLogger.Error("Failed to apply migrations", slog.String("error", err.Error()))
+		return fmt.Errorf("%w: %v", ErrMigrate, err)
+	}
+
+	for _, r := range results {
+		operationLogger.Info("Migration applied",
+			slog.String("source", r.Source.Path),
+			slog.Int64("version", r.Source.Version),
+			slog.Duration("duration", r.Duration),
+		)
+	}
+
+	version, err := m.provider.GetDBVersion(ctx)
+	if err != nil {
+		operationLogger.Error("Failed to get schema version", slog.String("error", err.Error()))
+		return fmt.Errorf("%w: %v", ErrMigrate, err)
+	}
+
+	operationLogger.Info("Migrations are up to date", slog.Int("applied", len(results)), slog.Int64("version", version))
+	return nil
+}
+
+/*
+CheckVersion fails with ErrSchemaOutdated while some migrations embedded into the binary are not applied.
+A newer schema is accepted, it is left by a replica of the next release during a rolling update
+*/
+func (m *Migrator) CheckVersion(ctx context.Context) error {
+	version, err := m.provider.GetDBVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSchemaVersion, err)
+	}
+
+	sources := m.provider.ListSources()
+	if len(sources) == 0 {
+		return nil
+	}
+	if expected := sources[len(sources)-1].Version; version < expected {
+		return fmt.Errorf("%w: database is at version %d, expected %d", ErrSchemaOutdated, version, expected)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+/*
+Cursor points to the last item of a page for keyset pagination:
+Value is the sort key of that item and ID breaks ties between equal keys.
+Sort is the order the cursor was issued for, it is valid for that order only.
+Lists without an entity key, e.g. playlist items, page by Position of the last item instead.
+Clients get it as an opaque string.
+*/
+type Cursor struct {
+	Sort     string `json:"s,omitempty"`
+	Value    string `json:"v,omitempty"`
+	ID       int    `json:"id,omitempty"`
+	Position int    `json:"p,omitempty"`
+}
+
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c) // marshalling of string and int can not fail
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func Decode(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.ID < 0 || c.Position < 0 || (c.ID == 0) == (c.Position == 0) {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,27 @@
+package pagination_test
+
+import (
+	"cloud-go-testtask/internal/pagination"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := pagination.Cursor{Value: "2024-12-16 12:00:00.123456", ID: 42}
+
+	decoded, err := pagination.Decode(cursor.Encode())
+	assert.NoError(t, err)
+	assert.Equal(t, cursor, *decoded)
+
+	position := pagination.Cursor{Position: 50}
+	decoded, err = pagination.Decode(position.Encode())
+	assert.NoError(t, err)
+	assert.Equal(t, position, *decoded)
+}
+
+func TestDecodeInvalidCursor(t *testing.T) {
+	for _, s := range []string{"", "not base64!", "bm90IGpzb24", pagination.Cursor{Value: "x"}.Encode(), pagination.Cursor{ID: 1, Position: 1}.Encode()} {
+		_, err := pagination.Decode(s)
+		assert.ErrorIs(t, err, pagination.ErrInvalidCursor, s)
+	}
+}
@@ -0,0 +1,78 @@
+package playlistio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const jsonVersion = 1
+
+/*
+jsonPlaylist is the export format of the service. Unlike other formats it keeps
+library song IDs and playlist description, so an exported playlist is imported back as is.
+Durations are in seconds as everywhere in the API.
+*/
+type jsonPlaylist struct {
+	Version     int        `json:"version"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Songs       []jsonSong `json:"songs"`
+}
+
+type jsonSong struct {
+	Position int    `json:"position"`
+	ID       int    `json:"id,omitempty"`
+	Title    string `json:"title"`
+	Artist   string `json:"artist"`
+	Duration int    `json:"duration"`
+	Location string `json:"location,omitempty"`
+}
+
+func parseJSON(r io.Reader) (*Document, error) {
+	var pl jsonPlaylist
+	if err := json.NewDecoder(r).Decode(&pl); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if pl.Version > jsonVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrMalformed, pl.Version)
+	}
+
+	doc := &Document{Title: strings.TrimSpace(pl.Name), Description: pl.Description}
+	for _, song := range pl.Songs {
+		doc.Entries = append(doc.Entries, Entry{
+			Index:    len(doc.Entries) + 1,
+			ID:       song.ID,
+			Location: song.Location,
+			Title:    strings.TrimSpace(song.Title),
+			Artist:   strings.TrimSpace(song.Artist),
+			Duration: secondsToDuration(song.Duration),
+		})
+	}
+
+	return doc, nil
+}
+
+func writeJSON(doc *Document, w io.Writer) error {
+	pl := jsonPlaylist{
+		Version:     jsonVersion,
+		Name:        doc.Title,
+		Description: doc.Description,
+		Songs:       make([]jsonSong, 0, len(doc.Entries)),
+	}
+	for i, entry := range doc.Entries {
+		pl.Songs = append(pl.Songs, jsonSong{
+			Position: i + 1,
+			ID:       entry.ID,
+			Title:    entry.Title,
+			Artist:   entry.Artist,
+			Duration: int(entry.Duration.Seconds()),
+			Location: entry.Location,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(pl)
+}
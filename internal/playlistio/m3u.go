@@ -0,0 +1,95 @@
+package playlistio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+parseM3U supports plain and extended M3U/M3U8:
+#EXTM3U
+#PLAYLIST:Name
+#EXTINF:183,John Lennon - Imagine
+music/imagine.mp3
+*/
+func parseM3U(r io.Reader) (*Document, error) {
+	doc := &Document{}
+	scanner := bufio.NewScanner(r)
+
+	var pending *Entry
+	first := true
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXTINF:"):
+			pending = parseExtInf(strings.TrimPrefix(line, "#EXTINF:"))
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			doc.Title = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			entry := Entry{}
+			if pending != nil {
+				entry = *pending
+				pending = nil
+			}
+			entry.Index = len(doc.Entries) + 1
+			entry.Location = line
+			if entry.Title == "" {
+				entry.Artist, entry.Title = titleFromLocation(line)
+			}
+			doc.Entries = append(doc.Entries, entry)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+/*
+parseExtInf parses "<seconds>[ attributes],<Artist - Title>", -1 seconds means unknown
+*/
+func parseExtInf(s string) *Entry {
+	info, name, _ := strings.Cut(s, ",")
+	seconds, _, _ := strings.Cut(strings.TrimSpace(info), " ")
+
+	entry := &Entry{}
+	if n, err := strconv.Atoi(seconds); err == nil {
+		entry.Duration = secondsToDuration(n)
+	}
+	entry.Artist, entry.Title = splitArtistTitle(name)
+
+	return entry
+}
+
+func writeM3U(doc *Document, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	bw.WriteString("#EXTM3U\n")
+	if doc.Title != "" {
+		fmt.Fprintf(bw, "#PLAYLIST:%s\n", singleLine(doc.Title))
+	}
+	for _, entry := range doc.Entries {
+		seconds := -1
+		if entry.Duration > 0 {
+			seconds = int(entry.Duration.Seconds())
+		}
+		fmt.Fprintf(bw, "#EXTINF:%d,%s\n%s\n", seconds, displayName(entry), location(entry))
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,177 @@
+package playlistio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown playlist format")
+	ErrMalformed     = errors.New("malformed playlist file")
+)
+
+type Format string
+
+const (
+	FormatM3U  Format = "m3u"
+	FormatM3U8 Format = "m3u8"
+	FormatPLS  Format = "pls"
+	FormatXSPF Format = "xspf"
+	FormatJSON Format = "json" // own format, keeps everything needed to restore the playlist
+)
+
+/*
+Entry is a single track of a playlist file. Index is 1-based position in the file,
+zero Duration means the file does not specify it. ID is the library song ID, known only for JSON
+*/
+type Entry struct {
+	Index    int
+	ID       int
+	Location string
+	Title    string
+	Artist   string
+	Duration time.Duration
+}
+
+type Document struct {
+	Title       string
+	Description string
+	Entries     []Entry
+}
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimPrefix(s, "."))); f {
+	case FormatM3U, FormatM3U8, FormatPLS, FormatXSPF, FormatJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownFormat, s)
+}
+
+/*
+DetectFormat guesses format by file extension first and by content type then
+*/
+func DetectFormat(filename, contentType string) (Format, error) {
+	if ext := path.Ext(filename); ext != "" {
+		if f, err := ParseFormat(ext); err == nil {
+			return f, nil
+		}
+	}
+
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	switch strings.TrimSpace(mediaType) {
+	case "audio/x-mpegurl", "audio/mpegurl", "application/x-mpegurl":
+		return FormatM3U, nil
+	case "application/vnd.apple.mpegurl":
+		return FormatM3U8, nil
+	case "audio/x-scpls":
+		return FormatPLS, nil
+	case "application/xspf+xml":
+		return FormatXSPF, nil
+	case "application/json":
+		return FormatJSON, nil
+	}
+
+	return "", fmt.Errorf("%w: file %q, content type %q", ErrUnknownFormat, filename, contentType)
+}
+
+func Parse(format Format, r io.Reader) (*Document, error) {
+	switch format {
+	case FormatM3U, FormatM3U8:
+		return parseM3U(r)
+	case FormatPLS:
+		return parsePLS(r)
+	case FormatXSPF:
+		return parseXSPF(r)
+	case FormatJSON:
+		return parseJSON(r)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+func Write(format Format, doc *Document, w io.Writer) error {
+	switch format {
+	case FormatM3U, FormatM3U8:
+		return writeM3U(doc, w)
+	case FormatPLS:
+		return writePLS(doc, w)
+	case FormatXSPF:
+		return writeXSPF(doc, w)
+	case FormatJSON:
+		return writeJSON(doc, w)
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+func ContentType(format Format) string {
+	switch format {
+	case FormatM3U:
+		return "audio/x-mpegurl"
+	case FormatM3U8:
+		return "application/vnd.apple.mpegurl"
+	case FormatPLS:
+		return "audio/x-scpls"
+	case FormatXSPF:
+		return "application/xspf+xml"
+	case FormatJSON:
+		return "application/json"
+	}
+	return "application/octet-stream"
+}
+
+/*
+splitArtistTitle splits the common "Artist - Title" notation
+*/
+func splitArtistTitle(s string) (artist, title string) {
+	s = strings.TrimSpace(s)
+	if artist, title, ok := strings.Cut(s, " - "); ok {
+		return strings.TrimSpace(artist), strings.TrimSpace(title)
+	}
+	return "", s
+}
+
+/*
+titleFromLocation is used when a file has no metadata except the track location
+*/
+func titleFromLocation(location string) (artist, title string) {
+	location = strings.ReplaceAll(location, "\\", "/")
+	name := path.Base(location)
+	name = strings.TrimSuffix(name, path.Ext(name))
+	return splitArtistTitle(name)
+}
+
+/*
+displayName is the reverse of splitArtistTitle
+*/
+func displayName(entry Entry) string {
+	name := singleLine(entry.Title)
+	if entry.Artist != "" {
+		name = singleLine(entry.Artist) + " - " + name
+	}
+	return name
+}
+
+/*
+location returns track location for formats which require it.
+Library songs have no files, so "Artist - Title" is used, it is read back by titleFromLocation
+*/
+func location(entry Entry) string {
+	if entry.Location != "" {
+		return singleLine(entry.Location)
+	}
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(displayName(entry))
+}
+
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func secondsToDuration(seconds int) time.Duration {
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,154 @@
+package playlistio_test
+
+import (
+	"cloud-go-testtask/internal/playlistio"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExtendedM3U(t *testing.T) {
+	input := "\ufeff#EXTM3U\n" +
+		"#PLAYLIST:Road trip\n" +
+		"#EXTINF:183,John Lennon - Imagine\n" +
+		"music/imagine.mp3\n" +
+		"\n" +
+		"#EXTINF:-1 tvg-id=\"x\",Bohemian Rhapsody\n" +
+		"music/queen.mp3\n" +
+		"C:\\Music\\Nirvana - Lithium.flac\n"
+
+	doc, err := playlistio.Parse(playlistio.FormatM3U8, strings.NewReader(input))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Road trip", doc.Title)
+	assert.Equal(t, []playlistio.Entry{
+		{Index: 1, Location: "music/imagine.mp3", Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second},
+		{Index: 2, Location: "music/queen.mp3", Title: "Bohemian Rhapsody"},
+		{Index: 3, Location: "C:\\Music\\Nirvana - Lithium.flac", Title: "Lithium", Artist: "Nirvana"},
+	}, doc.Entries)
+}
+
+func TestParsePLS(t *testing.T) {
+	input := "[playlist]\n" +
+		"File2=b.mp3\n" +
+		"Title2=Queen - Bohemian Rhapsody\n" +
+		"Length2=354\n" +
+		"File1=a.mp3\n" +
+		"Title1=John Lennon - Imagine\n" +
+		"Length1=-1\n" +
+		"NumberOfEntries=2\n" +
+		"Version=2\n"
+
+	doc, err := playlistio.Parse(playlistio.FormatPLS, strings.NewReader(input))
+	require.NoError(t, err)
+
+	assert.Equal(t, []playlistio.Entry{
+		{Index: 1, Location: "a.mp3", Title: "Imagine", Artist: "John Lennon"},
+		{Index: 2, Location: "b.mp3", Title: "Bohemian Rhapsody", Artist: "Queen", Duration: 354 * time.Second},
+	}, doc.Entries)
+}
+
+func TestParsePLSMalformed(t *testing.T) {
+	_, err := playlistio.Parse(playlistio.FormatPLS, strings.NewReader("not a playlist"))
+	assert.ErrorIs(t, err, playlistio.ErrMalformed)
+}
+
+func TestParseXSPF(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <title>Classics</title>
+  <trackList>
+    <track>
+      <location>file:///music/imagine.mp3</location>
+      <title>Imagine</title>
+      <creator>John Lennon</creator>
+      <duration>183000</duration>
+    </track>
+    <track>
+      <location>file:///music/Queen%20-%20Bohemian.mp3</location>
+    </track>
+  </trackList>
+</playlist>`
+
+	doc, err := playlistio.Parse(playlistio.FormatXSPF, strings.NewReader(input))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Classics", doc.Title)
+	require.Len(t, doc.Entries, 2)
+	assert.Equal(t, playlistio.Entry{
+		Index: 1, Location: "file:///music/imagine.mp3", Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second,
+	}, doc.Entries[0])
+	assert.Equal(t, 2, doc.Entries[1].Index)
+	assert.NotEmpty(t, doc.Entries[1].Title)
+
+	_, err = playlistio.Parse(playlistio.FormatXSPF, strings.NewReader("<playlist>"))
+	assert.ErrorIs(t, err, playlistio.ErrMalformed)
+}
+
+func TestDetectFormat(t *testing.T) {
+	cases := []struct {
+		filename    string
+		contentType string
+		want        playlistio.Format
+	}{
+		{"mix.M3U8", "", playlistio.FormatM3U8},
+		{"mix.pls", "application/octet-stream", playlistio.FormatPLS},
+		{"", "application/xspf+xml; charset=utf-8", playlistio.FormatXSPF},
+		{"upload", "audio/x-mpegurl", playlistio.FormatM3U},
+	}
+	for _, c := range cases {
+		got, err := playlistio.DetectFormat(c.filename, c.contentType)
+		require.NoError(t, err, c.filename)
+		assert.Equal(t, c.want, got)
+	}
+
+	_, err := playlistio.DetectFormat("mix.txt", "text/plain")
+	assert.ErrorIs(t, err, playlistio.ErrUnknownFormat)
+}
+
+func TestWriteParseRoundTrip(t *testing.T) {
+	doc := &playlistio.Document{
+		Title:       "Classics",
+		Description: "Songs everybody knows",
+		Entries: []playlistio.Entry{
+			{Index: 1, ID: 7, Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second},
+			{Index: 2, ID: 3, Title: "Bohemian Rhapsody", Artist: "Queen", Duration: 354 * time.Second},
+		},
+	}
+
+	for _, format := range []playlistio.Format{playlistio.FormatM3U, playlistio.FormatPLS, playlistio.FormatXSPF, playlistio.FormatJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf strings.Builder
+			require.NoError(t, playlistio.Write(format, doc, &buf))
+
+			parsed, err := playlistio.Parse(format, strings.NewReader(buf.String()))
+			require.NoError(t, err)
+			require.Len(t, parsed.Entries, len(doc.Entries))
+			for i, entry := range parsed.Entries {
+				assert.Equal(t, doc.Entries[i].Title, entry.Title)
+				assert.Equal(t, doc.Entries[i].Artist, entry.Artist)
+				assert.Equal(t, doc.Entries[i].Duration, entry.Duration)
+			}
+		})
+	}
+}
+
+func TestJSONIsLossless(t *testing.T) {
+	doc := &playlistio.Document{
+		Title:       "Mix",
+		Description: "Two  spaces - and a dash",
+		Entries: []playlistio.Entry{
+			{Index: 1, ID: 1, Title: "Title - With Dash", Artist: "", Duration: 61 * time.Second},
+			{Index: 2, ID: 2, Title: "Song", Artist: "Artist", Location: "music/song.mp3"},
+		},
+	}
+
+	var buf strings.Builder
+	require.NoError(t, playlistio.Write(playlistio.FormatJSON, doc, &buf))
+
+	parsed, err := playlistio.Parse(playlistio.FormatJSON, strings.NewReader(buf.String()))
+	require.NoError(t, err)
+	assert.Equal(t, doc, parsed)
+}
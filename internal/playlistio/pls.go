@@ -0,0 +1,120 @@
+package playlistio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+parsePLS parses INI-like PLS files:
+[playlist]
+File1=music/imagine.mp3
+Title1=John Lennon - Imagine
+Length1=183
+NumberOfEntries=1
+*/
+func parsePLS(r io.Reader) (*Document, error) {
+	scanner := bufio.NewScanner(r)
+	entries := make(map[int]*Entry)
+	sawHeader := false
+
+	for scanner.Scan() {
+		line := strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "\ufeff")
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			sawHeader = strings.EqualFold(line, "[playlist]")
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: unexpected line %q", ErrMalformed, line)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		var field string
+		for _, prefix := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, prefix) {
+				field = prefix
+				break
+			}
+		}
+		if field == "" {
+			continue // NumberOfEntries, Version and unknown keys
+		}
+
+		n, err := strconv.Atoi(strings.TrimPrefix(key, field))
+		if err != nil || n <= 0 {
+			continue
+		}
+
+		entry, ok := entries[n]
+		if !ok {
+			entry = &Entry{}
+			entries[n] = entry
+		}
+
+		switch field {
+		case "file":
+			entry.Location = value
+		case "title":
+			entry.Artist, entry.Title = splitArtistTitle(value)
+		case "length":
+			if seconds, err := strconv.Atoi(value); err == nil {
+				entry.Duration = secondsToDuration(seconds)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !sawHeader && len(entries) == 0 {
+		return nil, fmt.Errorf("%w: no [playlist] section", ErrMalformed)
+	}
+
+	numbers := make([]int, 0, len(entries))
+	for n := range entries {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	doc := &Document{}
+	for _, n := range numbers {
+		entry := *entries[n]
+		if entry.Location == "" {
+			continue
+		}
+		if entry.Title == "" {
+			entry.Artist, entry.Title = titleFromLocation(entry.Location)
+		}
+		entry.Index = len(doc.Entries) + 1
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return doc, nil
+}
+
+func writePLS(doc *Document, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	bw.WriteString("[playlist]\n")
+	for i, entry := range doc.Entries {
+		n := i + 1
+		seconds := -1
+		if entry.Duration > 0 {
+			seconds = int(entry.Duration.Seconds())
+		}
+		fmt.Fprintf(bw, "File%d=%s\nTitle%d=%s\nLength%d=%d\n", n, location(entry), n, displayName(entry), n, seconds)
+	}
+	fmt.Fprintf(bw, "NumberOfEntries=%d\nVersion=2\n", len(doc.Entries))
+
+	return bw.Flush()
+}
@@ -0,0 +1,81 @@
+package playlistio
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type xspfPlaylist struct {
+	XMLName    xml.Name    `xml:"playlist"`
+	Version    string      `xml:"version,attr"`
+	Namespace  string      `xml:"xmlns,attr"`
+	Title      string      `xml:"title,omitempty"`
+	Annotation string      `xml:"annotation,omitempty"`
+	Tracks     []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location   string `xml:"location,omitempty"`
+	Identifier string `xml:"identifier,omitempty"`
+	Title      string `xml:"title,omitempty"`
+	Creator    string `xml:"creator,omitempty"`
+	Duration   int64  `xml:"duration,omitempty"` // milliseconds
+}
+
+func parseXSPF(r io.Reader) (*Document, error) {
+	var pl xspfPlaylist
+	if err := xml.NewDecoder(r).Decode(&pl); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	doc := &Document{Title: strings.TrimSpace(pl.Title), Description: strings.TrimSpace(pl.Annotation)}
+	for _, track := range pl.Tracks {
+		entry := Entry{
+			Index:    len(doc.Entries) + 1,
+			Location: strings.TrimSpace(track.Location),
+			Title:    strings.TrimSpace(track.Title),
+			Artist:   strings.TrimSpace(track.Creator),
+		}
+		if track.Duration > 0 {
+			entry.Duration = time.Duration(track.Duration) * time.Millisecond
+		}
+		if entry.Title == "" && entry.Location != "" {
+			entry.Artist, entry.Title = titleFromLocation(entry.Location)
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return doc, nil
+}
+
+func writeXSPF(doc *Document, w io.Writer) error {
+	pl := xspfPlaylist{
+		Version:    "1",
+		Namespace:  "http://xspf.org/ns/0/",
+		Title:      doc.Title,
+		Annotation: doc.Description,
+		Tracks:     make([]xspfTrack, 0, len(doc.Entries)),
+	}
+	for _, entry := range doc.Entries {
+		pl.Tracks = append(pl.Tracks, xspfTrack{
+			Location: entry.Location,
+			Title:    entry.Title,
+			Creator:  entry.Artist,
+			Duration: entry.Duration.Milliseconds(),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(pl); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -3,12 +3,14 @@ package cache
 import (
 	"cloud-go-testtask/internal/entity"
 	"cloud-go-testtask/internal/repository"
+	"context"
 	"sync"
 )
 
 /*
 PlaylistRepositoryCache is an imitation of repository realization with linked list and synchronization
-AddSong is a method of PlaylistRepository to add a node to linked list
+AddSong is a method of PlaylistRepository to add a node to linked list.
+Methods take context to implement repository interfaces, in-memory operations don't block on it
 */
 type PlaylistRepositoryCache struct {
 	mu       sync.RWMutex
@@ -21,7 +23,7 @@ func NewPlaylistRepositoryCache() *PlaylistRepositoryCache {
 	}
 }
 
-func (r *PlaylistRepositoryCache) AddSong(song *entity.Song) error {
+func (r *PlaylistRepositoryCache) AddSong(ctx context.Context, song *entity.Song) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -35,7 +37,7 @@ func (r *PlaylistRepositoryCache) AddSong(song *entity.Song) error {
 
 }
 
-func (r *PlaylistRepositoryCache) GetPlaylist() (*entity.Playlist, error) {
+func (r *PlaylistRepositoryCache) GetPlaylist(ctx context.Context) (*entity.Playlist, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -46,14 +48,54 @@ func (r *PlaylistRepositoryCache) GetPlaylist() (*entity.Playlist, error) {
 	return r.playlist, nil
 }
 
-func (r *PlaylistRepositoryCache) SetCurrent(node *entity.PlaylistNode) error {
+/*
+SetCurrent makes the song of node current. The node may come from another copy of the playlist,
+then the node of the cached list holding the same song becomes current, so Prev and Next stay valid
+*/
+func (r *PlaylistRepositoryCache) SetCurrent(ctx context.Context, node *entity.PlaylistNode) error {
+	if node == nil || node.Song == nil {
+		return repository.ErrNilNode
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	return r.playlist.SetCurrent(node)
+
+	own := findNode(r.playlist, node)
+	if own == nil {
+		return repository.ErrCurrentSongNotFound
+	}
+	return r.playlist.SetCurrent(own)
 }
 
-func (r *PlaylistRepositoryCache) GetCurrent() (*entity.PlaylistNode, error) {
+func (r *PlaylistRepositoryCache) GetCurrent(ctx context.Context) (*entity.PlaylistNode, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	return r.playlist.GetCurrent(), nil
 }
+
+func (r *PlaylistRepositoryCache) LoadPlaylist(ctx context.Context, playlist *entity.Playlist) error {
+	if playlist == nil {
+		return repository.ErrNullPlaylist
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.playlist = playlist
+	return nil
+}
+
+/*
+findNode returns node itself if it belongs to playlist, otherwise the first node with the same song
+*/
+func findNode(playlist *entity.Playlist, node *entity.PlaylistNode) *entity.PlaylistNode {
+	var sameSong *entity.PlaylistNode
+	for n := playlist.GetHead(); n != nil; n = n.Next {
+		if n == node {
+			return n
+		}
+		if sameSong == nil && n.Song.ID == node.Song.ID {
+			sameSong = n
+		}
+	}
+	return sameSong
+}
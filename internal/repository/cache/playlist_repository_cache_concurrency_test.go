@@ -3,12 +3,14 @@ package cache_test
 import (
 	"cloud-go-testtask/internal/entity"
 	"cloud-go-testtask/internal/repository/cache"
+	"context"
 	"sync"
 	"testing"
 	"time"
 )
 
 func TestAddSongConcurrency(t *testing.T) {
+	ctx := context.Background()
 	repo := cache.NewPlaylistRepositoryCache()
 	numGoroutines := 20
 	songsPerGoroutine := 1000
@@ -28,7 +30,7 @@ func TestAddSongConcurrency(t *testing.T) {
 					Title:    "Concurrent Song",
 					Duration: 3 * time.Minute,
 				}
-				err := repo.AddSong(song)
+				err := repo.AddSong(ctx, song)
 				if err != nil {
 					errChan <- err
 				}
@@ -45,7 +47,7 @@ func TestAddSongConcurrency(t *testing.T) {
 		}
 	}
 
-	playlist, err := repo.GetPlaylist()
+	playlist, err := repo.GetPlaylist(ctx)
 	if err != nil {
 		t.Fatalf("failed to get playlist: %v", err)
 	}
@@ -0,0 +1,14 @@
+package cache_test
+
+import (
+	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/repository/cache"
+	"cloud-go-testtask/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestCacheConformance(t *testing.T) {
+	repositorytest.RunPlaylistRepository(t, func(t *testing.T) repository.PlaylistRepository {
+		return cache.NewPlaylistRepositoryCache()
+	})
+}
@@ -4,12 +4,14 @@ import (
 	"cloud-go-testtask/internal/entity"
 	"cloud-go-testtask/internal/repository"
 	"cloud-go-testtask/internal/repository/cache"
+	"context"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
 )
 
 func TestAddSong(t *testing.T) {
+	ctx := context.Background()
 	repo := cache.NewPlaylistRepositoryCache()
 
 	testSong := &entity.Song{
@@ -18,10 +20,10 @@ func TestAddSong(t *testing.T) {
 		Duration: 10 * time.Second,
 	}
 
-	err := repo.AddSong(testSong)
+	err := repo.AddSong(ctx, testSong)
 	assert.NoError(t, err)
 
-	playlist, err := repo.GetPlaylist()
+	playlist, err := repo.GetPlaylist(ctx)
 	assert.NoError(t, err)
 	assert.NotNil(t, playlist)
 
@@ -32,7 +34,7 @@ func TestAddSong(t *testing.T) {
 func TestAddNilSong(t *testing.T) {
 	repo := cache.NewPlaylistRepositoryCache()
 
-	err := repo.AddSong(nil)
+	err := repo.AddSong(context.Background(), nil)
 
 	assert.Error(t, err)
 	assert.Equal(t, repository.ErrNullSong, err)
@@ -41,7 +43,7 @@ func TestAddNilSong(t *testing.T) {
 func TestPlaylistNotInitialized(t *testing.T) {
 	repo := &cache.PlaylistRepositoryCache{}
 
-	_, err := repo.GetPlaylist()
+	_, err := repo.GetPlaylist(context.Background())
 	assert.Error(t, err)
 	assert.Equal(t, repository.ErrPlaylistNotInitialized, err)
 }
@@ -0,0 +1,14 @@
+package file
+
+/*
+Crash drops the repository the way a killed process does: the files are closed without a snapshot
+and the kernel releases the lock of the directory
+*/
+func (r *PlaylistRepositoryFile) Crash() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.log.Close()
+	r.log = nil
+	r.lock.Close()
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+)
+
+/*
+lockDir only creates the lock file, there is no flock outside unix and the directory is not
+protected from other processes
+*/
+func lockDir(dir string) (*os.File, error) {
+	return os.OpenFile(filepath.Join(dir, lockFileName), os.O_RDWR|os.O_CREATE, 0o644)
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package file_test
+
+import (
+	"cloud-go-testtask/internal/repository/file"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestFileRepositoryLock(t *testing.T) {
+	dir := t.TempDir()
+	repo := openRepo(t, dir)
+
+	// flock belongs to the open file, a second open conflicts even in the same process
+	_, err := file.NewPlaylistRepositoryFile(dir)
+	assert.ErrorIs(t, err, file.ErrLocked)
+
+	// the lock is released by Close and by the death of the process
+	require.NoError(t, repo.Close())
+	repo = openRepo(t, dir)
+	repo.Crash()
+	repo = openRepo(t, dir)
+	require.NoError(t, repo.Close())
+}
@@ -0,0 +1,215 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	logFileName      = "wal.log"
+	snapshotFileName = "snapshot.json"
+	lockFileName     = "lock"
+)
+
+/*
+entry is one line of the log: records written together, e.g. by one transaction.
+Lines are "<crc32 of json, 8 hex digits> <json>\n", a torn last line is detected by the checksum
+*/
+type entry struct {
+	Seq     uint64   `json:"seq"`
+	Records []record `json:"records"`
+}
+
+type snapshot struct {
+	Seq   uint64 `json:"seq"` // last log entry included into the state
+	State *state `json:"state"`
+}
+
+/*
+Recovery describes what NewPlaylistRepositoryFile found on disk, it is kept for logging by the caller
+*/
+type Recovery struct {
+	SnapshotSeq    uint64
+	Replayed       int   // log entries applied on top of the snapshot
+	TruncatedBytes int64 // size of the torn tail cut off the log
+}
+
+func loadSnapshot(dir string) (*snapshot, error) {
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return &snapshot{State: newState()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil || snap.State == nil {
+		return nil, fmt.Errorf("%w: invalid snapshot", ErrCorrupted)
+	}
+	// maps are null in JSON of a state without rows
+	if snap.State.Songs == nil {
+		snap.State.Songs = map[int]*songRow{}
+	}
+	if snap.State.Playlists == nil {
+		snap.State.Playlists = map[int]*playlistRow{}
+	}
+	if snap.State.SmartPlaylists == nil {
+		snap.State.SmartPlaylists = map[int]*smartPlaylistRow{}
+	}
+	return &snap, nil
+}
+
+/*
+writeSnapshot replaces the snapshot atomically: the new one is written to a temporary file,
+synced and renamed over the old one
+*/
+func writeSnapshot(dir string, snap snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, snapshotFileName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after successful rename
+
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, snapshotFileName)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+/*
+replayLog applies log entries newer than the snapshot to its state. Entries up to snapshot seq
+are left from a crash between writing the snapshot and truncating the log and are skipped.
+A line failing the checksum at the end of the log is a write torn by a crash, it was never
+acknowledged and is cut off. Damage before the end is reported as ErrCorrupted
+*/
+func replayLog(f *os.File, snap *snapshot) (lastSeq uint64, rec Recovery, err error) {
+	rec.SnapshotSeq = snap.Seq
+	lastSeq = snap.Seq
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, rec, err
+	}
+
+	reader := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) == 0 && errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return 0, rec, readErr
+		}
+
+		e, ok := decodeEntry(line)
+		if !ok {
+			rest, err := io.Copy(io.Discard, reader)
+			if err != nil {
+				return 0, rec, err
+			}
+			if rest > 0 {
+				return 0, rec, fmt.Errorf("%w: broken log entry at offset %d", ErrCorrupted, offset)
+			}
+			rec.TruncatedBytes = int64(len(line))
+			if err := f.Truncate(offset); err != nil {
+				return 0, rec, err
+			}
+			break
+		}
+
+		if e.Seq > snap.Seq {
+			if e.Seq != lastSeq+1 {
+				return 0, rec, fmt.Errorf("%w: log entry %d follows %d", ErrCorrupted, e.Seq, lastSeq)
+			}
+			for _, r := range e.Records {
+				if err := snap.State.apply(r); err != nil {
+					return 0, rec, fmt.Errorf("log entry %d: %w", e.Seq, err)
+				}
+			}
+			lastSeq = e.Seq
+			rec.Replayed++
+		}
+
+		offset += int64(len(line))
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+	}
+
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		return 0, rec, err
+	}
+	return lastSeq, rec, nil
+}
+
+func encodeEntry(e entry) ([]byte, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	line := make([]byte, 0, len(data)+10)
+	line = fmt.Appendf(line, "%08x ", crc32.ChecksumIEEE(data))
+	line = append(line, data...)
+	return append(line, '\n'), nil
+}
+
+func decodeEntry(line []byte) (entry, bool) {
+	var e entry
+
+	line, ok := bytes.CutSuffix(line, []byte("\n"))
+	if !ok || len(line) < 10 || line[8] != ' ' {
+		return e, false
+	}
+
+	sum, err := strconv.ParseUint(string(line[:8]), 16, 32)
+	if err != nil || uint32(sum) != crc32.ChecksumIEEE(line[9:]) {
+		return e, false
+	}
+	if err := json.Unmarshal(line[9:], &e); err != nil {
+		return e, false
+	}
+	return e, true
+}
+
+/*
+syncDir makes a rename or a file creation in dir durable
+*/
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,563 @@
+package file
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCorrupted = errors.New("storage files are corrupted")
+	ErrClosed    = errors.New("storage is closed")
+	ErrLocked    = errors.New("storage is used by another process")
+)
+
+const defaultSnapshotEvery = 1000
+
+/*
+PlaylistRepositoryFile keeps the library, playlists and playback state in memory and persists
+every change to an append-only log in dir before acknowledging it. Every snapshotEvery log entries
+the state is written to a snapshot and the log starts over. On start the snapshot is loaded
+and the log is replayed on top of it, a write torn by a crash is cut off the log.
+It is meant for a single process: the directory is locked while the repository is open
+and NewPlaylistRepositoryFile fails with ErrLocked if another process holds it
+*/
+type PlaylistRepositoryFile struct {
+	mu sync.RWMutex
+
+	dir     string
+	lock    *os.File // holds the lock of dir until Close
+	log     *os.File // nil after Close
+	logSize int64
+	seq     uint64 // last written log entry
+	state   *state
+
+	sinceSnapshot     int
+	snapshotEvery     int
+	defaultPlaylistID int
+	recovery          Recovery
+	now               func() time.Time
+	observer          repository.MethodObserver // nil if not instrumented
+}
+
+func NewPlaylistRepositoryFile(dir string) (*PlaylistRepositoryFile, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	lock, err := lockDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	snap, err := loadSnapshot(dir)
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	log, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	seq, recovery, err := replayLog(log, snap)
+	if err != nil {
+		log.Close()
+		lock.Close()
+		return nil, err
+	}
+
+	size, err := log.Seek(0, io.SeekCurrent)
+	if err != nil {
+		log.Close()
+		lock.Close()
+		return nil, err
+	}
+
+	r := &PlaylistRepositoryFile{
+		dir:           dir,
+		lock:          lock,
+		log:           log,
+		logSize:       size,
+		seq:           seq,
+		state:         snap.State,
+		sinceSnapshot: recovery.Replayed,
+		snapshotEvery: defaultSnapshotEvery,
+		recovery:      recovery,
+		now:           func() time.Time { return time.Now().UTC().Truncate(time.Microsecond) },
+	}
+
+	if seq == 0 {
+		if err := r.seed(); err != nil {
+			log.Close()
+			lock.Close()
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+/*
+seed writes the same default playlist the SQL migrations create
+*/
+func (r *PlaylistRepositoryFile) seed() error {
+	return r.update(context.Background(), func(w *writer) error {
+		now := r.now()
+		w.records = []record{
+			{Op: opPlaylistCreated, Playlist: &playlistRow{ID: 1, Name: "Default Playlist", Description: "This is the default playlist", CreatedAt: now, SongIDs: []int{}}},
+			{Op: opSongAdded, Song: &songRow{ID: 1, Title: "Default Song 1", Artist: "Default Artist 1", Duration: 300, AddedAt: now}},
+			{Op: opSongAdded, Song: &songRow{ID: 2, Title: "Default Song 2", Artist: "Default Artist 2", Duration: 250, AddedAt: now}},
+			{Op: opPlaylistSongAdded, PlaylistID: 1, ID: 1},
+			{Op: opPlaylistSongAdded, PlaylistID: 1, ID: 2},
+		}
+		return nil
+	})
+}
+
+func (r *PlaylistRepositoryFile) SetDefaultPlaylistID(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defaultPlaylistID = id
+}
+
+/*
+SetMethodObserver instruments the repository, it must be called before the repository is used
+*/
+func (r *PlaylistRepositoryFile) SetMethodObserver(observer repository.MethodObserver) {
+	r.observer = observer
+}
+
+/*
+observe reports the duration of method started at start, use as defer r.observe("Method", time.Now())
+*/
+func (r *PlaylistRepositoryFile) observe(method string, start time.Time) {
+	if r.observer != nil {
+		r.observer(method, time.Since(start))
+	}
+}
+
+/*
+SetSnapshotEvery sets how many log entries are written between snapshots
+*/
+func (r *PlaylistRepositoryFile) SetSnapshotEvery(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.snapshotEvery = max(n, 1)
+}
+
+/*
+Recovery returns what was found on disk when the repository was opened
+*/
+func (r *PlaylistRepositoryFile) Recovery() Recovery {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.recovery
+}
+
+/*
+Snapshot writes the state to the snapshot file and empties the log
+*/
+func (r *PlaylistRepositoryFile) Snapshot() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.log == nil {
+		return ErrClosed
+	}
+	return r.snapshotLocked()
+}
+
+/*
+Close writes a final snapshot, so the next start doesn't need to replay the log
+*/
+func (r *PlaylistRepositoryFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.log == nil {
+		return nil
+	}
+
+	snapErr := r.snapshotLocked()
+	err := r.log.Close()
+	r.log = nil
+	// the lock goes last, another process must not open the directory before the snapshot is written
+	lockErr := r.lock.Close()
+	return errors.Join(snapErr, err, lockErr)
+}
+
+func (r *PlaylistRepositoryFile) snapshotLocked() error {
+	if err := writeSnapshot(r.dir, snapshot{Seq: r.seq, State: r.state}); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	// entries up to seq are in the snapshot now, if truncation fails they are skipped on replay
+	if err := r.log.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate log: %w", err)
+	}
+	r.logSize = 0
+	r.sinceSnapshot = 0
+	return nil
+}
+
+/*
+update runs fn collecting records of a change and commits them. Records are applied to the state
+only after they are in the log, so fn validates the change against the current state itself.
+Nothing is written if ctx is done while waiting for other writers
+*/
+func (r *PlaylistRepositoryFile) update(ctx context.Context, fn func(w *writer) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.log == nil {
+		return ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	w := r.writer()
+	if err := fn(w); err != nil {
+		return err
+	}
+	return r.commit(w.records)
+}
+
+/*
+writer returns a writer over the state, reads made through it see the state as is.
+Must be called under lock
+*/
+func (r *PlaylistRepositoryFile) writer() *writer {
+	return &writer{state: r.state, defaultPlaylistID: r.defaultPlaylistID, now: r.now}
+}
+
+/*
+commit appends records as one log entry, syncs it and applies records to the state.
+A failed write is cut off, so the log never has garbage in the middle
+*/
+func (r *PlaylistRepositoryFile) commit(records []record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	line, err := encodeEntry(entry{Seq: r.seq + 1, Records: records})
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.log.Write(line); err != nil {
+		return errors.Join(fmt.Errorf("failed to write log: %w", err), r.log.Truncate(r.logSize))
+	}
+	if err := r.log.Sync(); err != nil {
+		return errors.Join(fmt.Errorf("failed to sync log: %w", err), r.log.Truncate(r.logSize))
+	}
+	r.logSize += int64(len(line))
+	r.seq++
+
+	for _, rec := range records {
+		if err := r.state.apply(rec); err != nil {
+			return err
+		}
+	}
+
+	r.sinceSnapshot++
+	if r.sinceSnapshot >= r.snapshotEvery {
+		// the change is durable in the log already, a failed snapshot is retried after the next write
+		_ = r.snapshotLocked()
+	}
+	return nil
+}
+
+/*
+ Methods for Playlist CRUD implementation
+*/
+
+func (r *PlaylistRepositoryFile) CreatePlaylist(ctx context.Context, name, description string) (int, error) {
+	defer r.observe("CreatePlaylist", time.Now())
+	var id int
+	err := r.update(ctx, func(w *writer) error {
+		var err error
+		id, err = w.CreatePlaylist(ctx, name, description)
+		return err
+	})
+	return id, err
+}
+
+func (r *PlaylistRepositoryFile) FindPlaylistIDByName(ctx context.Context, name string) (int, error) {
+	defer r.observe("FindPlaylistIDByName", time.Now())
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id := 0
+	for _, p := range r.state.Playlists {
+		if p.Name == name && (id == 0 || p.ID < id) {
+			id = p.ID
+		}
+	}
+	if id == 0 {
+		return 0, repository.ErrPlaylistNotFound
+	}
+	return id, nil
+}
+
+/*
+GetPlaylistByID loads playlist with its songs in order. An empty playlist is not an error
+*/
+func (r *PlaylistRepositoryFile) GetPlaylistByID(ctx context.Context, id int) (*entity.Playlist, error) {
+	defer r.observe("GetPlaylistByID", time.Now())
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.state.playlist(id)
+}
+
+func (r *PlaylistRepositoryFile) UpdatePlaylistCurrentSong(ctx context.Context, playlistID, songID int) error {
+	defer r.observe("UpdatePlaylistCurrentSong", time.Now())
+	return r.update(ctx, func(w *writer) error {
+		return w.setCurrent(playlistID, songID)
+	})
+}
+
+/*
+DeletePlaylistByID removes the playlist. The file does not version playlists, so version is ignored
+*/
+func (r *PlaylistRepositoryFile) DeletePlaylistByID(ctx context.Context, id, version int) error {
+	defer r.observe("DeletePlaylistByID", time.Now())
+	return r.update(ctx, func(w *writer) error {
+		if w.state.Playlists[id] == nil {
+			return repository.ErrPlaylistNotFound
+		}
+		return w.write(record{Op: opPlaylistDeleted, ID: id})
+	})
+}
+
+/*
+ Methods for Song CRUD implementation
+*/
+
+/*
+AddSong adds song to library, sets its ID and appends it to the default playlist if one is set
+*/
+func (r *PlaylistRepositoryFile) AddSong(ctx context.Context, song *entity.Song) error {
+	defer r.observe("AddSong", time.Now())
+	return r.update(ctx, func(w *writer) error {
+		return w.AddSong(ctx, song)
+	})
+}
+
+/*
+InsertSong adds song to library only and sets its ID
+*/
+func (r *PlaylistRepositoryFile) InsertSong(ctx context.Context, song *entity.Song) error {
+	defer r.observe("InsertSong", time.Now())
+	return r.update(ctx, func(w *writer) error {
+		return w.InsertSong(ctx, song)
+	})
+}
+
+/*
+FindSong looks up library song by title and artist ignoring case.
+With empty artist the title must be unique in library
+*/
+func (r *PlaylistRepositoryFile) FindSong(ctx context.Context, title, artist string) (*entity.Song, error) {
+	defer r.observe("FindSong", time.Now())
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var found []*songRow
+	for _, s := range r.state.Songs {
+		if strings.EqualFold(s.Title, title) && (artist == "" || strings.EqualFold(s.Artist, artist)) {
+			found = append(found, s)
+		}
+	}
+
+	if len(found) == 0 || (artist == "" && len(found) > 1) {
+		return nil, repository.ErrSongNotFound
+	}
+
+	first := slices.MinFunc(found, func(a, b *songRow) int { return a.ID - b.ID })
+	return first.toEntity(), nil
+}
+
+func (r *PlaylistRepositoryFile) GetSongByID(ctx context.Context, id int) (*entity.Song, error) {
+	defer r.observe("GetSongByID", time.Now())
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.writer().GetSongByID(ctx, id)
+}
+
+func (r *PlaylistRepositoryFile) UpdateSong(ctx context.Context, song *entity.Song) error {
+	defer r.observe("UpdateSong", time.Now())
+	return r.update(ctx, func(w *writer) error {
+		return w.UpdateSong(ctx, song)
+	})
+}
+
+/*
+DeleteSong removes song from library and all playlists.
+Playlists where it was current are left without current song.
+The file does not version songs, so version is ignored
+*/
+func (r *PlaylistRepositoryFile) DeleteSong(ctx context.Context, id, version int) error {
+	defer r.observe("DeleteSong", time.Now())
+	return r.update(ctx, func(w *writer) error {
+		return w.DeleteSong(ctx, id, version)
+	})
+}
+
+func (r *PlaylistRepositoryFile) IncrementPlayCount(ctx context.Context, songID int) error {
+	defer r.observe("IncrementPlayCount", time.Now())
+	return r.update(ctx, func(w *writer) error {
+		if w.state.Songs[songID] == nil {
+			return nil
+		}
+		return w.write(record{Op: opSongPlayed, ID: songID})
+	})
+}
+
+/*
+ Methods for Song-Playlist relations
+*/
+
+func (r *PlaylistRepositoryFile) AddSongToPlaylist(ctx context.Context, playlistID, songID int) error {
+	defer r.observe("AddSongToPlaylist", time.Now())
+	return r.update(ctx, func(w *writer) error {
+		return w.AddSongToPlaylist(ctx, playlistID, songID)
+	})
+}
+
+func (r *PlaylistRepositoryFile) RemoveSongFromPlaylist(ctx context.Context, playlistID, songID int) error {
+	defer r.observe("RemoveSongFromPlaylist", time.Now())
+	return r.update(ctx, func(w *writer) error {
+		return w.RemoveSongFromPlaylist(ctx, playlistID, songID)
+	})
+}
+
+/*
+SetPlaylistOrder puts songs of the playlist in the given order. Songs of the playlist missing
+in songIDs are moved to the end keeping their relative order. The file does not version playlists,
+so version is ignored
+*/
+func (r *PlaylistRepositoryFile) SetPlaylistOrder(ctx context.Context, playlistID int, songIDs []int, version int) error {
+	defer r.observe("SetPlaylistOrder", time.Now())
+	return r.update(ctx, func(w *writer) error {
+		return w.SetPlaylistOrder(ctx, playlistID, songIDs, version)
+	})
+}
+
+/*
+ PlaylistRepository interface methods impl
+*/
+
+func (r *PlaylistRepositoryFile) GetPlaylist(ctx context.Context) (*entity.Playlist, error) {
+	defer r.observe("GetPlaylist", time.Now())
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.writer().GetPlaylist(ctx)
+}
+
+func (r *PlaylistRepositoryFile) SetCurrent(ctx context.Context, node *entity.PlaylistNode) error {
+	defer r.observe("SetCurrent", time.Now())
+	return r.update(ctx, func(w *writer) error {
+		return w.SetCurrent(ctx, node)
+	})
+}
+
+/*
+SaveCheckpoint stores the current song of the default playlist together with the position within it
+and whether it is playing
+*/
+func (r *PlaylistRepositoryFile) SaveCheckpoint(ctx context.Context, checkpoint repository.Checkpoint) error {
+	defer r.observe("SaveCheckpoint", time.Now())
+	return r.update(ctx, func(w *writer) error {
+		if r.defaultPlaylistID == 0 {
+			return repository.ErrDefaultPlaylistNotSet
+		}
+		p := w.state.Playlists[r.defaultPlaylistID]
+		if p == nil {
+			return repository.ErrPlaylistNotFound
+		}
+		if !slices.Contains(p.SongIDs, checkpoint.SongID) {
+			return repository.ErrCurrentSongNotFound
+		}
+		return w.write(record{
+			Op:         opCheckpointSaved,
+			PlaylistID: r.defaultPlaylistID,
+			ID:         checkpoint.SongID,
+			PositionMS: checkpoint.Position.Milliseconds(),
+			Playing:    checkpoint.Playing,
+		})
+	})
+}
+
+func (r *PlaylistRepositoryFile) LoadCheckpoint(ctx context.Context) (repository.Checkpoint, error) {
+	defer r.observe("LoadCheckpoint", time.Now())
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.defaultPlaylistID == 0 {
+		return repository.Checkpoint{}, repository.ErrDefaultPlaylistNotSet
+	}
+	p := r.state.Playlists[r.defaultPlaylistID]
+	if p == nil {
+		return repository.Checkpoint{}, repository.ErrPlaylistNotFound
+	}
+	return repository.Checkpoint{SongID: p.CurrentSongID, Position: time.Duration(p.PositionMS) * time.Millisecond, Playing: p.Playing}, nil
+}
+
+/*
+GetCurrent returns the current node of the default playlist linked with its neighbours.
+Without stored current song the first song is current, as in GetPlaylist
+*/
+func (r *PlaylistRepositoryFile) GetCurrent(ctx context.Context) (*entity.PlaylistNode, error) {
+	defer r.observe("GetCurrent", time.Now())
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.writer().GetCurrent(ctx)
+}
+
+/*
+playlist builds entity from the stored rows, songs are copies of the state
+*/
+func (s *state) playlist(id int) (*entity.Playlist, error) {
+	p := s.Playlists[id]
+	if p == nil {
+		return nil, repository.ErrPlaylistNotFound
+	}
+
+	playlist := &entity.Playlist{ID: p.ID, Name: p.Name, Description: p.Description}
+
+	var currentNode *entity.PlaylistNode
+	for _, songID := range p.SongIDs {
+		node := playlist.AddToEnd(s.Songs[songID].toEntity())
+		if songID == p.CurrentSongID {
+			currentNode = node
+		}
+	}
+
+	if p.CurrentSongID != 0 && currentNode == nil {
+		return nil, repository.ErrCurrentSongNotFound
+	}
+	if currentNode != nil {
+		if err := playlist.SetCurrent(currentNode); err != nil {
+			return nil, err
+		}
+	}
+
+	return playlist, nil
+}
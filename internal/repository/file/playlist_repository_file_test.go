@@ -0,0 +1,379 @@
+package file_test
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/repository/file"
+	"cloud-go-testtask/internal/repository/repositorytest"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openRepo(t *testing.T, dir string) *file.PlaylistRepositoryFile {
+	t.Helper()
+
+	repo, err := file.NewPlaylistRepositoryFile(dir)
+	require.NoError(t, err)
+	repo.SetDefaultPlaylistID(1)
+	return repo
+}
+
+/*
+fill makes a few changes of every kind and returns id of the added song
+*/
+func fill(t *testing.T, repo *file.PlaylistRepositoryFile) int {
+	t.Helper()
+	ctx := context.Background()
+
+	song := &entity.Song{Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second}
+	require.NoError(t, repo.AddSong(ctx, song))
+	assert.ErrorIs(t, repo.AddSongToPlaylist(ctx, 1, song.ID), repository.ErrSongAlreadyInPlaylist)
+	require.NoError(t, repo.SetPlaylistOrder(ctx, 1, []int{song.ID}, 0))
+	require.NoError(t, repo.UpdatePlaylistCurrentSong(ctx, 1, song.ID))
+	require.NoError(t, repo.IncrementPlayCount(ctx, song.ID))
+
+	_, err := repo.CreateSmartPlaylist(ctx, &entity.SmartPlaylist{Name: "Short", SortBy: entity.SmartSortMostPlayed})
+	require.NoError(t, err)
+	return song.ID
+}
+
+func assertFilled(t *testing.T, repo *file.PlaylistRepositoryFile, songID int) {
+	t.Helper()
+	ctx := context.Background()
+
+	playlist, err := repo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{songID, 1, 2}, songIDs(playlist))
+	assert.Equal(t, songID, playlist.GetCurrent().Song.ID)
+	assert.Equal(t, 1, playlist.GetCurrent().Song.PlayCount)
+
+	smart, err := repo.ListSmartPlaylists(ctx)
+	require.NoError(t, err)
+	require.Len(t, smart, 1)
+	assert.Equal(t, "Short", smart[0].Name)
+}
+
+func TestFileRepositoryConformance(t *testing.T) {
+	repositorytest.RunPlaylistRepository(t, func(t *testing.T) repository.PlaylistRepository {
+		repo := openRepo(t, t.TempDir())
+		t.Cleanup(func() { repo.Close() })
+		id, err := repo.CreatePlaylist(context.Background(), "Conformance", "")
+		require.NoError(t, err)
+		repo.SetDefaultPlaylistID(id)
+		return repo
+	})
+}
+
+func TestFileRepositoryReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	repo := openRepo(t, dir)
+	songID := fill(t, repo)
+	require.NoError(t, repo.Close())
+	assert.ErrorIs(t, repo.AddSong(ctx, &entity.Song{Title: "x"}), file.ErrClosed)
+
+	// Close writes a snapshot, nothing is left to replay
+	repo = openRepo(t, dir)
+	assert.Equal(t, 0, repo.Recovery().Replayed)
+	assertFilled(t, repo, songID)
+
+	// ids are not reused after restart
+	song := &entity.Song{Title: "Jealous Guy", Artist: "John Lennon", Duration: 254 * time.Second}
+	require.NoError(t, repo.AddSong(ctx, song))
+	assert.Equal(t, songID+1, song.ID)
+}
+
+func TestFileRepositoryCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	repo := openRepo(t, dir)
+	songID := fill(t, repo)
+	checkpoint := repository.Checkpoint{SongID: 2, Position: 42500 * time.Millisecond, Playing: true}
+	require.NoError(t, repo.SaveCheckpoint(ctx, checkpoint))
+	assert.ErrorIs(t, repo.SaveCheckpoint(ctx, repository.Checkpoint{SongID: 100}), repository.ErrCurrentSongNotFound)
+
+	// the checkpoint is replayed from the log
+	repo.Crash()
+	repo = openRepo(t, dir)
+	loaded, err := repo.LoadCheckpoint(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, checkpoint, loaded)
+
+	require.NoError(t, repo.SetCurrent(ctx, &entity.PlaylistNode{Song: &entity.Song{ID: songID}}))
+	loaded, err = repo.LoadCheckpoint(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, repository.Checkpoint{SongID: songID, Playing: true}, loaded, "position is reset with the current song, playing is kept")
+}
+
+func TestFileRepositoryCrashRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	// the repository is dropped without Close, everything comes from the log
+	repo := openRepo(t, dir)
+	songID := fill(t, repo)
+	repo.Crash()
+
+	repo = openRepo(t, dir)
+	assert.Greater(t, repo.Recovery().Replayed, 0)
+	assertFilled(t, repo, songID)
+}
+
+func TestFileRepositoryTornWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	repo := openRepo(t, dir)
+	songID := fill(t, repo)
+
+	// crash in the middle of writing the next entry
+	repo.Crash()
+	appendToLog(t, dir, `5f3a9c01 {"seq":99,"records":[{"op":"song_del`)
+
+	repo = openRepo(t, dir)
+	assert.Greater(t, repo.Recovery().TruncatedBytes, int64(0))
+	assertFilled(t, repo, songID)
+
+	// the log is usable after truncation
+	require.NoError(t, repo.DeleteSong(ctx, 1, 0))
+	repo.Crash()
+	repo = openRepo(t, dir)
+	playlist, err := repo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{songID, 2}, songIDs(playlist))
+}
+
+func TestFileRepositoryCorruptedLog(t *testing.T) {
+	dir := t.TempDir()
+	repo := openRepo(t, dir)
+	fill(t, repo)
+	repo.Crash()
+
+	path := filepath.Join(dir, "wal.log")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(data), "\n")
+	lines[1] = strings.Replace(lines[1], "Imagine", "Imagino", 1)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "")), 0o644))
+
+	_, err = file.NewPlaylistRepositoryFile(dir)
+	assert.ErrorIs(t, err, file.ErrCorrupted)
+}
+
+func TestFileRepositorySnapshots(t *testing.T) {
+	dir := t.TempDir()
+
+	repo := openRepo(t, dir)
+	repo.SetSnapshotEvery(5)
+	songID := fill(t, repo)
+
+	// seed and five changes of fill give 6 entries, the last one is after the snapshot
+	assert.Equal(t, 1, countLogEntries(t, dir))
+	_, err := os.Stat(filepath.Join(dir, "snapshot.json"))
+	require.NoError(t, err)
+
+	repo.Crash()
+	repo = openRepo(t, dir)
+	assert.Equal(t, 1, repo.Recovery().Replayed)
+	assertFilled(t, repo, songID)
+}
+
+func TestFileRepositoryCrashAfterSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	repo := openRepo(t, dir)
+	songID := fill(t, repo)
+
+	// crash after the snapshot is renamed, but before the log is truncated
+	path := filepath.Join(dir, "wal.log")
+	log, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, repo.Snapshot())
+	repo.Crash()
+	require.NoError(t, os.WriteFile(path, log, 0o644))
+
+	repo = openRepo(t, dir)
+	assert.Equal(t, 0, repo.Recovery().Replayed)
+	assertFilled(t, repo, songID)
+}
+
+func TestFileRepositoryInTx(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	repo := openRepo(t, dir)
+
+	failed := errors.New("import failed")
+	err := repo.InTx(ctx, func(tx repository.TxRepository) error {
+		song := &entity.Song{Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second}
+		if err := tx.InsertSong(ctx, song); err != nil {
+			return err
+		}
+		id, err := tx.CreatePlaylist(ctx, "Road trip", "")
+		if err != nil {
+			return err
+		}
+		if err := tx.AddSongToPlaylist(ctx, id, song.ID); err != nil {
+			return err
+		}
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+
+	_, err = repo.FindPlaylistIDByName(ctx, "Road trip")
+	assert.ErrorIs(t, err, repository.ErrPlaylistNotFound)
+	_, err = repo.FindSong(ctx, "Imagine", "John Lennon")
+	assert.ErrorIs(t, err, repository.ErrSongNotFound)
+
+	var songID int
+	entriesBefore := countLogEntries(t, dir)
+	err = repo.InTx(ctx, func(tx repository.TxRepository) error {
+		song := &entity.Song{Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second}
+		if err := tx.InsertSong(ctx, song); err != nil {
+			return err
+		}
+		songID = song.ID
+		id, err := tx.CreatePlaylist(ctx, "Road trip", "")
+		if err != nil {
+			return err
+		}
+		if err := tx.AddSongToPlaylist(ctx, id, song.ID); err != nil {
+			return err
+		}
+		return tx.AddSongToPlaylist(ctx, id, song.ID)
+	})
+	assert.ErrorIs(t, err, repository.ErrSongAlreadyInPlaylist)
+	assert.Equal(t, entriesBefore, countLogEntries(t, dir))
+
+	err = repo.InTx(ctx, func(tx repository.TxRepository) error {
+		song := &entity.Song{Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second}
+		if err := tx.InsertSong(ctx, song); err != nil {
+			return err
+		}
+		songID = song.ID
+		id, err := tx.CreatePlaylist(ctx, "Road trip", "")
+		if err != nil {
+			return err
+		}
+		return tx.AddSongToPlaylist(ctx, id, song.ID)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, entriesBefore+1, countLogEntries(t, dir))
+	assert.Equal(t, 3, songID)
+
+	repo.Crash()
+	repo = openRepo(t, dir)
+	id, err := repo.FindPlaylistIDByName(ctx, "Road trip")
+	require.NoError(t, err)
+	playlist, err := repo.GetPlaylistByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, []int{songID}, songIDs(playlist))
+}
+
+/*
+TestFileRepositoryInTxPlayback runs playback writes in a transaction as the unit of work does:
+they see each other and are dropped together
+*/
+func TestFileRepositoryInTxPlayback(t *testing.T) {
+	ctx := context.Background()
+	repo := openRepo(t, t.TempDir())
+
+	var songID int
+	err := repo.InTx(ctx, func(tx repository.TxRepository) error {
+		song := &entity.Song{Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second}
+		if err := tx.AddSong(ctx, song); err != nil {
+			return err
+		}
+		songID = song.ID
+		if err := tx.SetCurrent(ctx, &entity.PlaylistNode{Song: song}); err != nil {
+			return err
+		}
+		current, err := tx.GetCurrent(ctx)
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, song.ID, current.Song.ID, "writes of the transaction are visible in it")
+		return tx.SetCurrent(ctx, &entity.PlaylistNode{Song: &entity.Song{ID: song.ID + 1}})
+	})
+	assert.ErrorIs(t, err, repository.ErrCurrentSongNotFound)
+
+	_, err = repo.GetSongByID(ctx, songID)
+	assert.ErrorIs(t, err, repository.ErrSongNotFound, "song insert is rolled back")
+	playlist, err := repo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, songIDs(playlist))
+	assert.Equal(t, 1, playlist.GetCurrent().Song.ID)
+
+	var editor repository.TxRepository
+	require.NoError(t, repo.InTx(ctx, func(tx repository.TxRepository) error {
+		editor = tx
+		return nil
+	}))
+	assert.Implements(t, (*repository.SongEditor)(nil), editor)
+	assert.Implements(t, (*repository.PlaylistEditor)(nil), editor)
+	assert.Implements(t, (*repository.PlaylistOrderer)(nil), editor)
+}
+
+func TestFileRepositorySearch(t *testing.T) {
+	ctx := context.Background()
+	repo := openRepo(t, t.TempDir())
+
+	for _, s := range []*entity.Song{
+		{Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second},
+		{Title: "Jealous Guy", Artist: "John Lennon", Duration: 254 * time.Second},
+	} {
+		require.NoError(t, repo.AddSong(ctx, s))
+	}
+
+	page, err := repo.SearchSongs(ctx, repository.SongQuery{Text: "lennon GUY", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Songs, 1)
+	assert.Equal(t, "Jealous Guy", page.Songs[0].Title)
+
+	var titles []string
+	q := repository.SongQuery{Sort: repository.SongSortDurationDesc, Limit: 3}
+	for {
+		page, err := repo.SearchSongs(ctx, q)
+		require.NoError(t, err)
+		for _, s := range page.Songs {
+			titles = append(titles, s.Title)
+		}
+		if page.Next == nil {
+			break
+		}
+		q.After = page.Next
+	}
+	assert.Equal(t, []string{"Default Song 1", "Jealous Guy", "Default Song 2", "Imagine"}, titles)
+}
+
+func songIDs(p *entity.Playlist) []int {
+	var ids []int
+	for node := p.GetHead(); node != nil; node = node.Next {
+		ids = append(ids, node.Song.ID)
+	}
+	return ids
+}
+
+func appendToLog(t *testing.T, dir, data string) {
+	t.Helper()
+
+	f, err := os.OpenFile(filepath.Join(dir, "wal.log"), os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteString(data)
+	require.NoError(t, err)
+}
+
+func countLogEntries(t *testing.T, dir string) int {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dir, "wal.log"))
+	require.NoError(t, err)
+	return strings.Count(string(data), "\n")
+}
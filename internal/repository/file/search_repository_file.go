@@ -0,0 +1,153 @@
+package file
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/pagination"
+	"cloud-go-testtask/internal/repository"
+	"cmp"
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ Methods for library search implementation
+*/
+
+// cursorTimeFormat keeps cursor values of timestamps comparable as text
+const cursorTimeFormat = "2006-01-02T15:04:05.000000Z"
+
+type songSortSpec struct {
+	key  func(s *songRow) string // sort key, also stored in cursor
+	cmp  func(a, b string) int
+	desc bool
+}
+
+var (
+	byText = func(a, b string) int { return strings.Compare(a, b) }
+	byInt  = func(a, b string) int {
+		x, _ := strconv.Atoi(a)
+		y, _ := strconv.Atoi(b)
+		return cmp.Compare(x, y)
+	}
+
+	songID       = func(s *songRow) string { return strconv.Itoa(s.ID) }
+	songTitle    = func(s *songRow) string { return strings.ToLower(s.Title) }
+	songArtist   = func(s *songRow) string { return strings.ToLower(s.Artist) }
+	songDuration = func(s *songRow) string { return strconv.Itoa(s.Duration) }
+	songAddedAt  = func(s *songRow) string { return s.AddedAt.UTC().Format(cursorTimeFormat) }
+)
+
+var songSorts = map[repository.SongSort]songSortSpec{
+	repository.SongSortID:           {key: songID, cmp: byInt},
+	repository.SongSortTitle:        {key: songTitle, cmp: byText},
+	repository.SongSortTitleDesc:    {key: songTitle, cmp: byText, desc: true},
+	repository.SongSortArtist:       {key: songArtist, cmp: byText},
+	repository.SongSortArtistDesc:   {key: songArtist, cmp: byText, desc: true},
+	repository.SongSortDuration:     {key: songDuration, cmp: byInt},
+	repository.SongSortDurationDesc: {key: songDuration, cmp: byInt, desc: true},
+	repository.SongSortAdded:        {key: songAddedAt, cmp: byText},
+	repository.SongSortAddedDesc:    {key: songAddedAt, cmp: byText, desc: true},
+}
+
+/*
+SearchSongs matches every word of the text as a substring of title or artist ignoring case
+and pages by (sort key, id) like the SQL implementation
+*/
+func (r *PlaylistRepositoryFile) SearchSongs(ctx context.Context, q repository.SongQuery) (*repository.SongPage, error) {
+	defer r.observe("SearchSongs", time.Now())
+	spec, ok := songSorts[q.Sort]
+	if !ok {
+		spec = songSorts[repository.SongSortID]
+	}
+
+	// compare orders songs by (key, id) in the requested direction
+	compare := func(aKey string, aID int, bKey string, bID int) int {
+		c := spec.cmp(aKey, bKey)
+		if c == 0 {
+			c = cmp.Compare(aID, bID)
+		}
+		if spec.desc {
+			return -c
+		}
+		return c
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	words := strings.Fields(strings.ToLower(q.Text))
+	minDuration, maxDuration := int(q.MinDuration.Seconds()), int(q.MaxDuration.Seconds())
+
+	var matched []*songRow
+	for _, s := range r.state.Songs {
+		switch {
+		case !containsWords(s.Title+" "+s.Artist, words),
+			q.Artist != "" && !strings.EqualFold(s.Artist, q.Artist),
+			q.MinDuration > 0 && s.Duration < minDuration,
+			q.MaxDuration > 0 && s.Duration > maxDuration,
+			q.After != nil && compare(spec.key(s), s.ID, q.After.Value, q.After.ID) <= 0:
+			continue
+		}
+		matched = append(matched, s)
+	}
+
+	slices.SortFunc(matched, func(a, b *songRow) int {
+		return compare(spec.key(a), a.ID, spec.key(b), b.ID)
+	})
+
+	page := &repository.SongPage{}
+	for _, s := range matched[:min(len(matched), q.Limit)] {
+		page.Songs = append(page.Songs, s.toEntity())
+	}
+	if len(matched) > q.Limit {
+		last := matched[q.Limit-1]
+		page.Next = &pagination.Cursor{Sort: string(q.Sort), Value: spec.key(last), ID: last.ID}
+	}
+
+	return page, nil
+}
+
+/*
+SearchPlaylists matches every word of the text in name or description and pages by id
+*/
+func (r *PlaylistRepositoryFile) SearchPlaylists(ctx context.Context, q repository.PlaylistQuery) (*repository.PlaylistPage, error) {
+	defer r.observe("SearchPlaylists", time.Now())
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	words := strings.Fields(strings.ToLower(q.Text))
+
+	page := &repository.PlaylistPage{}
+	for _, id := range sortedKeys(r.state.Playlists) {
+		p := r.state.Playlists[id]
+		if (q.After != nil && id <= q.After.ID) || !containsWords(p.Name+" "+p.Description, words) {
+			continue
+		}
+		if len(page.Playlists) == q.Limit {
+			page.Next = &pagination.Cursor{ID: page.Playlists[q.Limit-1].ID}
+			break
+		}
+		page.Playlists = append(page.Playlists, &entity.PlaylistInfo{
+			ID:          p.ID,
+			Name:        p.Name,
+			Description: p.Description,
+			SongCount:   len(p.SongIDs),
+			CreatedAt:   p.CreatedAt,
+		})
+	}
+
+	return page, nil
+}
+
+func containsWords(text string, words []string) bool {
+	text = strings.ToLower(text)
+	for _, w := range words {
+		if !strings.Contains(text, w) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package file
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/repository"
+	"context"
+	"slices"
+	"time"
+)
+
+/*
+ Methods for SmartPlaylist CRUD implementation
+*/
+
+func (r *PlaylistRepositoryFile) CreateSmartPlaylist(ctx context.Context, sp *entity.SmartPlaylist) (int, error) {
+	defer r.observe("CreateSmartPlaylist", time.Now())
+	err := r.update(ctx, func(w *writer) error {
+		row := newSmartPlaylistRow(sp)
+		row.ID = w.state.LastSmartPlaylistID + 1
+		if err := w.write(record{Op: opSmartPlaylistSaved, SmartPlaylist: row}); err != nil {
+			return err
+		}
+		sp.ID = row.ID
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return sp.ID, nil
+}
+
+func (r *PlaylistRepositoryFile) GetSmartPlaylistByID(ctx context.Context, id int) (*entity.SmartPlaylist, error) {
+	defer r.observe("GetSmartPlaylistByID", time.Now())
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	row := r.state.SmartPlaylists[id]
+	if row == nil {
+		return nil, repository.ErrSmartPlaylistNotFound
+	}
+	return row.toEntity(), nil
+}
+
+func (r *PlaylistRepositoryFile) ListSmartPlaylists(ctx context.Context) ([]*entity.SmartPlaylist, error) {
+	defer r.observe("ListSmartPlaylists", time.Now())
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var playlists []*entity.SmartPlaylist
+	for _, id := range sortedKeys(r.state.SmartPlaylists) {
+		playlists = append(playlists, r.state.SmartPlaylists[id].toEntity())
+	}
+	return playlists, nil
+}
+
+/*
+UpdateSmartPlaylist replaces the smart playlist. The file does not version smart playlists, so sp.Version is ignored
+*/
+func (r *PlaylistRepositoryFile) UpdateSmartPlaylist(ctx context.Context, sp *entity.SmartPlaylist) error {
+	defer r.observe("UpdateSmartPlaylist", time.Now())
+	return r.update(ctx, func(w *writer) error {
+		if w.state.SmartPlaylists[sp.ID] == nil {
+			return repository.ErrSmartPlaylistNotFound
+		}
+		return w.write(record{Op: opSmartPlaylistSaved, SmartPlaylist: newSmartPlaylistRow(sp)})
+	})
+}
+
+/*
+DeleteSmartPlaylistByID removes the smart playlist. The file does not version smart playlists, so version is ignored
+*/
+func (r *PlaylistRepositoryFile) DeleteSmartPlaylistByID(ctx context.Context, id, version int) error {
+	defer r.observe("DeleteSmartPlaylistByID", time.Now())
+	return r.update(ctx, func(w *writer) error {
+		if w.state.SmartPlaylists[id] == nil {
+			return repository.ErrSmartPlaylistNotFound
+		}
+		return w.write(record{Op: opSmartPlaylistDeleted, ID: id})
+	})
+}
+
+/*
+ListSongs returns the whole library, smart playlists are materialized from it
+*/
+func (r *PlaylistRepositoryFile) ListSongs(ctx context.Context) ([]*entity.Song, error) {
+	defer r.observe("ListSongs", time.Now())
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var songs []*entity.Song
+	for _, id := range sortedKeys(r.state.Songs) {
+		songs = append(songs, r.state.Songs[id].toEntity())
+	}
+	return songs, nil
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
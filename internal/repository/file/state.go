@@ -0,0 +1,310 @@
+package file
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"fmt"
+	"slices"
+	"time"
+)
+
+/*
+ Rows of the in-memory state, they are also the JSON layout of snapshots and log records
+*/
+
+type songRow struct {
+	ID        int       `json:"id"`
+	Title     string    `json:"title"`
+	Artist    string    `json:"artist"`
+	Duration  int       `json:"duration"` // seconds
+	AddedAt   time.Time `json:"added_at"`
+	PlayCount int       `json:"play_count"`
+}
+
+type playlistRow struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	CreatedAt     time.Time `json:"created_at"`
+	CurrentSongID int       `json:"current_song_id,omitempty"`     // 0 if not set
+	PositionMS    int64     `json:"current_position_ms,omitempty"` // within the current song
+	Playing       bool      `json:"current_playing,omitempty"`     // the current song was playing at the checkpoint
+	SongIDs       []int     `json:"song_ids"`                      // in play order
+}
+
+type smartRuleRow struct {
+	Field    string `json:"field"`
+	Operator string `json:"op"`
+	Value    string `json:"value"`
+}
+
+type smartPlaylistRow struct {
+	ID          int            `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Rules       []smartRuleRow `json:"rules"`
+	SortBy      string         `json:"sort_by"`
+	Limit       int            `json:"limit"`
+}
+
+/*
+state is everything the repository stores. It is changed only by apply,
+so replaying the log after a crash gives exactly the state that was acknowledged to callers
+*/
+type state struct {
+	Songs          map[int]*songRow          `json:"songs"`
+	Playlists      map[int]*playlistRow      `json:"playlists"`
+	SmartPlaylists map[int]*smartPlaylistRow `json:"smart_playlists"`
+
+	// last used ids, ids are never reused like SERIAL columns
+	LastSongID          int `json:"last_song_id"`
+	LastPlaylistID      int `json:"last_playlist_id"`
+	LastSmartPlaylistID int `json:"last_smart_playlist_id"`
+}
+
+func newState() *state {
+	return &state{
+		Songs:          map[int]*songRow{},
+		Playlists:      map[int]*playlistRow{},
+		SmartPlaylists: map[int]*smartPlaylistRow{},
+	}
+}
+
+func (s *state) clone() *state {
+	c := &state{
+		Songs:               make(map[int]*songRow, len(s.Songs)),
+		Playlists:           make(map[int]*playlistRow, len(s.Playlists)),
+		SmartPlaylists:      make(map[int]*smartPlaylistRow, len(s.SmartPlaylists)),
+		LastSongID:          s.LastSongID,
+		LastPlaylistID:      s.LastPlaylistID,
+		LastSmartPlaylistID: s.LastSmartPlaylistID,
+	}
+	for id, row := range s.Songs {
+		r := *row
+		c.Songs[id] = &r
+	}
+	for id, row := range s.Playlists {
+		r := *row
+		r.SongIDs = slices.Clone(row.SongIDs)
+		c.Playlists[id] = &r
+	}
+	for id, row := range s.SmartPlaylists {
+		r := *row
+		r.Rules = slices.Clone(row.Rules)
+		c.SmartPlaylists[id] = &r
+	}
+	return c
+}
+
+type recordOp string
+
+const (
+	opSongAdded            recordOp = "song_added"
+	opSongUpdated          recordOp = "song_updated"
+	opSongDeleted          recordOp = "song_deleted"
+	opSongPlayed           recordOp = "song_played"
+	opPlaylistCreated      recordOp = "playlist_created"
+	opPlaylistDeleted      recordOp = "playlist_deleted"
+	opPlaylistSongAdded    recordOp = "playlist_song_added"
+	opPlaylistSongRemoved  recordOp = "playlist_song_removed"
+	opPlaylistOrdered      recordOp = "playlist_ordered"
+	opCurrentSongSet       recordOp = "current_song_set"
+	opCheckpointSaved      recordOp = "checkpoint_saved"
+	opSmartPlaylistSaved   recordOp = "smart_playlist_saved"
+	opSmartPlaylistDeleted recordOp = "smart_playlist_deleted"
+)
+
+/*
+record is a single change of state. Only fields of its op are set
+*/
+type record struct {
+	Op            recordOp          `json:"op"`
+	Song          *songRow          `json:"song,omitempty"`
+	Playlist      *playlistRow      `json:"playlist,omitempty"`
+	SmartPlaylist *smartPlaylistRow `json:"smart_playlist,omitempty"`
+	ID            int               `json:"id,omitempty"`
+	PlaylistID    int               `json:"playlist_id,omitempty"`
+	SongIDs       []int             `json:"song_ids,omitempty"`
+	PositionMS    int64             `json:"position_ms,omitempty"`
+	Playing       bool              `json:"playing,omitempty"`
+}
+
+/*
+apply changes state by record. Methods of the repository check their arguments before writing
+a record, so an error here means the log doesn't match the snapshot it is replayed on
+*/
+func (s *state) apply(rec record) error {
+	switch rec.Op {
+	case opSongAdded:
+		if rec.Song == nil || s.Songs[rec.Song.ID] != nil {
+			return fmt.Errorf("%w: bad %s record", ErrCorrupted, rec.Op)
+		}
+		song := *rec.Song
+		s.Songs[song.ID] = &song
+		s.LastSongID = max(s.LastSongID, song.ID)
+
+	case opSongUpdated:
+		if rec.Song == nil || s.Songs[rec.Song.ID] == nil {
+			return fmt.Errorf("%w: bad %s record", ErrCorrupted, rec.Op)
+		}
+		row := s.Songs[rec.Song.ID]
+		row.Title, row.Artist, row.Duration = rec.Song.Title, rec.Song.Artist, rec.Song.Duration
+
+	case opSongDeleted:
+		if s.Songs[rec.ID] == nil {
+			return fmt.Errorf("%w: song %d of %s record not found", ErrCorrupted, rec.ID, rec.Op)
+		}
+		delete(s.Songs, rec.ID)
+		for _, p := range s.Playlists {
+			p.SongIDs = slices.DeleteFunc(p.SongIDs, func(id int) bool { return id == rec.ID })
+			if p.CurrentSongID == rec.ID {
+				p.CurrentSongID, p.PositionMS, p.Playing = 0, 0, false
+			}
+		}
+
+	case opSongPlayed:
+		if s.Songs[rec.ID] == nil {
+			return fmt.Errorf("%w: song %d of %s record not found", ErrCorrupted, rec.ID, rec.Op)
+		}
+		s.Songs[rec.ID].PlayCount++
+
+	case opPlaylistCreated:
+		if rec.Playlist == nil || s.Playlists[rec.Playlist.ID] != nil {
+			return fmt.Errorf("%w: bad %s record", ErrCorrupted, rec.Op)
+		}
+		p := *rec.Playlist
+		p.SongIDs = slices.Clone(p.SongIDs)
+		s.Playlists[p.ID] = &p
+		s.LastPlaylistID = max(s.LastPlaylistID, p.ID)
+
+	case opPlaylistDeleted:
+		if s.Playlists[rec.ID] == nil {
+			return fmt.Errorf("%w: playlist %d of %s record not found", ErrCorrupted, rec.ID, rec.Op)
+		}
+		delete(s.Playlists, rec.ID)
+
+	case opPlaylistSongAdded:
+		p := s.Playlists[rec.PlaylistID]
+		if p == nil || s.Songs[rec.ID] == nil || slices.Contains(p.SongIDs, rec.ID) {
+			return fmt.Errorf("%w: bad %s record", ErrCorrupted, rec.Op)
+		}
+		p.SongIDs = append(p.SongIDs, rec.ID)
+
+	case opPlaylistSongRemoved:
+		p := s.Playlists[rec.PlaylistID]
+		if p == nil {
+			return fmt.Errorf("%w: playlist %d of %s record not found", ErrCorrupted, rec.PlaylistID, rec.Op)
+		}
+		p.SongIDs = slices.DeleteFunc(p.SongIDs, func(id int) bool { return id == rec.ID })
+
+	case opPlaylistOrdered:
+		p := s.Playlists[rec.PlaylistID]
+		if p == nil {
+			return fmt.Errorf("%w: playlist %d of %s record not found", ErrCorrupted, rec.PlaylistID, rec.Op)
+		}
+		p.SongIDs = reorder(p.SongIDs, rec.SongIDs)
+
+	case opCurrentSongSet:
+		p := s.Playlists[rec.PlaylistID]
+		if p == nil || s.Songs[rec.ID] == nil {
+			return fmt.Errorf("%w: bad %s record", ErrCorrupted, rec.Op)
+		}
+		p.CurrentSongID, p.PositionMS = rec.ID, 0
+
+	case opCheckpointSaved:
+		p := s.Playlists[rec.PlaylistID]
+		if p == nil || !slices.Contains(p.SongIDs, rec.ID) {
+			return fmt.Errorf("%w: bad %s record", ErrCorrupted, rec.Op)
+		}
+		p.CurrentSongID, p.PositionMS, p.Playing = rec.ID, rec.PositionMS, rec.Playing
+
+	case opSmartPlaylistSaved:
+		if rec.SmartPlaylist == nil {
+			return fmt.Errorf("%w: bad %s record", ErrCorrupted, rec.Op)
+		}
+		sp := *rec.SmartPlaylist
+		sp.Rules = slices.Clone(sp.Rules)
+		s.SmartPlaylists[sp.ID] = &sp
+		s.LastSmartPlaylistID = max(s.LastSmartPlaylistID, sp.ID)
+
+	case opSmartPlaylistDeleted:
+		if s.SmartPlaylists[rec.ID] == nil {
+			return fmt.Errorf("%w: smart playlist %d of %s record not found", ErrCorrupted, rec.ID, rec.Op)
+		}
+		delete(s.SmartPlaylists, rec.ID)
+
+	default:
+		return fmt.Errorf("%w: unknown record %q", ErrCorrupted, rec.Op)
+	}
+
+	return nil
+}
+
+/*
+reorder puts songs of order first, the rest keep their relative order after them.
+Ids which are not in the playlist are ignored
+*/
+func reorder(songIDs, order []int) []int {
+	result := make([]int, 0, len(songIDs))
+	for _, id := range order {
+		if slices.Contains(songIDs, id) && !slices.Contains(result, id) {
+			result = append(result, id)
+		}
+	}
+	for _, id := range songIDs {
+		if !slices.Contains(result, id) {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func (r *songRow) toEntity() *entity.Song {
+	return &entity.Song{
+		ID:        r.ID,
+		Title:     r.Title,
+		Artist:    r.Artist,
+		Duration:  time.Duration(r.Duration) * time.Second,
+		AddedAt:   r.AddedAt,
+		PlayCount: r.PlayCount,
+	}
+}
+
+func (r *smartPlaylistRow) toEntity() *entity.SmartPlaylist {
+	rules := make([]entity.SmartRule, 0, len(r.Rules))
+	for _, rule := range r.Rules {
+		rules = append(rules, entity.SmartRule{
+			Field:    entity.RuleField(rule.Field),
+			Operator: entity.RuleOperator(rule.Operator),
+			Value:    rule.Value,
+		})
+	}
+
+	return &entity.SmartPlaylist{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		Rules:       rules,
+		SortBy:      entity.SmartSort(r.SortBy),
+		Limit:       r.Limit,
+	}
+}
+
+func newSmartPlaylistRow(sp *entity.SmartPlaylist) *smartPlaylistRow {
+	rules := make([]smartRuleRow, 0, len(sp.Rules))
+	for _, rule := range sp.Rules {
+		rules = append(rules, smartRuleRow{
+			Field:    string(rule.Field),
+			Operator: string(rule.Operator),
+			Value:    rule.Value,
+		})
+	}
+
+	return &smartPlaylistRow{
+		ID:          sp.ID,
+		Name:        sp.Name,
+		Description: sp.Description,
+		Rules:       rules,
+		SortBy:      string(sp.SortBy),
+		Limit:       sp.Limit,
+	}
+}
@@ -0,0 +1,205 @@
+package file
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/repository"
+	"context"
+	"slices"
+	"time"
+)
+
+/*
+writer validates changes against state and collects their records.
+Outside of transaction records are applied by commit after they are logged (apply is false),
+inside InTx the state is a private copy and records are applied at once, so later writes
+of the transaction see earlier ones. In InTx it is the repository bound to the transaction
+*/
+type writer struct {
+	state             *state
+	apply             bool
+	records           []record
+	defaultPlaylistID int
+	now               func() time.Time
+}
+
+func (w *writer) write(rec record) error {
+	if w.apply {
+		if err := w.state.apply(rec); err != nil {
+			return err
+		}
+	}
+	w.records = append(w.records, rec)
+	return nil
+}
+
+/*
+InTx runs fn with a writer over a copy of the state. If fn succeeds all its changes are written
+as one log entry, so after a crash either all of them or none are recovered
+*/
+func (r *PlaylistRepositoryFile) InTx(ctx context.Context, fn func(tx repository.TxRepository) error) error {
+	defer r.observe("InTx", time.Now())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.log == nil {
+		return ErrClosed
+	}
+
+	w := &writer{state: r.state.clone(), apply: true, defaultPlaylistID: r.defaultPlaylistID, now: r.now}
+	if err := fn(w); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.commit(w.records)
+}
+
+/*
+InsertSong adds song to library only and sets its ID
+*/
+func (w *writer) InsertSong(ctx context.Context, song *entity.Song) error {
+	if song == nil {
+		return repository.ErrNullSong
+	}
+
+	row := &songRow{
+		ID:       w.state.LastSongID + 1,
+		Title:    song.Title,
+		Artist:   song.Artist,
+		Duration: int(song.Duration.Seconds()),
+		AddedAt:  w.now(),
+	}
+	if err := w.write(record{Op: opSongAdded, Song: row}); err != nil {
+		return err
+	}
+
+	song.ID = row.ID
+	song.AddedAt = row.AddedAt
+	return nil
+}
+
+func (w *writer) CreatePlaylist(ctx context.Context, name, description string) (int, error) {
+	row := &playlistRow{
+		ID:          w.state.LastPlaylistID + 1,
+		Name:        name,
+		Description: description,
+		CreatedAt:   w.now(),
+		SongIDs:     []int{},
+	}
+	if err := w.write(record{Op: opPlaylistCreated, Playlist: row}); err != nil {
+		return 0, err
+	}
+	return row.ID, nil
+}
+
+func (w *writer) AddSongToPlaylist(ctx context.Context, playlistID, songID int) error {
+	p := w.state.Playlists[playlistID]
+	switch {
+	case p == nil:
+		return repository.ErrPlaylistNotFound
+	case w.state.Songs[songID] == nil:
+		return repository.ErrSongNotFound
+	case slices.Contains(p.SongIDs, songID):
+		return repository.ErrSongAlreadyInPlaylist
+	}
+	return w.write(record{Op: opPlaylistSongAdded, PlaylistID: playlistID, ID: songID})
+}
+
+/*
+AddSong adds song to library and appends it to the default playlist if one is set
+*/
+func (w *writer) AddSong(ctx context.Context, song *entity.Song) error {
+	if err := w.InsertSong(ctx, song); err != nil {
+		return err
+	}
+	if w.state.Playlists[w.defaultPlaylistID] == nil {
+		return nil
+	}
+	// the song is new, so it can't be in the playlist yet
+	return w.write(record{Op: opPlaylistSongAdded, PlaylistID: w.defaultPlaylistID, ID: song.ID})
+}
+
+func (w *writer) GetPlaylist(ctx context.Context) (*entity.Playlist, error) {
+	if w.defaultPlaylistID == 0 {
+		return nil, repository.ErrDefaultPlaylistNotSet
+	}
+	return w.state.playlist(w.defaultPlaylistID)
+}
+
+func (w *writer) GetCurrent(ctx context.Context) (*entity.PlaylistNode, error) {
+	playlist, err := w.GetPlaylist(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return playlist.GetCurrent(), nil
+}
+
+func (w *writer) SetCurrent(ctx context.Context, node *entity.PlaylistNode) error {
+	if node == nil || node.Song == nil {
+		return repository.ErrNilNode
+	}
+	if w.defaultPlaylistID == 0 {
+		return repository.ErrDefaultPlaylistNotSet
+	}
+	p := w.state.Playlists[w.defaultPlaylistID]
+	if p == nil {
+		return repository.ErrPlaylistNotFound
+	}
+	if !slices.Contains(p.SongIDs, node.Song.ID) {
+		return repository.ErrCurrentSongNotFound
+	}
+	return w.setCurrent(w.defaultPlaylistID, node.Song.ID)
+}
+
+func (w *writer) GetSongByID(ctx context.Context, id int) (*entity.Song, error) {
+	s := w.state.Songs[id]
+	if s == nil {
+		return nil, repository.ErrSongNotFound
+	}
+	return s.toEntity(), nil
+}
+
+func (w *writer) UpdateSong(ctx context.Context, song *entity.Song) error {
+	if w.state.Songs[song.ID] == nil {
+		return repository.ErrSongNotFound
+	}
+	return w.write(record{Op: opSongUpdated, Song: &songRow{
+		ID:       song.ID,
+		Title:    song.Title,
+		Artist:   song.Artist,
+		Duration: int(song.Duration.Seconds()),
+	}})
+}
+
+func (w *writer) DeleteSong(ctx context.Context, id, version int) error {
+	if w.state.Songs[id] == nil {
+		return repository.ErrSongNotFound
+	}
+	return w.write(record{Op: opSongDeleted, ID: id})
+}
+
+func (w *writer) RemoveSongFromPlaylist(ctx context.Context, playlistID, songID int) error {
+	p := w.state.Playlists[playlistID]
+	if p == nil || !slices.Contains(p.SongIDs, songID) {
+		return nil
+	}
+	return w.write(record{Op: opPlaylistSongRemoved, PlaylistID: playlistID, ID: songID})
+}
+
+func (w *writer) SetPlaylistOrder(ctx context.Context, playlistID int, songIDs []int, version int) error {
+	if w.state.Playlists[playlistID] == nil {
+		return nil
+	}
+	return w.write(record{Op: opPlaylistOrdered, PlaylistID: playlistID, SongIDs: slices.Clone(songIDs)})
+}
+
+func (w *writer) setCurrent(playlistID, songID int) error {
+	if w.state.Playlists[playlistID] == nil {
+		return nil
+	}
+	if w.state.Songs[songID] == nil {
+		return repository.ErrSongNotFound
+	}
+	return w.write(record{Op: opCurrentSongSet, PlaylistID: playlistID, ID: songID})
+}
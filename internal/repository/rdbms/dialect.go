@@ -0,0 +1,58 @@
+package rdbms
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Dialect of the database behind the repository. Queries are written in SQL both Postgres and SQLite
+understand ($N placeholders, RETURNING, row values), dialects differ only in search and casts
+*/
+type Dialect string
+
+const (
+	DialectPostgres Dialect = "postgres"
+	DialectSQLite   Dialect = "sqlite"
+)
+
+/*
+castType maps a Postgres type of a sort key to the type used to compare cursor values.
+SQLite keeps timestamps as text in sortable format, so they are compared as text
+*/
+func (d Dialect) castType(pgType string) string {
+	if d != DialectSQLite {
+		return pgType
+	}
+
+	switch pgType {
+	case "int":
+		return "INTEGER"
+	default:
+		return "TEXT"
+	}
+}
+
+/*
+textMatch returns condition matching text query against columns. Postgres uses full-text search
+over the generated search_vector column, SQLite requires every word to be a substring (case-insensitive for ASCII)
+*/
+func (d Dialect) textMatch(vectorColumn string, columns []string, text string, arg func(any) string) string {
+	if d != DialectSQLite {
+		return vectorColumn + " @@ websearch_to_tsquery('simple', " + arg(text) + ")"
+	}
+
+	haystack := strings.Join(columns, " || ' ' || ")
+	var conds []string
+	for _, word := range strings.Fields(text) {
+		conds = append(conds, fmt.Sprintf(`(%s) LIKE '%%' || %s || '%%' ESCAPE '\'`, haystack, arg(escapeLike(word))))
+	}
+	if len(conds) == 0 {
+		return "1 = 1"
+	}
+	return strings.Join(conds, " AND ")
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,126 @@
+package rdbms
+
+import (
+	"cloud-go-testtask/internal/repository"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+/*
+ Methods for Idempotency-Key implementation
+*/
+
+/*
+idempotencyNow is the clock of key expiry. Whole seconds in UTC keep timestamps SQLite stores as text sortable
+*/
+func idempotencyNow() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+/*
+ReserveIdempotencyKey inserts the key unless it is taken. An expired key, either an old response or a reservation
+of a request which never completed, is removed first. Of concurrent requests with the same key only one inserts it
+*/
+func (r *PlaylistRepositoryRDBMS) ReserveIdempotencyKey(ctx context.Context, key, fingerprint, reservation string, lease time.Duration) (*repository.IdempotentResponse, error) {
+	ctx, end := r.instrument(ctx, "ReserveIdempotencyKey")
+	defer end()
+
+	// the stored response may expire between the insert and the select, then the key is taken again
+	for {
+		now := idempotencyNow()
+		if _, err := r.q.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE idempotency_key = $1 AND expires_at <= $2", key, now); err != nil {
+			return nil, err
+		}
+
+		res, err := r.q.ExecContext(ctx, `
+			INSERT INTO idempotency_keys (idempotency_key, fingerprint, reservation, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (idempotency_key) DO NOTHING`,
+			key, fingerprint, reservation, now, now.Add(lease))
+		if err != nil {
+			return nil, err
+		}
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if inserted == 1 {
+			return nil, nil
+		}
+
+		stored, err := r.getIdempotentResponse(ctx, key)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		return stored, err
+	}
+}
+
+func (r *PlaylistRepositoryRDBMS) getIdempotentResponse(ctx context.Context, key string) (*repository.IdempotentResponse, error) {
+	var response repository.IdempotentResponse
+	var status sql.NullInt64
+	var header sql.NullString
+
+	err := r.q.QueryRowContext(ctx, "SELECT fingerprint, status, header, body FROM idempotency_keys WHERE idempotency_key = $1", key).
+		Scan(&response.Fingerprint, &status, &header, &response.Body)
+	if err != nil {
+		return nil, err
+	}
+	response.Status = int(status.Int64)
+
+	if header.Valid {
+		if err := json.Unmarshal([]byte(header.String), &response.Header); err != nil {
+			return nil, err
+		}
+	}
+	return &response, nil
+}
+
+/*
+SaveIdempotentResponse stores the response of the reserved key, it is replayed for ttl from now.
+ErrIdempotencyKeyLost is returned if the reservation has expired and the key was taken by another request
+*/
+func (r *PlaylistRepositoryRDBMS) SaveIdempotentResponse(ctx context.Context, key, reservation string, response *repository.IdempotentResponse, ttl time.Duration) error {
+	ctx, end := r.instrument(ctx, "SaveIdempotentResponse")
+	defer end()
+
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.q.ExecContext(ctx,
+		"UPDATE idempotency_keys SET status = $1, header = $2, body = $3, expires_at = $4 WHERE idempotency_key = $5 AND reservation = $6 AND status IS NULL",
+		response.Status, string(header), response.Body, idempotencyNow().Add(ttl), key, reservation)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(res, repository.ErrIdempotencyKeyLost)
+}
+
+/*
+ReleaseIdempotencyKey removes the reservation of the key, a stored response or the reservation
+of a retry which took the expired key over is kept
+*/
+func (r *PlaylistRepositoryRDBMS) ReleaseIdempotencyKey(ctx context.Context, key, reservation string) error {
+	ctx, end := r.instrument(ctx, "ReleaseIdempotencyKey")
+	defer end()
+	_, err := r.q.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE idempotency_key = $1 AND reservation = $2 AND status IS NULL", key, reservation)
+	return err
+}
+
+/*
+PurgeIdempotencyKeys removes expired keys and returns how many
+*/
+func (r *PlaylistRepositoryRDBMS) PurgeIdempotencyKeys(ctx context.Context) (int64, error) {
+	ctx, end := r.instrument(ctx, "PurgeIdempotencyKeys")
+	defer end()
+	res, err := r.q.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= $1", idempotencyNow())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -2,29 +2,46 @@ package rdbms
 
 import (
 	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/logging"
 	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/tracing"
+	"context"
 	"database/sql"
 	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"log/slog"
 	"time"
 )
 
 type PlaylistRepositoryRDBMS struct {
 	db                *sql.DB
-	defaultPlaylistID int // Может есть способ лучше?...
+	q                 querier // db itself or transaction opened by InTx
+	defaultPlaylistID int     // Может есть способ лучше?...
+	dialect           Dialect
+	observer          repository.MethodObserver // nil if not instrumented
 }
 
 func NewPlaylistRepositoryRDBMS(db *sql.DB) repository.PlaylistRepository {
-	return &PlaylistRepositoryRDBMS{db: db}
+	return &PlaylistRepositoryRDBMS{db: db, q: db, dialect: DialectPostgres}
+}
+
+/*
+NewPlaylistRepositorySQLite works over SQLite database with the schema from migrations/sqlite
+*/
+func NewPlaylistRepositorySQLite(db *sql.DB) repository.PlaylistRepository {
+	return &PlaylistRepositoryRDBMS{db: db, q: db, dialect: DialectSQLite}
 }
 
 /*
  Methods for Playlist CRUD implementation
 */
 
-func (r *PlaylistRepositoryRDBMS) CreatePlaylist(name, description string) (int, error) {
+func (r *PlaylistRepositoryRDBMS) CreatePlaylist(ctx context.Context, name, description string) (int, error) {
+	ctx, end := r.instrument(ctx, "CreatePlaylist")
+	defer end()
 	var createdPlaylistId int
 
-	err := r.db.QueryRow(
+	err := r.q.QueryRowContext(ctx,
 		"INSERT INTO  playlists (name, description) VALUES ($1, $2) RETURNING id",
 		name, description).Scan(&createdPlaylistId)
 
@@ -38,9 +55,11 @@ func (r *PlaylistRepositoryRDBMS) CreatePlaylist(name, description string) (int,
 	return createdPlaylistId, nil
 }
 
-func (r *PlaylistRepositoryRDBMS) FindPlaylistIDByName(name string) (int, error) {
+func (r *PlaylistRepositoryRDBMS) FindPlaylistIDByName(ctx context.Context, name string) (int, error) {
+	ctx, end := r.instrument(ctx, "FindPlaylistIDByName")
+	defer end()
 	var id int
-	err := r.db.QueryRow("SELECT id FROM playlists WHERE name = $1", name).Scan(&id)
+	err := r.q.QueryRowContext(ctx, "SELECT id FROM playlists WHERE name = $1", name).Scan(&id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, repository.ErrPlaylistNotFound
@@ -54,11 +73,50 @@ func (r *PlaylistRepositoryRDBMS) SetDefaultPlaylistID(id int) {
 	r.defaultPlaylistID = id
 }
 
-func (r *PlaylistRepositoryRDBMS) GetPlaylistByID(id int) (*entity.Playlist, error) {
+/*
+SetMethodObserver instruments the repository, it must be called before the repository is used
+*/
+func (r *PlaylistRepositoryRDBMS) SetMethodObserver(observer repository.MethodObserver) {
+	r.observer = observer
+}
+
+/*
+instrument starts a span of method and returns the function ending it, which also reports
+the duration to the observer and to the request logger at debug level.
+Use as ctx, end := r.instrument(ctx, "Method"); defer end()
+*/
+func (r *PlaylistRepositoryRDBMS) instrument(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, func()) {
+	const opPrefix = "rdbms.PlaylistRepositoryRDBMS."
+	start := time.Now()
+	attrs = append(attrs, attribute.String("db.system", string(r.dialect)))
+	ctx, span := tracing.Start(ctx, opPrefix+method, attrs...)
+
+	return ctx, func() {
+		span.End()
+		duration := time.Since(start)
+		if r.observer != nil {
+			r.observer(method, duration)
+		}
+		if logger := logging.FromContext(ctx, nil); logger != nil {
+			logger.Debug("Query done", slog.String("op", opPrefix+method), slog.Duration("duration", duration))
+		}
+	}
+}
+
+/*
+GetPlaylistByID loads playlist with its songs in order. An empty playlist is not an error
+*/
+func (r *PlaylistRepositoryRDBMS) GetPlaylistByID(ctx context.Context, id int) (*entity.Playlist, error) {
+	ctx, end := r.instrument(ctx, "GetPlaylistByID", tracing.PlaylistID(id))
+	defer end()
 
 	var currentSongID sql.NullInt64 //int
+	var description sql.NullString
+
+	playlist := entity.Playlist{ID: id}
 
-	err := r.db.QueryRow("SELECT current_song_id FROM playlists WHERE id=$1", id).Scan(&currentSongID)
+	err := r.q.QueryRowContext(ctx, "SELECT name, description, current_song_id, version FROM playlists WHERE id=$1", id).
+		Scan(&playlist.Name, &description, &currentSongID, &playlist.Version)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 
@@ -67,11 +125,10 @@ func (r *PlaylistRepositoryRDBMS) GetPlaylistByID(id int) (*entity.Playlist, err
 
 		return nil, err
 	}
+	playlist.Description = description.String
 
-	playlist := entity.Playlist{}
-
-	rows, err := r.db.Query(`
-		SELECT s.id, s.title, s.artist, s.duration
+	rows, err := r.q.QueryContext(ctx, `
+		SELECT s.id, s.title, s.artist, s.duration, s.created_at, s.play_count, s.version
 		FROM playlist_songs ps
 		JOIN songs s ON s.id = ps.song_id
 		WHERE ps.playlist_id = $1
@@ -83,13 +140,11 @@ func (r *PlaylistRepositoryRDBMS) GetPlaylistByID(id int) (*entity.Playlist, err
 	defer rows.Close()
 
 	var currentNode *entity.PlaylistNode
-	foundSongs := false
 
 	for rows.Next() {
-		foundSongs = true
 		var s entity.Song
 		var durationSec int
-		if err := rows.Scan(&s.ID, &s.Title, &s.Artist, &durationSec); err != nil {
+		if err := rows.Scan(&s.ID, &s.Title, &s.Artist, &durationSec, &s.AddedAt, &s.PlayCount, &s.Version); err != nil {
 			return nil, err
 		}
 		s.Duration = time.Duration(durationSec) * time.Second
@@ -99,9 +154,8 @@ func (r *PlaylistRepositoryRDBMS) GetPlaylistByID(id int) (*entity.Playlist, err
 			currentNode = node
 		}
 	}
-
-	if !foundSongs {
-		return nil, repository.ErrNoSongsInPlaylist
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
 	if currentSongID.Valid && currentNode == nil {
@@ -117,8 +171,10 @@ func (r *PlaylistRepositoryRDBMS) GetPlaylistByID(id int) (*entity.Playlist, err
 	return &playlist, nil
 }
 
-func (r *PlaylistRepositoryRDBMS) UpdatePlaylistCurrentSong(playlistID, songID int) error {
-	_, err := r.db.Exec("UPDATE playlists SET current_song_id = $1 WHERE id = $2", songID, playlistID)
+func (r *PlaylistRepositoryRDBMS) UpdatePlaylistCurrentSong(ctx context.Context, playlistID, songID int) error {
+	ctx, end := r.instrument(ctx, "UpdatePlaylistCurrentSong", tracing.PlaylistID(playlistID), tracing.SongID(songID))
+	defer end()
+	_, err := r.q.ExecContext(ctx, "UPDATE playlists SET current_song_id = $1, current_position_ms = 0 WHERE id = $2", songID, playlistID)
 
 	if err != nil {
 		return err
@@ -127,13 +183,18 @@ func (r *PlaylistRepositoryRDBMS) UpdatePlaylistCurrentSong(playlistID, songID i
 	return nil
 }
 
-func (r *PlaylistRepositoryRDBMS) DeletePlaylistByID(id int) error {
-	_, err := r.db.Exec("DELETE FROM playlists WHERE id = $1", id)
+func (r *PlaylistRepositoryRDBMS) DeletePlaylistByID(ctx context.Context, id, version int) error {
+	ctx, end := r.instrument(ctx, "DeletePlaylistByID", tracing.PlaylistID(id))
+	defer end()
+	res, err := r.q.ExecContext(ctx, "DELETE FROM playlists WHERE id = $1 AND ($2 = 0 OR version = $2)", id, version)
 
 	if err != nil {
 		return err
 	}
 
+	if err := requireAffected(res, repository.ErrPlaylistNotFound); err != nil {
+		return r.versionConflict(ctx, "playlists", id, err)
+	}
 	return nil
 }
 
@@ -141,12 +202,41 @@ func (r *PlaylistRepositoryRDBMS) DeletePlaylistByID(id int) error {
  Methods for Song CRUD implementation
 */
 
-func (r *PlaylistRepositoryRDBMS) AddSong(song *entity.Song) error {
+/*
+AddSong inserts song into library, sets its ID and appends it to the default playlist if one is set
+*/
+func (r *PlaylistRepositoryRDBMS) AddSong(ctx context.Context, song *entity.Song) error {
+	ctx, end := r.instrument(ctx, "AddSong")
+	defer end()
+	if song == nil {
+		return repository.ErrNullSong
+	}
+
+	return r.inTx(ctx, func(txRepo *PlaylistRepositoryRDBMS) error {
+		if err := txRepo.InsertSong(ctx, song); err != nil {
+			return err
+		}
+		if txRepo.defaultPlaylistID == 0 {
+			return nil
+		}
+		return txRepo.AddSongToPlaylist(ctx, txRepo.defaultPlaylistID, song.ID)
+	})
+}
+
+/*
+InsertSong inserts song into library only and sets its ID
+*/
+func (r *PlaylistRepositoryRDBMS) InsertSong(ctx context.Context, song *entity.Song) error {
+	ctx, end := r.instrument(ctx, "InsertSong")
+	defer end()
+	if song == nil {
+		return repository.ErrNullSong
+	}
 
 	duration := int(song.Duration.Seconds())
 
-	_, err := r.db.Exec("INSERT INTO songs (title, artist, duration) VALUES ($1, $2, $3)",
-		song.Title, song.Artist, duration)
+	err := r.q.QueryRowContext(ctx, "INSERT INTO songs (title, artist, duration) VALUES ($1, $2, $3) RETURNING id, created_at, version",
+		song.Title, song.Artist, duration).Scan(&song.ID, &song.AddedAt, &song.Version)
 
 	if err != nil { // TODO: Add additional err handling
 		return repository.ErrAddSong
@@ -155,13 +245,61 @@ func (r *PlaylistRepositoryRDBMS) AddSong(song *entity.Song) error {
 	return nil
 }
 
-func (r *PlaylistRepositoryRDBMS) GetSongByID(id int) (*entity.Song, error) {
+/*
+FindSong looks up library song by title and artist ignoring case.
+With empty artist the title must be unique in library
+*/
+func (r *PlaylistRepositoryRDBMS) FindSong(ctx context.Context, title, artist string) (*entity.Song, error) {
+	ctx, end := r.instrument(ctx, "FindSong")
+	defer end()
+	query := "SELECT id, title, artist, duration, created_at, play_count, version FROM songs WHERE lower(title) = lower($1)"
+	args := []any{title}
+	if artist != "" {
+		query += " AND lower(artist) = lower($2)"
+		args = append(args, artist)
+	}
+	query += " ORDER BY id LIMIT 2"
+
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var songs []*entity.Song
+	for rows.Next() {
+		var s entity.Song
+		var durationSec int
+		if err := rows.Scan(&s.ID, &s.Title, &s.Artist, &durationSec, &s.AddedAt, &s.PlayCount, &s.Version); err != nil {
+			return nil, err
+		}
+		s.Duration = time.Duration(durationSec) * time.Second
+		songs = append(songs, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(songs) == 0 || (artist == "" && len(songs) > 1) {
+		return nil, repository.ErrSongNotFound
+	}
+
+	return songs[0], nil
+}
+
+func (r *PlaylistRepositoryRDBMS) GetSongByID(ctx context.Context, id int) (*entity.Song, error) {
+	ctx, end := r.instrument(ctx, "GetSongByID", tracing.SongID(id))
+	defer end()
 	var song entity.Song
 	var duration int
 
-	err := r.db.QueryRow("SELECT id, title, artist, duration FROM songs WHERE id = $1", id).Scan(&song.ID, &song.Title, &duration)
+	err := r.q.QueryRowContext(ctx, "SELECT id, title, artist, duration, created_at, play_count, version FROM songs WHERE id = $1", id).
+		Scan(&song.ID, &song.Title, &song.Artist, &duration, &song.AddedAt, &song.PlayCount, &song.Version)
 
-	if err != nil { // TODO: Add additional err handling
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrSongNotFound
+		}
 		return nil, err
 	}
 
@@ -170,26 +308,112 @@ func (r *PlaylistRepositoryRDBMS) GetSongByID(id int) (*entity.Song, error) {
 	return &song, nil
 }
 
-func (r *PlaylistRepositoryRDBMS) UpdateSong(song *entity.Song) error {
+/*
+UpdateSong changes song details and bumps its version along with the versions of playlists holding it.
+With non-zero song.Version only that version is updated
+*/
+func (r *PlaylistRepositoryRDBMS) UpdateSong(ctx context.Context, song *entity.Song) error {
+	ctx, end := r.instrument(ctx, "UpdateSong", tracing.SongID(song.ID))
+	defer end()
 	duration := int(song.Duration.Seconds())
 
-	_, err := r.db.Exec(
-		"UPDATE songs SET title = $1, artist = $2, duration = $3 WHERE id = $4",
-		song.Title, song.Artist, duration, song.ID)
+	return r.inTx(ctx, func(txRepo *PlaylistRepositoryRDBMS) error {
+		var version int
+		err := txRepo.q.QueryRowContext(ctx, `
+			UPDATE songs SET title = $1, artist = $2, duration = $3, version = version + 1
+			WHERE id = $4 AND ($5 = 0 OR version = $5) RETURNING version`,
+			song.Title, song.Artist, duration, song.ID, song.Version).Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return txRepo.versionConflict(ctx, "songs", song.ID, repository.ErrSongNotFound)
+		}
+		if err != nil {
+			return err
+		}
 
-	if err != nil { // TODO: Add additional err handling
+		if err := txRepo.touchPlaylistsOf(ctx, song.ID); err != nil {
+			return err
+		}
+		song.Version = version
+		return nil
+	})
+}
+
+/*
+DeleteSong removes song from library and all playlists, bumping their versions.
+Playlists where it was current are left without current song. With non-zero version only that version is removed
+*/
+func (r *PlaylistRepositoryRDBMS) DeleteSong(ctx context.Context, id, version int) error {
+	ctx, end := r.instrument(ctx, "DeleteSong", tracing.SongID(id))
+	defer end()
+	return r.inTx(ctx, func(txRepo *PlaylistRepositoryRDBMS) error {
+		if _, err := txRepo.q.ExecContext(ctx, "UPDATE playlists SET current_song_id = NULL, current_position_ms = 0, current_playing = FALSE WHERE current_song_id = $1", id); err != nil {
+			return err
+		}
+		if err := txRepo.touchPlaylistsOf(ctx, id); err != nil {
+			return err
+		}
+
+		res, err := txRepo.q.ExecContext(ctx, "DELETE FROM songs WHERE id = $1 AND ($2 = 0 OR version = $2)", id, version)
+		if err != nil {
+			return err
+		}
+
+		if err := requireAffected(res, repository.ErrSongNotFound); err != nil {
+			return txRepo.versionConflict(ctx, "songs", id, err)
+		}
+		return nil
+	})
+}
+
+/*
+versionConflict tells why a conditional write of the row id in table matched nothing:
+ErrVersionMismatch if the row exists, notFound otherwise
+*/
+func (r *PlaylistRepositoryRDBMS) versionConflict(ctx context.Context, table string, id int, notFound error) error {
+	var exists bool
+	if err := r.q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+table+" WHERE id = $1)", id).Scan(&exists); err != nil {
 		return err
 	}
+	if exists {
+		return repository.ErrVersionMismatch
+	}
+	return notFound
+}
 
+/*
+touchPlaylist bumps the version of the playlist. With non-zero version only that version is bumped
+and the playlist must exist
+*/
+func (r *PlaylistRepositoryRDBMS) touchPlaylist(ctx context.Context, playlistID, version int) error {
+	res, err := r.q.ExecContext(ctx,
+		"UPDATE playlists SET version = version + 1 WHERE id = $1 AND ($2 = 0 OR version = $2)", playlistID, version)
+	if err != nil || version == 0 {
+		return err
+	}
+	if err := requireAffected(res, repository.ErrPlaylistNotFound); err != nil {
+		return r.versionConflict(ctx, "playlists", playlistID, err)
+	}
 	return nil
 }
 
-func (r *PlaylistRepositoryRDBMS) DeleteSong(id int) error {
-	_, err := r.db.Exec("DELETE FROM songs WHERE id = $1", id)
+/*
+touchPlaylistsOf bumps the versions of all playlists holding the song
+*/
+func (r *PlaylistRepositoryRDBMS) touchPlaylistsOf(ctx context.Context, songID int) error {
+	_, err := r.q.ExecContext(ctx,
+		"UPDATE playlists SET version = version + 1 WHERE id IN (SELECT playlist_id FROM playlist_songs WHERE song_id = $1)", songID)
+	return err
+}
+
+func (r *PlaylistRepositoryRDBMS) IncrementPlayCount(ctx context.Context, songID int) error {
+	ctx, end := r.instrument(ctx, "IncrementPlayCount", tracing.SongID(songID))
+	defer end()
+	_, err := r.q.ExecContext(ctx, "UPDATE songs SET play_count = play_count + 1 WHERE id = $1", songID)
 
-	if err != nil { // TODO: Add additional err handling
+	if err != nil {
 		return err
 	}
+
 	return nil
 }
 
@@ -197,56 +421,106 @@ func (r *PlaylistRepositoryRDBMS) DeleteSong(id int) error {
  Methods for Song-Playlist relatins
 */
 
-func (r *PlaylistRepositoryRDBMS) AddSongToPlaylist(playlistID, songID int) error {
-	var maxNumberInPlaylist sql.NullInt64
+func (r *PlaylistRepositoryRDBMS) AddSongToPlaylist(ctx context.Context, playlistID, songID int) error {
+	ctx, end := r.instrument(ctx, "AddSongToPlaylist", tracing.PlaylistID(playlistID), tracing.SongID(songID))
+	defer end()
+	return r.inTx(ctx, func(txRepo *PlaylistRepositoryRDBMS) error {
+		var maxNumberInPlaylist sql.NullInt64
 
-	err := r.db.QueryRow("SELECT MAX(song_order) FROM playlist_songs WHERE playlist_id = $1",
-		playlistID).Scan(&maxNumberInPlaylist)
+		err := txRepo.q.QueryRowContext(ctx, "SELECT MAX(song_order) FROM playlist_songs WHERE playlist_id = $1",
+			playlistID).Scan(&maxNumberInPlaylist)
 
-	if err != nil { // TODO: Add additional err handling
-		return err
-	}
+		if err != nil { // TODO: Add additional err handling
+			return err
+		}
 
-	newNumber := 1
-	if maxNumberInPlaylist.Valid {
-		newNumber = int(maxNumberInPlaylist.Int64) + 1
-	}
+		newNumber := 1
+		if maxNumberInPlaylist.Valid {
+			newNumber = int(maxNumberInPlaylist.Int64) + 1
+		}
 
-	_, err = r.db.Exec("INSERT INTO playlist_songs (playlist_id, song_id, song_order) VALUES ($1, $2, $3)",
-		playlistID, songID, newNumber)
+		_, err = txRepo.q.ExecContext(ctx, "INSERT INTO playlist_songs (playlist_id, song_id, song_order) VALUES ($1, $2, $3)",
+			playlistID, songID, newNumber)
 
-	if err != nil { // TODO: Add additional err handling
-		return err
-	}
+		if err != nil { // TODO: Add additional err handling
+			return err
+		}
 
-	return nil
+		return txRepo.touchPlaylist(ctx, playlistID, 0)
+	})
 }
 
-func (r *PlaylistRepositoryRDBMS) RemoveSongFromPlaylist(playlistID, songID int) error {
-	_, err := r.db.Exec(
-		"DELETE FROM  playlist_songs WHERE playlist_id = $1 AND song_id = $2",
-		playlistID, songID)
+/*
+SetPlaylistOrder renumbers playlist songs in the given order. Orders are negated first
+to keep (playlist_id, song_order) unique during renumbering. Songs of the playlist missing
+in songIDs are moved to the end keeping their relative order. The version is bumped first,
+so a concurrent reorder expecting the same version waits for this one and then fails
+*/
+func (r *PlaylistRepositoryRDBMS) SetPlaylistOrder(ctx context.Context, playlistID int, songIDs []int, version int) error {
+	ctx, end := r.instrument(ctx, "SetPlaylistOrder", tracing.PlaylistID(playlistID))
+	defer end()
+	return r.inTx(ctx, func(txRepo *PlaylistRepositoryRDBMS) error {
+		if err := txRepo.touchPlaylist(ctx, playlistID, version); err != nil {
+			return err
+		}
 
-	if err != nil { // TODO: Add additional err handling
+		if _, err := txRepo.q.ExecContext(ctx,
+			"UPDATE playlist_songs SET song_order = -song_order WHERE playlist_id = $1", playlistID); err != nil {
+			return err
+		}
+
+		for i, songID := range songIDs {
+			if _, err := txRepo.q.ExecContext(ctx,
+				"UPDATE playlist_songs SET song_order = $1 WHERE playlist_id = $2 AND song_id = $3",
+				i+1, playlistID, songID); err != nil {
+				return err
+			}
+		}
+
+		_, err := txRepo.q.ExecContext(ctx,
+			"UPDATE playlist_songs SET song_order = $1 - song_order WHERE playlist_id = $2 AND song_order < 0",
+			len(songIDs), playlistID)
 		return err
-	}
+	})
+}
 
-	return nil
+func (r *PlaylistRepositoryRDBMS) RemoveSongFromPlaylist(ctx context.Context, playlistID, songID int) error {
+	ctx, end := r.instrument(ctx, "RemoveSongFromPlaylist", tracing.PlaylistID(playlistID), tracing.SongID(songID))
+	defer end()
+	return r.inTx(ctx, func(txRepo *PlaylistRepositoryRDBMS) error {
+		_, err := txRepo.q.ExecContext(ctx,
+			"DELETE FROM  playlist_songs WHERE playlist_id = $1 AND song_id = $2",
+			playlistID, songID)
+
+		if err != nil { // TODO: Add additional err handling
+			return err
+		}
+
+		return txRepo.touchPlaylist(ctx, playlistID, 0)
+	})
 }
 
 /*
  PlaylistRepository interface methods impl
 */
 
-func (r *PlaylistRepositoryRDBMS) GetPlaylist() (*entity.Playlist, error) {
+func (r *PlaylistRepositoryRDBMS) GetPlaylist(ctx context.Context) (*entity.Playlist, error) {
+	ctx, end := r.instrument(ctx, "GetPlaylist", tracing.PlaylistID(r.defaultPlaylistID))
+	defer end()
 	if r.defaultPlaylistID == 0 {
 		return nil, repository.ErrDefaultPlaylistNotSet
 	}
 
-	return r.GetPlaylistByID(r.defaultPlaylistID)
+	return r.GetPlaylistByID(ctx, r.defaultPlaylistID)
 }
 
-func (r *PlaylistRepositoryRDBMS) SetCurrent(node *entity.PlaylistNode) error {
+/*
+SetCurrent stores the song of node as current in the default playlist.
+The song must be in the playlist, otherwise ErrCurrentSongNotFound is returned
+*/
+func (r *PlaylistRepositoryRDBMS) SetCurrent(ctx context.Context, node *entity.PlaylistNode) error {
+	ctx, end := r.instrument(ctx, "SetCurrent", tracing.PlaylistID(r.defaultPlaylistID))
+	defer end()
 	if r.defaultPlaylistID == 0 {
 		return repository.ErrDefaultPlaylistNotSet
 	}
@@ -254,35 +528,72 @@ func (r *PlaylistRepositoryRDBMS) SetCurrent(node *entity.PlaylistNode) error {
 		return repository.ErrNilNode
 	}
 
-	return r.UpdatePlaylistCurrentSong(r.defaultPlaylistID, node.Song.ID)
+	res, err := r.q.ExecContext(ctx, `
+		UPDATE playlists SET current_song_id = $1, current_position_ms = 0
+		WHERE id = $2 AND EXISTS (SELECT 1 FROM playlist_songs WHERE playlist_id = $2 AND song_id = $1)`,
+		node.Song.ID, r.defaultPlaylistID)
+	if err != nil {
+		return err
+	}
 
+	return requireAffected(res, repository.ErrCurrentSongNotFound)
 }
 
-func (r *PlaylistRepositoryRDBMS) GetCurrent() (*entity.PlaylistNode, error) {
+/*
+SaveCheckpoint stores the current song of the default playlist together with the position within it
+and whether it is playing
+*/
+func (r *PlaylistRepositoryRDBMS) SaveCheckpoint(ctx context.Context, checkpoint repository.Checkpoint) error {
+	ctx, end := r.instrument(ctx, "SaveCheckpoint", tracing.PlaylistID(r.defaultPlaylistID), tracing.SongID(checkpoint.SongID))
+	defer end()
 	if r.defaultPlaylistID == 0 {
-		return nil, repository.ErrDefaultPlaylistNotSet
+		return repository.ErrDefaultPlaylistNotSet
 	}
 
-	var currentSongID sql.NullInt64
+	res, err := r.q.ExecContext(ctx, `
+		UPDATE playlists SET current_song_id = $1, current_position_ms = $2, current_playing = $3
+		WHERE id = $4 AND EXISTS (SELECT 1 FROM playlist_songs WHERE playlist_id = $4 AND song_id = $1)`,
+		checkpoint.SongID, checkpoint.Position.Milliseconds(), checkpoint.Playing, r.defaultPlaylistID)
+	if err != nil {
+		return err
+	}
 
-	err := r.db.QueryRow("SELECT current_song_id FROM playlists WHERE id = $1",
-		r.defaultPlaylistID).Scan(&currentSongID)
+	return requireAffected(res, repository.ErrCurrentSongNotFound)
+}
 
-	if err != nil { //TODO: add additional error handling
-		return nil, err
+func (r *PlaylistRepositoryRDBMS) LoadCheckpoint(ctx context.Context) (repository.Checkpoint, error) {
+	ctx, end := r.instrument(ctx, "LoadCheckpoint", tracing.PlaylistID(r.defaultPlaylistID))
+	defer end()
+	if r.defaultPlaylistID == 0 {
+		return repository.Checkpoint{}, repository.ErrDefaultPlaylistNotSet
 	}
 
-	if !currentSongID.Valid {
-		return nil, nil
+	var songID sql.NullInt64
+	var positionMS int64
+	var playing bool
+	err := r.q.QueryRowContext(ctx, "SELECT current_song_id, current_position_ms, current_playing FROM playlists WHERE id = $1", r.defaultPlaylistID).
+		Scan(&songID, &positionMS, &playing)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.Checkpoint{}, repository.ErrPlaylistNotFound
+	}
+	if err != nil {
+		return repository.Checkpoint{}, err
 	}
 
-	song, err := r.GetSongByID(int(currentSongID.Int64))
+	return repository.Checkpoint{SongID: int(songID.Int64), Position: time.Duration(positionMS) * time.Millisecond, Playing: playing}, nil
+}
+
+/*
+GetCurrent returns the current node of the default playlist linked with its neighbours.
+Without stored current song the first song is current, as in GetPlaylist
+*/
+func (r *PlaylistRepositoryRDBMS) GetCurrent(ctx context.Context) (*entity.PlaylistNode, error) {
+	ctx, end := r.instrument(ctx, "GetCurrent", tracing.PlaylistID(r.defaultPlaylistID))
+	defer end()
+	playlist, err := r.GetPlaylist(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	node := &entity.PlaylistNode{
-		Song: song,
-	}
-	return node, nil
+	return playlist.GetCurrent(), nil
 }
@@ -0,0 +1,167 @@
+package rdbms
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/pagination"
+	"cloud-go-testtask/internal/repository"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+ Methods for library search implementation
+*/
+
+type songSortSpec struct {
+	expr string // sort key expression, also stored in cursor as text
+	cast string // type of the key to compare cursor value with
+	desc bool
+}
+
+var songSorts = map[repository.SongSort]songSortSpec{
+	repository.SongSortID:           {expr: "s.id", cast: "int"},
+	repository.SongSortTitle:        {expr: "lower(s.title)", cast: "text"},
+	repository.SongSortTitleDesc:    {expr: "lower(s.title)", cast: "text", desc: true},
+	repository.SongSortArtist:       {expr: "lower(s.artist)", cast: "text"},
+	repository.SongSortArtistDesc:   {expr: "lower(s.artist)", cast: "text", desc: true},
+	repository.SongSortDuration:     {expr: "s.duration", cast: "int"},
+	repository.SongSortDurationDesc: {expr: "s.duration", cast: "int", desc: true},
+	repository.SongSortAdded:        {expr: "s.created_at", cast: "timestamp"},
+	repository.SongSortAddedDesc:    {expr: "s.created_at", cast: "timestamp", desc: true},
+}
+
+/*
+SearchSongs uses full-text search over title and artist (word match on SQLite) and keyset pagination by (sort key, id)
+*/
+func (r *PlaylistRepositoryRDBMS) SearchSongs(ctx context.Context, q repository.SongQuery) (*repository.SongPage, error) {
+	ctx, end := r.instrument(ctx, "SearchSongs")
+	defer end()
+	spec, ok := songSorts[q.Sort]
+	if !ok {
+		spec = songSorts[repository.SongSortID]
+	}
+
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.Text != "" {
+		where = append(where, r.dialect.textMatch("s.search_vector", []string{"s.title", "s.artist"}, q.Text, arg))
+	}
+	if q.Artist != "" {
+		where = append(where, "lower(s.artist) = lower("+arg(q.Artist)+")")
+	}
+	if q.MinDuration > 0 {
+		where = append(where, "s.duration >= "+arg(int(q.MinDuration.Seconds())))
+	}
+	if q.MaxDuration > 0 {
+		where = append(where, "s.duration <= "+arg(int(q.MaxDuration.Seconds())))
+	}
+
+	direction, cmp := "ASC", ">"
+	if spec.desc {
+		direction, cmp = "DESC", "<"
+	}
+
+	if q.After != nil {
+		where = append(where, fmt.Sprintf("(%s, s.id) %s (CAST(%s AS %s), %s)",
+			spec.expr, cmp, arg(q.After.Value), r.dialect.castType(spec.cast), arg(q.After.ID)))
+	}
+
+	query := "SELECT s.id, s.title, s.artist, s.duration, s.created_at, s.play_count, s.version, " + "CAST(" + spec.expr + " AS TEXT) FROM songs s"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, s.id %s LIMIT %s", spec.expr, direction, direction, arg(q.Limit+1))
+
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &repository.SongPage{}
+	var keys []string
+
+	for rows.Next() {
+		var s entity.Song
+		var durationSec int
+		var key string
+		if err := rows.Scan(&s.ID, &s.Title, &s.Artist, &durationSec, &s.AddedAt, &s.PlayCount, &s.Version, &key); err != nil {
+			return nil, err
+		}
+		s.Duration = time.Duration(durationSec) * time.Second
+		page.Songs = append(page.Songs, &s)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Songs) > q.Limit {
+		page.Songs = page.Songs[:q.Limit]
+		last := page.Songs[q.Limit-1]
+		page.Next = &pagination.Cursor{Sort: string(q.Sort), Value: keys[q.Limit-1], ID: last.ID}
+	}
+
+	return page, nil
+}
+
+/*
+SearchPlaylists uses full-text search over name and description and keyset pagination by id
+*/
+func (r *PlaylistRepositoryRDBMS) SearchPlaylists(ctx context.Context, q repository.PlaylistQuery) (*repository.PlaylistPage, error) {
+	ctx, end := r.instrument(ctx, "SearchPlaylists")
+	defer end()
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.Text != "" {
+		where = append(where, r.dialect.textMatch("p.search_vector", []string{"p.name", "COALESCE(p.description, '')"}, q.Text, arg))
+	}
+	if q.After != nil {
+		where = append(where, "p.id > "+arg(q.After.ID))
+	}
+
+	query := `SELECT p.id, p.name, COALESCE(p.description, ''), p.created_at,
+		(SELECT COUNT(*) FROM playlist_songs ps WHERE ps.playlist_id = p.id)
+		FROM playlists p`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY p.id LIMIT " + arg(q.Limit+1)
+
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &repository.PlaylistPage{}
+	for rows.Next() {
+		var p entity.PlaylistInfo
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.CreatedAt, &p.SongCount); err != nil {
+			return nil, err
+		}
+		page.Playlists = append(page.Playlists, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Playlists) > q.Limit {
+		page.Playlists = page.Playlists[:q.Limit]
+		page.Next = &pagination.Cursor{ID: page.Playlists[q.Limit-1].ID}
+	}
+
+	return page, nil
+}
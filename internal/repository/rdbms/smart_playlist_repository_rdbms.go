@@ -0,0 +1,216 @@
+package rdbms
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/tracing"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+/*
+ Methods for SmartPlaylist CRUD implementation
+*/
+
+type smartRuleRow struct {
+	Field    string `json:"field"`
+	Operator string `json:"op"`
+	Value    string `json:"value"`
+}
+
+func encodeSmartRules(rules []entity.SmartRule) ([]byte, error) {
+	rows := make([]smartRuleRow, 0, len(rules))
+	for _, rule := range rules {
+		rows = append(rows, smartRuleRow{
+			Field:    string(rule.Field),
+			Operator: string(rule.Operator),
+			Value:    rule.Value,
+		})
+	}
+	return json.Marshal(rows)
+}
+
+func decodeSmartRules(data []byte) ([]entity.SmartRule, error) {
+	var rows []smartRuleRow
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+
+	rules := make([]entity.SmartRule, 0, len(rows))
+	for _, row := range rows {
+		rules = append(rules, entity.SmartRule{
+			Field:    entity.RuleField(row.Field),
+			Operator: entity.RuleOperator(row.Operator),
+			Value:    row.Value,
+		})
+	}
+	return rules, nil
+}
+
+func (r *PlaylistRepositoryRDBMS) CreateSmartPlaylist(ctx context.Context, sp *entity.SmartPlaylist) (int, error) {
+	ctx, end := r.instrument(ctx, "CreateSmartPlaylist")
+	defer end()
+	rules, err := encodeSmartRules(sp.Rules)
+	if err != nil {
+		return 0, err
+	}
+
+	var id, version int
+	err = r.q.QueryRowContext(ctx,
+		"INSERT INTO smart_playlists (name, description, rules, sort_by, song_limit) VALUES ($1, $2, $3, $4, $5) RETURNING id, version",
+		sp.Name, sp.Description, rules, string(sp.SortBy), sp.Limit).Scan(&id, &version)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, repository.ErrPlaylistCreationFailed
+		}
+		return 0, err
+	}
+
+	sp.ID = id
+	sp.Version = version
+	return id, nil
+}
+
+func (r *PlaylistRepositoryRDBMS) GetSmartPlaylistByID(ctx context.Context, id int) (*entity.SmartPlaylist, error) {
+	ctx, end := r.instrument(ctx, "GetSmartPlaylistByID", tracing.SmartPlaylistID(id))
+	defer end()
+	row := r.q.QueryRowContext(ctx,
+		"SELECT id, name, description, rules, sort_by, song_limit, version FROM smart_playlists WHERE id = $1", id)
+
+	sp, err := scanSmartPlaylist(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrSmartPlaylistNotFound
+		}
+		return nil, err
+	}
+
+	return sp, nil
+}
+
+func (r *PlaylistRepositoryRDBMS) ListSmartPlaylists(ctx context.Context) ([]*entity.SmartPlaylist, error) {
+	ctx, end := r.instrument(ctx, "ListSmartPlaylists")
+	defer end()
+	rows, err := r.q.QueryContext(ctx,
+		"SELECT id, name, description, rules, sort_by, song_limit, version FROM smart_playlists ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var playlists []*entity.SmartPlaylist
+	for rows.Next() {
+		sp, err := scanSmartPlaylist(rows)
+		if err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, sp)
+	}
+
+	return playlists, rows.Err()
+}
+
+func (r *PlaylistRepositoryRDBMS) UpdateSmartPlaylist(ctx context.Context, sp *entity.SmartPlaylist) error {
+	ctx, end := r.instrument(ctx, "UpdateSmartPlaylist", tracing.SmartPlaylistID(sp.ID))
+	defer end()
+	rules, err := encodeSmartRules(sp.Rules)
+	if err != nil {
+		return err
+	}
+
+	var version int
+	err = r.q.QueryRowContext(ctx, `
+		UPDATE smart_playlists SET name = $1, description = $2, rules = $3, sort_by = $4, song_limit = $5, version = version + 1
+		WHERE id = $6 AND ($7 = 0 OR version = $7) RETURNING version`,
+		sp.Name, sp.Description, rules, string(sp.SortBy), sp.Limit, sp.ID, sp.Version).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return r.versionConflict(ctx, "smart_playlists", sp.ID, repository.ErrSmartPlaylistNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	sp.Version = version
+	return nil
+}
+
+func (r *PlaylistRepositoryRDBMS) DeleteSmartPlaylistByID(ctx context.Context, id, version int) error {
+	ctx, end := r.instrument(ctx, "DeleteSmartPlaylistByID", tracing.SmartPlaylistID(id))
+	defer end()
+	res, err := r.q.ExecContext(ctx, "DELETE FROM smart_playlists WHERE id = $1 AND ($2 = 0 OR version = $2)", id, version)
+	if err != nil {
+		return err
+	}
+
+	if err := requireAffected(res, repository.ErrSmartPlaylistNotFound); err != nil {
+		return r.versionConflict(ctx, "smart_playlists", id, err)
+	}
+	return nil
+}
+
+/*
+ListSongs returns the whole library, smart playlists are materialized from it
+*/
+func (r *PlaylistRepositoryRDBMS) ListSongs(ctx context.Context) ([]*entity.Song, error) {
+	ctx, end := r.instrument(ctx, "ListSongs")
+	defer end()
+	rows, err := r.q.QueryContext(ctx, "SELECT id, title, artist, duration, created_at, play_count, version FROM songs ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var songs []*entity.Song
+	for rows.Next() {
+		var s entity.Song
+		var durationSec int
+		if err := rows.Scan(&s.ID, &s.Title, &s.Artist, &durationSec, &s.AddedAt, &s.PlayCount, &s.Version); err != nil {
+			return nil, err
+		}
+		s.Duration = time.Duration(durationSec) * time.Second
+		songs = append(songs, &s)
+	}
+
+	return songs, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSmartPlaylist(row rowScanner) (*entity.SmartPlaylist, error) {
+	var sp entity.SmartPlaylist
+	var description sql.NullString
+	var rules []byte
+	var sortBy string
+
+	if err := row.Scan(&sp.ID, &sp.Name, &description, &rules, &sortBy, &sp.Limit, &sp.Version); err != nil {
+		return nil, err
+	}
+
+	decoded, err := decodeSmartRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	sp.Description = description.String
+	sp.Rules = decoded
+	sp.SortBy = entity.SmartSort(sortBy)
+
+	return &sp, nil
+}
+
+func requireAffected(res sql.Result, notFound error) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return notFound
+	}
+	return nil
+}
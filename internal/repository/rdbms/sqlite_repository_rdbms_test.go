@@ -0,0 +1,373 @@
+package rdbms_test
+
+import (
+	"cloud-go-testtask/internal/config"
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/migrator"
+	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/repository/rdbms"
+	"cloud-go-testtask/internal/repository/repositorytest"
+	"cloud-go-testtask/internal/storage"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/*
+newSQLiteRepo returns repository over a fresh SQLite database migrated by the embedded migrations.
+Default playlist 1 has songs 1 and 2
+*/
+func newSQLiteRepo(t *testing.T) *rdbms.PlaylistRepositoryRDBMS {
+	t.Helper()
+
+	cfg := &config.Config{Storage: storage.SQLite, StoragePath: filepath.Join(t.TempDir(), "storage.db")}
+	db, dialect, err := storage.OpenDB(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	m, err := migrator.New(db, dialect, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	require.NoError(t, m.Up(context.Background()))
+
+	repo := storage.NewRepository(db, dialect)
+	repo.SetDefaultPlaylistID(1)
+	return repo
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	repositorytest.RunPlaylistRepository(t, func(t *testing.T) repository.PlaylistRepository {
+		repo := newSQLiteRepo(t)
+		id, err := repo.CreatePlaylist(context.Background(), "Conformance", "")
+		require.NoError(t, err)
+		repo.SetDefaultPlaylistID(id)
+		return repo
+	})
+}
+
+func TestSQLiteInTx(t *testing.T) {
+	ctx := context.Background()
+	repo := newSQLiteRepo(t)
+
+	err := repo.InTx(ctx, func(tx repository.TxRepository) error {
+		song := &entity.Song{Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second}
+		if err := tx.AddSong(ctx, song); err != nil {
+			return err
+		}
+		return tx.SetCurrent(ctx, &entity.PlaylistNode{Song: &entity.Song{ID: song.ID + 1}})
+	})
+	assert.ErrorIs(t, err, repository.ErrCurrentSongNotFound)
+
+	_, err = repo.FindSong(ctx, "Imagine", "John Lennon")
+	assert.ErrorIs(t, err, repository.ErrSongNotFound, "song insert is rolled back")
+	playlist, err := repo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, songIDs(playlist))
+}
+
+func TestSQLiteCanceledContext(t *testing.T) {
+	repo := newSQLiteRepo(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	song := &entity.Song{Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second}
+	assert.ErrorIs(t, repo.AddSong(ctx, song), context.Canceled)
+	_, err := repo.GetPlaylist(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = repo.FindSong(context.Background(), "Imagine", "John Lennon")
+	assert.ErrorIs(t, err, repository.ErrSongNotFound, "canceled write is not applied")
+}
+
+func TestSQLiteCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	repo := newSQLiteRepo(t)
+
+	checkpoint := repository.Checkpoint{SongID: 2, Position: 42500 * time.Millisecond, Playing: true}
+	require.NoError(t, repo.SaveCheckpoint(ctx, checkpoint))
+	loaded, err := repo.LoadCheckpoint(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, checkpoint, loaded)
+
+	current, err := repo.GetCurrent(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, current.Song.ID, "checkpoint song becomes current")
+
+	assert.ErrorIs(t, repo.SaveCheckpoint(ctx, repository.Checkpoint{SongID: 100}), repository.ErrCurrentSongNotFound)
+
+	require.NoError(t, repo.SetCurrent(ctx, &entity.PlaylistNode{Song: &entity.Song{ID: 1}}))
+	loaded, err = repo.LoadCheckpoint(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, repository.Checkpoint{SongID: 1, Playing: true}, loaded, "position is reset with the current song, playing is kept")
+}
+
+func TestSQLiteMethodObserver(t *testing.T) {
+	ctx := context.Background()
+	repo := newSQLiteRepo(t)
+
+	var methods []string
+	repo.SetMethodObserver(func(method string, duration time.Duration) {
+		methods = append(methods, method)
+	})
+
+	_, err := repo.GetSongByID(ctx, 1)
+	require.NoError(t, err)
+	require.NoError(t, repo.InTx(ctx, func(tx repository.TxRepository) error {
+		_, err := tx.CreatePlaylist(ctx, "Observed", "")
+		return err
+	}))
+	assert.Equal(t, []string{"GetSongByID", "CreatePlaylist", "InTx"}, methods, "calls in transaction are observed too")
+}
+
+func TestSQLitePlaylist(t *testing.T) {
+	ctx := context.Background()
+	repo := newSQLiteRepo(t)
+
+	song := &entity.Song{Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second}
+	require.NoError(t, repo.AddSong(ctx, song))
+	assert.NotZero(t, song.ID)
+	assert.False(t, song.AddedAt.IsZero())
+	assert.Error(t, repo.AddSongToPlaylist(ctx, 1, song.ID), "AddSong has already put the song into default playlist")
+
+	playlist, err := repo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, song.ID}, songIDs(playlist))
+
+	require.NoError(t, repo.SetPlaylistOrder(ctx, 1, []int{song.ID, 1}, 0))
+	require.NoError(t, repo.UpdatePlaylistCurrentSong(ctx, 1, song.ID))
+
+	playlist, err = repo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{song.ID, 1, 2}, songIDs(playlist))
+	assert.Equal(t, song.ID, playlist.GetCurrent().Song.ID)
+
+	found, err := repo.FindSong(ctx, "IMAGINE", "john lennon")
+	require.NoError(t, err)
+	assert.Equal(t, song.ID, found.ID)
+
+	// deleting the current song leaves playlist without stored current song, so the first one is current
+	require.NoError(t, repo.DeleteSong(ctx, song.ID, 0))
+	current, err := repo.GetCurrent(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, current.Song.ID)
+
+	playlist, err = repo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, songIDs(playlist))
+	assert.Equal(t, 1, playlist.GetCurrent().Song.ID)
+
+	assert.ErrorIs(t, repo.DeleteSong(ctx, song.ID, 0), repository.ErrSongNotFound)
+}
+
+func TestSQLiteVersions(t *testing.T) {
+	ctx := context.Background()
+	repo := newSQLiteRepo(t)
+
+	playlist, err := repo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	version := playlist.Version
+	assert.NotZero(t, version)
+
+	song := &entity.Song{Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second}
+	require.NoError(t, repo.AddSong(ctx, song))
+	assert.Equal(t, 1, song.Version)
+	version++ // the song is added to the default playlist
+
+	stale := *song
+	song.Title = "Imagine (Remastered)"
+	require.NoError(t, repo.UpdateSong(ctx, song))
+	assert.Equal(t, 2, song.Version)
+	version++ // the playlist holds the song
+
+	stale.Title = "Lost update"
+	assert.ErrorIs(t, repo.UpdateSong(ctx, &stale), repository.ErrVersionMismatch)
+	stored, err := repo.GetSongByID(ctx, song.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Imagine (Remastered)", stored.Title)
+	assert.Equal(t, 2, stored.Version)
+
+	assert.ErrorIs(t, repo.UpdateSong(ctx, &entity.Song{ID: 100, Title: "Missing", Version: 1}), repository.ErrSongNotFound)
+
+	playlist, err = repo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, version, playlist.Version)
+	assert.Equal(t, 2, playlist.GetTail().Song.Version)
+
+	assert.ErrorIs(t, repo.SetPlaylistOrder(ctx, 1, []int{song.ID}, version-1), repository.ErrVersionMismatch)
+	require.NoError(t, repo.SetPlaylistOrder(ctx, 1, []int{song.ID}, version))
+	assert.ErrorIs(t, repo.SetPlaylistOrder(ctx, 100, []int{song.ID}, version), repository.ErrPlaylistNotFound)
+
+	playlist, err = repo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, version+1, playlist.Version)
+	assert.Equal(t, []int{song.ID, 1, 2}, songIDs(playlist))
+
+	assert.ErrorIs(t, repo.DeleteSong(ctx, song.ID, 1), repository.ErrVersionMismatch)
+	require.NoError(t, repo.DeleteSong(ctx, song.ID, 2))
+	assert.ErrorIs(t, repo.DeleteSong(ctx, song.ID, 2), repository.ErrSongNotFound)
+
+	id, err := repo.CreatePlaylist(ctx, "Road trip", "")
+	require.NoError(t, err)
+	assert.ErrorIs(t, repo.DeletePlaylistByID(ctx, id, 2), repository.ErrVersionMismatch)
+	require.NoError(t, repo.DeletePlaylistByID(ctx, id, 1))
+	assert.ErrorIs(t, repo.DeletePlaylistByID(ctx, id, 1), repository.ErrPlaylistNotFound)
+}
+
+func TestSQLiteSearch(t *testing.T) {
+	ctx := context.Background()
+	repo := newSQLiteRepo(t)
+
+	for _, s := range []*entity.Song{
+		{Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second},
+		{Title: "Jealous Guy", Artist: "John Lennon", Duration: 254 * time.Second},
+		{Title: "100% Pure", Artist: "Someone", Duration: 200 * time.Second},
+	} {
+		require.NoError(t, repo.AddSong(ctx, s))
+	}
+
+	page, err := repo.SearchSongs(ctx, repository.SongQuery{Text: "lennon guy", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Songs, 1)
+	assert.Equal(t, "Jealous Guy", page.Songs[0].Title)
+
+	page, err = repo.SearchSongs(ctx, repository.SongQuery{Text: "0%", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Songs, 1)
+	assert.Equal(t, "100% Pure", page.Songs[0].Title)
+
+	// keyset pagination by title desc through all five songs
+	var titles []string
+	q := repository.SongQuery{Sort: repository.SongSortTitleDesc, Limit: 2}
+	for {
+		page, err := repo.SearchSongs(ctx, q)
+		require.NoError(t, err)
+		for _, s := range page.Songs {
+			titles = append(titles, s.Title)
+		}
+		if page.Next == nil {
+			break
+		}
+		q.After = page.Next
+	}
+	assert.Equal(t, []string{"Jealous Guy", "Imagine", "Default Song 2", "Default Song 1", "100% Pure"}, titles)
+
+	// cursor over timestamps compares stored text
+	page, err = repo.SearchSongs(ctx, repository.SongQuery{Sort: repository.SongSortAdded, Limit: 4})
+	require.NoError(t, err)
+	require.NotNil(t, page.Next)
+	assert.True(t, repository.SongSortAdded.ValidCursorValue(page.Next.Value), page.Next.Value)
+	page, err = repo.SearchSongs(ctx, repository.SongQuery{Sort: repository.SongSortAdded, Limit: 4, After: page.Next})
+	require.NoError(t, err)
+	assert.Len(t, page.Songs, 1)
+
+	id, err := repo.CreatePlaylist(ctx, "Road trip", "songs for a long drive")
+	require.NoError(t, err)
+	playlists, err := repo.SearchPlaylists(ctx, repository.PlaylistQuery{Text: "drive", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, playlists.Playlists, 1)
+	assert.Equal(t, id, playlists.Playlists[0].ID)
+}
+
+func TestSQLiteSmartPlaylist(t *testing.T) {
+	ctx := context.Background()
+	repo := newSQLiteRepo(t)
+
+	sp := &entity.SmartPlaylist{
+		Name:   "Short",
+		Rules:  []entity.SmartRule{{Field: entity.RuleFieldDuration, Operator: entity.RuleOpLess, Value: "260"}},
+		SortBy: entity.SmartSortMostPlayed,
+		Limit:  5,
+	}
+	id, err := repo.CreateSmartPlaylist(ctx, sp)
+	require.NoError(t, err)
+
+	got, err := repo.GetSmartPlaylistByID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, sp, got)
+	assert.Equal(t, 1, got.Version)
+
+	// writes expecting another version fail, the matching one bumps it
+	got.Version = 5
+	assert.ErrorIs(t, repo.UpdateSmartPlaylist(ctx, got), repository.ErrVersionMismatch)
+	got.Version = 1
+	got.Limit = 10
+	require.NoError(t, repo.UpdateSmartPlaylist(ctx, got))
+	assert.Equal(t, 2, got.Version)
+
+	assert.ErrorIs(t, repo.DeleteSmartPlaylistByID(ctx, id, 1), repository.ErrVersionMismatch)
+	require.NoError(t, repo.DeleteSmartPlaylistByID(ctx, id, 2))
+	_, err = repo.GetSmartPlaylistByID(ctx, id)
+	assert.ErrorIs(t, err, repository.ErrSmartPlaylistNotFound)
+}
+
+func TestSQLiteIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+	repo := newSQLiteRepo(t)
+
+	stored, err := repo.ReserveIdempotencyKey(ctx, "key", "fingerprint", "first", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	// a retry while the first request is served sees the reservation
+	stored, err = repo.ReserveIdempotencyKey(ctx, "key", "fingerprint", "retry", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, "fingerprint", stored.Fingerprint)
+	assert.Zero(t, stored.Status)
+
+	response := &repository.IdempotentResponse{
+		Fingerprint: "fingerprint",
+		Status:      201,
+		Header:      map[string][]string{"Content-Type": {"application/json"}},
+		Body:        []byte(`{"id":3}`),
+	}
+	assert.ErrorIs(t, repo.SaveIdempotentResponse(ctx, "missing", "first", response, time.Hour), repository.ErrIdempotencyKeyLost)
+	assert.ErrorIs(t, repo.SaveIdempotentResponse(ctx, "key", "retry", response, time.Hour), repository.ErrIdempotencyKeyLost)
+	require.NoError(t, repo.SaveIdempotentResponse(ctx, "key", "first", response, time.Hour))
+
+	// a stored response outlives release
+	require.NoError(t, repo.ReleaseIdempotencyKey(ctx, "key", "first"))
+	stored, err = repo.ReserveIdempotencyKey(ctx, "key", "other", "third", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, response, stored)
+
+	// a released reservation is free
+	_, err = repo.ReserveIdempotencyKey(ctx, "released", "fingerprint", "first", time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, repo.ReleaseIdempotencyKey(ctx, "released", "first"))
+	stored, err = repo.ReserveIdempotencyKey(ctx, "released", "other", "retry", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	// an expired reservation is free, the request which outlived it neither saves nor releases the key of the retry
+	_, err = repo.ReserveIdempotencyKey(ctx, "expired", "fingerprint", "first", 0)
+	require.NoError(t, err)
+	stored, err = repo.ReserveIdempotencyKey(ctx, "expired", "fingerprint", "retry", time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+	require.NoError(t, repo.ReleaseIdempotencyKey(ctx, "expired", "first"))
+	assert.ErrorIs(t, repo.SaveIdempotentResponse(ctx, "expired", "first", response, time.Hour), repository.ErrIdempotencyKeyLost)
+	stored, err = repo.ReserveIdempotencyKey(ctx, "expired", "fingerprint", "third", time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Zero(t, stored.Status)
+
+	_, err = repo.ReserveIdempotencyKey(ctx, "purged", "fingerprint", "first", 0)
+	require.NoError(t, err)
+	purged, err := repo.PurgeIdempotencyKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+}
+
+func songIDs(p *entity.Playlist) []int {
+	var ids []int
+	for node := p.GetHead(); node != nil; node = node.Next {
+		ids = append(ids, node.Song.ID)
+	}
+	return ids
+}
@@ -0,0 +1,59 @@
+package rdbms
+
+import (
+	"cloud-go-testtask/internal/repository"
+	"context"
+	"database/sql"
+	"errors"
+)
+
+/*
+querier is the common part of *sql.DB and *sql.Tx, so the same methods work inside transaction
+*/
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+/*
+InTx runs fn with a repository bound to a single transaction.
+The transaction is committed if fn returns nil and rolled back otherwise.
+Calls made on a repository which is already inside transaction join it.
+*/
+func (r *PlaylistRepositoryRDBMS) InTx(ctx context.Context, fn func(tx repository.TxRepository) error) error {
+	ctx, end := r.instrument(ctx, "InTx")
+	defer end()
+	return r.inTx(ctx, func(txRepo *PlaylistRepositoryRDBMS) error {
+		return fn(txRepo)
+	})
+}
+
+func (r *PlaylistRepositoryRDBMS) inTx(ctx context.Context, fn func(txRepo *PlaylistRepositoryRDBMS) error) error {
+	if _, ok := r.q.(*sql.Tx); ok {
+		return fn(r)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	txRepo := &PlaylistRepositoryRDBMS{
+		db:                r.db,
+		q:                 tx,
+		defaultPlaylistID: r.defaultPlaylistID,
+		dialect:           r.dialect,
+		observer:          r.observer,
+	}
+
+	if err := fn(txRepo); err != nil {
+		// canceled context has already rolled the transaction back
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
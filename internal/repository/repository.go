@@ -2,11 +2,14 @@ package repository
 
 import (
 	"cloud-go-testtask/internal/entity"
+	"context"
 	"errors"
+	"time"
 )
 
 var (
 	ErrNullSong               = errors.New("received null instead of Song struct")
+	ErrNullPlaylist           = errors.New("received null instead of Playlist struct")
 	ErrPlaylistNotInitialized = errors.New("playlist is not initialized")
 	ErrPlaylistNotFound       = errors.New("playlist not found")
 	ErrNoSongsInPlaylist      = errors.New("no songs found in playlist")
@@ -15,11 +18,164 @@ var (
 	ErrNilNode                = errors.New("node or node.Song is nil")
 	ErrAddSong                = errors.New("failed to add song")
 	ErrPlaylistCreationFailed = errors.New("playlist creation failed")
+	ErrSmartPlaylistNotFound  = errors.New("smart playlist not found")
+	ErrSongNotFound           = errors.New("song not found")
+	ErrSongAlreadyInPlaylist  = errors.New("song is already in playlist")
+	ErrVersionMismatch        = errors.New("version does not match")
+	ErrIdempotencyKeyLost     = errors.New("idempotency key is no longer reserved")
 )
 
 type PlaylistRepository interface {
-	GetPlaylist() (*entity.Playlist, error)
-	AddSong(song *entity.Song) error
-	SetCurrent(node *entity.PlaylistNode) error
-	GetCurrent() (*entity.PlaylistNode, error)
+	GetPlaylist(ctx context.Context) (*entity.Playlist, error)
+	AddSong(ctx context.Context, song *entity.Song) error
+	SetCurrent(ctx context.Context, node *entity.PlaylistNode) error
+	GetCurrent(ctx context.Context) (*entity.PlaylistNode, error)
+}
+
+/*
+Transactor is implemented by repositories which can run several writes in one transaction.
+fn gets the repository bound to the transaction, which is committed if fn returns nil
+and rolled back otherwise
+*/
+type Transactor interface {
+	InTx(ctx context.Context, fn func(tx TxRepository) error) error
+}
+
+/*
+TxRepository is the repository bound to a transaction. It also implements the optional interfaces
+(SongEditor, PlaylistEditor, PlaylistOrderer) of the repository which runs the transaction
+*/
+type TxRepository interface {
+	PlaylistRepository
+	PlaylistWriter
+}
+
+/*
+PlaylistLoader is implemented by repositories which can swap the whole playlist at once,
+e.g. the cache when a smart playlist is sent to playback
+*/
+type PlaylistLoader interface {
+	LoadPlaylist(ctx context.Context, playlist *entity.Playlist) error
+}
+
+/*
+PlayCountRecorder is implemented by repositories which keep play statistics of songs
+*/
+type PlayCountRecorder interface {
+	IncrementPlayCount(ctx context.Context, songID int) error
+}
+
+/*
+MethodObserver receives the duration of every call of an instrumented repository method, e.g. to export metrics
+*/
+type MethodObserver func(method string, duration time.Duration)
+
+/*
+Checkpoint is the point where playback of the default playlist stopped. SongID is 0 if no song is current.
+Playing tells whether the song was playing, so an instance taking playback over resumes it
+*/
+type Checkpoint struct {
+	SongID   int
+	Position time.Duration
+	Playing  bool
+}
+
+/*
+Checkpointer is implemented by repositories which keep the playback position within the current song,
+so playback resumes from it after restart. SetCurrent resets the position to the start of the song
+*/
+type Checkpointer interface {
+	SaveCheckpoint(ctx context.Context, checkpoint Checkpoint) error
+	LoadCheckpoint(ctx context.Context) (Checkpoint, error)
+}
+
+/*
+PlaylistOrderer is implemented by repositories which store the order of songs in playlists.
+A non-zero version makes the write conditional: ErrVersionMismatch is returned if the playlist has another one
+*/
+type PlaylistOrderer interface {
+	SetPlaylistOrder(ctx context.Context, playlistID int, songIDs []int, version int) error
+}
+
+/*
+PlaylistEditor is implemented by repositories which store songs of playlists,
+the reconciler rewrites the playlist in DB after the cache through it
+*/
+type PlaylistEditor interface {
+	AddSongToPlaylist(ctx context.Context, playlistID, songID int) error
+	RemoveSongFromPlaylist(ctx context.Context, playlistID, songID int) error
+}
+
+type SongReader interface {
+	GetSongByID(ctx context.Context, id int) (*entity.Song, error)
+}
+
+/*
+SongEditor is implemented by repositories which allow to change and remove library songs.
+UpdateSong expects song.Version and DeleteSong expects version unless it is zero, and fail with
+ErrVersionMismatch if the song has another one. UpdateSong sets song.Version to the new version
+*/
+type SongEditor interface {
+	SongReader
+	UpdateSong(ctx context.Context, song *entity.Song) error
+	DeleteSong(ctx context.Context, id, version int) error
+}
+
+/*
+IdempotentResponse is the response to the first request with an Idempotency-Key, replayed on retries.
+Fingerprint identifies the request, Status is 0 while it is still being served
+*/
+type IdempotentResponse struct {
+	Fingerprint string
+	Status      int
+	Header      map[string][]string
+	Body        []byte
+}
+
+/*
+IdempotencyStore is implemented by repositories which keep responses for Idempotency-Key.
+ReserveIdempotencyKey takes a free key for lease under a unique reservation token and returns nil, for a taken
+one it returns what is stored. SaveIdempotentResponse keeps the response of the reserved key for ttl,
+ReleaseIdempotencyKey frees the key of a request which is not to be replayed. Both act only while the key
+is held by the same reservation. Expired keys are free, PurgeIdempotencyKeys removes them
+*/
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(ctx context.Context, key, fingerprint, reservation string, lease time.Duration) (*IdempotentResponse, error)
+	SaveIdempotentResponse(ctx context.Context, key, reservation string, response *IdempotentResponse, ttl time.Duration) error
+	ReleaseIdempotencyKey(ctx context.Context, key, reservation string) error
+	PurgeIdempotencyKeys(ctx context.Context) (int64, error)
+}
+
+/*
+SmartPlaylistRepository stores smart playlist definitions. UpdateSmartPlaylist expects sp.Version and
+DeleteSmartPlaylistByID expects version unless it is zero, and fail with ErrVersionMismatch
+if the smart playlist has another one. Create and update set sp.Version to the stored version
+*/
+type SmartPlaylistRepository interface {
+	CreateSmartPlaylist(ctx context.Context, sp *entity.SmartPlaylist) (int, error)
+	GetSmartPlaylistByID(ctx context.Context, id int) (*entity.SmartPlaylist, error)
+	ListSmartPlaylists(ctx context.Context) ([]*entity.SmartPlaylist, error)
+	UpdateSmartPlaylist(ctx context.Context, sp *entity.SmartPlaylist) error
+	DeleteSmartPlaylistByID(ctx context.Context, id, version int) error
+	ListSongs(ctx context.Context) ([]*entity.Song, error)
+}
+
+/*
+PlaylistWriter is the set of writes the import groups into one transaction.
+Unlike AddSong, InsertSong puts the song into library only, not into the default playlist
+*/
+type PlaylistWriter interface {
+	InsertSong(ctx context.Context, song *entity.Song) error
+	CreatePlaylist(ctx context.Context, name, description string) (int, error)
+	AddSongToPlaylist(ctx context.Context, playlistID, songID int) error
+}
+
+type PlaylistReader interface {
+	GetPlaylistByID(ctx context.Context, id int) (*entity.Playlist, error)
+}
+
+type ImportRepository interface {
+	SongReader
+	Transactor
+	FindSong(ctx context.Context, title, artist string) (*entity.Song, error)
 }
@@ -0,0 +1,274 @@
+/*
+Package repositorytest is a conformance suite for implementations of repository.PlaylistRepository,
+so the cache, the databases and the test mocks agree on what the interface means
+*/
+package repositorytest
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/repository"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+Factory returns a new repository holding an empty playlist
+*/
+type Factory func(t *testing.T) repository.PlaylistRepository
+
+/*
+RunPlaylistRepository checks the contract of repository.PlaylistRepository:
+  - AddSong appends songs to the end of the playlist in the order they were added
+  - with no current song set the first song is current, an empty playlist has no current song
+  - GetCurrent returns the same song as GetPlaylist().GetCurrent() linked with its neighbours
+  - SetCurrent accepts any node holding a song of the playlist, e.g. from an earlier GetPlaylist,
+    and refuses songs which are not in the playlist
+  - nil arguments are reported with ErrNullSong and ErrNilNode
+  - concurrent writers keep every song exactly once and in per-writer order
+*/
+func RunPlaylistRepository(t *testing.T, newRepo Factory) {
+	ctx := context.Background()
+
+	t.Run("Empty", func(t *testing.T) {
+		repo := newRepo(t)
+
+		playlist, err := repo.GetPlaylist(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, playlist.GetHead())
+		assert.Nil(t, playlist.GetCurrent())
+
+		current, err := repo.GetCurrent(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, current)
+	})
+
+	t.Run("NilArguments", func(t *testing.T) {
+		repo := newRepo(t)
+
+		assert.ErrorIs(t, repo.AddSong(ctx, nil), repository.ErrNullSong)
+		assert.ErrorIs(t, repo.SetCurrent(ctx, nil), repository.ErrNilNode)
+		assert.ErrorIs(t, repo.SetCurrent(ctx, &entity.PlaylistNode{}), repository.ErrNilNode)
+
+		playlist, err := repo.GetPlaylist(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, playlist.GetHead())
+	})
+
+	t.Run("Ordering", func(t *testing.T) {
+		repo := newRepo(t)
+		songs := addSongs(t, ctx, repo, 0, 3)
+
+		playlist, err := repo.GetPlaylist(ctx)
+		require.NoError(t, err)
+		nodes := checkLinks(t, playlist)
+		require.Len(t, nodes, len(songs))
+		for i, node := range nodes {
+			assert.Equal(t, songs[i].ID, node.Song.ID)
+			assert.Equal(t, songs[i].Title, node.Song.Title)
+			assert.Equal(t, songs[i].Artist, node.Song.Artist)
+			assert.Equal(t, songs[i].Duration, node.Song.Duration)
+		}
+	})
+
+	t.Run("FirstSongIsCurrent", func(t *testing.T) {
+		repo := newRepo(t)
+		songs := addSongs(t, ctx, repo, 0, 2)
+
+		current, err := repo.GetCurrent(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, current)
+		assert.Equal(t, songs[0].ID, current.Song.ID)
+		assert.Nil(t, current.Prev)
+		require.NotNil(t, current.Next)
+		assert.Equal(t, songs[1].ID, current.Next.Song.ID)
+
+		playlist, err := repo.GetPlaylist(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, songs[0].ID, playlist.GetCurrent().Song.ID)
+	})
+
+	t.Run("SetCurrent", func(t *testing.T) {
+		repo := newRepo(t)
+		songs := addSongs(t, ctx, repo, 0, 3)
+
+		playlist, err := repo.GetPlaylist(ctx)
+		require.NoError(t, err)
+		require.NoError(t, repo.SetCurrent(ctx, playlist.GetHead().Next))
+
+		assertCurrent(t, ctx, repo, songs, 1)
+	})
+
+	t.Run("SetCurrentFromCopy", func(t *testing.T) {
+		repo := newRepo(t)
+		songs := addSongs(t, ctx, repo, 0, 3)
+
+		// the node is not linked, the repository must use its own one
+		copied := *songs[2]
+		require.NoError(t, repo.SetCurrent(ctx, &entity.PlaylistNode{Song: &copied}))
+
+		assertCurrent(t, ctx, repo, songs, 2)
+	})
+
+	t.Run("SetCurrentForeignSong", func(t *testing.T) {
+		repo := newRepo(t)
+		songs := addSongs(t, ctx, repo, 0, 2)
+		require.NoError(t, repo.SetCurrent(ctx, &entity.PlaylistNode{Song: songs[1]}))
+
+		foreign := &entity.Song{ID: songs[1].ID + 1000, Title: "Foreign", Duration: time.Minute}
+		other := &entity.Playlist{}
+		other.AddToEnd(foreign)
+		assert.ErrorIs(t, repo.SetCurrent(ctx, other.GetHead()), repository.ErrCurrentSongNotFound)
+
+		assertCurrent(t, ctx, repo, songs, 1)
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		repo := newRepo(t)
+
+		const writers, songsPerWriter, readers = 4, 10, 4
+
+		var wg sync.WaitGroup
+		added := make([][]*entity.Song, writers)
+		errs := make(chan error, writers*songsPerWriter+readers*songsPerWriter)
+
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < songsPerWriter; i++ {
+					song := newSong(w*songsPerWriter + i)
+					if err := repo.AddSong(ctx, song); err != nil {
+						errs <- err
+						return
+					}
+					added[w] = append(added[w], song)
+				}
+			}(w)
+		}
+
+		for r := 0; r < readers; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < songsPerWriter; i++ {
+					current, err := repo.GetCurrent(ctx)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if current == nil {
+						continue
+					}
+					if err := repo.SetCurrent(ctx, &entity.PlaylistNode{Song: current.Song}); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		playlist, err := repo.GetPlaylist(ctx)
+		require.NoError(t, err)
+		nodes := checkLinks(t, playlist)
+		require.Len(t, nodes, writers*songsPerWriter)
+
+		position := make(map[int]int, len(nodes))
+		for i, node := range nodes {
+			_, duplicate := position[node.Song.ID]
+			assert.False(t, duplicate, "song %d is in playlist twice", node.Song.ID)
+			position[node.Song.ID] = i
+		}
+		for w, songs := range added {
+			for i := 1; i < len(songs); i++ {
+				assert.Less(t, position[songs[i-1].ID], position[songs[i].ID],
+					"songs of writer %d are out of order", w)
+			}
+		}
+	})
+}
+
+func newSong(n int) *entity.Song {
+	return &entity.Song{
+		ID:       n + 1,
+		Title:    fmt.Sprintf("Song %d", n+1),
+		Artist:   fmt.Sprintf("Artist %d", n%3+1),
+		Duration: time.Duration(n+1) * time.Minute,
+	}
+}
+
+/*
+addSongs adds count songs numbered from first. Repositories may assign their own IDs,
+so callers must use IDs of the returned songs
+*/
+func addSongs(t *testing.T, ctx context.Context, repo repository.PlaylistRepository, first, count int) []*entity.Song {
+	t.Helper()
+
+	songs := make([]*entity.Song, 0, count)
+	for n := first; n < first+count; n++ {
+		song := newSong(n)
+		require.NoError(t, repo.AddSong(ctx, song))
+		songs = append(songs, song)
+	}
+	return songs
+}
+
+/*
+checkLinks walks the playlist from head to tail checking Prev, Next and tail pointers
+and returns its nodes
+*/
+func checkLinks(t *testing.T, playlist *entity.Playlist) []*entity.PlaylistNode {
+	t.Helper()
+
+	var nodes []*entity.PlaylistNode
+	var prev *entity.PlaylistNode
+	for node := playlist.GetHead(); node != nil; node = node.Next {
+		require.Same(t, prev, node.Prev, "broken Prev link at position %d", len(nodes)+1)
+		require.NotNil(t, node.Song)
+		nodes = append(nodes, node)
+		prev = node
+	}
+	assert.Same(t, prev, playlist.GetTail())
+	return nodes
+}
+
+/*
+assertCurrent checks that songs[i] is current both in GetCurrent and GetPlaylist
+and that the current node is linked with its neighbours
+*/
+func assertCurrent(t *testing.T, ctx context.Context, repo repository.PlaylistRepository, songs []*entity.Song, i int) {
+	t.Helper()
+
+	current, err := repo.GetCurrent(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, current)
+	assert.Equal(t, songs[i].ID, current.Song.ID)
+
+	if i > 0 {
+		require.NotNil(t, current.Prev)
+		assert.Equal(t, songs[i-1].ID, current.Prev.Song.ID)
+	} else {
+		assert.Nil(t, current.Prev)
+	}
+	if i < len(songs)-1 {
+		require.NotNil(t, current.Next)
+		assert.Equal(t, songs[i+1].ID, current.Next.Song.ID)
+	} else {
+		assert.Nil(t, current.Next)
+	}
+
+	playlist, err := repo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, playlist.GetCurrent())
+	assert.Equal(t, songs[i].ID, playlist.GetCurrent().Song.ID)
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/pagination"
+	"context"
+	"strconv"
+	"time"
+)
+
+type SongSort string
+
+const (
+	SongSortID           SongSort = "id"
+	SongSortTitle        SongSort = "title"
+	SongSortTitleDesc    SongSort = "-title"
+	SongSortArtist       SongSort = "artist"
+	SongSortArtistDesc   SongSort = "-artist"
+	SongSortDuration     SongSort = "duration"
+	SongSortDurationDesc SongSort = "-duration"
+	SongSortAdded        SongSort = "added"
+	SongSortAddedDesc    SongSort = "-added"
+)
+
+func (s SongSort) Valid() bool {
+	switch s {
+	case SongSortID, SongSortTitle, SongSortTitleDesc, SongSortArtist, SongSortArtistDesc,
+		SongSortDuration, SongSortDurationDesc, SongSortAdded, SongSortAddedDesc:
+		return true
+	}
+	return false
+}
+
+// cursorTimeLayouts are the text forms of timestamps the storages put into cursors
+var cursorTimeLayouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999",
+}
+
+/*
+ValidCursorValue tells whether value can be the sort key of a song, so an edited cursor is rejected
+before the storage compares it with keys of another type
+*/
+func (s SongSort) ValidCursorValue(value string) bool {
+	switch s {
+	case SongSortID, SongSortDuration, SongSortDurationDesc:
+		_, err := strconv.Atoi(value)
+		return err == nil
+	case SongSortAdded, SongSortAddedDesc:
+		for _, layout := range cursorTimeLayouts {
+			if _, err := time.Parse(layout, value); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+/*
+SongQuery describes a library search. Zero values mean "no filter",
+After is the cursor returned with the previous page.
+*/
+type SongQuery struct {
+	Text        string
+	Artist      string
+	MinDuration time.Duration
+	MaxDuration time.Duration
+	Sort        SongSort
+	Limit       int
+	After       *pagination.Cursor
+}
+
+type SongPage struct {
+	Songs []*entity.Song
+	Next  *pagination.Cursor // nil on the last page
+}
+
+type PlaylistQuery struct {
+	Text  string
+	Limit int
+	After *pagination.Cursor
+}
+
+type PlaylistPage struct {
+	Playlists []*entity.PlaylistInfo
+	Next      *pagination.Cursor // nil on the last page
+}
+
+/*
+LibraryRepository manages playlists of the library. DeletePlaylistByID expects version unless it is zero
+and fails with ErrVersionMismatch if the playlist has another one
+*/
+type LibraryRepository interface {
+	PlaylistReader
+	CreatePlaylist(ctx context.Context, name, description string) (int, error)
+	FindPlaylistIDByName(ctx context.Context, name string) (int, error)
+	DeletePlaylistByID(ctx context.Context, id, version int) error
+	SearchSongs(ctx context.Context, q SongQuery) (*SongPage, error)
+	SearchPlaylists(ctx context.Context, q PlaylistQuery) (*PlaylistPage, error)
+}
@@ -6,6 +6,7 @@ package service
 
 import (
 	"cloud-go-testtask/internal/entity"
+	"context"
 	"log/slog"
 	"sync"
 	"time"
@@ -15,8 +16,8 @@ import (
 PlaylistRepositoryInterface is a contract for repository
 */
 type PlaylistRepositoryInterface interface {
-	AddSong(song *entity.Song) error
-	GetPlaylist() (*entity.Playlist, error)
+	AddSong(ctx context.Context, song *entity.Song) error
+	GetPlaylist(ctx context.Context) (*entity.Playlist, error)
 }
 
 /*
@@ -60,7 +61,7 @@ func (s *PlaylistService) Play() error {
 		return nil
 	}
 
-	playlist, err := s.repo.GetPlaylist()
+	playlist, err := s.repo.GetPlaylist(context.Background())
 	if err != nil {
 		operationLogger.Error("Failed to get playlist", slog.String("error", err.Error()))
 		return err
@@ -109,7 +110,7 @@ func (s *PlaylistService) AddSong(song *entity.Song) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if err := s.repo.AddSong(song); err != nil {
+	if err := s.repo.AddSong(context.Background(), song); err != nil {
 		operationLogger.Error("Failed to add song", slog.String("error", err.Error()))
 		return err
 	}
@@ -126,7 +127,7 @@ func (s *PlaylistService) Next() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	playlist, err := s.repo.GetPlaylist()
+	playlist, err := s.repo.GetPlaylist(context.Background())
 	if err != nil {
 		operationLogger.Error("Failed to get playlist", slog.String("error", err.Error()))
 		return err
@@ -166,7 +167,7 @@ func (s *PlaylistService) Prev() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	playlist, err := s.repo.GetPlaylist()
+	playlist, err := s.repo.GetPlaylist(context.Background())
 	if err != nil {
 		operationLogger.Error("Failed to get playlist", slog.String("error", err.Error()))
 		return err
@@ -220,7 +221,7 @@ func (s *PlaylistService) playCurrentSong() {
 	for {
 		s.mu.Lock()
 
-		playlist, err := s.repo.GetPlaylist()
+		playlist, err := s.repo.GetPlaylist(context.Background())
 		if err != nil {
 			operationLogger.Error("Failed to get playlist", slog.String("error", err.Error()))
 			s.mu.Unlock()
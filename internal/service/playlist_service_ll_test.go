@@ -4,6 +4,7 @@ import (
 	"cloud-go-testtask/internal/entity"
 	"cloud-go-testtask/internal/repository/cache"
 	"cloud-go-testtask/internal/service"
+	"context"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"log/slog"
@@ -31,7 +32,7 @@ func TestPlaylistService_Concurrency(t *testing.T) {
 
 	wg.Wait()
 
-	playlist, err := repo.GetPlaylist()
+	playlist, err := repo.GetPlaylist(context.Background())
 	assert.NoError(t, err)
 
 	count := 0
@@ -52,7 +53,7 @@ func TestAddSong(t *testing.T) {
 	err := service.AddSong(song)
 	assert.NoError(t, err)
 
-	playlist, err := repo.GetPlaylist()
+	playlist, err := repo.GetPlaylist(context.Background())
 	assert.NoError(t, err)
 	assert.NotNil(t, playlist.GetHead())
 	assert.Equal(t, song, playlist.GetHead().Song)
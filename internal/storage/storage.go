@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"cloud-go-testtask/internal/config"
+	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/repository/file"
+	"cloud-go-testtask/internal/repository/rdbms"
+	"database/sql"
+	"errors"
+	"fmt"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+	"os"
+	"path/filepath"
+)
+
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+	File     = "file"
+)
+
+var (
+	ErrUnknownStorage = errors.New("unknown storage, expected postgres, sqlite or file")
+	ErrNoDatabase     = errors.New("file storage has no database")
+)
+
+/*
+Repository is everything the use cases need from persistent storage, all backends implement it
+*/
+type Repository interface {
+	repository.PlaylistRepository
+	repository.PlaylistWriter
+	repository.PlayCountRecorder
+	repository.PlaylistOrderer
+	repository.SongEditor
+	repository.SmartPlaylistRepository
+	repository.LibraryRepository
+	repository.ImportRepository
+	SetDefaultPlaylistID(id int)
+	SetMethodObserver(observer repository.MethodObserver)
+}
+
+/*
+Storage is the backend selected by STORAGE
+*/
+type Storage struct {
+	Repo    Repository
+	DB      *sql.DB       // nil for file storage
+	Dialect rdbms.Dialect // empty for file storage
+	close   func() error
+}
+
+/*
+Open opens the backend selected by STORAGE: Postgres configured by DB_* settings,
+SQLite file at STORAGE_PATH or append-only log with snapshots in STORAGE_PATH directory
+*/
+func Open(cfg *config.Config) (*Storage, error) {
+	if cfg.Storage == File {
+		repo, err := file.NewPlaylistRepositoryFile(cfg.StoragePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file storage: %w", err)
+		}
+		return &Storage{Repo: repo, close: repo.Close}, nil
+	}
+
+	db, dialect, err := OpenDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{Repo: NewRepository(db, dialect), DB: db, Dialect: dialect, close: db.Close}, nil
+}
+
+func (s *Storage) Close() error {
+	return s.close()
+}
+
+/*
+OpenDB connects to the SQL database selected by STORAGE. The connection is checked before returning
+*/
+func OpenDB(cfg *config.Config) (*sql.DB, rdbms.Dialect, error) {
+	var db *sql.DB
+	var dialect rdbms.Dialect
+	var err error
+
+	switch cfg.Storage {
+	case Postgres, "":
+		dialect = rdbms.DialectPostgres
+		db, err = sql.Open("postgres", cfg.DBConfig.GetPostgresDSN())
+	case SQLite:
+		dialect = rdbms.DialectSQLite
+		db, err = openSQLite(cfg.StoragePath)
+	case File:
+		return nil, "", ErrNoDatabase
+	default:
+		return nil, "", fmt.Errorf("%w: %q", ErrUnknownStorage, cfg.Storage)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, "", fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return db, dialect, nil
+}
+
+/*
+openSQLite opens database file creating its directory. Foreign keys are off by default in SQLite
+and have to be enabled on every connection; a single connection avoids SQLITE_BUSY between writers
+and keeps ":memory:" databases shared
+*/
+func openSQLite(path string) (*sql.DB, error) {
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	return db, nil
+}
+
+/*
+NewRepository returns repository for database opened by OpenDB
+*/
+func NewRepository(db *sql.DB, dialect rdbms.Dialect) *rdbms.PlaylistRepositoryRDBMS {
+	if dialect == rdbms.DialectSQLite {
+		return rdbms.NewPlaylistRepositorySQLite(db).(*rdbms.PlaylistRepositoryRDBMS)
+	}
+	return rdbms.NewPlaylistRepositoryRDBMS(db).(*rdbms.PlaylistRepositoryRDBMS)
+}
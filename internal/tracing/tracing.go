@@ -0,0 +1,95 @@
+/*
+Package tracing sets up OpenTelemetry tracing. Spans are named after the "op" strings of slog records,
+e.g. usecase.PlaylistUseCase.Next, so a trace and the log lines of one request can be matched
+*/
+package tracing
+
+import (
+	"cloud-go-testtask/internal/config"
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+const instrumentationName = "cloud-go-testtask"
+
+/*
+Setup installs the global tracer provider exporting spans over OTLP/HTTP to cfg.Endpoint.
+With an empty endpoint spans are not recorded. The returned function flushes buffered spans
+and stops the exporter
+*/
+func Setup(ctx context.Context, cfg config.TracingConfig) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+/*
+Start starts a span of operation op as a child of the span in ctx
+*/
+func Start(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, op, trace.WithAttributes(attrs...))
+}
+
+/*
+StartServer starts a server span of an incoming request, continuing the trace of the caller
+if header carries its context
+*/
+func StartServer(ctx context.Context, header http.Header, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+	return otel.Tracer(instrumentationName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+/*
+Inject writes the trace context of ctx into header of an outgoing request, so the callee continues the trace
+*/
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+/*
+Attributes of the entities an operation works with, shared by all layers so spans can be searched by them
+*/
+
+func PlaylistID(id int) attribute.KeyValue {
+	return attribute.Int("playlist.id", id)
+}
+
+func SongID(id int) attribute.KeyValue {
+	return attribute.Int("song.id", id)
+}
+
+func SmartPlaylistID(id int) attribute.KeyValue {
+	return attribute.Int("smart_playlist.id", id)
+}
@@ -0,0 +1,126 @@
+package tracing_test
+
+import (
+	"cloud-go-testtask/internal/config"
+	"cloud-go-testtask/internal/delivery"
+	"cloud-go-testtask/internal/migrator"
+	"cloud-go-testtask/internal/storage"
+	"cloud-go-testtask/internal/tracing"
+	"context"
+	"encoding/hex"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+/*
+collector stands in for an OpenTelemetry Collector, it accepts OTLP/HTTP exports and keeps the spans
+*/
+type collector struct {
+	mu    sync.Mutex
+	spans []*tracepb.Span
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || r.URL.Path != "/v1/traces" {
+		http.Error(w, "bad export", http.StatusBadRequest)
+		return
+	}
+	var req coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+	c.mu.Unlock()
+
+	resp, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(resp)
+}
+
+func (c *collector) span(t *testing.T, name string) *tracepb.Span {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("span %q is not exported", name)
+	return nil
+}
+
+func TestSetupExportsRequestTrace(t *testing.T) {
+	ctx := context.Background()
+	col := &collector{}
+	srv := httptest.NewServer(col)
+	defer srv.Close()
+
+	shutdown, err := tracing.Setup(ctx, config.TracingConfig{
+		Endpoint:    strings.TrimPrefix(srv.URL, "http://"),
+		Insecure:    true,
+		SampleRatio: 1,
+		ServiceName: "playlist-test",
+	})
+	require.NoError(t, err)
+
+	cfg := &config.Config{Storage: storage.SQLite, StoragePath: filepath.Join(t.TempDir(), "storage.db")}
+	db, dialect, err := storage.OpenDB(cfg)
+	require.NoError(t, err)
+	defer db.Close()
+	m, err := migrator.New(db, dialect, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+	require.NoError(t, m.Up(ctx))
+	repo := storage.NewRepository(db, dialect)
+
+	router := chi.NewRouter()
+	router.Use(delivery.Tracing())
+	router.Get("/songs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := repo.GetSongByID(r.Context(), 1); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	const callerTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/songs/1", nil)
+	req.Header.Set("traceparent", "00-"+callerTraceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	require.NoError(t, shutdown(ctx), "shutdown flushes buffered spans")
+
+	server := col.span(t, "GET /songs/{id}")
+	query := col.span(t, "rdbms.PlaylistRepositoryRDBMS.GetSongByID")
+	assert.Equal(t, callerTraceID, hex.EncodeToString(server.TraceId), "trace of the caller is continued")
+	assert.Equal(t, server.TraceId, query.TraceId)
+	assert.Equal(t, server.SpanId, query.ParentSpanId, "query span is a child of the request span")
+
+	var songID int64
+	for _, attr := range query.Attributes {
+		if attr.Key == "song.id" {
+			songID = attr.Value.GetIntValue()
+		}
+	}
+	assert.Equal(t, int64(1), songID)
+}
@@ -0,0 +1,89 @@
+package usecase
+
+import (
+	"cloud-go-testtask/internal/logging"
+	"cloud-go-testtask/internal/playlistio"
+	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+/*
+ExportUseCase serializes stored playlists to playlist files
+*/
+type ExportUseCase struct {
+	repo   repository.PlaylistReader
+	logger *slog.Logger
+}
+
+func NewExportUseCase(repo repository.PlaylistReader, logger *slog.Logger) *ExportUseCase {
+	return &ExportUseCase{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+/*
+Document returns the playlist in the format independent form, songs are kept in playlist order
+*/
+func (uc *ExportUseCase) Document(ctx context.Context, id int) (*playlistio.Document, error) {
+	const op = "usecase.ExportUseCase.Document"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op, tracing.PlaylistID(id))
+	defer span.End()
+
+	playlist, err := uc.repo.GetPlaylistByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrPlaylistNotFound) {
+			operationLogger.Warn("Playlist not found", slog.Int("id", id))
+			return nil, fmt.Errorf("%w: %v", ErrPlaylistNotFound, err)
+		}
+		operationLogger.Error("Failed to get playlist", slog.Int("id", id), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%w: %v", ErrGetPlaylistFromDB, err)
+	}
+
+	doc := &playlistio.Document{Title: playlist.Name, Description: playlist.Description}
+	for node := playlist.GetHead(); node != nil; node = node.Next {
+		if node.Song == nil {
+			continue
+		}
+		doc.Entries = append(doc.Entries, playlistio.Entry{
+			Index:    len(doc.Entries) + 1,
+			ID:       node.Song.ID,
+			Title:    node.Song.Title,
+			Artist:   node.Song.Artist,
+			Duration: node.Song.Duration,
+		})
+	}
+
+	return doc, nil
+}
+
+func (uc *ExportUseCase) Export(ctx context.Context, id int, format playlistio.Format, w io.Writer) error {
+	const op = "usecase.ExportUseCase.Export"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op), slog.String("format", string(format)))
+	ctx, span := tracing.Start(ctx, op, tracing.PlaylistID(id))
+	defer span.End()
+
+	if _, err := playlistio.ParseFormat(string(format)); err != nil {
+		operationLogger.Warn("Unknown export format")
+		return fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+
+	doc, err := uc.Document(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := playlistio.Write(format, doc, w); err != nil {
+		operationLogger.Error("Failed to write playlist", slog.Int("id", id), slog.String("error", err.Error()))
+		return fmt.Errorf("%w: %v", ErrExportPlaylist, err)
+	}
+
+	operationLogger.Debug("Playlist exported", slog.Int("id", id), slog.Int("songs", len(doc.Entries)))
+	return nil
+}
@@ -0,0 +1,53 @@
+package usecase
+
+import (
+	"bytes"
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/playlistio"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	songs := []*entity.Song{
+		{ID: 1, Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second},
+		{ID: 2, Title: "Song", Artist: "Twins", Duration: 60 * time.Second},
+		{ID: 3, Title: "Song", Artist: "Twins", Duration: 90 * time.Second}, // same metadata as song 2
+	}
+	playlist := &entity.Playlist{ID: 5, Name: "Mix", Description: "Backup me"}
+	for _, i := range []int{2, 0, 1} {
+		playlist.AddToEnd(songs[i])
+	}
+	library := NewMockLibraryRepo()
+	library.AddPlaylist(playlist)
+
+	var buf bytes.Buffer
+	require.NoError(t, NewExportUseCase(library, slog.Default()).Export(ctx, 5, playlistio.FormatJSON, &buf))
+
+	repo := NewMockImportRepo(songs...)
+	report, err := NewImportUseCase(repo, nil, slog.Default()).Import(ctx, ImportRequest{Format: playlistio.FormatJSON, Body: &buf})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Mix", report.Name)
+	assert.Zero(t, report.CreatedSongs)
+	assert.Empty(t, report.Unresolved)
+	imported, name := repo.PlaylistSongs(report.PlaylistID)
+	assert.Equal(t, "Mix", name)
+	assert.Equal(t, []int{3, 1, 2}, imported)
+}
+
+func TestExportErrors(t *testing.T) {
+	ctx := context.Background()
+	uc := NewExportUseCase(NewMockLibraryRepo(), slog.Default())
+
+	err := uc.Export(ctx, 1, playlistio.FormatJSON, &bytes.Buffer{})
+	assert.ErrorIs(t, err, ErrPlaylistNotFound)
+
+	err = uc.Export(ctx, 1, "wav", &bytes.Buffer{})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
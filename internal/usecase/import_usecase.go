@@ -0,0 +1,219 @@
+package usecase
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/logging"
+	"cloud-go-testtask/internal/playlistio"
+	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const defaultImportedPlaylistName = "Imported playlist"
+
+/*
+ImportUseCase builds new playlists from playlist files.
+Entries are matched with library songs by title and artist, missing songs are created.
+*/
+type ImportUseCase struct {
+	repo     repository.ImportRepository
+	playback *PlaylistUseCase
+	logger   *slog.Logger
+}
+
+func NewImportUseCase(repo repository.ImportRepository, playback *PlaylistUseCase, logger *slog.Logger) *ImportUseCase {
+	return &ImportUseCase{
+		repo:     repo,
+		playback: playback,
+		logger:   logger,
+	}
+}
+
+type UnresolvedEntry struct {
+	Index    int
+	Location string
+	Title    string
+	Artist   string
+	Reason   string
+}
+
+type ImportReport struct {
+	PlaylistID   int
+	Name         string
+	Imported     int
+	CreatedSongs int
+	Unresolved   []UnresolvedEntry
+}
+
+type ImportRequest struct {
+	Name        string // taken from the file or defaultImportedPlaylistName if empty
+	Description string
+	Format      playlistio.Format
+	Body        io.Reader
+}
+
+func (uc *ImportUseCase) Import(ctx context.Context, req ImportRequest) (*ImportReport, error) {
+	const op = "usecase.ImportUseCase.Import"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op), slog.String("format", string(req.Format)))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	operationLogger.Debug("Importing playlist")
+
+	doc, err := playlistio.Parse(req.Format, req.Body)
+	if err != nil {
+		operationLogger.Warn("Failed to parse playlist file", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlaylistFile, err)
+	}
+
+	if req.Description == "" {
+		req.Description = doc.Description
+	}
+
+	report := &ImportReport{Name: req.Name}
+	if report.Name == "" {
+		report.Name = doc.Title
+	}
+	if report.Name == "" {
+		report.Name = defaultImportedPlaylistName
+	}
+
+	resolved, err := uc.resolve(ctx, doc.Entries, report)
+	if err != nil {
+		operationLogger.Error("Failed to resolve playlist entries", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%w: %v", ErrImportPlaylist, err)
+	}
+
+	if len(resolved) == 0 {
+		operationLogger.Warn("No entries could be imported", slog.Int("unresolved", len(report.Unresolved)))
+		return report, ErrNothingToImport
+	}
+
+	err = uc.repo.InTx(ctx, func(tx repository.TxRepository) error {
+		created := 0
+		for _, song := range resolved {
+			if song.ID != 0 {
+				continue
+			}
+			if err := tx.InsertSong(ctx, song); err != nil {
+				return fmt.Errorf("add song %q: %w", song.Title, err)
+			}
+			created++
+		}
+
+		playlistID, err := tx.CreatePlaylist(ctx, report.Name, req.Description)
+		if err != nil {
+			return fmt.Errorf("create playlist: %w", err)
+		}
+
+		for _, song := range resolved {
+			if err := tx.AddSongToPlaylist(ctx, playlistID, song.ID); err != nil {
+				return fmt.Errorf("add song %d to playlist: %w", song.ID, err)
+			}
+		}
+
+		report.PlaylistID = playlistID
+		report.CreatedSongs = created
+		return nil
+	})
+	if err != nil {
+		operationLogger.Error("Failed to store imported playlist", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%w: %v", ErrImportPlaylist, err)
+	}
+	report.Imported = len(resolved)
+
+	if uc.playback != nil && report.CreatedSongs > 0 {
+		uc.playback.LibraryChanged()
+	}
+
+	operationLogger.Info("Playlist imported",
+		slog.Int("playlist_id", report.PlaylistID),
+		slog.Int("imported", report.Imported),
+		slog.Int("created_songs", report.CreatedSongs),
+		slog.Int("unresolved", len(report.Unresolved)),
+	)
+
+	return report, nil
+}
+
+/*
+resolve matches entries with library songs. Entries which can not be matched or created
+are put into report. Songs to be created have zero ID.
+*/
+func (uc *ImportUseCase) resolve(ctx context.Context, entries []playlistio.Entry, report *ImportReport) ([]*entity.Song, error) {
+	var resolved []*entity.Song
+	created := make(map[string]*entity.Song) // songs created by this import, by artist and title
+	seen := make(map[int]bool)               // the same song can appear in playlist only once
+
+	unresolved := func(entry playlistio.Entry, reason string) {
+		report.Unresolved = append(report.Unresolved, UnresolvedEntry{
+			Index:    entry.Index,
+			Location: entry.Location,
+			Title:    entry.Title,
+			Artist:   entry.Artist,
+			Reason:   reason,
+		})
+	}
+
+	for _, entry := range entries {
+		if entry.Title == "" {
+			unresolved(entry, "missing title")
+			continue
+		}
+
+		song, err := uc.findSong(ctx, entry)
+		if err == nil {
+			if seen[song.ID] {
+				unresolved(entry, "duplicate entry")
+				continue
+			}
+			seen[song.ID] = true
+			resolved = append(resolved, song)
+			continue
+		}
+		if !errors.Is(err, repository.ErrSongNotFound) {
+			return nil, err
+		}
+
+		key := strings.ToLower(entry.Artist) + "\x00" + strings.ToLower(entry.Title)
+		switch {
+		case created[key] != nil:
+			unresolved(entry, "duplicate entry")
+		case entry.Artist == "":
+			unresolved(entry, "song not found in library and artist is unknown")
+		case entry.Duration <= 0:
+			unresolved(entry, "song not found in library and duration is unknown")
+		default:
+			song = &entity.Song{Title: entry.Title, Artist: entry.Artist, Duration: entry.Duration}
+			created[key] = song
+			resolved = append(resolved, song)
+		}
+	}
+
+	return resolved, nil
+}
+
+/*
+findSong prefers the song ID from exported JSON if the song still has the same title and artist,
+so songs with equal metadata are not mixed up. Otherwise it searches by title and artist
+*/
+func (uc *ImportUseCase) findSong(ctx context.Context, entry playlistio.Entry) (*entity.Song, error) {
+	if entry.ID > 0 {
+		song, err := uc.repo.GetSongByID(ctx, entry.ID)
+		switch {
+		case err == nil:
+			if strings.EqualFold(song.Title, entry.Title) && strings.EqualFold(song.Artist, entry.Artist) {
+				return song, nil
+			}
+		case !errors.Is(err, repository.ErrSongNotFound):
+			return nil, err
+		}
+	}
+
+	return uc.repo.FindSong(ctx, entry.Title, entry.Artist)
+}
@@ -0,0 +1,96 @@
+package usecase
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/playlistio"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+const importTestM3U = `#EXTM3U
+#PLAYLIST:Road trip
+#EXTINF:183,John Lennon - Imagine
+imagine.mp3
+#EXTINF:354,Queen - Bohemian Rhapsody
+queen.mp3
+#EXTINF:-1,Unknown Song
+unknown.mp3
+#EXTINF:100,Nobody - No Duration Known
+#EXTINF:-1,Nobody - No Duration
+nd.mp3
+#EXTINF:183,john lennon - IMAGINE
+imagine-again.mp3
+`
+
+func TestImportResolvesAndCreatesSongs(t *testing.T) {
+	imagine := &entity.Song{ID: 1, Title: "Imagine", Artist: "John Lennon", Duration: 183 * time.Second}
+	repo := NewMockImportRepo(imagine)
+	uc := NewImportUseCase(repo, nil, slog.Default())
+
+	report, err := uc.Import(context.Background(), ImportRequest{Format: playlistio.FormatM3U, Body: strings.NewReader(importTestM3U)})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Road trip", report.Name)
+	assert.Equal(t, 2, report.Imported)
+	assert.Equal(t, 1, report.CreatedSongs)
+	require.Len(t, report.Unresolved, 3)
+	assert.Equal(t, "Unknown Song", report.Unresolved[0].Title)
+	assert.Equal(t, "No Duration", report.Unresolved[1].Title)
+	assert.Equal(t, "duplicate entry", report.Unresolved[2].Reason)
+
+	songs, name := repo.PlaylistSongs(report.PlaylistID)
+	assert.Equal(t, "Road trip", name)
+	assert.Equal(t, []int{1, 2}, songs)
+	assert.Len(t, repo.Songs(), 2)
+}
+
+func TestImportNothingToImport(t *testing.T) {
+	uc := NewImportUseCase(NewMockImportRepo(), nil, slog.Default())
+
+	report, err := uc.Import(context.Background(), ImportRequest{
+		Name:   "Empty",
+		Format: playlistio.FormatM3U,
+		Body:   strings.NewReader("#EXTM3U\n#EXTINF:-1,Unknown\nunknown.mp3\n"),
+	})
+	assert.ErrorIs(t, err, ErrNothingToImport)
+	require.NotNil(t, report)
+	assert.Zero(t, report.PlaylistID)
+	assert.Len(t, report.Unresolved, 1)
+}
+
+func TestImportInvalidFile(t *testing.T) {
+	uc := NewImportUseCase(NewMockImportRepo(), nil, slog.Default())
+
+	_, err := uc.Import(context.Background(), ImportRequest{Format: playlistio.FormatXSPF, Body: strings.NewReader("<playlist")})
+	assert.ErrorIs(t, err, ErrInvalidPlaylistFile)
+}
+
+func TestImportRollsBackOnFailure(t *testing.T) {
+	for _, failOn := range []string{"InsertSong", "CreatePlaylist", "AddSongToPlaylist"} {
+		t.Run(failOn, func(t *testing.T) {
+			repo := NewMockImportRepo()
+			repo.FailOn = failOn
+			uc := NewImportUseCase(repo, nil, slog.Default())
+
+			_, err := uc.Import(context.Background(), ImportRequest{Format: playlistio.FormatM3U, Body: strings.NewReader(importTestM3U)})
+			assert.ErrorIs(t, err, ErrImportPlaylist)
+			assert.Empty(t, repo.Songs(), "songs created in failed import must not be kept")
+		})
+	}
+}
+
+func TestImportNotifiesLibraryChange(t *testing.T) {
+	playback := NewPlaylistUseCase(NewMockPlaylistRepo(), NewMockPlaylistRepo(), slog.Default())
+	changed := 0
+	playback.OnLibraryChange(func() { changed++ })
+
+	uc := NewImportUseCase(NewMockImportRepo(), playback, slog.Default())
+	_, err := uc.Import(context.Background(), ImportRequest{Name: "New", Format: playlistio.FormatM3U, Body: strings.NewReader(importTestM3U)})
+	require.NoError(t, err)
+	assert.Equal(t, 1, changed)
+}
@@ -0,0 +1,290 @@
+package usecase
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/logging"
+	"cloud-go-testtask/internal/pagination"
+	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+/*
+LibraryUseCase serves queries over the whole library (all songs and playlists in DB) and manages playlists.
+Playlist loaded into playback is read from cache to show the actual current song.
+*/
+type LibraryUseCase struct {
+	repo     repository.LibraryRepository
+	playback *PlaylistUseCase
+	logger   *slog.Logger
+}
+
+func NewLibraryUseCase(repo repository.LibraryRepository, playback *PlaylistUseCase, logger *slog.Logger) *LibraryUseCase {
+	return &LibraryUseCase{
+		repo:     repo,
+		playback: playback,
+		logger:   logger,
+	}
+}
+
+type PlaylistItem struct {
+	Position int // 1-based
+	Current  bool
+	Song     *entity.Song
+}
+
+type PlaylistPage struct {
+	ID            int
+	Name          string
+	Description   string
+	Version       int // 0 if the storage does not version playlists
+	SongCount     int
+	TotalDuration time.Duration
+	// CurrentPosition is the position of current song, 0 if none
+	CurrentPosition int
+	Items           []PlaylistItem
+	Next            *pagination.Cursor // nil on the last page
+}
+
+func (uc *LibraryUseCase) SearchSongs(ctx context.Context, q repository.SongQuery) (*repository.SongPage, error) {
+	const op = "usecase.LibraryUseCase.SearchSongs"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	if q.Sort == "" {
+		q.Sort = repository.SongSortID
+	}
+	if !q.Sort.Valid() {
+		return nil, fmt.Errorf("%w: unknown sort %q", ErrInvalidQuery, q.Sort)
+	}
+	if q.MinDuration < 0 || q.MaxDuration < 0 {
+		return nil, fmt.Errorf("%w: duration must not be negative", ErrInvalidQuery)
+	}
+	if q.MaxDuration > 0 && q.MinDuration > q.MaxDuration {
+		return nil, fmt.Errorf("%w: min_duration is greater than max_duration", ErrInvalidQuery)
+	}
+	// the cursor is compared with sort keys in SQL, one of another sort would not even cast
+	if q.After != nil && (q.After.Sort != string(q.Sort) || !q.Sort.ValidCursorValue(q.After.Value)) {
+		operationLogger.Warn("Cursor does not match the sort", slog.String("sort", string(q.Sort)), slog.String("cursor_sort", q.After.Sort))
+		return nil, fmt.Errorf("%w: cursor was issued for another sort", ErrInvalidQuery)
+	}
+	limit, err := normalizeLimit(q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	q.Limit = limit
+
+	page, err := uc.repo.SearchSongs(ctx, q)
+	if err != nil {
+		operationLogger.Error("Failed to search songs", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%w: %v", ErrSearch, err)
+	}
+
+	operationLogger.Debug("Songs found", slog.Int("count", len(page.Songs)))
+	return page, nil
+}
+
+func (uc *LibraryUseCase) SearchPlaylists(ctx context.Context, q repository.PlaylistQuery) (*repository.PlaylistPage, error) {
+	const op = "usecase.LibraryUseCase.SearchPlaylists"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	limit, err := normalizeLimit(q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	q.Limit = limit
+
+	page, err := uc.repo.SearchPlaylists(ctx, q)
+	if err != nil {
+		operationLogger.Error("Failed to search playlists", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%w: %v", ErrSearch, err)
+	}
+
+	operationLogger.Debug("Playlists found", slog.Int("count", len(page.Playlists)))
+	return page, nil
+}
+
+/*
+GetPlaylistPage returns a page of playlist items after the position stored in cursor.
+Count, total duration and current position are computed over the whole playlist.
+*/
+func (uc *LibraryUseCase) GetPlaylistPage(ctx context.Context, id, limit int, after *pagination.Cursor) (*PlaylistPage, error) {
+	const op = "usecase.LibraryUseCase.GetPlaylistPage"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op, tracing.PlaylistID(id))
+	defer span.End()
+
+	limit, err := normalizeLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	playlist, err := uc.getPlaylist(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrPlaylistNotFound) {
+			operationLogger.Warn("Playlist not found", slog.Int("id", id))
+			return nil, fmt.Errorf("%w: %v", ErrPlaylistNotFound, err)
+		}
+		operationLogger.Error("Failed to get playlist", slog.Int("id", id), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%w: %v", ErrGetPlaylistFromDB, err)
+	}
+
+	start := 0
+	if after != nil {
+		if after.Position == 0 {
+			operationLogger.Warn("Cursor is not a playlist position")
+			return nil, fmt.Errorf("%w: cursor was issued for another list", ErrInvalidQuery)
+		}
+		start = after.Position
+	}
+
+	page := &PlaylistPage{
+		ID:          playlist.ID,
+		Name:        playlist.Name,
+		Description: playlist.Description,
+		Version:     playlist.Version,
+	}
+	current := playlist.GetCurrent()
+
+	position := 0
+	for node := playlist.GetHead(); node != nil; node = node.Next {
+		if node.Song == nil {
+			continue
+		}
+		position++
+		page.SongCount++
+		page.TotalDuration += node.Song.Duration
+		if node == current {
+			page.CurrentPosition = position
+		}
+
+		if position <= start {
+			continue
+		}
+		if len(page.Items) == limit {
+			if page.Next == nil {
+				page.Next = &pagination.Cursor{Position: position - 1}
+			}
+			continue
+		}
+		page.Items = append(page.Items, PlaylistItem{
+			Position: position,
+			Current:  node == current,
+			Song:     node.Song,
+		})
+	}
+
+	return page, nil
+}
+
+func (uc *LibraryUseCase) CreatePlaylist(ctx context.Context, name, description string) (int, error) {
+	const op = "usecase.LibraryUseCase.CreatePlaylist"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op), slog.String("name", name))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	if strings.TrimSpace(name) == "" {
+		return 0, fmt.Errorf("%w: name is required", ErrInvalidPlaylist)
+	}
+
+	_, err := uc.repo.FindPlaylistIDByName(ctx, name)
+	switch {
+	case err == nil:
+		operationLogger.Warn("Playlist already exists")
+		return 0, ErrPlaylistAlreadyExists
+	case !errors.Is(err, repository.ErrPlaylistNotFound):
+		operationLogger.Error("Failed to check playlist name", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%w: %v", ErrCreatePlaylist, err)
+	}
+
+	id, err := uc.repo.CreatePlaylist(ctx, name, description)
+	if err != nil {
+		operationLogger.Error("Failed to create playlist", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%w: %v", ErrCreatePlaylist, err)
+	}
+
+	operationLogger.Debug("Playlist created", slog.Int("id", id))
+	return id, nil
+}
+
+/*
+DeletePlaylist removes playlist, the songs stay in library.
+The playlist which is loaded into playback can not be removed.
+With ifMatch the playlist is removed only if it still has one of these versions
+*/
+func (uc *LibraryUseCase) DeletePlaylist(ctx context.Context, id int, ifMatch []int) error {
+	const op = "usecase.LibraryUseCase.DeletePlaylist"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op), slog.Int("id", id))
+	ctx, span := tracing.Start(ctx, op, tracing.PlaylistID(id))
+	defer span.End()
+
+	if uc.playback != nil {
+		if live, err := uc.playback.GetPlaylist(ctx); err == nil && live.ID == id {
+			operationLogger.Warn("Attempt to delete playlist loaded into playback")
+			return ErrPlaylistInUse
+		}
+	}
+
+	var version int
+	if len(ifMatch) > 0 {
+		playlist, err := uc.repo.GetPlaylistByID(ctx, id)
+		if err != nil {
+			return wrapDeletePlaylistErr(operationLogger, err)
+		}
+		if version, err = checkVersion(operationLogger, playlist.Version, ifMatch); err != nil {
+			return err
+		}
+	}
+
+	if err := uc.repo.DeletePlaylistByID(ctx, id, version); err != nil {
+		return wrapDeletePlaylistErr(operationLogger, err)
+	}
+
+	operationLogger.Debug("Playlist deleted")
+	return nil
+}
+
+func wrapDeletePlaylistErr(operationLogger *slog.Logger, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrPlaylistNotFound):
+		operationLogger.Warn("Playlist not found")
+		return fmt.Errorf("%w: %v", ErrPlaylistNotFound, err)
+	case errors.Is(err, repository.ErrVersionMismatch):
+		operationLogger.Warn("Playlist changed meanwhile")
+		return fmt.Errorf("%w: %v", ErrVersionConflict, err)
+	}
+	operationLogger.Error("Failed to delete playlist", slog.String("error", err.Error()))
+	return fmt.Errorf("%w: %v", ErrDeletePlaylist, err)
+}
+
+func (uc *LibraryUseCase) getPlaylist(ctx context.Context, id int) (*entity.Playlist, error) {
+	if uc.playback != nil {
+		if live, err := uc.playback.GetPlaylist(ctx); err == nil && live.ID == id {
+			return live, nil
+		}
+	}
+	return uc.repo.GetPlaylistByID(ctx, id)
+}
+
+func normalizeLimit(limit int) (int, error) {
+	switch {
+	case limit == 0:
+		return DefaultPageSize, nil
+	case limit < 0 || limit > MaxPageSize:
+		return 0, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxPageSize)
+	}
+	return limit, nil
+}
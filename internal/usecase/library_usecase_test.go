@@ -0,0 +1,164 @@
+package usecase
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/pagination"
+	"cloud-go-testtask/internal/repository"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSearchSongsPagination(t *testing.T) {
+	var songs []*entity.Song
+	for i := 1; i <= 5; i++ {
+		songs = append(songs, &entity.Song{ID: i, Title: "Song", Artist: "Artist", Duration: time.Minute})
+	}
+	repo := NewMockLibraryRepo(songs...)
+	uc := NewLibraryUseCase(repo, nil, slog.Default())
+
+	var got []int
+	q := repository.SongQuery{Limit: 2}
+	for {
+		page, err := uc.SearchSongs(context.Background(), q)
+		require.NoError(t, err)
+		for _, s := range page.Songs {
+			got = append(got, s.ID)
+		}
+		if page.Next == nil {
+			break
+		}
+		q.After = page.Next
+	}
+
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, got)
+	assert.Equal(t, repository.SongSortID, repo.LastSongQuery.Sort, "default sort is applied")
+}
+
+func TestSearchSongsDefaultLimit(t *testing.T) {
+	repo := NewMockLibraryRepo()
+	uc := NewLibraryUseCase(repo, nil, slog.Default())
+
+	_, err := uc.SearchSongs(context.Background(), repository.SongQuery{Sort: repository.SongSortDurationDesc})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultPageSize, repo.LastSongQuery.Limit)
+}
+
+func TestSearchSongsInvalidQuery(t *testing.T) {
+	uc := NewLibraryUseCase(NewMockLibraryRepo(), nil, slog.Default())
+
+	invalid := []repository.SongQuery{
+		{Sort: "popularity"},
+		{Limit: -1},
+		{Limit: MaxPageSize + 1},
+		{MinDuration: 5 * time.Minute, MaxDuration: time.Minute},
+		{MinDuration: -time.Second},
+		{Sort: repository.SongSortAdded, After: &pagination.Cursor{Sort: "title", Value: "imagine", ID: 1}},
+		{Sort: repository.SongSortAdded, After: &pagination.Cursor{Sort: "added", Value: "imagine", ID: 1}},
+		{Sort: repository.SongSortDuration, After: &pagination.Cursor{Sort: "duration", Value: "3m", ID: 1}},
+		{After: &pagination.Cursor{Value: "1", ID: 1}},
+	}
+	for _, q := range invalid {
+		_, err := uc.SearchSongs(context.Background(), q)
+		assert.ErrorIs(t, err, ErrInvalidQuery)
+	}
+}
+
+func TestGetPlaylistPage(t *testing.T) {
+	ctx := context.Background()
+	playlist := &entity.Playlist{ID: 7, Name: "Road trip"}
+	for i := 1; i <= 5; i++ {
+		playlist.AddToEnd(&entity.Song{ID: i * 10, Title: "Song", Artist: "Artist", Duration: time.Minute})
+	}
+	require.NoError(t, playlist.SetCurrent(playlist.GetHead().Next.Next))
+
+	repo := NewMockLibraryRepo()
+	repo.AddPlaylist(playlist)
+	uc := NewLibraryUseCase(repo, nil, slog.Default())
+
+	first, err := uc.GetPlaylistPage(ctx, 7, 2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Road trip", first.Name)
+	assert.Equal(t, 5, first.SongCount)
+	assert.Equal(t, 5*time.Minute, first.TotalDuration)
+	assert.Equal(t, 3, first.CurrentPosition)
+	require.Len(t, first.Items, 2)
+	assert.Equal(t, 1, first.Items[0].Position)
+	require.NotNil(t, first.Next)
+
+	second, err := uc.GetPlaylistPage(ctx, 7, 2, first.Next)
+	require.NoError(t, err)
+	require.Len(t, second.Items, 2)
+	assert.Equal(t, 3, second.Items[0].Position)
+	assert.True(t, second.Items[0].Current)
+	assert.False(t, second.Items[1].Current)
+
+	last, err := uc.GetPlaylistPage(ctx, 7, 2, second.Next)
+	require.NoError(t, err)
+	require.Len(t, last.Items, 1)
+	assert.Equal(t, 50, last.Items[0].Song.ID)
+	assert.Nil(t, last.Next)
+
+	_, err = uc.GetPlaylistPage(ctx, 8, 2, nil)
+	assert.ErrorIs(t, err, ErrPlaylistNotFound)
+
+	_, err = uc.GetPlaylistPage(ctx, 7, 2, &pagination.Cursor{Sort: "id", Value: "2", ID: 2})
+	assert.ErrorIs(t, err, ErrInvalidQuery, "a search cursor is not a position")
+}
+
+func TestGetPlaylistPagePrefersPlayback(t *testing.T) {
+	ctx := context.Background()
+	stored := &entity.Playlist{ID: 1, Name: "Default"}
+	stored.AddToEnd(&entity.Song{ID: 1, Title: "Song1", Duration: time.Minute})
+	stored.AddToEnd(&entity.Song{ID: 2, Title: "Song2", Duration: time.Minute})
+
+	require.NoError(t, stored.SetCurrent(stored.GetTail()))
+
+	playback := NewPlaylistUseCase(NewMockPlaylistRepo(), NewMockPlaylistRepo(), slog.Default())
+	require.NoError(t, playback.LoadPlaylist(ctx, stored, true))
+	snapshot, err := playback.GetPlaylist(ctx)
+	require.NoError(t, err)
+	require.NoError(t, snapshot.SetCurrent(snapshot.GetHead()), "the snapshot does not reach playback")
+
+	repo := NewMockLibraryRepo()
+	repo.AddPlaylist(&entity.Playlist{ID: 1, Name: "Default"})
+	uc := NewLibraryUseCase(repo, playback, slog.Default())
+
+	page, err := uc.GetPlaylistPage(ctx, 1, 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, page.CurrentPosition)
+	assert.Len(t, page.Items, 2)
+}
+
+func TestCreateAndDeletePlaylist(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockLibraryRepo()
+	playback := NewPlaylistUseCase(NewMockPlaylistRepo(), NewMockPlaylistRepo(), slog.Default())
+	uc := NewLibraryUseCase(repo, playback, slog.Default())
+
+	id, err := uc.CreatePlaylist(ctx, "Road trip", "")
+	require.NoError(t, err)
+
+	_, err = uc.CreatePlaylist(ctx, "Road trip", "again")
+	assert.ErrorIs(t, err, ErrPlaylistAlreadyExists)
+	_, err = uc.CreatePlaylist(ctx, " ", "")
+	assert.ErrorIs(t, err, ErrInvalidPlaylist)
+
+	loaded, err := repo.GetPlaylistByID(ctx, id)
+	require.NoError(t, err)
+	require.NoError(t, playback.LoadPlaylist(ctx, loaded, true))
+	assert.ErrorIs(t, uc.DeletePlaylist(ctx, id, nil), ErrPlaylistInUse)
+
+	require.NoError(t, playback.LoadPlaylist(ctx, &entity.Playlist{}, false))
+	require.NoError(t, uc.DeletePlaylist(ctx, id, nil))
+	assert.ErrorIs(t, uc.DeletePlaylist(ctx, id, nil), ErrPlaylistNotFound)
+
+	// with If-Match only the listed version is removed
+	repo.AddPlaylist(&entity.Playlist{ID: 7, Name: "Versioned", Version: 3})
+	assert.ErrorIs(t, uc.DeletePlaylist(ctx, 7, []int{2}), ErrVersionConflict)
+	assert.ErrorIs(t, uc.DeletePlaylist(ctx, 8, []int{2}), ErrPlaylistNotFound)
+	require.NoError(t, uc.DeletePlaylist(ctx, 7, []int{2, 3}))
+}
@@ -2,12 +2,27 @@ package usecase
 
 import (
 	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/pagination"
+	"cloud-go-testtask/internal/repository"
+	"context"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type MockPlaylistRepo struct {
 	mu       sync.Mutex
 	playlist *entity.Playlist
+	position time.Duration // of the checkpoint
+	playing  bool          // of the checkpoint
+
+	Order    []int // song IDs passed to the last SetPlaylistOrder
+	OrderErr error
+
+	Fail      func(method string) error // called before every write, its error is returned instead
+	Commits   int
+	Rollbacks int
 }
 
 func NewMockPlaylistRepo() *MockPlaylistRepo {
@@ -16,27 +31,548 @@ func NewMockPlaylistRepo() *MockPlaylistRepo {
 	}
 }
 
-func (m *MockPlaylistRepo) AddSong(song *entity.Song) error {
+/*
+AddSong appends song to the playlist. Songs without ID get the next free one, as in DB
+*/
+func (m *MockPlaylistRepo) AddSong(ctx context.Context, song *entity.Song) error {
+	if song == nil {
+		return repository.ErrNullSong
+	}
+	if err := m.fail("AddSong"); err != nil {
+		return err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if song.ID == 0 {
+		for node := m.playlist.GetHead(); node != nil; node = node.Next {
+			song.ID = max(song.ID, node.Song.ID)
+		}
+		song.ID++
+	}
 	m.playlist.AddToEnd(song)
 	return nil
 }
 
-func (m *MockPlaylistRepo) GetPlaylist() (*entity.Playlist, error) {
+func (m *MockPlaylistRepo) GetPlaylist(ctx context.Context) (*entity.Playlist, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return m.playlist, nil
 }
 
-func (m *MockPlaylistRepo) SetCurrent(node *entity.PlaylistNode) error {
+func (m *MockPlaylistRepo) SetCurrent(ctx context.Context, node *entity.PlaylistNode) error {
+	if node == nil || node.Song == nil {
+		return repository.ErrNilNode
+	}
+	if err := m.fail("SetCurrent"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for n := m.playlist.GetHead(); n != nil; n = n.Next {
+		if n == node || n.Song.ID == node.Song.ID {
+			m.position = 0
+			return m.playlist.SetCurrent(n)
+		}
+	}
+	return repository.ErrCurrentSongNotFound
+}
+
+func (m *MockPlaylistRepo) SaveCheckpoint(ctx context.Context, checkpoint repository.Checkpoint) error {
+	if err := m.fail("SaveCheckpoint"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for n := m.playlist.GetHead(); n != nil; n = n.Next {
+		if n.Song.ID == checkpoint.SongID {
+			m.position, m.playing = checkpoint.Position, checkpoint.Playing
+			return m.playlist.SetCurrent(n)
+		}
+	}
+	return repository.ErrCurrentSongNotFound
+}
+
+func (m *MockPlaylistRepo) LoadCheckpoint(ctx context.Context) (repository.Checkpoint, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	return m.playlist.SetCurrent(node)
+
+	var checkpoint repository.Checkpoint
+	if current := m.playlist.GetCurrent(); current != nil {
+		checkpoint.SongID, checkpoint.Position, checkpoint.Playing = current.Song.ID, m.position, m.playing
+	}
+	return checkpoint, nil
 }
 
-func (m *MockPlaylistRepo) GetCurrent() (*entity.PlaylistNode, error) {
+func (m *MockPlaylistRepo) GetCurrent(ctx context.Context) (*entity.PlaylistNode, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return m.playlist.GetCurrent(), nil
 }
+
+func (m *MockPlaylistRepo) LoadPlaylist(ctx context.Context, playlist *entity.Playlist) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.playlist = playlist
+	return nil
+}
+
+func (m *MockPlaylistRepo) GetSongByID(ctx context.Context, id int) (*entity.Song, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for node := m.playlist.GetHead(); node != nil; node = node.Next {
+		if node.Song.ID == id {
+			song := *node.Song
+			return &song, nil
+		}
+	}
+	return nil, repository.ErrSongNotFound
+}
+
+/*
+UpdateSong versions songs like the DB: a non-zero song.Version must match, the stored version is bumped
+*/
+func (m *MockPlaylistRepo) UpdateSong(ctx context.Context, song *entity.Song) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for node := m.playlist.GetHead(); node != nil; node = node.Next {
+		if node.Song.ID == song.ID {
+			if song.Version != 0 && song.Version != node.Song.Version {
+				return repository.ErrVersionMismatch
+			}
+			updated := *song
+			updated.Version = node.Song.Version + 1
+			node.Song = &updated
+			song.Version = updated.Version
+			return nil
+		}
+	}
+	return repository.ErrSongNotFound
+}
+
+func (m *MockPlaylistRepo) DeleteSong(ctx context.Context, id, version int) error {
+	if err := m.fail("DeleteSong"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for node := m.playlist.GetHead(); node != nil; node = node.Next {
+		if node.Song.ID == id && version != 0 && version != node.Song.Version {
+			return repository.ErrVersionMismatch
+		}
+	}
+	if err := m.playlist.RemoveSong(id); err != nil {
+		return repository.ErrSongNotFound
+	}
+	return nil
+}
+
+func (m *MockPlaylistRepo) SetPlaylistOrder(ctx context.Context, playlistID int, songIDs []int, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.OrderErr != nil {
+		return m.OrderErr
+	}
+	if version != 0 && version != m.playlist.Version {
+		return repository.ErrVersionMismatch
+	}
+	m.playlist.Version++
+	m.Order = songIDs
+	return nil
+}
+
+/*
+AddSongToPlaylist appends a song known only by its ID, the mock keeps no library
+*/
+func (m *MockPlaylistRepo) AddSongToPlaylist(ctx context.Context, playlistID, songID int) error {
+	if err := m.fail("AddSongToPlaylist"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.playlist.AddToEnd(&entity.Song{ID: songID})
+	return nil
+}
+
+func (m *MockPlaylistRepo) RemoveSongFromPlaylist(ctx context.Context, playlistID, songID int) error {
+	if err := m.fail("RemoveSongFromPlaylist"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.playlist.RemoveSong(songID)
+}
+
+/*
+InsertSong gives song the next free ID without adding it to the playlist, the mock keeps no library
+*/
+func (m *MockPlaylistRepo) InsertSong(ctx context.Context, song *entity.Song) error {
+	if song == nil {
+		return repository.ErrNullSong
+	}
+	if err := m.fail("InsertSong"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if song.ID == 0 {
+		for node := m.playlist.GetHead(); node != nil; node = node.Next {
+			song.ID = max(song.ID, node.Song.ID)
+		}
+		song.ID++
+	}
+	return nil
+}
+
+/*
+CreatePlaylist always fails, the mock keeps a single playlist
+*/
+func (m *MockPlaylistRepo) CreatePlaylist(ctx context.Context, name, description string) (int, error) {
+	return 0, repository.ErrPlaylistCreationFailed
+}
+
+/*
+InTx imitates transaction: songs and the current song are restored if fn fails
+*/
+func (m *MockPlaylistRepo) InTx(ctx context.Context, fn func(tx repository.TxRepository) error) error {
+	m.mu.Lock()
+	saved := copyPlaylist(m.playlist)
+	m.mu.Unlock()
+
+	if err := fn(m); err != nil {
+		m.mu.Lock()
+		m.playlist = saved
+		m.Rollbacks++
+		m.mu.Unlock()
+		return err
+	}
+
+	m.mu.Lock()
+	m.Commits++
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MockPlaylistRepo) fail(method string) error {
+	if m.Fail == nil {
+		return nil
+	}
+	return m.Fail(method)
+}
+
+func copyPlaylist(playlist *entity.Playlist) *entity.Playlist {
+	copied := &entity.Playlist{ID: playlist.ID, Name: playlist.Name, Description: playlist.Description}
+	for node := playlist.GetHead(); node != nil; node = node.Next {
+		n := copied.AddToEnd(node.Song)
+		if node == playlist.GetCurrent() {
+			_ = copied.SetCurrent(n)
+		}
+	}
+	return copied
+}
+
+type MockSmartPlaylistRepo struct {
+	mu        sync.Mutex
+	nextID    int
+	playlists map[int]*entity.SmartPlaylist
+	songs     []*entity.Song
+}
+
+func NewMockSmartPlaylistRepo(songs ...*entity.Song) *MockSmartPlaylistRepo {
+	return &MockSmartPlaylistRepo{
+		playlists: make(map[int]*entity.SmartPlaylist),
+		songs:     songs,
+	}
+}
+
+func (m *MockSmartPlaylistRepo) CreateSmartPlaylist(ctx context.Context, sp *entity.SmartPlaylist) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	sp.ID = m.nextID
+	sp.Version = 1
+	stored := *sp
+	m.playlists[sp.ID] = &stored
+	return sp.ID, nil
+}
+
+func (m *MockSmartPlaylistRepo) GetSmartPlaylistByID(ctx context.Context, id int) (*entity.SmartPlaylist, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sp, ok := m.playlists[id]
+	if !ok {
+		return nil, repository.ErrSmartPlaylistNotFound
+	}
+	stored := *sp
+	return &stored, nil
+}
+
+func (m *MockSmartPlaylistRepo) ListSmartPlaylists(ctx context.Context) ([]*entity.SmartPlaylist, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var playlists []*entity.SmartPlaylist
+	for id := 1; id <= m.nextID; id++ {
+		if sp, ok := m.playlists[id]; ok {
+			stored := *sp
+			playlists = append(playlists, &stored)
+		}
+	}
+	return playlists, nil
+}
+
+func (m *MockSmartPlaylistRepo) UpdateSmartPlaylist(ctx context.Context, sp *entity.SmartPlaylist) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.playlists[sp.ID]
+	if !ok {
+		return repository.ErrSmartPlaylistNotFound
+	}
+	if sp.Version != 0 && current.Version != sp.Version {
+		return repository.ErrVersionMismatch
+	}
+	sp.Version = current.Version + 1
+	stored := *sp
+	m.playlists[sp.ID] = &stored
+	return nil
+}
+
+func (m *MockSmartPlaylistRepo) DeleteSmartPlaylistByID(ctx context.Context, id, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sp, ok := m.playlists[id]
+	if !ok {
+		return repository.ErrSmartPlaylistNotFound
+	}
+	if version != 0 && sp.Version != version {
+		return repository.ErrVersionMismatch
+	}
+	delete(m.playlists, id)
+	return nil
+}
+
+func (m *MockSmartPlaylistRepo) ListSongs(ctx context.Context) ([]*entity.Song, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	songs := make([]*entity.Song, len(m.songs))
+	copy(songs, m.songs)
+	return songs, nil
+}
+
+func (m *MockSmartPlaylistRepo) AddLibrarySong(song *entity.Song) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.songs = append(m.songs, song)
+}
+
+type MockLibraryRepo struct {
+	mu            sync.Mutex
+	songs         []*entity.Song
+	playlists     map[int]*entity.Playlist
+	LastSongQuery repository.SongQuery
+}
+
+func NewMockLibraryRepo(songs ...*entity.Song) *MockLibraryRepo {
+	return &MockLibraryRepo{songs: songs, playlists: make(map[int]*entity.Playlist)}
+}
+
+func (m *MockLibraryRepo) AddPlaylist(playlist *entity.Playlist) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.playlists[playlist.ID] = playlist
+}
+
+func (m *MockLibraryRepo) GetPlaylistByID(ctx context.Context, id int) (*entity.Playlist, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	playlist, ok := m.playlists[id]
+	if !ok {
+		return nil, repository.ErrPlaylistNotFound
+	}
+	return playlist, nil
+}
+
+func (m *MockLibraryRepo) CreatePlaylist(ctx context.Context, name, description string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := 1
+	for existing := range m.playlists {
+		if existing >= id {
+			id = existing + 1
+		}
+	}
+	m.playlists[id] = &entity.Playlist{ID: id, Name: name, Description: description}
+	return id, nil
+}
+
+func (m *MockLibraryRepo) FindPlaylistIDByName(ctx context.Context, name string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, playlist := range m.playlists {
+		if playlist.Name == name {
+			return id, nil
+		}
+	}
+	return 0, repository.ErrPlaylistNotFound
+}
+
+func (m *MockLibraryRepo) DeletePlaylistByID(ctx context.Context, id, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	playlist, ok := m.playlists[id]
+	if !ok {
+		return repository.ErrPlaylistNotFound
+	}
+	if version != 0 && playlist.Version != version {
+		return repository.ErrVersionMismatch
+	}
+	delete(m.playlists, id)
+	return nil
+}
+
+func (m *MockLibraryRepo) SearchSongs(ctx context.Context, q repository.SongQuery) (*repository.SongPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.LastSongQuery = q
+
+	page := &repository.SongPage{}
+	for _, song := range m.songs {
+		if q.After != nil && song.ID <= q.After.ID {
+			continue
+		}
+		if len(page.Songs) == q.Limit {
+			page.Next = &pagination.Cursor{Sort: string(q.Sort), Value: strconv.Itoa(page.Songs[q.Limit-1].ID), ID: page.Songs[q.Limit-1].ID}
+			break
+		}
+		page.Songs = append(page.Songs, song)
+	}
+	return page, nil
+}
+
+func (m *MockLibraryRepo) SearchPlaylists(ctx context.Context, q repository.PlaylistQuery) (*repository.PlaylistPage, error) {
+	return &repository.PlaylistPage{}, nil
+}
+
+/*
+MockImportRepo keeps writes made inside InTx in a staging copy and applies them only
+if the callback succeeds. FailOn makes the named write operation fail.
+*/
+type MockImportRepo struct {
+	mu        sync.Mutex
+	songs     []*entity.Song
+	playlists map[int][]int
+	names     map[int]string
+	FailOn    string
+}
+
+func NewMockImportRepo(songs ...*entity.Song) *MockImportRepo {
+	return &MockImportRepo{songs: songs, playlists: make(map[int][]int), names: make(map[int]string)}
+}
+
+func (m *MockImportRepo) FindSong(ctx context.Context, title, artist string) (*entity.Song, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var found *entity.Song
+	for _, song := range m.songs {
+		if !strings.EqualFold(song.Title, title) || (artist != "" && !strings.EqualFold(song.Artist, artist)) {
+			continue
+		}
+		if found != nil {
+			return nil, repository.ErrSongNotFound // ambiguous title
+		}
+		found = song
+	}
+	if found == nil {
+		return nil, repository.ErrSongNotFound
+	}
+	return found, nil
+}
+
+func (m *MockImportRepo) GetSongByID(ctx context.Context, id int) (*entity.Song, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, song := range m.songs {
+		if song.ID == id {
+			return song, nil
+		}
+	}
+	return nil, repository.ErrSongNotFound
+}
+
+func (m *MockImportRepo) InTx(ctx context.Context, fn func(tx repository.TxRepository) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := &mockImportTx{repo: m, songs: append([]*entity.Song(nil), m.songs...), playlists: make(map[int][]int), names: make(map[int]string)}
+	if err := fn(tx); err != nil {
+		for _, song := range tx.songs[len(m.songs):] {
+			song.ID = 0
+		}
+		return err
+	}
+
+	m.songs = tx.songs
+	for id, songs := range tx.playlists {
+		m.playlists[id] = songs
+		m.names[id] = tx.names[id]
+	}
+	return nil
+}
+
+func (m *MockImportRepo) Songs() []*entity.Song {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*entity.Song(nil), m.songs...)
+}
+
+func (m *MockImportRepo) PlaylistSongs(id int) ([]int, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.playlists[id], m.names[id]
+}
+
+/*
+mockImportTx is the repository given to InTx. The import does not touch playback,
+so the methods of repository.PlaylistRepository are left unimplemented
+*/
+type mockImportTx struct {
+	repository.PlaylistRepository
+	repo      *MockImportRepo
+	songs     []*entity.Song
+	playlists map[int][]int
+	names     map[int]string
+}
+
+func (tx *mockImportTx) InsertSong(ctx context.Context, song *entity.Song) error {
+	if tx.repo.FailOn == "InsertSong" {
+		return repository.ErrAddSong
+	}
+	song.ID = len(tx.songs) + 1
+	tx.songs = append(tx.songs, song)
+	return nil
+}
+
+func (tx *mockImportTx) CreatePlaylist(ctx context.Context, name, description string) (int, error) {
+	if tx.repo.FailOn == "CreatePlaylist" {
+		return 0, repository.ErrPlaylistCreationFailed
+	}
+	id := len(tx.repo.playlists) + len(tx.playlists) + 1
+	tx.playlists[id] = []int{}
+	tx.names[id] = name
+	return id, nil
+}
+
+func (tx *mockImportTx) AddSongToPlaylist(ctx context.Context, playlistID, songID int) error {
+	if tx.repo.FailOn == "AddSongToPlaylist" {
+		return repository.ErrAddSong
+	}
+	tx.playlists[playlistID] = append(tx.playlists[playlistID], songID)
+	return nil
+}
@@ -0,0 +1,14 @@
+package usecase
+
+import (
+	"testing"
+
+	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/repository/repositorytest"
+)
+
+func TestMockPlaylistRepoConformance(t *testing.T) {
+	repositorytest.RunPlaylistRepository(t, func(t *testing.T) repository.PlaylistRepository {
+		return NewMockPlaylistRepo()
+	})
+}
@@ -2,10 +2,16 @@ package usecase
 
 import (
 	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/logging"
 	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/tracing"
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,28 +27,248 @@ type PlaylistUseCase struct {
 	paused   bool
 	position time.Duration
 
-	stopChan chan struct{}
-	logger   *slog.Logger
+	// leading is false on followers: another instance drives playback and only its checkpoints
+	// move the current song here. Instances without leader election always lead
+	leading        bool
+	lastCheckpoint repository.Checkpoint // saved by checkpoint, repeated ones are skipped
+	playingAtStop  bool                  // playback was going when the lifecycle stopped it
+
+	// persistCurrent is false while a playlist which is not stored in DB (e.g. smart one) is loaded
+	persistCurrent      bool
+	libraryListeners    []func()
+	transitionListeners []func(Transition)
+
+	// lifecycle bounds background playback, it is canceled when the server stops or by Shutdown
+	lifecycle     context.Context
+	stopPlayback  context.CancelFunc
+	playbackGroup sync.WaitGroup
+	goroutines    atomic.Int32 // running playback goroutines
+	cacheLoaded   atomic.Bool  // set once InitCache has loaded the playlist
+	stopChan      chan struct{}
+	logger        *slog.Logger
 }
 
 func NewPlaylistUseCase(rdbmsRepo, cacheRepo repository.PlaylistRepository, logger *slog.Logger) *PlaylistUseCase {
-	return &PlaylistUseCase{
-		rdbmsRepo: rdbmsRepo,
-		cacheRepo: cacheRepo,
-		logger:    logger,
+	uc := &PlaylistUseCase{
+		rdbmsRepo:      rdbmsRepo,
+		cacheRepo:      cacheRepo,
+		persistCurrent: true,
+		leading:        true,
+		logger:         logger,
 	}
+	uc.lifecycle, uc.stopPlayback = context.WithCancel(context.Background())
+	return uc
 }
 
-func (uc *PlaylistUseCase) InitCache() error {
-	const op = "usecase.PlaylistUseCase.InitCache"
+/*
+SetLifecycle binds background playback to ctx. Playback stops when ctx is done
+and Play refuses to start it again
+*/
+func (uc *PlaylistUseCase) SetLifecycle(ctx context.Context) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	uc.stopPlayback()
+	uc.lifecycle, uc.stopPlayback = context.WithCancel(ctx)
+}
+
+/*
+Shutdown stops playback, waits until playback goroutines exit, so the play history they write
+is flushed, and saves the current song and position for InitCache to resume from.
+Playback can't be started again afterwards
+*/
+func (uc *PlaylistUseCase) Shutdown(ctx context.Context) error {
+	const op = "usecase.PlaylistUseCase.Shutdown"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	uc.mu.Lock()
+	uc.stopPlayback()
+	uc.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		uc.playbackGroup.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		operationLogger.Debug("Playback stopped")
+	case <-ctx.Done():
+		operationLogger.Error("Playback did not stop in time", slog.String("error", ctx.Err().Error()))
+		return fmt.Errorf("%w: playback did not stop: %v", ErrShutdown, ctx.Err())
+	}
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	saved, err := uc.checkpoint(ctx, operationLogger)
+	if err != nil {
+		return err
+	}
+	if saved {
+		operationLogger.Info("Playback checkpoint saved",
+			slog.Int("song_id", uc.lastCheckpoint.SongID),
+			slog.Duration("position", uc.lastCheckpoint.Position),
+			slog.Bool("playing", uc.lastCheckpoint.Playing),
+		)
+	}
+	return nil
+}
+
+/*
+RunCheckpointer saves the checkpoint every interval until ctx is done, so an instance taking playback
+over after a crash of this one resumes close to where it stopped. Nothing is written while the
+checkpoint stays the same, e.g. on pause
+*/
+func (uc *PlaylistUseCase) RunCheckpointer(ctx context.Context, interval time.Duration) {
+	const op = "usecase.PlaylistUseCase.RunCheckpointer"
 	operationLogger := uc.logger.With(slog.String("op", op))
 
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			uc.mu.Lock()
+			// errors are logged by checkpoint, the next tick retries
+			_, _ = uc.checkpoint(ctx, operationLogger)
+			uc.mu.Unlock()
+		}
+	}
+}
+
+/*
+checkpoint saves the current song, the position and whether it is playing unless the same checkpoint
+is saved already. Followers save nothing, the checkpoint is the leader's. Must be called under lock
+*/
+func (uc *PlaylistUseCase) checkpoint(ctx context.Context, operationLogger *slog.Logger) (bool, error) {
+	checkpointer, ok := uc.rdbmsRepo.(repository.Checkpointer)
+	if !ok || !uc.persistCurrent || !uc.leading {
+		return false, nil
+	}
+	current, err := uc.cacheRepo.GetCurrent(ctx)
+	if err != nil {
+		operationLogger.Error("Failed to get current song from cache", slog.String("error", err.Error()))
+		return false, fmt.Errorf("%w: %v", ErrCheckpoint, err)
+	}
+	if current == nil || current.Song == nil {
+		return false, nil
+	}
+
+	checkpoint := repository.Checkpoint{SongID: current.Song.ID, Position: uc.position, Playing: uc.playing || uc.playingAtStop}
+	if checkpoint == uc.lastCheckpoint {
+		return false, nil
+	}
+	if err := checkpointer.SaveCheckpoint(ctx, checkpoint); err != nil {
+		operationLogger.Error("Failed to save checkpoint", slog.String("error", err.Error()))
+		return false, fmt.Errorf("%w: %v", ErrCheckpoint, err)
+	}
+	uc.lastCheckpoint = checkpoint
+	return true, nil
+}
+
+/*
+startPlayback runs playCurrentSong in a goroutine tracked by Shutdown, uc.mu must be held.
+Nothing is started once the lifecycle is done
+*/
+func (uc *PlaylistUseCase) startPlayback() {
+	if uc.lifecycle.Err() != nil {
+		uc.playing = false
+		return
+	}
+
+	uc.playbackGroup.Add(1)
+	uc.goroutines.Add(1)
+	go func() {
+		defer uc.playbackGroup.Done()
+		defer uc.goroutines.Add(-1)
+		uc.playCurrentSong()
+	}()
+}
+
+/*
+OnLibraryChange registers a callback which is called after songs are added or played.
+Callbacks are executed under the use case lock and must not call PlaylistUseCase back.
+*/
+func (uc *PlaylistUseCase) OnLibraryChange(fn func()) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	uc.libraryListeners = append(uc.libraryListeners, fn)
+}
+
+/*
+LibraryChanged notifies listeners about library changes made bypassing PlaylistUseCase, e.g. by import
+*/
+func (uc *PlaylistUseCase) LibraryChanged() {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	uc.notifyLibraryChange()
+}
+
+func (uc *PlaylistUseCase) notifyLibraryChange() {
+	for _, fn := range uc.libraryListeners {
+		fn()
+	}
+}
+
+type TransitionReason string
+
+const (
+	TransitionNext TransitionReason = "next"
+	TransitionPrev TransitionReason = "prev"
+	TransitionAuto TransitionReason = "auto" // the previous song has been played to the end
+)
+
+/*
+Transition is a change of the current song during playback. Skipped is set if the previous song
+was left by Next or Prev after it had started playing
+*/
+type Transition struct {
+	Reason  TransitionReason
+	From    *entity.Song
+	To      *entity.Song
+	Skipped bool
+}
+
+/*
+OnTransition registers a callback which is called when the current song changes during playback.
+Callbacks are executed under the use case lock and must not call PlaylistUseCase back.
+*/
+func (uc *PlaylistUseCase) OnTransition(fn func(Transition)) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	uc.transitionListeners = append(uc.transitionListeners, fn)
+}
+
+func (uc *PlaylistUseCase) notifyTransition(t Transition) {
+	for _, fn := range uc.transitionListeners {
+		fn(t)
+	}
+}
+
+/*
+PlaybackGoroutines returns the number of running playback goroutines, at most one is expected
+*/
+func (uc *PlaylistUseCase) PlaybackGoroutines() int {
+	return int(uc.goroutines.Load())
+}
+
+func (uc *PlaylistUseCase) InitCache(ctx context.Context) error {
+	const op = "usecase.PlaylistUseCase.InitCache"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
 	operationLogger.Debug("Initializing cache")
 
 	uc.mu.Lock()
 	defer uc.mu.Unlock()
 
-	playlist, err := uc.rdbmsRepo.GetPlaylist()
+	playlist, err := uc.rdbmsRepo.GetPlaylist(ctx)
 	if err != nil {
 		operationLogger.Error("Failed to get playlist from DB",
 			slog.String("error", err.Error()),
@@ -50,77 +276,191 @@ func (uc *PlaylistUseCase) InitCache() error {
 		return fmt.Errorf("InitCache: %w", err)
 	}
 
-	current := playlist.GetHead()
-	for current != nil {
-		if err := uc.cacheRepo.AddSong(current.Song); err != nil {
-			operationLogger.Error("Failed to add song to Cache",
-				slog.String("song_title", current.Song.Title),
-				slog.String("error", err.Error()),
-			)
-			return fmt.Errorf("InitCache: %w", err)
-		}
-		operationLogger.Debug("Added song to Cache",
-			slog.String("song_title", current.Song.Title),
-		)
-
-		current = current.Next
+	if err := uc.loadPlaylist(ctx, operationLogger, playlist, true); err != nil {
+		return fmt.Errorf("InitCache: %w", err)
 	}
 
-	currentNode := playlist.GetCurrent()
-	if currentNode != nil {
-		if err := uc.cacheRepo.SetCurrent(currentNode); err != nil {
-			operationLogger.Error("Failed to set current song in Cache",
-				slog.String("song_title", currentNode.Song.Title),
-				slog.String("error", err.Error()),
-			)
-			return fmt.Errorf("InitCache: %w", err)
-		}
+	if currentNode := playlist.GetCurrent(); currentNode != nil {
 		operationLogger.Debug("Set current song in Cache",
 			slog.String("song_title", currentNode.Song.Title),
 		)
+		uc.restoreCheckpoint(ctx, operationLogger, currentNode.Song)
 	}
 
+	uc.cacheLoaded.Store(true)
 	operationLogger.Debug("Cache initialized successfully")
 	return nil
 }
 
-func (uc *PlaylistUseCase) Play() error {
+/*
+CheckCache fails with ErrCacheNotInitialized until InitCache has succeeded
+*/
+func (uc *PlaylistUseCase) CheckCache(context.Context) error {
+	if !uc.cacheLoaded.Load() {
+		return ErrCacheNotInitialized
+	}
+	return nil
+}
+
+/*
+restoreCheckpoint resumes from the position saved by Shutdown or RunCheckpointer if the song is still
+current and returns the checkpoint, the zero one if it is for another song. A failure only loses
+the position, so it is logged and playback starts from the beginning of the song
+*/
+func (uc *PlaylistUseCase) restoreCheckpoint(ctx context.Context, operationLogger *slog.Logger, current *entity.Song) repository.Checkpoint {
+	checkpointer, ok := uc.rdbmsRepo.(repository.Checkpointer)
+	if !ok {
+		return repository.Checkpoint{}
+	}
+
+	checkpoint, err := checkpointer.LoadCheckpoint(ctx)
+	if err != nil {
+		operationLogger.Warn("Failed to load playback checkpoint", slog.String("error", err.Error()))
+		return repository.Checkpoint{}
+	}
+	if checkpoint.SongID != current.ID {
+		return repository.Checkpoint{}
+	}
+
+	if checkpoint.Position > 0 && checkpoint.Position < current.Duration {
+		uc.position = checkpoint.Position
+		operationLogger.Debug("Playback position restored", slog.Duration("position", checkpoint.Position))
+	}
+	return checkpoint
+}
+
+/*
+Lead makes this instance drive playback once it is elected. The playlist is reloaded from DB,
+where the previous leader left it, and playback resumes from its checkpoint if it was playing
+*/
+func (uc *PlaylistUseCase) Lead(ctx context.Context) error {
+	const op = "usecase.PlaylistUseCase.Lead"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	playlist, err := uc.rdbmsRepo.GetPlaylist(ctx)
+	if err != nil {
+		operationLogger.Error("Failed to get playlist from DB", slog.String("error", err.Error()))
+		return fmt.Errorf("%w: %v", ErrTakeOver, err)
+	}
+	if err := uc.loadPlaylist(ctx, operationLogger, playlist, true); err != nil {
+		return fmt.Errorf("%w: %v", ErrTakeOver, err)
+	}
+	uc.leading = true
+
+	current := playlist.GetCurrent()
+	if current == nil || current.Song == nil {
+		operationLogger.Info("Took playback over, no song is current")
+		return nil
+	}
+	checkpoint := uc.restoreCheckpoint(ctx, operationLogger, current.Song)
+	uc.lastCheckpoint = checkpoint
+	if checkpoint.Playing {
+		uc.playing = true
+		uc.stopChan = make(chan struct{}, 1)
+		uc.startPlayback()
+	}
+
+	operationLogger.Info("Took playback over",
+		slog.Int("song_id", current.Song.ID),
+		slog.Duration("position", uc.position),
+		slog.Bool("playing", uc.playing),
+	)
+	return nil
+}
+
+/*
+Follow hands playback over to another instance. Playback stops here without a checkpoint, which is
+the leader's to write, and playback commands fail with ErrNotLeader until Lead
+*/
+func (uc *PlaylistUseCase) Follow(ctx context.Context) {
+	const op = "usecase.PlaylistUseCase.Follow"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	if uc.leading {
+		operationLogger.Info("Following another instance", slog.Bool("was_playing", uc.playing))
+	}
+	uc.leading = false
+	uc.playing = false
+	uc.paused = false
+	uc.position = 0
+	select {
+	case uc.stopChan <- struct{}{}:
+	default:
+	}
+}
+
+/*
+Leading reports whether this instance drives playback
+*/
+func (uc *PlaylistUseCase) Leading() bool {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	return uc.leading
+}
+
+func (uc *PlaylistUseCase) Play(ctx context.Context) error {
 	const op = "usecase.PlaylistUseCase.Play"
-	operationLogger := uc.logger.With(slog.String("op", op))
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
 
 	operationLogger.Debug("Play called")
 
 	uc.mu.Lock()
 	defer uc.mu.Unlock()
 
+	if !uc.leading {
+		operationLogger.Warn("Play called on a follower")
+		return ErrNotLeader
+	}
+
 	if uc.playing && !uc.paused {
 		operationLogger.Warn("Play called, but already playing")
 		return nil
 	}
+	if err := uc.lifecycle.Err(); err != nil {
+		operationLogger.Warn("Play called after playback was stopped")
+		return fmt.Errorf("%w: %v", ErrPlaybackStopped, err)
+	}
 
 	uc.paused = false
 	if !uc.playing {
 		uc.playing = true
 		uc.stopChan = make(chan struct{}, 1)
-		go uc.playCurrentSong() // Playback emulation
+		uc.startPlayback() // Playback emulation
 		operationLogger.Debug("Playback started")
 	} else {
-		go uc.playCurrentSong()
+		uc.startPlayback()
 		operationLogger.Debug("Resumed playback")
 	}
 
 	return nil
 }
 
-func (uc *PlaylistUseCase) Pause() error {
+func (uc *PlaylistUseCase) Pause(ctx context.Context) error {
 	const op = "usecase.PlaylistUseCase.Pause"
-	operationLogger := uc.logger.With(slog.String("op", op))
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
 
 	operationLogger.Debug("Pause called")
 
 	uc.mu.Lock()
 	defer uc.mu.Unlock()
 
+	if !uc.leading {
+		operationLogger.Warn("Pause called on a follower")
+		return ErrNotLeader
+	}
+
 	if !uc.playing {
 		operationLogger.Warn("Pause called, but not playing")
 		return ErrNotPlaying
@@ -143,16 +483,23 @@ func (uc *PlaylistUseCase) Pause() error {
 	return nil
 }
 
-func (uc *PlaylistUseCase) Next() error {
+func (uc *PlaylistUseCase) Next(ctx context.Context) error {
 	const op = "usecase.PlaylistUseCase.Next"
-	operationLogger := uc.logger.With(slog.String("op", op))
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
 
 	operationLogger.Debug("Next called")
 
 	uc.mu.Lock()
 	defer uc.mu.Unlock()
 
-	playlist, err := uc.cacheRepo.GetPlaylist()
+	if !uc.leading {
+		operationLogger.Warn("Next called on a follower")
+		return ErrNotLeader
+	}
+
+	playlist, err := uc.cacheRepo.GetPlaylist(ctx)
 	if err != nil {
 		operationLogger.Error("Failed to get playlist from Cache",
 			slog.String("error", err.Error()),
@@ -166,41 +513,31 @@ func (uc *PlaylistUseCase) Next() error {
 		return fmt.Errorf("%w: %v", ErrNoNextSong, err)
 	}
 
-	uc.position = 0
-	uc.playing = false
-	uc.paused = false
-
-	select {
-	case uc.stopChan <- struct{}{}:
-	default:
-	}
-
-	if err := uc.cacheRepo.SetCurrent(current.Next); err != nil {
-		return fmt.Errorf("%w: %v", ErrSetCurrentInCache, err)
+	if err := uc.switchCurrent(ctx, operationLogger, TransitionNext, current, current.Next); err != nil {
+		return err
 	}
-
-	if err := uc.rdbmsRepo.SetCurrent(current.Next); err != nil {
-		return fmt.Errorf("%w: %v", ErrSetCurrentInDB, err)
-	}
-
-	uc.playing = true
-	uc.stopChan = make(chan struct{}, 1)
-	go uc.playCurrentSong()
 	operationLogger.Info("Moved to next song and started playback")
 
 	return nil
 }
 
-func (uc *PlaylistUseCase) Prev() error {
+func (uc *PlaylistUseCase) Prev(ctx context.Context) error {
 	const op = "usecase.PlaylistUseCase.Prev"
-	operationLogger := uc.logger.With(slog.String("op", op))
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
 
 	operationLogger.Debug("Prev called")
 
 	uc.mu.Lock()
 	defer uc.mu.Unlock()
 
-	playlist, err := uc.cacheRepo.GetPlaylist()
+	if !uc.leading {
+		operationLogger.Warn("Prev called on a follower")
+		return ErrNotLeader
+	}
+
+	playlist, err := uc.cacheRepo.GetPlaylist(ctx)
 	if err != nil {
 		operationLogger.Error("Failed to get playlist from Cache",
 			slog.String("error", err.Error()),
@@ -214,40 +551,62 @@ func (uc *PlaylistUseCase) Prev() error {
 		return fmt.Errorf("%w: %v", ErrNoPrevSong, err)
 	}
 
-	uc.position = 0
-	uc.playing = false
-	uc.paused = false
+	if err := uc.switchCurrent(ctx, operationLogger, TransitionPrev, current, current.Prev); err != nil {
+		return err
+	}
+	operationLogger.Info("Moved to previous song and started playback")
+
+	return nil
+}
+
+/*
+switchCurrent makes target current in DB and cache and restarts playback from its beginning.
+On failure both stores keep the previous current song and playback is not touched.
+Must be called under lock
+*/
+func (uc *PlaylistUseCase) switchCurrent(ctx context.Context, operationLogger *slog.Logger, reason TransitionReason, current, target *entity.PlaylistNode) error {
+	uow := uc.newUnitOfWork(ctx, operationLogger)
+	if uc.persistCurrent {
+		uow.DB(ErrSetCurrentInDB,
+			func(repo repository.PlaylistRepository) error { return repo.SetCurrent(ctx, target) },
+			func(repo repository.PlaylistRepository) error { return repo.SetCurrent(ctx, current) },
+		)
+	}
+	uow.Cache(ErrSetCurrentInCache,
+		func() error { return uc.cacheRepo.SetCurrent(ctx, target) },
+		func() error { return uc.cacheRepo.SetCurrent(ctx, current) },
+	)
+	if err := uow.Commit(); err != nil {
+		return err
+	}
 
 	select {
 	case uc.stopChan <- struct{}{}:
 	default:
 	}
 
-	if err := uc.cacheRepo.SetCurrent(current.Prev); err != nil {
-		return fmt.Errorf("%w: %v", ErrSetCurrentInCache, err)
-	}
-	if err := uc.rdbmsRepo.SetCurrent(current.Prev); err != nil {
-		return fmt.Errorf("%w: %v", ErrSetCurrentInDB, err)
-	}
-
+	uc.notifyTransition(Transition{Reason: reason, From: current.Song, To: target.Song, Skipped: uc.position > 0})
+	uc.position = 0
+	uc.paused = false
 	uc.playing = true
 	uc.stopChan = make(chan struct{}, 1)
-	go uc.playCurrentSong()
-	operationLogger.Info("Moved to previous song and started playback")
+	uc.startPlayback()
 
 	return nil
 }
 
-func (uc *PlaylistUseCase) GetCurrentSong() (*entity.Song, error) {
+func (uc *PlaylistUseCase) GetCurrentSong(ctx context.Context) (*entity.Song, error) {
 	const op = "usecase.PlaylistUseCase.GetCurrentSong"
-	operationLogger := uc.logger.With(slog.String("op", op))
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
 
 	operationLogger.Debug("GetCurrentSong called")
 
 	uc.mu.Lock()
 	defer uc.mu.Unlock()
 
-	node, err := uc.cacheRepo.GetCurrent()
+	node, err := uc.cacheRepo.GetCurrent(ctx)
 	if err != nil {
 		operationLogger.Error("Failed to get current song from Cache",
 			slog.String("error", err.Error()),
@@ -266,15 +625,214 @@ func (uc *PlaylistUseCase) GetCurrentSong() (*entity.Song, error) {
 	return node.Song, nil
 }
 
-func (uc *PlaylistUseCase) GetPlaylist() (*entity.Playlist, error) {
+/*
+GetPlaylist returns a copy of the loaded playlist taken under the lock, playback keeps changing the cached one
+*/
+func (uc *PlaylistUseCase) GetPlaylist(ctx context.Context) (*entity.Playlist, error) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	playlist, err := uc.cacheRepo.GetPlaylist(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGetPlaylistFromCache, err)
+	}
+	return playlist.Clone(), nil
+}
+
+/*
+Seek moves playback position inside the current song. Playback continues from the new position
+if it was running, paused playback resumes from it
+*/
+func (uc *PlaylistUseCase) Seek(ctx context.Context, position time.Duration) error {
+	const op = "usecase.PlaylistUseCase.Seek"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op), slog.Duration("position", position))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
 	uc.mu.Lock()
 	defer uc.mu.Unlock()
 
-	playlist, err := uc.cacheRepo.GetPlaylist()
+	if !uc.leading {
+		operationLogger.Warn("Seek called on a follower")
+		return ErrNotLeader
+	}
+
+	current, err := uc.cacheRepo.GetCurrent(ctx)
+	if err != nil {
+		operationLogger.Error("Failed to get current song from Cache", slog.String("error", err.Error()))
+		return fmt.Errorf("%w: %v", ErrGetCurrentNode, err)
+	}
+	if current == nil || current.Song == nil {
+		return ErrNoCurrentSong
+	}
+	if position < 0 || position >= current.Song.Duration {
+		operationLogger.Warn("Seek position out of range", slog.Duration("duration", current.Song.Duration))
+		return fmt.Errorf("%w: song is %s long", ErrInvalidSeek, current.Song.Duration)
+	}
+
+	uc.position = position
+
+	if uc.playing {
+		select {
+		case uc.stopChan <- struct{}{}:
+		default:
+		}
+		uc.stopChan = make(chan struct{}, 1)
+		uc.startPlayback()
+	}
+
+	operationLogger.Debug("Playback position changed")
+	return nil
+}
+
+/*
+MoveSong reorders the loaded playlist, positions are 1-based.
+The new order is stored in DB unless the playlist exists only in cache.
+ifMatch lists the playlist versions the client expects, any version is accepted if it is empty
+*/
+func (uc *PlaylistUseCase) MoveSong(ctx context.Context, from, to int, ifMatch []int) error {
+	const op = "usecase.PlaylistUseCase.MoveSong"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op), slog.Int("from", from), slog.Int("to", to))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	playlist, err := uc.cacheRepo.GetPlaylist(ctx)
+	if err != nil {
+		operationLogger.Error("Failed to get playlist from Cache", slog.String("error", err.Error()))
+		return fmt.Errorf("%w: %v", ErrGetPlaylistFromCache, err)
+	}
+
+	var songIDs []int
+	for node := playlist.GetHead(); node != nil; node = node.Next {
+		songIDs = append(songIDs, node.Song.ID)
+	}
+
+	if from < 1 || from > len(songIDs) || to < 1 || to > len(songIDs) {
+		operationLogger.Warn("Invalid move", slog.String("error", entity.ErrInvalidPosition.Error()))
+		return fmt.Errorf("%w: %v", ErrInvalidPosition, entity.ErrInvalidPosition)
+	}
+
+	version, err := checkVersion(operationLogger, playlist.Version, ifMatch)
+	if err != nil {
+		return err
+	}
+
+	uow := uc.newUnitOfWork(ctx, operationLogger)
+	persisted, seen := false, playlist.Version
+	if _, ok := uc.rdbmsRepo.(repository.PlaylistOrderer); ok && uc.persistCurrent && playlist.ID != 0 {
+		persisted = true
+		moved := slices.Insert(slices.Delete(slices.Clone(songIDs), from-1, from), to-1, songIDs[from-1])
+		uow.DB(ErrReorderPlaylist,
+			func(repo repository.PlaylistRepository) error {
+				return setPlaylistOrder(ctx, repo, playlist.ID, moved, version)
+			},
+			func(repo repository.PlaylistRepository) error {
+				return setPlaylistOrder(ctx, repo, playlist.ID, songIDs, 0)
+			},
+		)
+	}
+	uow.Cache(ErrInvalidPosition,
+		func() error { return playlist.Move(from, to) },
+		func() error { return playlist.Move(to, from) },
+	)
+	if err := uow.Commit(); err != nil {
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			operationLogger.Warn("Playlist changed meanwhile", slog.Int("version", playlist.Version))
+			return fmt.Errorf("%w: %v", ErrVersionConflict, err)
+		}
+		operationLogger.Error("Failed to move song", slog.String("error", err.Error()))
+		return err
+	}
+	if persisted {
+		uc.touchPlaylist(playlist, seen)
+	}
+
+	operationLogger.Debug("Song moved")
+	return nil
+}
+
+func setPlaylistOrder(ctx context.Context, repo repository.PlaylistRepository, playlistID int, songIDs []int, version int) error {
+	orderer, ok := repo.(repository.PlaylistOrderer)
+	if !ok {
+		return ErrReorderPlaylist
+	}
+	return orderer.SetPlaylistOrder(ctx, playlistID, songIDs, version)
+}
+
+/*
+checkVersion matches the version of an entity against ifMatch of the client. It returns the version
+a conditional write must expect, 0 if the client accepts any
+*/
+func checkVersion(operationLogger *slog.Logger, version int, ifMatch []int) (int, error) {
+	if len(ifMatch) == 0 {
+		return 0, nil
+	}
+	if version == 0 || !slices.Contains(ifMatch, version) {
+		operationLogger.Warn("Version does not match", slog.Int("version", version), slog.Any("if_match", ifMatch))
+		return 0, fmt.Errorf("%w: current version is %d", ErrVersionConflict, version)
+	}
+	return version, nil
+}
+
+/*
+touchPlaylist follows a write which bumped the version of the loaded playlist in DB,
+version is the one the playlist had before. Detached and unversioned playlists are left as is.
+Must be called under lock
+*/
+func (uc *PlaylistUseCase) touchPlaylist(playlist *entity.Playlist, version int) {
+	if uc.persistCurrent && playlist.ID != 0 && version != 0 {
+		playlist.Version = version + 1
+	}
+}
+
+/*
+PlaybackState is a snapshot of the playback engine. Index is 1-based position
+of the current song in the loaded playlist, zero if there is no current song
+*/
+type PlaybackState struct {
+	Playing      bool
+	Paused       bool
+	Position     time.Duration
+	Song         *entity.Song
+	PlaylistID   int
+	PlaylistName string
+	Index        int
+	Total        int
+}
+
+func (uc *PlaylistUseCase) State(ctx context.Context) (*PlaybackState, error) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	playlist, err := uc.cacheRepo.GetPlaylist(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrGetPlaylistFromCache, err)
 	}
-	return playlist, nil
+
+	state := &PlaybackState{
+		Playing:      uc.playing,
+		Paused:       uc.paused,
+		Position:     uc.position,
+		PlaylistID:   playlist.ID,
+		PlaylistName: playlist.Name,
+	}
+
+	current := playlist.GetCurrent()
+	for node := playlist.GetHead(); node != nil; node = node.Next {
+		if node.Song == nil {
+			continue
+		}
+		state.Total++
+		if node == current {
+			state.Index = state.Total
+			state.Song = node.Song
+		}
+	}
+
+	return state, nil
 }
 
 /*
@@ -286,7 +844,8 @@ func (uc *PlaylistUseCase) playCurrentSong() {
 
 	for {
 		uc.mu.Lock()
-		playlist, err := uc.cacheRepo.GetPlaylist()
+		lifecycle := uc.lifecycle
+		playlist, err := uc.cacheRepo.GetPlaylist(lifecycle)
 		if err != nil {
 			operationLogger.Error("Failed to get playlist", slog.String("error", err.Error()))
 			uc.playing = false
@@ -295,6 +854,10 @@ func (uc *PlaylistUseCase) playCurrentSong() {
 		}
 
 		current := playlist.GetCurrent()
+		var songID int
+		if current != nil && current.Song != nil {
+			songID = current.Song.ID
+		}
 		position := uc.position
 		playing := uc.playing
 		stopChan := uc.stopChan
@@ -324,6 +887,7 @@ func (uc *PlaylistUseCase) playCurrentSong() {
 					uc.mu.Unlock()
 					return
 				}
+				uc.notifyTransition(Transition{Reason: TransitionAuto, From: current.Song, To: current.Next.Song})
 				uc.position = 0
 				uc.mu.Unlock()
 				continue
@@ -359,7 +923,7 @@ func (uc *PlaylistUseCase) playCurrentSong() {
 					ticker.Stop()
 					return
 				}
-				uc.position = elapsed
+				uc.position = position + time.Since(startTime)
 				uc.mu.Unlock()
 
 			case <-stopChan:
@@ -370,7 +934,21 @@ func (uc *PlaylistUseCase) playCurrentSong() {
 					slog.String("op", op),
 				)
 				uc.mu.Lock()
-				uc.playing = false
+				if uc.stopChan == stopChan { // Next/Prev have already started a new playback
+					uc.playing = false
+				}
+				uc.mu.Unlock()
+				return
+
+			case <-lifecycle.Done():
+				ticker.Stop()
+				operationLogger.Debug("Playback stopped by shutdown", slog.String("title", current.Song.Title))
+				uc.mu.Lock()
+				if uc.stopChan == stopChan {
+					uc.playing = false
+					uc.playingAtStop = true                        // the next leader resumes playback
+					uc.position = position + time.Since(startTime) // saved by Shutdown
+				}
 				uc.mu.Unlock()
 				return
 			}
@@ -378,7 +956,13 @@ func (uc *PlaylistUseCase) playCurrentSong() {
 
 		ticker.Stop()
 
+		// the song has been played, so its play is recorded even if shutdown has begun meanwhile
+		recorded := uc.recordPlay(context.WithoutCancel(lifecycle), songID)
+
 		uc.mu.Lock()
+		if recorded {
+			uc.notifyLibraryChange()
+		}
 		if current.Next != nil {
 			if err := playlist.SetCurrent(current.Next); err != nil {
 				operationLogger.Error("Failed to set current song", slog.String("error", err.Error()))
@@ -386,20 +970,23 @@ func (uc *PlaylistUseCase) playCurrentSong() {
 				uc.mu.Unlock()
 				return
 			}
+			uc.notifyTransition(Transition{Reason: TransitionAuto, From: current.Song, To: current.Next.Song})
 			uc.position = 0
 			uc.mu.Unlock()
 		} else {
 			operationLogger.Debug("No next song. Playback completed.")
-			uc.mu.Unlock()
 			uc.playing = false
+			uc.mu.Unlock()
 			return
 		}
 	}
 }
 
-func (uc *PlaylistUseCase) AddSong(title, artist string, duration time.Duration) error {
+func (uc *PlaylistUseCase) AddSong(ctx context.Context, title, artist string, duration time.Duration) (*entity.Song, error) {
 	const op = "usecase.SongUseCase.AddSong"
-	operationLogger := uc.logger.With(slog.String("op", op))
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
 
 	operationLogger.Debug("Adding new song",
 		slog.String("title", title),
@@ -416,30 +1003,282 @@ func (uc *PlaylistUseCase) AddSong(title, artist string, duration time.Duration)
 		Duration: duration,
 	}
 
-	if err := uc.rdbmsRepo.AddSong(song); err != nil {
-		operationLogger.Error("Failed to add song to DB",
-			slog.String("title", title),
-			slog.String("artist", artist),
-			slog.Duration("duration", duration),
-			slog.String("error", err.Error()),
+	var version int
+	if playlist, err := uc.cacheRepo.GetPlaylist(ctx); err == nil {
+		version = playlist.Version
+	}
+	// a detached playlist, e.g. a smart one, is not the default playlist in DB the song is appended to
+	detached := !uc.persistCurrent
+
+	uow := uc.newUnitOfWork(ctx, operationLogger)
+	uow.DB(ErrAddSongToDB,
+		func(repo repository.PlaylistRepository) error { return repo.AddSong(ctx, song) },
+		func(repo repository.PlaylistRepository) error {
+			editor, ok := repo.(repository.SongEditor)
+			if !ok {
+				return ErrSongEditUnsupported
+			}
+			return editor.DeleteSong(ctx, song.ID, 0)
+		},
+	)
+	if !detached {
+		uow.Cache(ErrAddSongToCache,
+			func() error { return uc.cacheRepo.AddSong(ctx, song) },
+			nil,
 		)
-		return fmt.Errorf("%w: %v", ErrAddSongToDB, err)
 	}
-
-	if err := uc.cacheRepo.AddSong(song); err != nil {
-		operationLogger.Error("Failed to add song to Cache",
+	if err := uow.Commit(); err != nil {
+		operationLogger.Error("Failed to add song",
 			slog.String("title", title),
 			slog.String("artist", artist),
 			slog.Duration("duration", duration),
 			slog.String("error", err.Error()),
 		)
-		return fmt.Errorf("%w: %v", ErrAddSongToCache, err)
+		return nil, err
 	}
+	if playlist, err := uc.cacheRepo.GetPlaylist(ctx); err == nil && !detached {
+		uc.touchPlaylist(playlist, version)
+	}
+
+	uc.notifyLibraryChange()
 
 	operationLogger.Debug("Song added successfully",
 		slog.String("title", title),
 		slog.String("artist", artist),
 	)
 
+	return song, nil
+}
+
+/*
+UpdateSong changes song metadata in DB and in the loaded playlist.
+Empty title or artist and zero duration keep the current values.
+ifMatch lists the song versions the client expects, any version is accepted if it is empty
+*/
+func (uc *PlaylistUseCase) UpdateSong(ctx context.Context, id int, title, artist string, duration time.Duration, ifMatch []int) (*entity.Song, error) {
+	const op = "usecase.PlaylistUseCase.UpdateSong"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op), slog.Int("song_id", id))
+	ctx, span := tracing.Start(ctx, op, tracing.SongID(id))
+	defer span.End()
+
+	if duration < 0 {
+		return nil, fmt.Errorf("%w: duration must be positive", ErrInvalidSong)
+	}
+
+	editor, ok := uc.rdbmsRepo.(repository.SongEditor)
+	if !ok {
+		operationLogger.Error("Repository does not support song editing")
+		return nil, ErrSongEditUnsupported
+	}
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	song, err := editor.GetSongByID(ctx, id)
+	if err != nil {
+		return nil, wrapSongErr(operationLogger, err, ErrUpdateSongNotFound, ErrUpdateSong)
+	}
+
+	if title != "" {
+		song.Title = title
+	}
+	if artist != "" {
+		song.Artist = artist
+	}
+	if duration > 0 {
+		song.Duration = duration
+	}
+
+	if song.Version, err = checkVersion(operationLogger, song.Version, ifMatch); err != nil {
+		return nil, err
+	}
+	if err := editor.UpdateSong(ctx, song); err != nil {
+		return nil, wrapSongErr(operationLogger, err, ErrUpdateSongNotFound, ErrUpdateSong)
+	}
+
+	if playlist, err := uc.cacheRepo.GetPlaylist(ctx); err == nil {
+		version, found := playlist.Version, false
+		for node := playlist.GetHead(); node != nil; node = node.Next {
+			if node.Song != nil && node.Song.ID == id {
+				updated := *node.Song
+				updated.Title, updated.Artist, updated.Duration = song.Title, song.Artist, song.Duration
+				updated.Version = song.Version
+				node.Song = &updated
+				found = true
+			}
+		}
+		if found {
+			uc.touchPlaylist(playlist, version)
+		}
+	}
+
+	uc.notifyLibraryChange()
+
+	operationLogger.Debug("Song updated")
+	return song, nil
+}
+
+/*
+DeleteSong removes song from library. The current song of the loaded playlist can not be removed.
+ifMatch lists the song versions the client expects, any version is accepted if it is empty
+*/
+func (uc *PlaylistUseCase) DeleteSong(ctx context.Context, id int, ifMatch []int) error {
+	const op = "usecase.PlaylistUseCase.DeleteSong"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op), slog.Int("song_id", id))
+	ctx, span := tracing.Start(ctx, op, tracing.SongID(id))
+	defer span.End()
+
+	editor, ok := uc.rdbmsRepo.(repository.SongEditor)
+	if !ok {
+		operationLogger.Error("Repository does not support song editing")
+		return ErrSongEditUnsupported
+	}
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	playlist, err := uc.cacheRepo.GetPlaylist(ctx)
+	if err != nil {
+		operationLogger.Error("Failed to get playlist from Cache", slog.String("error", err.Error()))
+		return fmt.Errorf("%w: %v", ErrGetPlaylistFromCache, err)
+	}
+
+	if current := playlist.GetCurrent(); current != nil && current.Song != nil && current.Song.ID == id {
+		operationLogger.Warn("Attempt to delete current song")
+		return ErrCannotDeleteCurrentSong
+	}
+
+	var version int
+	if len(ifMatch) > 0 {
+		song, err := editor.GetSongByID(ctx, id)
+		if err != nil {
+			return wrapSongErr(operationLogger, err, ErrDeleteSongNotFound, ErrDeleteSong)
+		}
+		if version, err = checkVersion(operationLogger, song.Version, ifMatch); err != nil {
+			return err
+		}
+	}
+
+	songIDs, _ := playlistSongIDs(playlist)
+	playlistVersion := playlist.Version
+
+	if err := editor.DeleteSong(ctx, id, version); err != nil {
+		return wrapSongErr(operationLogger, err, ErrDeleteSongNotFound, ErrDeleteSong)
+	}
+
+	if err := playlist.RemoveSong(id); err != nil && !errors.Is(err, entity.ErrSongNotFound) {
+		operationLogger.Error("Failed to remove song from Cache", slog.String("error", err.Error()))
+	}
+	if slices.Contains(songIDs, id) {
+		uc.touchPlaylist(playlist, playlistVersion)
+	}
+
+	uc.notifyLibraryChange()
+
+	operationLogger.Debug("Song deleted")
+	return nil
+}
+
+func wrapSongErr(operationLogger *slog.Logger, err, notFound, failed error) error {
+	if errors.Is(err, repository.ErrSongNotFound) {
+		operationLogger.Warn("Song not found")
+		return notFound
+	}
+	if errors.Is(err, repository.ErrVersionMismatch) {
+		operationLogger.Warn("Song changed meanwhile")
+		return fmt.Errorf("%w: %v", ErrVersionConflict, err)
+	}
+	operationLogger.Error("Song operation failed", slog.String("error", err.Error()))
+	return fmt.Errorf("%w: %v", failed, err)
+}
+
+/*
+LoadPlaylist replaces the playlist in cache and stops current playback.
+When persist is false current song changes are not written to DB,
+which is used for playlists that do not exist there (e.g. smart playlists).
+Followers keep the playlist of the leader and fail with ErrNotLeader
+*/
+func (uc *PlaylistUseCase) LoadPlaylist(ctx context.Context, playlist *entity.Playlist, persist bool) error {
+	const op = "usecase.PlaylistUseCase.LoadPlaylist"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	if !uc.leading {
+		operationLogger.Warn("LoadPlaylist called on a follower")
+		return ErrNotLeader
+	}
+
+	// playback changes the loaded playlist under uc.mu, the caller keeps reading its own one
+	return uc.loadPlaylist(ctx, operationLogger, playlist.Clone(), persist)
+}
+
+/*
+ReloadPlaylist loads the default playlist from DB back into cache
+*/
+func (uc *PlaylistUseCase) ReloadPlaylist(ctx context.Context) error {
+	const op = "usecase.PlaylistUseCase.ReloadPlaylist"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	playlist, err := uc.rdbmsRepo.GetPlaylist(ctx)
+	if err != nil {
+		operationLogger.Error("Failed to get playlist from DB", slog.String("error", err.Error()))
+		return fmt.Errorf("%w: %v", ErrGetPlaylistFromDB, err)
+	}
+
+	return uc.loadPlaylist(ctx, operationLogger, playlist, true)
+}
+
+func (uc *PlaylistUseCase) loadPlaylist(ctx context.Context, operationLogger *slog.Logger, playlist *entity.Playlist, persist bool) error {
+	loader, ok := uc.cacheRepo.(repository.PlaylistLoader)
+	if !ok {
+		operationLogger.Error("Cache does not support playlist loading")
+		return ErrLoadPlaylistUnsupported
+	}
+
+	uc.playing = false
+	uc.paused = false
+	uc.position = 0
+
+	select {
+	case uc.stopChan <- struct{}{}:
+	default:
+	}
+
+	if err := loader.LoadPlaylist(ctx, playlist); err != nil {
+		operationLogger.Error("Failed to load playlist into Cache", slog.String("error", err.Error()))
+		return fmt.Errorf("%w: %v", ErrLoadPlaylist, err)
+	}
+	uc.persistCurrent = persist
+
+	operationLogger.Debug("Playlist loaded into Cache", slog.Bool("persist_current", persist))
 	return nil
 }
+
+/*
+recordPlay stores the fact that the song was played till the end and tells whether listeners are to be notified.
+It is called without the lock, so a slow DB does not hold up API calls and the checkpointer
+*/
+func (uc *PlaylistUseCase) recordPlay(ctx context.Context, songID int) bool {
+	const op = "usecase.PlaylistUseCase.recordPlay"
+
+	if recorder, ok := uc.rdbmsRepo.(repository.PlayCountRecorder); ok {
+		if err := recorder.IncrementPlayCount(ctx, songID); err != nil {
+			uc.logger.Error("Failed to record play",
+				slog.String("op", op),
+				slog.Int("song_id", songID),
+				slog.String("error", err.Error()),
+			)
+			return false
+		}
+	}
+	return true
+}
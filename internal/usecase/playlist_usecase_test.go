@@ -1,14 +1,18 @@
 package usecase
 
 import (
+	"context"
 	"log/slog"
 	"testing"
 	"time"
 
 	"cloud-go-testtask/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPlayCurrentSongUnderLoad(t *testing.T) {
+	ctx := context.Background()
 	rdbmsRepo := NewMockPlaylistRepo()
 	cacheRepo := NewMockPlaylistRepo()
 
@@ -23,27 +27,27 @@ func TestPlayCurrentSongUnderLoad(t *testing.T) {
 	}
 
 	for _, s := range songs {
-		if err := rdbmsRepo.AddSong(s); err != nil {
+		if err := rdbmsRepo.AddSong(ctx, s); err != nil {
 			t.Fatalf("failed to add song to rdbms: %v", err)
 		}
 	}
 
 	for _, s := range songs {
-		if err := cacheRepo.AddSong(s); err != nil {
+		if err := cacheRepo.AddSong(ctx, s); err != nil {
 			t.Fatalf("Failed to add song to cache: %v", err)
 		}
 	}
 
-	pl, _ := cacheRepo.GetPlaylist()
-	if err := cacheRepo.SetCurrent(pl.GetHead()); err != nil {
+	pl, _ := cacheRepo.GetPlaylist(ctx)
+	if err := cacheRepo.SetCurrent(ctx, pl.GetHead()); err != nil {
 		t.Fatalf("failed to set current in cache: %v", err)
 	}
-	if err := rdbmsRepo.SetCurrent(pl.GetHead()); err != nil {
+	if err := rdbmsRepo.SetCurrent(ctx, pl.GetHead()); err != nil {
 		t.Fatalf("failed to set current in rdbms: %v", err)
 	}
 
 	// Запустим воспроизведение
-	if err := uc.Play(); err != nil {
+	if err := uc.Play(ctx); err != nil {
 		t.Fatalf("failed to start play: %v", err)
 	}
 
@@ -57,11 +61,11 @@ func TestPlayCurrentSongUnderLoad(t *testing.T) {
 			for j := 0; j < iterations; j++ {
 				switch j % 3 {
 				case 0:
-					uc.Pause()
+					uc.Pause(ctx)
 				case 1:
-					uc.Next()
+					uc.Next(ctx)
 				case 2:
-					uc.Prev()
+					uc.Prev(ctx)
 				}
 
 				time.Sleep(100 * time.Millisecond)
@@ -76,9 +80,282 @@ func TestPlayCurrentSongUnderLoad(t *testing.T) {
 
 	time.Sleep(2 * time.Second)
 
-	if _, err := uc.GetCurrentSong(); err != nil {
+	if _, err := uc.GetCurrentSong(ctx); err != nil {
 		t.Logf("Could not get current song at the end: %v", err)
 	}
 
 	t.Log("Load test completed successfully")
 }
+
+func newLoadedPlaylistUseCase(t *testing.T, songs ...*entity.Song) (*PlaylistUseCase, *MockPlaylistRepo) {
+	ctx := context.Background()
+	rdbmsRepo := NewMockPlaylistRepo()
+	cacheRepo := NewMockPlaylistRepo()
+	for _, s := range songs {
+		require.NoError(t, rdbmsRepo.AddSong(ctx, s))
+	}
+
+	uc := NewPlaylistUseCase(rdbmsRepo, cacheRepo, slog.Default())
+	require.NoError(t, uc.InitCache(ctx))
+	return uc, rdbmsRepo
+}
+
+func TestUpdateSong(t *testing.T) {
+	ctx := context.Background()
+	uc, rdbmsRepo := newLoadedPlaylistUseCase(t,
+		&entity.Song{ID: 1, Title: "Song1", Artist: "Artist1", Duration: 5 * time.Second},
+		&entity.Song{ID: 2, Title: "Song2", Artist: "Artist2", Duration: 5 * time.Second},
+	)
+
+	song, err := uc.UpdateSong(ctx, 2, "Renamed", "", 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", song.Title)
+	assert.Equal(t, "Artist2", song.Artist, "empty fields keep their values")
+	assert.Equal(t, 5*time.Second, song.Duration)
+
+	stored, err := rdbmsRepo.GetSongByID(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", stored.Title)
+
+	playlist, err := uc.GetPlaylist(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", playlist.GetTail().Song.Title, "cached playlist is updated")
+
+	_, err = uc.UpdateSong(ctx, 3, "Missing", "", 0, nil)
+	assert.ErrorIs(t, err, ErrUpdateSongNotFound)
+
+	_, err = uc.UpdateSong(ctx, 1, "", "", -time.Second, nil)
+	assert.ErrorIs(t, err, ErrInvalidSong)
+}
+
+func TestDeleteSong(t *testing.T) {
+	ctx := context.Background()
+	uc, _ := newLoadedPlaylistUseCase(t,
+		&entity.Song{ID: 1, Title: "Song1", Artist: "Artist1", Duration: 5 * time.Second},
+		&entity.Song{ID: 2, Title: "Song2", Artist: "Artist2", Duration: 5 * time.Second},
+	)
+
+	assert.ErrorIs(t, uc.DeleteSong(ctx, 1, nil), ErrCannotDeleteCurrentSong)
+	require.NoError(t, uc.DeleteSong(ctx, 2, nil))
+	assert.ErrorIs(t, uc.DeleteSong(ctx, 2, nil), ErrDeleteSongNotFound)
+
+	state, err := uc.State(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, state.Total)
+}
+
+func TestState(t *testing.T) {
+	ctx := context.Background()
+	uc, _ := newLoadedPlaylistUseCase(t,
+		&entity.Song{ID: 1, Title: "Song1", Artist: "Artist1", Duration: 5 * time.Second},
+		&entity.Song{ID: 2, Title: "Song2", Artist: "Artist2", Duration: 5 * time.Second},
+	)
+
+	state, err := uc.State(ctx)
+	require.NoError(t, err)
+	assert.False(t, state.Playing)
+	assert.Equal(t, 1, state.Index)
+	assert.Equal(t, 2, state.Total)
+	assert.Equal(t, 1, state.Song.ID)
+
+	require.NoError(t, uc.Next(ctx))
+	require.NoError(t, uc.Pause(ctx))
+
+	state, err = uc.State(ctx)
+	require.NoError(t, err)
+	assert.True(t, state.Paused)
+	assert.Equal(t, 2, state.Index)
+}
+
+func TestNextKeepsPlaying(t *testing.T) {
+	ctx := context.Background()
+	uc, _ := newLoadedPlaylistUseCase(t,
+		&entity.Song{ID: 1, Title: "Song1", Artist: "Artist1", Duration: 5 * time.Second},
+		&entity.Song{ID: 2, Title: "Song2", Artist: "Artist2", Duration: 5 * time.Second},
+	)
+
+	require.NoError(t, uc.Play(ctx))
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, uc.Next(ctx))
+	time.Sleep(100 * time.Millisecond)
+
+	state, err := uc.State(ctx)
+	require.NoError(t, err)
+	assert.True(t, state.Playing, "stopping the previous song must not stop the new one")
+	assert.Equal(t, 2, state.Song.ID)
+	require.NoError(t, uc.Pause(ctx))
+}
+
+func TestPlaybackLifecycle(t *testing.T) {
+	ctx := context.Background()
+	uc, _ := newLoadedPlaylistUseCase(t,
+		&entity.Song{ID: 1, Title: "Song1", Artist: "Artist1", Duration: 5 * time.Second},
+	)
+
+	lifecycle, stop := context.WithCancel(ctx)
+	uc.SetLifecycle(lifecycle)
+
+	require.NoError(t, uc.Play(ctx))
+	time.Sleep(100 * time.Millisecond)
+	stop()
+
+	assert.Eventually(t, func() bool {
+		state, err := uc.State(ctx)
+		return err == nil && !state.Playing
+	}, time.Second, 10*time.Millisecond, "playback stops with the lifecycle")
+	assert.ErrorIs(t, uc.Play(ctx), ErrPlaybackStopped)
+}
+
+func TestShutdownSavesCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	uc, rdbmsRepo := newLoadedPlaylistUseCase(t,
+		&entity.Song{ID: 1, Title: "Song1", Artist: "Artist1", Duration: 5 * time.Second},
+		&entity.Song{ID: 2, Title: "Song2", Artist: "Artist2", Duration: 5 * time.Second},
+	)
+
+	require.NoError(t, uc.Next(ctx))
+	require.NoError(t, uc.Seek(ctx, 2*time.Second))
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, uc.Shutdown(ctx))
+	assert.ErrorIs(t, uc.Play(ctx), ErrPlaybackStopped)
+
+	checkpoint, err := rdbmsRepo.LoadCheckpoint(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, checkpoint.SongID)
+	assert.GreaterOrEqual(t, checkpoint.Position, 2*time.Second+100*time.Millisecond, "position is taken at the moment playback stops")
+
+	restarted := NewPlaylistUseCase(rdbmsRepo, NewMockPlaylistRepo(), slog.Default())
+	require.NoError(t, restarted.InitCache(ctx))
+	state, err := restarted.State(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, state.Song.ID)
+	assert.Equal(t, checkpoint.Position, state.Position)
+}
+
+func TestFailover(t *testing.T) {
+	ctx := context.Background()
+	leader, rdbmsRepo := newLoadedPlaylistUseCase(t,
+		&entity.Song{ID: 1, Title: "Song1", Artist: "Artist1", Duration: 5 * time.Second},
+		&entity.Song{ID: 2, Title: "Song2", Artist: "Artist2", Duration: 5 * time.Second},
+	)
+	follower := NewPlaylistUseCase(rdbmsRepo, NewMockPlaylistRepo(), slog.Default())
+	require.NoError(t, follower.InitCache(ctx))
+	follower.Follow(ctx)
+	assert.False(t, follower.Leading())
+	assert.ErrorIs(t, follower.Play(ctx), ErrNotLeader)
+	assert.ErrorIs(t, follower.Next(ctx), ErrNotLeader)
+
+	require.NoError(t, leader.Next(ctx))
+	require.NoError(t, leader.Seek(ctx, 2*time.Second))
+	checkpoints, stopCheckpoints := context.WithCancel(ctx)
+	defer stopCheckpoints()
+	go leader.RunCheckpointer(checkpoints, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		checkpoint, err := rdbmsRepo.LoadCheckpoint(ctx)
+		return err == nil && checkpoint.SongID == 2 && checkpoint.Position >= 2*time.Second && checkpoint.Playing
+	}, time.Second, 10*time.Millisecond, "the leader checkpoints while playing")
+
+	// the leader loses its lock, e.g. its DB connection breaks, and stops without a checkpoint
+	stopCheckpoints()
+	leader.Follow(ctx)
+	saved, err := rdbmsRepo.LoadCheckpoint(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, follower.Lead(ctx))
+	assert.True(t, follower.Leading())
+	state, err := follower.State(ctx)
+	require.NoError(t, err)
+	assert.True(t, state.Playing, "playback resumes on the new leader")
+	assert.Equal(t, 2, state.Song.ID)
+	assert.GreaterOrEqual(t, state.Position, saved.Position)
+
+	require.NoError(t, leader.Shutdown(ctx))
+	checkpoint, err := rdbmsRepo.LoadCheckpoint(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, saved, checkpoint, "the former leader does not overwrite the checkpoint")
+	require.NoError(t, follower.Shutdown(ctx))
+}
+
+func TestMoveSong(t *testing.T) {
+	ctx := context.Background()
+	uc, rdbmsRepo := newLoadedPlaylistUseCase(t,
+		&entity.Song{ID: 1, Title: "Song1", Artist: "Artist1", Duration: 5 * time.Second},
+		&entity.Song{ID: 2, Title: "Song2", Artist: "Artist2", Duration: 5 * time.Second},
+		&entity.Song{ID: 3, Title: "Song3", Artist: "Artist3", Duration: 5 * time.Second},
+	)
+	playlist, err := uc.cacheRepo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	playlist.ID = 1
+
+	require.NoError(t, uc.MoveSong(ctx, 3, 1, nil))
+	assert.Equal(t, []int{3, 1, 2}, rdbmsRepo.Order)
+
+	state, err := uc.State(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, state.Song.ID, "current song is kept")
+	assert.Equal(t, 2, state.Index)
+
+	assert.ErrorIs(t, uc.MoveSong(ctx, 1, 4, nil), ErrInvalidPosition)
+
+	rdbmsRepo.OrderErr = assert.AnError
+	assert.ErrorIs(t, uc.MoveSong(ctx, 1, 2, nil), ErrReorderPlaylist)
+	assert.Equal(t, 3, playlist.GetHead().Song.ID, "cache order is restored when DB fails")
+}
+
+func TestVersionConflict(t *testing.T) {
+	ctx := context.Background()
+	uc, _ := newLoadedPlaylistUseCase(t,
+		&entity.Song{ID: 1, Title: "Song1", Artist: "Artist1", Duration: 5 * time.Second, Version: 1},
+		&entity.Song{ID: 2, Title: "Song2", Artist: "Artist2", Duration: 5 * time.Second, Version: 1},
+		&entity.Song{ID: 3, Title: "Song3", Artist: "Artist3", Duration: 5 * time.Second, Version: 1},
+	)
+	playlist, err := uc.cacheRepo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	playlist.ID, playlist.Version = 1, 1
+
+	_, err = uc.UpdateSong(ctx, 2, "Renamed", "", 0, []int{2})
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	song, err := uc.UpdateSong(ctx, 2, "Renamed", "", 0, []int{1, 5})
+	require.NoError(t, err)
+	assert.Equal(t, 2, song.Version)
+	assert.Equal(t, 2, playlist.GetHead().Next.Song.Version, "cached song follows the new version")
+	assert.Equal(t, 2, playlist.Version, "playlist holding the song is bumped")
+
+	_, err = uc.UpdateSong(ctx, 2, "Lost update", "", 0, []int{1})
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	assert.Equal(t, "Renamed", playlist.GetHead().Next.Song.Title)
+
+	assert.ErrorIs(t, uc.DeleteSong(ctx, 2, []int{1}), ErrVersionConflict)
+	require.NoError(t, uc.DeleteSong(ctx, 2, []int{2}))
+	assert.Equal(t, 3, playlist.Version)
+
+	assert.ErrorIs(t, uc.MoveSong(ctx, 2, 1, []int{2}), ErrVersionConflict)
+	assert.Equal(t, 1, playlist.GetHead().Song.ID, "order is kept on conflict")
+	require.NoError(t, uc.MoveSong(ctx, 2, 1, []int{3}))
+	assert.Equal(t, 3, playlist.GetHead().Song.ID)
+	assert.Equal(t, 4, playlist.Version)
+}
+
+func TestSeek(t *testing.T) {
+	ctx := context.Background()
+	uc, _ := newLoadedPlaylistUseCase(t,
+		&entity.Song{ID: 1, Title: "Song1", Artist: "Artist1", Duration: 5 * time.Second},
+	)
+
+	require.NoError(t, uc.Seek(ctx, 3*time.Second))
+	state, err := uc.State(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3*time.Second, state.Position)
+
+	assert.ErrorIs(t, uc.Seek(ctx, 5*time.Second), ErrInvalidSeek)
+	assert.ErrorIs(t, uc.Seek(ctx, -time.Second), ErrInvalidSeek)
+
+	require.NoError(t, uc.Play(ctx))
+	time.Sleep(1200 * time.Millisecond)
+	state, err = uc.State(ctx)
+	require.NoError(t, err)
+	assert.True(t, state.Playing)
+	assert.GreaterOrEqual(t, state.Position, 4*time.Second, "playback continues from the seek position")
+	require.NoError(t, uc.Pause(ctx))
+}
@@ -0,0 +1,380 @@
+package usecase
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/logging"
+	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/tracing"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+/*
+Consistency is the difference between the cached playlist and the one stored in DB
+*/
+type Consistency struct {
+	Detached       bool  // a playlist which is not stored in DB (e.g. smart one) is loaded, nothing is compared
+	CacheSongs     int   // songs in the cached playlist
+	DBSongs        int   // songs in the playlist in DB
+	MissingInDB    []int // IDs of songs only the cache has
+	MissingInCache []int // IDs of songs only DB has
+	OrderDiffers   bool  // both have the same songs in different order
+	CacheCurrentID int   // 0 if there is no current song
+	DBCurrentID    int
+}
+
+func (c *Consistency) Consistent() bool {
+	return c.Detached || len(c.MissingInDB) == 0 && len(c.MissingInCache) == 0 &&
+		!c.OrderDiffers && c.CacheCurrentID == c.DBCurrentID
+}
+
+/*
+RepairDirection names the side Reconcile takes as the source of truth
+*/
+type RepairDirection string
+
+const (
+	RepairNone  RepairDirection = "none"  // only report the difference
+	RepairCache RepairDirection = "cache" // DB is right, the cache is reloaded from it
+	RepairDB    RepairDirection = "db"    // cache is right, songs, order and current song in DB are rewritten
+)
+
+func ParseRepairDirection(s string) (RepairDirection, error) {
+	switch direction := RepairDirection(s); direction {
+	case "":
+		return RepairNone, nil
+	case RepairNone, RepairCache, RepairDB:
+		return direction, nil
+	}
+	return "", fmt.Errorf("%w: %q, expected none, cache or db", ErrInvalidRepair, s)
+}
+
+/*
+Reconciliation is the outcome of Reconcile. Found is the difference seen before the repair
+*/
+type Reconciliation struct {
+	Found    *Consistency
+	Repaired bool
+}
+
+/*
+CheckConsistency compares the cached playlist with the one in DB. The lock is held meanwhile,
+so no write of the use case gets between the two reads
+*/
+func (uc *PlaylistUseCase) CheckConsistency(ctx context.Context) (*Consistency, error) {
+	const op = "usecase.PlaylistUseCase.CheckConsistency"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	consistency, _, _, err := uc.compare(ctx, operationLogger)
+	return consistency, err
+}
+
+/*
+Reconcile compares the cached playlist with the one in DB and, unless direction is RepairNone,
+makes the other side match the source of truth. The leader's current song is not a difference
+while DB has it, as in Resync, so repairing the cache does not rewind playback.
+Only the leader may repair DB, followers fail with ErrNotLeader: their cache may lag behind
+*/
+func (uc *PlaylistUseCase) Reconcile(ctx context.Context, direction RepairDirection) (*Reconciliation, error) {
+	const op = "usecase.PlaylistUseCase.Reconcile"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op), slog.String("repair", string(direction)))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	if direction == RepairDB && !uc.leading {
+		operationLogger.Warn("DB is repaired only by the leader")
+		return nil, ErrNotLeader
+	}
+
+	found, cached, stored, err := uc.compare(ctx, operationLogger)
+	if err != nil {
+		return nil, err
+	}
+	uc.keepLeaderCurrent(found, stored)
+	result := &Reconciliation{Found: found}
+	if found.Consistent() {
+		operationLogger.Debug("Cache and DB are consistent")
+		return result, nil
+	}
+
+	operationLogger.Warn("Cache and DB diverged",
+		slog.Any("missing_in_db", found.MissingInDB),
+		slog.Any("missing_in_cache", found.MissingInCache),
+		slog.Bool("order_differs", found.OrderDiffers),
+		slog.Int("cache_current_song_id", found.CacheCurrentID),
+		slog.Int("db_current_song_id", found.DBCurrentID),
+	)
+
+	switch direction {
+	case RepairNone:
+		return result, nil
+	case RepairCache:
+		err = uc.repairCache(ctx, operationLogger, found, stored)
+	case RepairDB:
+		err = uc.repairDB(ctx, operationLogger, found, cached, stored)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRepair, direction)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	result.Repaired = true
+	operationLogger.Info("Cache and DB reconciled")
+	return result, nil
+}
+
+/*
+Resync reloads the cache from DB after another instance changed the playlist or its songs.
+Unlike Reconcile it also compares song details, and does nothing when both sides are equal,
+so replaying own changes costs two reads. Playback goes on if the current song is the same.
+The leader keeps its current song while DB has it: songs it moved to on its own reach DB
+with the next checkpoint, followers take the current song from DB
+*/
+func (uc *PlaylistUseCase) Resync(ctx context.Context) (bool, error) {
+	const op = "usecase.PlaylistUseCase.Resync"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	found, cached, stored, err := uc.compare(ctx, operationLogger)
+	if err != nil {
+		return false, err
+	}
+	if found.Detached {
+		return false, nil
+	}
+	uc.keepLeaderCurrent(found, stored)
+	if found.Consistent() && cached.Version == stored.Version && sameSongs(cached, stored) {
+		return false, nil
+	}
+
+	if err := uc.repairCache(ctx, operationLogger, found, stored); err != nil {
+		return false, err
+	}
+	operationLogger.Info("Cache resynced from DB",
+		slog.Int("songs", found.DBSongs),
+		slog.Int("current_song_id", found.DBCurrentID),
+	)
+	return true, nil
+}
+
+/*
+keepLeaderCurrent makes the leader's current song the current one of stored while stored has it:
+songs the leader moved to on its own reach DB with the next checkpoint. Must be called under lock
+*/
+func (uc *PlaylistUseCase) keepLeaderCurrent(found *Consistency, stored *entity.Playlist) {
+	if found.Detached || !uc.leading || found.CacheCurrentID == found.DBCurrentID || found.CacheCurrentID == 0 ||
+		slices.Contains(found.MissingInDB, found.CacheCurrentID) {
+		return
+	}
+	for node := stored.GetHead(); node != nil; node = node.Next {
+		if node.Song != nil && node.Song.ID == found.CacheCurrentID {
+			_ = stored.SetCurrent(node) // the node is in stored
+			found.DBCurrentID = found.CacheCurrentID
+			return
+		}
+	}
+}
+
+/*
+RunReconciler reconciles every interval until ctx is done. Only the leader reconciles, followers
+follow its changes with Resync. Failures are logged and retried on the next tick
+*/
+func (uc *PlaylistUseCase) RunReconciler(ctx context.Context, interval time.Duration, direction RepairDirection) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !uc.Leading() {
+				continue
+			}
+			// errors are logged by Reconcile
+			_, _ = uc.Reconcile(ctx, direction)
+		}
+	}
+}
+
+/*
+compare reads both playlists and the difference between them. Must be called under lock
+*/
+func (uc *PlaylistUseCase) compare(ctx context.Context, operationLogger *slog.Logger) (*Consistency, *entity.Playlist, *entity.Playlist, error) {
+	if !uc.persistCurrent {
+		return &Consistency{Detached: true}, nil, nil, nil
+	}
+
+	cached, err := uc.cacheRepo.GetPlaylist(ctx)
+	if err != nil {
+		operationLogger.Error("Failed to get playlist from cache", slog.String("error", err.Error()))
+		return nil, nil, nil, fmt.Errorf("%w: %v", ErrGetPlaylistFromCache, err)
+	}
+	stored, err := uc.rdbmsRepo.GetPlaylist(ctx)
+	if err != nil {
+		operationLogger.Error("Failed to get playlist from DB", slog.String("error", err.Error()))
+		return nil, nil, nil, fmt.Errorf("%w: %v", ErrGetPlaylistFromDB, err)
+	}
+
+	return comparePlaylists(cached, stored), cached, stored, nil
+}
+
+/*
+repairCache loads the playlist from DB into cache. Playback goes on if the current song is the same,
+otherwise the song DB considers current wins and playback stops as after ReloadPlaylist.
+Must be called under lock
+*/
+func (uc *PlaylistUseCase) repairCache(ctx context.Context, operationLogger *slog.Logger, found *Consistency, stored *entity.Playlist) error {
+	if found.CacheCurrentID != found.DBCurrentID {
+		if err := uc.loadPlaylist(ctx, operationLogger, stored, true); err != nil {
+			return fmt.Errorf("%w: %v", ErrRepairCache, err)
+		}
+		return nil
+	}
+
+	loader, ok := uc.cacheRepo.(repository.PlaylistLoader)
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrRepairCache, ErrLoadPlaylistUnsupported)
+	}
+	if err := loader.LoadPlaylist(ctx, stored); err != nil {
+		operationLogger.Error("Failed to load playlist into Cache", slog.String("error", err.Error()))
+		return fmt.Errorf("%w: %v", ErrRepairCache, err)
+	}
+
+	if uc.playing { // the playback goroutine walks nodes of the replaced list, it resumes on the new one
+		select {
+		case uc.stopChan <- struct{}{}:
+		default:
+		}
+		uc.stopChan = make(chan struct{}, 1)
+		uc.startPlayback()
+	}
+	return nil
+}
+
+/*
+repairDB rewrites the playlist in DB after the cache in one transaction: missing songs are added,
+extra ones removed, then the order and the current song are set. Must be called under lock
+*/
+func (uc *PlaylistUseCase) repairDB(ctx context.Context, operationLogger *slog.Logger, found *Consistency, cached, stored *entity.Playlist) error {
+	order, current := playlistSongIDs(cached)
+
+	uow := uc.newUnitOfWork(ctx, operationLogger)
+	uow.DB(ErrRepairDB, func(repo repository.PlaylistRepository) error {
+		editor, ok := repo.(repository.PlaylistEditor)
+		if !ok {
+			return ErrRepairUnsupported
+		}
+		orderer, ok := repo.(repository.PlaylistOrderer)
+		if !ok {
+			return ErrRepairUnsupported
+		}
+
+		for _, id := range found.MissingInDB {
+			if err := editor.AddSongToPlaylist(ctx, stored.ID, id); err != nil {
+				return fmt.Errorf("song %d: %w", id, err)
+			}
+		}
+		for _, id := range found.MissingInCache {
+			if err := editor.RemoveSongFromPlaylist(ctx, stored.ID, id); err != nil {
+				return fmt.Errorf("song %d: %w", id, err)
+			}
+		}
+		if err := orderer.SetPlaylistOrder(ctx, stored.ID, order, 0); err != nil {
+			return err
+		}
+		if current != 0 {
+			return repo.SetCurrent(ctx, &entity.PlaylistNode{Song: &entity.Song{ID: current}})
+		}
+		return nil
+	}, nil)
+
+	if err := uow.Commit(); err != nil {
+		return err
+	}
+
+	// the rewrite bumped the version in DB as many times as it took statements
+	if repaired, err := uc.rdbmsRepo.GetPlaylist(ctx); err == nil {
+		cached.Version = repaired.Version
+	}
+	return nil
+}
+
+func comparePlaylists(cached, stored *entity.Playlist) *Consistency {
+	cachedIDs, cachedCurrent := playlistSongIDs(cached)
+	storedIDs, storedCurrent := playlistSongIDs(stored)
+
+	c := &Consistency{
+		CacheSongs:     len(cachedIDs),
+		DBSongs:        len(storedIDs),
+		CacheCurrentID: cachedCurrent,
+		DBCurrentID:    storedCurrent,
+	}
+	for _, id := range cachedIDs {
+		if !slices.Contains(storedIDs, id) {
+			c.MissingInDB = append(c.MissingInDB, id)
+		}
+	}
+	for _, id := range storedIDs {
+		if !slices.Contains(cachedIDs, id) {
+			c.MissingInCache = append(c.MissingInCache, id)
+		}
+	}
+	c.OrderDiffers = len(c.MissingInDB) == 0 && len(c.MissingInCache) == 0 && !slices.Equal(cachedIDs, storedIDs)
+	return c
+}
+
+/*
+sameSongs reports whether both playlists hold songs with equal details in the same order.
+Play counts are left out, the cache does not track them
+*/
+func sameSongs(cached, stored *entity.Playlist) bool {
+	a, b := cached.GetHead(), stored.GetHead()
+	for ; a != nil && b != nil; a, b = a.Next, b.Next {
+		if a.Song == nil || b.Song == nil {
+			if a.Song != b.Song {
+				return false
+			}
+			continue
+		}
+		if a.Song.ID != b.Song.ID || a.Song.Title != b.Song.Title || a.Song.Artist != b.Song.Artist ||
+			a.Song.Duration != b.Song.Duration || a.Song.Version != b.Song.Version {
+			return false
+		}
+	}
+	return a == nil && b == nil
+}
+
+/*
+playlistSongIDs returns IDs of the songs of playlist in order and ID of the current one, 0 if none
+*/
+func playlistSongIDs(playlist *entity.Playlist) ([]int, int) {
+	var ids []int
+	current := 0
+	for node := playlist.GetHead(); node != nil; node = node.Next {
+		if node.Song == nil {
+			continue
+		}
+		ids = append(ids, node.Song.ID)
+		if node == playlist.GetCurrent() {
+			current = node.Song.ID
+		}
+	}
+	return ids, current
+}
@@ -0,0 +1,266 @@
+package usecase
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+/*
+newDriftingPlaylistUseCase returns use case with songs 1, 2 loaded and the mock DB detached from the cache:
+mocks share the playlist InitCache loaded, DB gets its own copy to drift from the cache
+*/
+func newDriftingPlaylistUseCase(t *testing.T) (*PlaylistUseCase, *MockPlaylistRepo) {
+	ctx := context.Background()
+	uc, rdbmsRepo := newLoadedPlaylistUseCase(t,
+		&entity.Song{ID: 1, Title: "Song1", Artist: "Artist1", Duration: 5 * time.Second},
+		&entity.Song{ID: 2, Title: "Song2", Artist: "Artist2", Duration: 5 * time.Second},
+	)
+	stored, err := rdbmsRepo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	require.NoError(t, rdbmsRepo.LoadPlaylist(ctx, copyPlaylist(stored)))
+	return uc, rdbmsRepo
+}
+
+func TestCheckConsistency(t *testing.T) {
+	ctx := context.Background()
+	assert.ErrorIs(t, NewPlaylistUseCase(NewMockPlaylistRepo(), NewMockPlaylistRepo(), slog.Default()).CheckCache(ctx), ErrCacheNotInitialized)
+
+	uc, rdbmsRepo := newDriftingPlaylistUseCase(t)
+	require.NoError(t, uc.CheckCache(ctx))
+
+	consistency, err := uc.CheckConsistency(ctx)
+	require.NoError(t, err)
+	assert.True(t, consistency.Consistent())
+	assert.Equal(t, 2, consistency.DBSongs)
+
+	// another writer changes DB behind the use case
+	require.NoError(t, rdbmsRepo.AddSong(ctx, &entity.Song{ID: 3, Title: "Song3", Artist: "Artist3", Duration: 5 * time.Second}))
+	require.NoError(t, rdbmsRepo.SetCurrent(ctx, &entity.PlaylistNode{Song: &entity.Song{ID: 2}}))
+
+	consistency, err = uc.CheckConsistency(ctx)
+	require.NoError(t, err)
+	assert.False(t, consistency.Consistent())
+	assert.Equal(t, []int{3}, consistency.MissingInCache)
+	assert.Empty(t, consistency.MissingInDB)
+	assert.Equal(t, 2, consistency.DBCurrentID)
+	assert.Equal(t, 1, consistency.CacheCurrentID)
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("report only", func(t *testing.T) {
+		uc, rdbmsRepo := newDriftingPlaylistUseCase(t)
+		require.NoError(t, rdbmsRepo.RemoveSongFromPlaylist(ctx, 1, 2))
+
+		result, err := uc.Reconcile(ctx, RepairNone)
+		require.NoError(t, err)
+		assert.False(t, result.Repaired)
+		assert.Equal(t, []int{2}, result.Found.MissingInDB)
+
+		consistency, err := uc.CheckConsistency(ctx)
+		require.NoError(t, err)
+		assert.False(t, consistency.Consistent(), "nothing is repaired")
+	})
+
+	t.Run("cache from DB keeps playback", func(t *testing.T) {
+		uc, rdbmsRepo := newDriftingPlaylistUseCase(t)
+		require.NoError(t, uc.Play(ctx))
+		require.NoError(t, rdbmsRepo.AddSong(ctx, &entity.Song{ID: 3, Title: "Song3", Artist: "Artist3", Duration: 5 * time.Second}))
+
+		result, err := uc.Reconcile(ctx, RepairCache)
+		require.NoError(t, err)
+		assert.True(t, result.Repaired)
+		assert.Equal(t, []int{3}, result.Found.MissingInCache)
+
+		consistency, err := uc.CheckConsistency(ctx)
+		require.NoError(t, err)
+		assert.True(t, consistency.Consistent())
+
+		state, err := uc.State(ctx)
+		require.NoError(t, err)
+		assert.True(t, state.Playing, "the current song is the same, so playback goes on")
+		assert.Equal(t, 3, state.Total)
+		require.NoError(t, uc.Shutdown(ctx))
+	})
+
+	t.Run("DB from cache", func(t *testing.T) {
+		uc, rdbmsRepo := newDriftingPlaylistUseCase(t)
+		require.NoError(t, rdbmsRepo.RemoveSongFromPlaylist(ctx, 1, 2))
+		require.NoError(t, rdbmsRepo.AddSongToPlaylist(ctx, 1, 7))
+		require.NoError(t, rdbmsRepo.SetCurrent(ctx, &entity.PlaylistNode{Song: &entity.Song{ID: 7}}))
+
+		result, err := uc.Reconcile(ctx, RepairDB)
+		require.NoError(t, err)
+		assert.True(t, result.Repaired)
+		assert.Equal(t, 1, rdbmsRepo.Commits, "DB is rewritten in one transaction")
+		assert.Equal(t, []int{1, 2}, rdbmsRepo.Order)
+
+		consistency, err := uc.CheckConsistency(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, consistency.MissingInDB)
+		assert.Empty(t, consistency.MissingInCache)
+		assert.Equal(t, 1, consistency.DBCurrentID)
+	})
+
+	t.Run("failed DB repair is rolled back", func(t *testing.T) {
+		uc, rdbmsRepo := newDriftingPlaylistUseCase(t)
+		require.NoError(t, rdbmsRepo.RemoveSongFromPlaylist(ctx, 1, 2))
+		rdbmsRepo.Fail = func(method string) error {
+			if method == "AddSongToPlaylist" {
+				return errors.New("song is not in library")
+			}
+			return nil
+		}
+
+		result, err := uc.Reconcile(ctx, RepairDB)
+		assert.ErrorIs(t, err, ErrRepairDB)
+		assert.False(t, result.Repaired)
+		assert.Equal(t, 1, rdbmsRepo.Rollbacks)
+	})
+
+	t.Run("cache from DB keeps the leader's current song", func(t *testing.T) {
+		uc, rdbmsRepo := newDriftingPlaylistUseCase(t)
+		require.NoError(t, uc.Play(ctx))
+		require.NoError(t, uc.Seek(ctx, 2*time.Second))
+		// DB lags behind the leader until the next checkpoint
+		require.NoError(t, rdbmsRepo.SetCurrent(ctx, &entity.PlaylistNode{Song: &entity.Song{ID: 2}}))
+		require.NoError(t, rdbmsRepo.AddSong(ctx, &entity.Song{ID: 3, Title: "Song3", Artist: "Artist3", Duration: 5 * time.Second}))
+
+		result, err := uc.Reconcile(ctx, RepairCache)
+		require.NoError(t, err)
+		assert.True(t, result.Repaired)
+		assert.Equal(t, 1, result.Found.DBCurrentID)
+
+		state, err := uc.State(ctx)
+		require.NoError(t, err)
+		assert.True(t, state.Playing, "playback is not stopped")
+		assert.Equal(t, 1, state.Song.ID)
+		assert.GreaterOrEqual(t, state.Position, 2*time.Second, "playback is not rewound")
+		assert.Equal(t, 3, state.Total)
+		require.NoError(t, uc.Shutdown(ctx))
+	})
+
+	t.Run("follower does not repair DB", func(t *testing.T) {
+		uc, rdbmsRepo := newDriftingPlaylistUseCase(t)
+		uc.Follow(ctx)
+		require.NoError(t, rdbmsRepo.AddSong(ctx, &entity.Song{ID: 3, Title: "Song3", Artist: "Artist3", Duration: 5 * time.Second}))
+
+		_, err := uc.Reconcile(ctx, RepairDB)
+		assert.ErrorIs(t, err, ErrNotLeader)
+		assert.Zero(t, rdbmsRepo.Commits)
+
+		result, err := uc.Reconcile(ctx, RepairNone)
+		require.NoError(t, err)
+		assert.Equal(t, []int{3}, result.Found.MissingInCache)
+	})
+
+	_, err := ParseRepairDirection("both")
+	assert.ErrorIs(t, err, ErrInvalidRepair)
+}
+
+func TestRunReconcilerOnlyOnLeader(t *testing.T) {
+	ctx := context.Background()
+	uc, rdbmsRepo := newDriftingPlaylistUseCase(t)
+	uc.Follow(ctx)
+	require.NoError(t, rdbmsRepo.AddSong(ctx, &entity.Song{ID: 3, Title: "Song3", Artist: "Artist3", Duration: 5 * time.Second}))
+
+	reconciler, stop := context.WithCancel(ctx)
+	defer stop()
+	go uc.RunReconciler(reconciler, 10*time.Millisecond, RepairCache)
+
+	time.Sleep(50 * time.Millisecond)
+	consistency, err := uc.CheckConsistency(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3}, consistency.MissingInCache, "followers leave the cache to Resync")
+
+	require.NoError(t, uc.Lead(ctx))
+	require.Eventually(t, func() bool {
+		consistency, err := uc.CheckConsistency(ctx)
+		return err == nil && consistency.Consistent()
+	}, time.Second, 10*time.Millisecond, "the leader reconciles")
+	require.NoError(t, uc.Shutdown(ctx))
+}
+
+func TestResync(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("nothing changed", func(t *testing.T) {
+		uc, _ := newDriftingPlaylistUseCase(t)
+
+		resynced, err := uc.Resync(ctx)
+		require.NoError(t, err)
+		assert.False(t, resynced)
+	})
+
+	t.Run("song details changed by another instance", func(t *testing.T) {
+		uc, rdbmsRepo := newDriftingPlaylistUseCase(t)
+		require.NoError(t, uc.Play(ctx))
+
+		// the same songs in the same order, only the title differs
+		stored, err := rdbmsRepo.GetPlaylist(ctx)
+		require.NoError(t, err)
+		edited := &entity.Playlist{ID: stored.ID, Name: stored.Name}
+		for node := stored.GetHead(); node != nil; node = node.Next {
+			song := *node.Song
+			if song.ID == 2 {
+				song.Title = "Renamed"
+			}
+			n := edited.AddToEnd(&song)
+			if node == stored.GetCurrent() {
+				require.NoError(t, edited.SetCurrent(n))
+			}
+		}
+		require.NoError(t, rdbmsRepo.LoadPlaylist(ctx, edited))
+
+		resynced, err := uc.Resync(ctx)
+		require.NoError(t, err)
+		assert.True(t, resynced)
+
+		state, err := uc.State(ctx)
+		require.NoError(t, err)
+		assert.True(t, state.Playing, "the current song is the same, so playback goes on")
+		cached, err := uc.cacheRepo.GetPlaylist(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "Renamed", cached.GetHead().Next.Song.Title)
+		require.NoError(t, uc.Shutdown(ctx))
+	})
+
+	t.Run("follower takes current song from DB", func(t *testing.T) {
+		uc, rdbmsRepo := newDriftingPlaylistUseCase(t)
+		uc.Follow(ctx)
+		require.NoError(t, rdbmsRepo.SetCurrent(ctx, &entity.PlaylistNode{Song: &entity.Song{ID: 2}}))
+
+		resynced, err := uc.Resync(ctx)
+		require.NoError(t, err)
+		assert.True(t, resynced)
+
+		consistency, err := uc.CheckConsistency(ctx)
+		require.NoError(t, err)
+		assert.True(t, consistency.Consistent())
+		assert.Equal(t, 2, consistency.CacheCurrentID)
+	})
+
+	t.Run("leader keeps its current song", func(t *testing.T) {
+		uc, rdbmsRepo := newDriftingPlaylistUseCase(t)
+		require.NoError(t, uc.Play(ctx))
+		// DB lags behind until the next checkpoint, e.g. after the leader has moved to the next song by itself
+		require.NoError(t, rdbmsRepo.SetCurrent(ctx, &entity.PlaylistNode{Song: &entity.Song{ID: 2}}))
+
+		resynced, err := uc.Resync(ctx)
+		require.NoError(t, err)
+		assert.False(t, resynced)
+
+		state, err := uc.State(ctx)
+		require.NoError(t, err)
+		assert.True(t, state.Playing)
+		assert.Equal(t, 1, state.Song.ID)
+		require.NoError(t, uc.Shutdown(ctx))
+	})
+}
@@ -0,0 +1,271 @@
+package usecase
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/logging"
+	"cloud-go-testtask/internal/repository"
+	"cloud-go-testtask/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+/*
+SmartPlaylistUseCase manages rule based playlists and keeps their materialized versions.
+Materialized playlists are dropped whenever the library changes and rebuilt on next access.
+*/
+type SmartPlaylistUseCase struct {
+	mu           sync.Mutex
+	repo         repository.SmartPlaylistRepository
+	playback     *PlaylistUseCase
+	materialized map[int]*entity.Playlist
+
+	now    func() time.Time
+	logger *slog.Logger
+}
+
+func NewSmartPlaylistUseCase(repo repository.SmartPlaylistRepository, playback *PlaylistUseCase, logger *slog.Logger) *SmartPlaylistUseCase {
+	uc := &SmartPlaylistUseCase{
+		repo:         repo,
+		playback:     playback,
+		materialized: make(map[int]*entity.Playlist),
+		now:          time.Now,
+		logger:       logger,
+	}
+
+	if playback != nil {
+		playback.OnLibraryChange(uc.Invalidate)
+	}
+
+	return uc
+}
+
+func (uc *SmartPlaylistUseCase) Create(ctx context.Context, sp *entity.SmartPlaylist) (int, error) {
+	const op = "usecase.SmartPlaylistUseCase.Create"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	if err := uc.validate(sp); err != nil {
+		operationLogger.Warn("Invalid smart playlist", slog.String("error", err.Error()))
+		return 0, err
+	}
+
+	id, err := uc.repo.CreateSmartPlaylist(ctx, sp)
+	if err != nil {
+		operationLogger.Error("Failed to create smart playlist", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%w: %v", ErrSmartPlaylistRepo, err)
+	}
+
+	operationLogger.Debug("Smart playlist created", slog.Int("id", id))
+	return id, nil
+}
+
+func (uc *SmartPlaylistUseCase) Get(ctx context.Context, id int) (*entity.SmartPlaylist, error) {
+	const op = "usecase.SmartPlaylistUseCase.Get"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op, tracing.SmartPlaylistID(id))
+	defer span.End()
+
+	sp, err := uc.repo.GetSmartPlaylistByID(ctx, id)
+	if err != nil {
+		operationLogger.Warn("Failed to get smart playlist", slog.Int("id", id), slog.String("error", err.Error()))
+		return nil, wrapSmartPlaylistErr(err)
+	}
+
+	return sp, nil
+}
+
+func (uc *SmartPlaylistUseCase) List(ctx context.Context) ([]*entity.SmartPlaylist, error) {
+	const op = "usecase.SmartPlaylistUseCase.List"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	playlists, err := uc.repo.ListSmartPlaylists(ctx)
+	if err != nil {
+		operationLogger.Error("Failed to list smart playlists", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%w: %v", ErrSmartPlaylistRepo, err)
+	}
+
+	return playlists, nil
+}
+
+/*
+Update replaces the definition of smart playlist sp.ID and sets sp.Version to the new version.
+With ifMatch it is replaced only if it still has one of these versions
+*/
+func (uc *SmartPlaylistUseCase) Update(ctx context.Context, sp *entity.SmartPlaylist, ifMatch []int) error {
+	const op = "usecase.SmartPlaylistUseCase.Update"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	if err := uc.validate(sp); err != nil {
+		operationLogger.Warn("Invalid smart playlist", slog.String("error", err.Error()))
+		return err
+	}
+
+	version, err := uc.expectedVersion(ctx, operationLogger, sp.ID, ifMatch)
+	if err != nil {
+		return err
+	}
+	sp.Version = version
+
+	if err := uc.repo.UpdateSmartPlaylist(ctx, sp); err != nil {
+		operationLogger.Warn("Failed to update smart playlist", slog.Int("id", sp.ID), slog.String("error", err.Error()))
+		return wrapSmartPlaylistErr(err)
+	}
+
+	uc.forget(sp.ID)
+	return nil
+}
+
+/*
+Delete removes the smart playlist. With ifMatch it is removed only if it still has one of these versions
+*/
+func (uc *SmartPlaylistUseCase) Delete(ctx context.Context, id int, ifMatch []int) error {
+	const op = "usecase.SmartPlaylistUseCase.Delete"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op, tracing.SmartPlaylistID(id))
+	defer span.End()
+
+	version, err := uc.expectedVersion(ctx, operationLogger, id, ifMatch)
+	if err != nil {
+		return err
+	}
+
+	if err := uc.repo.DeleteSmartPlaylistByID(ctx, id, version); err != nil {
+		operationLogger.Warn("Failed to delete smart playlist", slog.Int("id", id), slog.String("error", err.Error()))
+		return wrapSmartPlaylistErr(err)
+	}
+
+	uc.forget(id)
+	return nil
+}
+
+/*
+Materialize returns the playlist computed from rules, reusing the previous result
+if the library has not changed since then
+*/
+func (uc *SmartPlaylistUseCase) Materialize(ctx context.Context, id int) (*entity.Playlist, error) {
+	uc.mu.Lock()
+	playlist, ok := uc.materialized[id]
+	uc.mu.Unlock()
+
+	if ok {
+		return playlist, nil
+	}
+
+	return uc.Refresh(ctx, id)
+}
+
+/*
+Refresh recomputes the smart playlist from the current library state
+*/
+func (uc *SmartPlaylistUseCase) Refresh(ctx context.Context, id int) (*entity.Playlist, error) {
+	const op = "usecase.SmartPlaylistUseCase.Refresh"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op, tracing.SmartPlaylistID(id))
+	defer span.End()
+
+	sp, err := uc.repo.GetSmartPlaylistByID(ctx, id)
+	if err != nil {
+		operationLogger.Warn("Failed to get smart playlist", slog.Int("id", id), slog.String("error", err.Error()))
+		return nil, wrapSmartPlaylistErr(err)
+	}
+
+	songs, err := uc.repo.ListSongs(ctx)
+	if err != nil {
+		operationLogger.Error("Failed to list songs", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%w: %v", ErrSmartPlaylistRepo, err)
+	}
+
+	playlist := sp.Materialize(songs, uc.now())
+
+	uc.mu.Lock()
+	uc.materialized[id] = playlist
+	uc.mu.Unlock()
+
+	operationLogger.Debug("Smart playlist materialized", slog.Int("id", id))
+	return playlist, nil
+}
+
+/*
+Invalidate drops all materialized playlists. It is registered as library change listener
+*/
+func (uc *SmartPlaylistUseCase) Invalidate() {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	uc.materialized = make(map[int]*entity.Playlist)
+}
+
+/*
+Play materializes the smart playlist and starts it in the playback engine
+*/
+func (uc *SmartPlaylistUseCase) Play(ctx context.Context, id int) error {
+	const op = "usecase.SmartPlaylistUseCase.Play"
+	operationLogger := logging.FromContext(ctx, uc.logger).With(slog.String("op", op))
+	ctx, span := tracing.Start(ctx, op, tracing.SmartPlaylistID(id))
+	defer span.End()
+
+	playlist, err := uc.Refresh(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if playlist.GetHead() == nil {
+		operationLogger.Warn("Smart playlist is empty", slog.Int("id", id))
+		return ErrEmptySmartPlaylist
+	}
+
+	if err := uc.playback.LoadPlaylist(ctx, playlist, false); err != nil {
+		return err
+	}
+
+	return uc.playback.Play(ctx)
+}
+
+func (uc *SmartPlaylistUseCase) validate(sp *entity.SmartPlaylist) error {
+	if sp == nil || sp.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSmartPlaylist)
+	}
+	if err := sp.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSmartPlaylist, err)
+	}
+	return nil
+}
+
+func (uc *SmartPlaylistUseCase) forget(id int) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	delete(uc.materialized, id)
+}
+
+/*
+expectedVersion returns the version a conditional write of smart playlist id must expect, 0 without ifMatch
+*/
+func (uc *SmartPlaylistUseCase) expectedVersion(ctx context.Context, operationLogger *slog.Logger, id int, ifMatch []int) (int, error) {
+	if len(ifMatch) == 0 {
+		return 0, nil
+	}
+	sp, err := uc.repo.GetSmartPlaylistByID(ctx, id)
+	if err != nil {
+		operationLogger.Warn("Failed to get smart playlist", slog.Int("id", id), slog.String("error", err.Error()))
+		return 0, wrapSmartPlaylistErr(err)
+	}
+	return checkVersion(operationLogger, sp.Version, ifMatch)
+}
+
+func wrapSmartPlaylistErr(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrSmartPlaylistNotFound):
+		return fmt.Errorf("%w: %v", ErrSmartPlaylistNotFound, err)
+	case errors.Is(err, repository.ErrVersionMismatch):
+		return fmt.Errorf("%w: %v", ErrVersionConflict, err)
+	}
+	return fmt.Errorf("%w: %v", ErrSmartPlaylistRepo, err)
+}
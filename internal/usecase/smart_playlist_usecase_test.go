@@ -0,0 +1,141 @@
+package usecase
+
+import (
+	"cloud-go-testtask/internal/entity"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSmartPlaylistInvalidatedOnLibraryChange(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.Default()
+	playback := NewPlaylistUseCase(NewMockPlaylistRepo(), NewMockPlaylistRepo(), logger)
+	repo := NewMockSmartPlaylistRepo(
+		&entity.Song{ID: 1, Title: "Song1", Artist: "Artist1", Duration: 5 * time.Second},
+	)
+	uc := NewSmartPlaylistUseCase(repo, playback, logger)
+
+	id, err := uc.Create(ctx, &entity.SmartPlaylist{
+		Name:  "Artist1 only",
+		Rules: []entity.SmartRule{{Field: entity.RuleFieldArtist, Operator: entity.RuleOpEquals, Value: "Artist1"}},
+	})
+	require.NoError(t, err)
+
+	playlist, err := uc.Materialize(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, songIDs(playlist))
+
+	repo.AddLibrarySong(&entity.Song{ID: 2, Title: "Song2", Artist: "Artist1", Duration: 5 * time.Second})
+
+	cached, err := uc.Materialize(ctx, id)
+	require.NoError(t, err)
+	assert.Same(t, playlist, cached, "materialized playlist is reused until the library changes")
+
+	_, err = playback.AddSong(ctx, "Song3", "Artist2", 5*time.Second)
+	require.NoError(t, err)
+
+	refreshed, err := uc.Materialize(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, songIDs(refreshed))
+}
+
+func TestSmartPlaylistPlay(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.Default()
+	rdbmsRepo := NewMockPlaylistRepo()
+	cacheRepo := NewMockPlaylistRepo()
+	playback := NewPlaylistUseCase(rdbmsRepo, cacheRepo, logger)
+	repo := NewMockSmartPlaylistRepo(
+		&entity.Song{ID: 1, Title: "Song1", Artist: "Artist1", Duration: 5 * time.Second},
+		&entity.Song{ID: 2, Title: "Song2", Artist: "Artist2", Duration: 5 * time.Second},
+	)
+	uc := NewSmartPlaylistUseCase(repo, playback, logger)
+
+	id, err := uc.Create(ctx, &entity.SmartPlaylist{
+		Name:  "Artist2 only",
+		Rules: []entity.SmartRule{{Field: entity.RuleFieldArtist, Operator: entity.RuleOpEquals, Value: "Artist2"}},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, uc.Play(ctx, id))
+	defer playback.Pause(ctx)
+
+	song, err := playback.GetCurrentSong(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, song.ID)
+
+	current, err := rdbmsRepo.GetCurrent(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, current, "smart playlist current song must not be persisted")
+
+	materialized, err := uc.Materialize(ctx, id)
+	require.NoError(t, err)
+	loaded, err := cacheRepo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	assert.NotSame(t, materialized.GetHead(), loaded.GetHead(), "playback gets its own copy")
+
+	added, err := playback.AddSong(ctx, "Song3", "Artist3", 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2}, songIDs(loaded), "the song goes to the default playlist in DB only")
+	stored, err := rdbmsRepo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, added.ID, stored.GetTail().Song.ID)
+}
+
+func TestSmartPlaylistErrors(t *testing.T) {
+	ctx := context.Background()
+	uc := NewSmartPlaylistUseCase(NewMockSmartPlaylistRepo(), nil, slog.Default())
+
+	_, err := uc.Create(ctx, &entity.SmartPlaylist{})
+	assert.ErrorIs(t, err, ErrInvalidSmartPlaylist)
+
+	_, err = uc.Create(ctx, &entity.SmartPlaylist{
+		Name:  "Broken",
+		Rules: []entity.SmartRule{{Field: entity.RuleFieldDuration, Operator: entity.RuleOpWithin, Value: "1"}},
+	})
+	assert.ErrorIs(t, err, ErrInvalidSmartPlaylist)
+
+	_, err = uc.Materialize(ctx, 42)
+	assert.ErrorIs(t, err, ErrSmartPlaylistNotFound)
+
+	assert.ErrorIs(t, uc.Delete(ctx, 42, nil), ErrSmartPlaylistNotFound)
+}
+
+func TestSmartPlaylistConditionalWrites(t *testing.T) {
+	ctx := context.Background()
+	uc := NewSmartPlaylistUseCase(NewMockSmartPlaylistRepo(), nil, slog.Default())
+
+	sp := &entity.SmartPlaylist{
+		Name:  "Short",
+		Rules: []entity.SmartRule{{Field: entity.RuleFieldDuration, Operator: entity.RuleOpLess, Value: "260"}},
+	}
+	id, err := uc.Create(ctx, sp)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sp.Version)
+
+	update := *sp
+	update.Limit = 5
+	assert.ErrorIs(t, uc.Update(ctx, &update, []int{2}), ErrVersionConflict)
+	require.NoError(t, uc.Update(ctx, &update, []int{1}))
+	assert.Equal(t, 2, update.Version)
+
+	stored, err := uc.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, 5, stored.Limit)
+
+	assert.ErrorIs(t, uc.Delete(ctx, id, []int{1}), ErrVersionConflict)
+	assert.ErrorIs(t, uc.Delete(ctx, 42, []int{1}), ErrSmartPlaylistNotFound)
+	require.NoError(t, uc.Delete(ctx, id, []int{2}))
+}
+
+func songIDs(p *entity.Playlist) []int {
+	var ids []int
+	for node := p.GetHead(); node != nil; node = node.Next {
+		ids = append(ids, node.Song.ID)
+	}
+	return ids
+}
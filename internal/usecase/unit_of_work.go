@@ -0,0 +1,154 @@
+package usecase
+
+import (
+	"cloud-go-testtask/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+/*
+unitOfWork keeps DB and cache consistent during one use case operation.
+DB steps run first, in one transaction if the repository is a repository.Transactor.
+Cache steps run only after the commit. If a cache step fails, cache steps done before it
+are undone and the committed DB steps are compensated, both in reverse order
+*/
+type unitOfWork struct {
+	ctx    context.Context
+	db     repository.PlaylistRepository
+	logger *slog.Logger
+
+	dbSteps    []dbStep
+	cacheSteps []cacheStep
+}
+
+/*
+dbStep is a write to DB with the write restoring the previous state. Both get the repository
+bound to the transaction, when there is one. err is the use case error reported if do fails
+*/
+type dbStep struct {
+	err  error
+	do   func(repo repository.PlaylistRepository) error
+	undo func(repo repository.PlaylistRepository) error
+}
+
+type cacheStep struct {
+	err  error
+	do   func() error
+	undo func() error
+}
+
+func (uc *PlaylistUseCase) newUnitOfWork(ctx context.Context, operationLogger *slog.Logger) *unitOfWork {
+	return &unitOfWork{ctx: ctx, db: uc.rdbmsRepo, logger: operationLogger}
+}
+
+/*
+DB adds a DB write. undo may be nil if the write needs no compensation
+*/
+func (u *unitOfWork) DB(err error, do, undo func(repo repository.PlaylistRepository) error) {
+	u.dbSteps = append(u.dbSteps, dbStep{err: err, do: do, undo: undo})
+}
+
+/*
+Cache adds a cache change. undo may be nil if the change needs no compensation
+*/
+func (u *unitOfWork) Cache(err error, do, undo func() error) {
+	u.cacheSteps = append(u.cacheSteps, cacheStep{err: err, do: do, undo: undo})
+}
+
+/*
+Commit runs the steps. The error wraps err of the failed step and ErrCompensation
+if the previous state could not be restored
+*/
+func (u *unitOfWork) Commit() error {
+	if err := u.commitDB(); err != nil {
+		return err
+	}
+
+	for i, step := range u.cacheSteps {
+		if err := step.do(); err != nil {
+			u.logger.Error("Cache change failed, rolling back", slog.String("error", err.Error()))
+			return errors.Join(
+				fmt.Errorf("%w: %v", step.err, err),
+				u.undoCache(u.cacheSteps[:i]),
+				u.compensateDB(u.dbSteps),
+			)
+		}
+	}
+
+	return nil
+}
+
+func (u *unitOfWork) commitDB() error {
+	if len(u.dbSteps) == 0 {
+		return nil
+	}
+
+	if transactor, ok := u.db.(repository.Transactor); ok {
+		return transactor.InTx(u.ctx, func(tx repository.TxRepository) error {
+			for _, step := range u.dbSteps {
+				if err := step.do(tx); err != nil {
+					u.logger.Error("DB write failed, rolling back transaction", slog.String("error", err.Error()))
+					return fmt.Errorf("%w: %v", step.err, err)
+				}
+			}
+			return nil
+		})
+	}
+
+	// without transactions writes made before the failed one are compensated
+	for i, step := range u.dbSteps {
+		if err := step.do(u.db); err != nil {
+			u.logger.Error("DB write failed, rolling back", slog.String("error", err.Error()))
+			return errors.Join(fmt.Errorf("%w: %v", step.err, err), u.compensateDB(u.dbSteps[:i]))
+		}
+	}
+	return nil
+}
+
+func (u *unitOfWork) compensateDB(steps []dbStep) error {
+	undo := func(repo repository.PlaylistRepository) error {
+		var errs []error
+		for i := len(steps) - 1; i >= 0; i-- {
+			if steps[i].undo == nil {
+				continue
+			}
+			if err := steps[i].undo(repo); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	var err error
+	if transactor, ok := u.db.(repository.Transactor); ok {
+		err = transactor.InTx(u.ctx, func(tx repository.TxRepository) error { return undo(tx) })
+	} else {
+		err = undo(u.db)
+	}
+
+	if err != nil {
+		u.logger.Error("Failed to compensate DB changes, DB and cache diverged", slog.String("error", err.Error()))
+		return fmt.Errorf("%w: DB: %v", ErrCompensation, err)
+	}
+	return nil
+}
+
+func (u *unitOfWork) undoCache(steps []cacheStep) error {
+	var errs []error
+	for i := len(steps) - 1; i >= 0; i-- {
+		if steps[i].undo == nil {
+			continue
+		}
+		if err := steps[i].undo(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		u.logger.Error("Failed to undo cache changes, DB and cache diverged", slog.String("error", err.Error()))
+		return fmt.Errorf("%w: cache: %v", ErrCompensation, err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"cloud-go-testtask/internal/entity"
+	"cloud-go-testtask/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/*
+newSplitPlaylistUseCase returns use case whose cache holds a copy of the DB playlist,
+so a write missed by one of the stores is visible. The second song is current
+*/
+func newSplitPlaylistUseCase(t *testing.T) (*PlaylistUseCase, *MockPlaylistRepo, *MockPlaylistRepo) {
+	t.Helper()
+	ctx := context.Background()
+
+	rdbmsRepo := NewMockPlaylistRepo()
+	cacheRepo := NewMockPlaylistRepo()
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, rdbmsRepo.AddSong(ctx, &entity.Song{ID: i, Title: "Song", Duration: 5 * time.Second}))
+	}
+	playlist, err := rdbmsRepo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	require.NoError(t, rdbmsRepo.SetCurrent(ctx, playlist.GetHead().Next))
+
+	uc := NewPlaylistUseCase(rdbmsRepo, cacheRepo, slog.Default())
+	require.NoError(t, uc.LoadPlaylist(ctx, copyPlaylist(playlist), true))
+	return uc, rdbmsRepo, cacheRepo
+}
+
+func assertConsistent(t *testing.T, rdbmsRepo, cacheRepo *MockPlaylistRepo) {
+	t.Helper()
+	ctx := context.Background()
+
+	inDB, err := rdbmsRepo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	inCache, err := cacheRepo.GetPlaylist(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, songIDs(inDB), songIDs(inCache), "DB and cache have different songs")
+	assert.Equal(t, inDB.GetCurrent().Song.ID, inCache.GetCurrent().Song.ID, "DB and cache have different current song")
+}
+
+/*
+failOnCall makes the named method fail starting with the n-th call
+*/
+func failOnCall(method string, n int) func(string) error {
+	calls := 0
+	return func(m string) error {
+		if m != method {
+			return nil
+		}
+		calls++
+		if calls >= n {
+			return assert.AnError
+		}
+		return nil
+	}
+}
+
+func TestAddSongUnitOfWork(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		dbFail     func(string) error
+		cacheFail  func(string) error
+		want       []error
+		consistent bool
+	}{
+		{
+			name:       "DB write fails",
+			dbFail:     failOnCall("AddSong", 1),
+			want:       []error{ErrAddSongToDB},
+			consistent: true,
+		},
+		{
+			name:       "cache write fails",
+			cacheFail:  failOnCall("AddSong", 1),
+			want:       []error{ErrAddSongToCache},
+			consistent: true,
+		},
+		{
+			name:      "compensation fails",
+			dbFail:    failOnCall("DeleteSong", 1),
+			cacheFail: failOnCall("AddSong", 1),
+			want:      []error{ErrAddSongToCache, ErrCompensation},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, rdbmsRepo, cacheRepo := newSplitPlaylistUseCase(t)
+			rdbmsRepo.Fail, cacheRepo.Fail = tt.dbFail, tt.cacheFail
+
+			_, err := uc.AddSong(ctx, "New", "Artist", 5*time.Second)
+			for _, want := range tt.want {
+				assert.ErrorIs(t, err, want)
+			}
+			if tt.consistent {
+				assertConsistent(t, rdbmsRepo, cacheRepo)
+			}
+
+			playlist, err := cacheRepo.GetPlaylist(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []int{1, 2, 3}, songIDs(playlist), "cache is changed only after commit")
+		})
+	}
+
+	t.Run("success", func(t *testing.T) {
+		uc, rdbmsRepo, cacheRepo := newSplitPlaylistUseCase(t)
+
+		song, err := uc.AddSong(ctx, "New", "Artist", 5*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, 4, song.ID)
+		assert.Equal(t, 1, rdbmsRepo.Commits)
+		assertConsistent(t, rdbmsRepo, cacheRepo)
+	})
+}
+
+func TestSwitchCurrentUnitOfWork(t *testing.T) {
+	steps := map[string]func(uc *PlaylistUseCase, ctx context.Context) error{
+		"Next": (*PlaylistUseCase).Next,
+		"Prev": (*PlaylistUseCase).Prev,
+	}
+
+	for name, step := range steps {
+		// failOnCall counts calls, so every step gets its own table
+		tests := []struct {
+			name      string
+			dbFail    func(string) error
+			cacheFail func(string) error
+			want      []error
+		}{
+			{
+				name:   "DB write fails",
+				dbFail: failOnCall("SetCurrent", 1),
+				want:   []error{ErrSetCurrentInDB},
+			},
+			{
+				name:      "cache write fails",
+				cacheFail: failOnCall("SetCurrent", 1),
+				want:      []error{ErrSetCurrentInCache},
+			},
+			{
+				name:      "compensation fails",
+				dbFail:    failOnCall("SetCurrent", 2),
+				cacheFail: failOnCall("SetCurrent", 1),
+				want:      []error{ErrSetCurrentInCache, ErrCompensation},
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(name+" "+tt.name, func(t *testing.T) {
+				uc, rdbmsRepo, cacheRepo := newSplitPlaylistUseCase(t)
+				rdbmsRepo.Fail, cacheRepo.Fail = tt.dbFail, tt.cacheFail
+
+				stepErr := step(uc, context.Background())
+				for _, want := range tt.want {
+					assert.ErrorIs(t, stepErr, want)
+				}
+
+				current, err := cacheRepo.GetCurrent(context.Background())
+				require.NoError(t, err)
+				assert.Equal(t, 2, current.Song.ID, "cache keeps the previous current song")
+
+				state, err := uc.State(context.Background())
+				require.NoError(t, err)
+				assert.False(t, state.Playing, "playback is not started on failure")
+
+				if !errors.Is(stepErr, ErrCompensation) {
+					assertConsistent(t, rdbmsRepo, cacheRepo)
+				}
+			})
+		}
+	}
+}
+
+func TestUnitOfWorkWithoutTransactions(t *testing.T) {
+	ctx := context.Background()
+	rdbmsRepo := NewMockPlaylistRepo()
+	rdbmsRepo.Fail = failOnCall("AddSong", 2)
+	uc := NewPlaylistUseCase(struct{ repository.PlaylistRepository }{rdbmsRepo}, NewMockPlaylistRepo(), slog.Default())
+
+	cacheChanged := false
+	uow := uc.newUnitOfWork(ctx, slog.Default())
+	for _, song := range []*entity.Song{{ID: 1}, {ID: 2}} {
+		uow.DB(ErrAddSongToDB,
+			func(repo repository.PlaylistRepository) error { return repo.AddSong(ctx, song) },
+			func(repo repository.PlaylistRepository) error {
+				return rdbmsRepo.DeleteSong(ctx, song.ID, 0)
+			},
+		)
+	}
+	uow.Cache(ErrAddSongToCache, func() error { cacheChanged = true; return nil }, nil)
+
+	assert.ErrorIs(t, uow.Commit(), ErrAddSongToDB)
+	assert.False(t, cacheChanged)
+
+	playlist, err := rdbmsRepo.GetPlaylist(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, songIDs(playlist), "the first write is compensated")
+	assert.Zero(t, rdbmsRepo.Commits+rdbmsRepo.Rollbacks)
+}
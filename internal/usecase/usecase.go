@@ -7,6 +7,11 @@ var (
 	ErrAddSongToCache       = errors.New("failed to add song to cache")
 	ErrAlreadyPaused        = errors.New("already paused")
 	ErrNotPlaying           = errors.New("not playing")
+	ErrPlaybackStopped      = errors.New("playback is stopped by shutdown")
+	ErrShutdown             = errors.New("failed to shut down playback")
+	ErrCheckpoint           = errors.New("failed to save playback checkpoint")
+	ErrNotLeader            = errors.New("playback is driven by another instance")
+	ErrTakeOver             = errors.New("failed to take playback over")
 	ErrGetPlaylistFromCache = errors.New("failed to get playlist from cache")
 	ErrNoNextSong           = errors.New("no next song")
 	ErrNoPrevSong           = errors.New("no previous song")
@@ -14,12 +19,46 @@ var (
 	ErrSetCurrentInDB       = errors.New("failed to set current in DB")
 	ErrGetCurrentNode       = errors.New("failed to get current node")
 	ErrNoCurrentSong        = errors.New("no current song")
+	ErrGetPlaylistFromDB    = errors.New("failed to get playlist from DB")
+	ErrInvalidSeek          = errors.New("seek position is out of song range")
+	ErrInvalidPosition      = errors.New("invalid playlist position")
+	ErrReorderPlaylist      = errors.New("failed to reorder playlist")
+	ErrCompensation         = errors.New("failed to restore consistency of DB and cache")
+	ErrCacheNotInitialized  = errors.New("cache is not initialized")
+	ErrInvalidRepair        = errors.New("invalid repair direction")
+	ErrRepairCache          = errors.New("failed to repair cache from DB")
+	ErrRepairDB             = errors.New("failed to repair DB from cache")
+	ErrRepairUnsupported    = errors.New("repository does not support playlist repair")
 
-	ErrPlaylistNotFound      = errors.New("playlist not found") //TODO: implement methods for CRUD
+	ErrLoadPlaylist            = errors.New("failed to load playlist")
+	ErrLoadPlaylistUnsupported = errors.New("cache does not support playlist loading")
+
+	ErrSmartPlaylistNotFound = errors.New("smart playlist not found")
+	ErrInvalidSmartPlaylist  = errors.New("invalid smart playlist")
+	ErrSmartPlaylistRepo     = errors.New("smart playlist repository failure")
+	ErrEmptySmartPlaylist    = errors.New("no songs match smart playlist rules")
+
+	ErrInvalidQuery = errors.New("invalid query")
+	ErrSearch       = errors.New("failed to search library")
+
+	ErrInvalidPlaylistFile = errors.New("invalid playlist file")
+	ErrImportPlaylist      = errors.New("failed to import playlist")
+	ErrNothingToImport     = errors.New("no playlist entries could be imported")
+	ErrExportPlaylist      = errors.New("failed to export playlist")
+
+	ErrPlaylistNotFound      = errors.New("playlist not found")
 	ErrPlaylistAlreadyExists = errors.New("playlist already exists")
+	ErrInvalidPlaylist       = errors.New("invalid playlist")
+	ErrCreatePlaylist        = errors.New("failed to create playlist")
 	ErrDeletePlaylist        = errors.New("failed to delete playlist")
+	ErrPlaylistInUse         = errors.New("playlist is loaded into playback")
+	ErrInvalidSong           = errors.New("invalid song")
+	ErrUpdateSong            = errors.New("failed to update song")
+	ErrDeleteSong            = errors.New("failed to delete song")
 	ErrUpdateSongNotFound    = errors.New("song not found")
 	ErrDeleteSongNotFound    = errors.New("song not found")
+	ErrSongEditUnsupported   = errors.New("repository does not support song editing")
+	ErrVersionConflict       = errors.New("version does not match")
 
 	ErrCannotDeleteCurrentSong = errors.New("cannot delete the currently playing song")
 )
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE songs
+    ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT now(),
+    ADD COLUMN play_count INT NOT NULL DEFAULT 0;
+
+CREATE TABLE smart_playlists (
+                                 id SERIAL PRIMARY KEY,
+                                 name VARCHAR(255) NOT NULL,
+                                 description TEXT,
+                                 rules JSONB NOT NULL DEFAULT '[]',
+                                 sort_by VARCHAR(32) NOT NULL DEFAULT '',
+                                 song_limit INT NOT NULL DEFAULT 0,
+                                 created_at TIMESTAMP DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE smart_playlists;
+
+ALTER TABLE songs
+    DROP COLUMN play_count,
+    DROP COLUMN created_at;
@@ -0,0 +1,26 @@
+-- +goose Up
+ALTER TABLE songs
+    ADD COLUMN search_vector tsvector
+        GENERATED ALWAYS AS (to_tsvector('simple', title || ' ' || artist)) STORED;
+
+ALTER TABLE playlists
+    ADD COLUMN search_vector tsvector
+        GENERATED ALWAYS AS (to_tsvector('simple', name || ' ' || COALESCE(description, ''))) STORED;
+
+CREATE INDEX idx_songs_search_vector ON songs USING GIN (search_vector);
+CREATE INDEX idx_songs_title ON songs (lower(title), id);
+CREATE INDEX idx_songs_artist ON songs (lower(artist), id);
+CREATE INDEX idx_songs_duration ON songs (duration, id);
+CREATE INDEX idx_songs_created_at ON songs (created_at, id);
+CREATE INDEX idx_playlists_search_vector ON playlists USING GIN (search_vector);
+
+-- +goose Down
+DROP INDEX idx_playlists_search_vector;
+DROP INDEX idx_songs_created_at;
+DROP INDEX idx_songs_duration;
+DROP INDEX idx_songs_artist;
+DROP INDEX idx_songs_title;
+DROP INDEX idx_songs_search_vector;
+
+ALTER TABLE playlists DROP COLUMN search_vector;
+ALTER TABLE songs DROP COLUMN search_vector;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE playlists
+    ADD COLUMN current_position_ms BIGINT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE playlists
+    DROP COLUMN current_position_ms;
@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE FUNCTION notify_playlist_change() RETURNS trigger AS $$
+DECLARE
+    data jsonb;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        data := to_jsonb(OLD);
+    ELSE
+        data := to_jsonb(NEW);
+    END IF;
+
+    PERFORM pg_notify('playlist_changes', json_build_object(
+        'table', TG_TABLE_NAME,
+        'op', lower(TG_OP),
+        'playlist_id', CASE WHEN TG_TABLE_NAME = 'playlists' THEN data -> 'id' ELSE data -> 'playlist_id' END,
+        'song_id', CASE WHEN TG_TABLE_NAME = 'songs' THEN data -> 'id' ELSE data -> 'song_id' END
+    )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER songs_notify_change
+    AFTER INSERT OR DELETE ON songs
+    FOR EACH ROW EXECUTE FUNCTION notify_playlist_change();
+
+-- play counts go up after every played song, caches don't hold them
+CREATE TRIGGER songs_notify_update
+    AFTER UPDATE ON songs
+    FOR EACH ROW
+    WHEN (OLD.title IS DISTINCT FROM NEW.title
+        OR OLD.artist IS DISTINCT FROM NEW.artist
+        OR OLD.duration IS DISTINCT FROM NEW.duration)
+    EXECUTE FUNCTION notify_playlist_change();
+
+-- playback checkpoints update current_position_ms every few seconds, they are not worth a resync
+CREATE TRIGGER playlists_notify_change
+    AFTER INSERT OR DELETE OR UPDATE OF name, description, current_song_id ON playlists
+    FOR EACH ROW EXECUTE FUNCTION notify_playlist_change();
+
+CREATE TRIGGER playlist_songs_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON playlist_songs
+    FOR EACH ROW EXECUTE FUNCTION notify_playlist_change();
+
+-- +goose Down
+DROP TRIGGER playlist_songs_notify_change ON playlist_songs;
+DROP TRIGGER playlists_notify_change ON playlists;
+DROP TRIGGER songs_notify_update ON songs;
+DROP TRIGGER songs_notify_change ON songs;
+DROP FUNCTION notify_playlist_change();
@@ -0,0 +1,38 @@
+-- +goose Up
+ALTER TABLE playlists
+    ADD COLUMN current_playing BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE playback_leaders (
+                                  playlist_id INT PRIMARY KEY REFERENCES playlists(id) ON DELETE CASCADE,
+                                  instance_id VARCHAR(255) NOT NULL,
+                                  address VARCHAR(255) NOT NULL,
+                                  elected_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- the leader checkpoints the position every few seconds, only a change of the current song is worth a resync
+DROP TRIGGER playlists_notify_change ON playlists;
+
+CREATE TRIGGER playlists_notify_change
+    AFTER INSERT OR DELETE ON playlists
+    FOR EACH ROW EXECUTE FUNCTION notify_playlist_change();
+
+CREATE TRIGGER playlists_notify_update
+    AFTER UPDATE ON playlists
+    FOR EACH ROW
+    WHEN (OLD.name IS DISTINCT FROM NEW.name
+        OR OLD.description IS DISTINCT FROM NEW.description
+        OR OLD.current_song_id IS DISTINCT FROM NEW.current_song_id)
+    EXECUTE FUNCTION notify_playlist_change();
+
+-- +goose Down
+DROP TRIGGER playlists_notify_update ON playlists;
+DROP TRIGGER playlists_notify_change ON playlists;
+
+CREATE TRIGGER playlists_notify_change
+    AFTER INSERT OR DELETE OR UPDATE OF name, description, current_song_id ON playlists
+    FOR EACH ROW EXECUTE FUNCTION notify_playlist_change();
+
+DROP TABLE playback_leaders;
+
+ALTER TABLE playlists
+    DROP COLUMN current_playing;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- every write bumps the version, conditional writes of clients compare it with If-Match
+ALTER TABLE songs
+    ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+-- the version of a playlist changes with its songs and their order, not with playback
+ALTER TABLE playlists
+    ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+ALTER TABLE smart_playlists
+    ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE smart_playlists DROP COLUMN version;
+ALTER TABLE playlists DROP COLUMN version;
+ALTER TABLE songs DROP COLUMN version;
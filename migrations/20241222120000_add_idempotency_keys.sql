@@ -0,0 +1,19 @@
+-- +goose Up
+-- responses to requests with Idempotency-Key, replayed on retries until expires_at.
+-- status is NULL while the first request is served, the key is reserved for a short lease meanwhile.
+-- reservation identifies the request holding the key, a late one must not save or release the key of a retry
+CREATE TABLE idempotency_keys (
+                                  idempotency_key VARCHAR(255) PRIMARY KEY,
+                                  fingerprint CHAR(64) NOT NULL,
+                                  reservation CHAR(32) NOT NULL,
+                                  status INT,
+                                  header TEXT,
+                                  body BYTEA,
+                                  created_at TIMESTAMP NOT NULL,
+                                  expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+-- +goose Down
+DROP TABLE idempotency_keys;
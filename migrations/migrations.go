@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+/*
+FS holds the SQL migrations compiled into the binary, so neither migrate nor the app depend on
+the migrations directory being present next to them. Postgres migrations are in the root,
+SQLite ones with the same versions are in sqlite/
+*/
+//go:embed *.sql sqlite/*.sql
+var FS embed.FS
+
+/*
+ForDialect returns migrations for "postgres" or "sqlite"
+*/
+func ForDialect(dialect string) fs.FS {
+	if dialect == "sqlite" {
+		sub, _ := fs.Sub(FS, "sqlite") // fails only on invalid path
+		return sub
+	}
+	return FS
+}
@@ -0,0 +1,34 @@
+-- +goose Up
+-- SQLite can't add columns with non-constant defaults, so songs get created_at and play_count here
+-- instead of in 20241216120000_add_smart_playlists.sql
+CREATE TABLE songs (
+                       id INTEGER PRIMARY KEY AUTOINCREMENT,
+                       title VARCHAR(255) NOT NULL,
+                       artist VARCHAR(255) NOT NULL,
+                       duration INT NOT NULL,
+                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                       play_count INT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE playlists (
+                           id INTEGER PRIMARY KEY AUTOINCREMENT,
+                           name VARCHAR(255) NOT NULL,
+                           description TEXT,
+                           current_song_id INT,
+                           created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                           FOREIGN KEY (current_song_id) REFERENCES songs(id)
+);
+
+CREATE TABLE playlist_songs (
+                                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                playlist_id INT NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+                                song_id INT NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+                                song_order INT NOT NULL,
+                                UNIQUE (playlist_id, song_order),
+                                UNIQUE (playlist_id, song_id)
+);
+
+-- +goose Down
+DROP TABLE playlist_songs;
+DROP TABLE playlists;
+DROP TABLE songs;
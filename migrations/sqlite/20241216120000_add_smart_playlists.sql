@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE smart_playlists (
+                                 id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                 name VARCHAR(255) NOT NULL,
+                                 description TEXT,
+                                 rules TEXT NOT NULL DEFAULT '[]',
+                                 sort_by VARCHAR(32) NOT NULL DEFAULT '',
+                                 song_limit INT NOT NULL DEFAULT 0,
+                                 created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE smart_playlists;
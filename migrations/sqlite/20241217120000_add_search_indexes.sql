@@ -0,0 +1,12 @@
+-- +goose Up
+-- Text search on SQLite is a substring match, only sort keys are indexed
+CREATE INDEX idx_songs_title ON songs (lower(title), id);
+CREATE INDEX idx_songs_artist ON songs (lower(artist), id);
+CREATE INDEX idx_songs_duration ON songs (duration, id);
+CREATE INDEX idx_songs_created_at ON songs (created_at, id);
+
+-- +goose Down
+DROP INDEX idx_songs_created_at;
+DROP INDEX idx_songs_duration;
+DROP INDEX idx_songs_artist;
+DROP INDEX idx_songs_title;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE playlists ADD COLUMN current_position_ms INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE playlists DROP COLUMN current_position_ms;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- SQLite storage is used by a single instance, there are no other caches to notify.
+-- The migration keeps versions equal to the Postgres ones
+SELECT 1;
+
+-- +goose Down
+SELECT 1;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- SQLite storage is used by a single instance, which always leads playback, so there is no playback_leaders table
+ALTER TABLE playlists ADD COLUMN current_playing BOOLEAN NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE playlists DROP COLUMN current_playing;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE songs ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE playlists ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE smart_playlists ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE smart_playlists DROP COLUMN version;
+ALTER TABLE playlists DROP COLUMN version;
+ALTER TABLE songs DROP COLUMN version;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE idempotency_keys (
+                                  idempotency_key VARCHAR(255) PRIMARY KEY,
+                                  fingerprint CHAR(64) NOT NULL,
+                                  reservation CHAR(32) NOT NULL,
+                                  status INT,
+                                  header TEXT,
+                                  body BLOB,
+                                  created_at TIMESTAMP NOT NULL,
+                                  expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+-- +goose Down
+DROP TABLE idempotency_keys;